@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// azureBackend is a registry tree stored on an Azure blob container.
+type azureBackend struct {
+	client *container.Client
+	// root is prepended as is to the paths to obtain the blob names.
+	// the registry stores its blobs with a leading slash, older
+	// versions of it did not.
+	root string
+}
+
+var (
+	_ storageBackend   = &azureBackend{}
+	_ serverSideCopier = &azureBackend{}
+)
+
+func newAzureBackend(client *container.Client, root string) *azureBackend {
+	return &azureBackend{client: client, root: root}
+}
+
+func newAzureBackendFromEnv(env envReader) (*azureBackend, error) {
+	// the AZURE_ variables are not prepended with REGISTRY_STORAGE, the
+	// operator sets them this way for the azure sdk used by the registry.
+	opts := &configOpts{
+		storageAccountName: env.get("REGISTRY_STORAGE_AZURE_ACCOUNTNAME"),
+		containerName:      env.get("REGISTRY_STORAGE_AZURE_CONTAINER"),
+		accountKey:         env.get("REGISTRY_STORAGE_AZURE_ACCOUNTKEY"),
+		realm:              env.get("REGISTRY_STORAGE_AZURE_REALM"),
+		clientID:           env.get("AZURE_CLIENT_ID"),
+		tenantID:           env.get("AZURE_TENANT_ID"),
+		clientSecret:       env.get("AZURE_CLIENT_SECRET"),
+		federatedTokenFile: env.get("AZURE_FEDERATED_TOKEN_FILE"),
+		environment:        env.get("AZURE_ENVIRONMENT"),
+	}
+	if err := validate(opts); err != nil {
+		return nil, err
+	}
+	if len(opts.environment) == 0 {
+		opts.environment = "AZUREPUBLICCLOUD"
+	}
+
+	cloudConfig, err := getCloudConfig(opts.environment)
+	if err != nil {
+		return nil, err
+	}
+	if authorityHost := env.get("AZURE_AUTHORITY_HOST"); authorityHost != "" {
+		cloudConfig.ActiveDirectoryAuthorityHost = authorityHost
+	}
+
+	client, err := getClient(cloudConfig, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newAzureBackend(client, trimRoot(env.get("REGISTRY_STORAGE_AZURE_ROOTDIRECTORY"))), nil
+}
+
+func (b *azureBackend) String() string {
+	return fmt.Sprintf("azure container %s", b.client.URL())
+}
+
+func (b *azureBackend) blobName(path string) string {
+	return b.root + path
+}
+
+func (b *azureBackend) list(ctx context.Context, prefix string, fn func(object) error) error {
+	blobPrefix := b.blobName(prefix)
+	pager := b.client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{
+		Prefix: &blobPrefix,
+	})
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		if resp.Segment == nil {
+			return fmt.Errorf("response has no segments")
+		}
+		for _, blob := range resp.Segment.BlobItems {
+			if blob.Name == nil {
+				return fmt.Errorf(
+					"required blob property Name is missing while listing blobs under: %s",
+					blobPrefix,
+				)
+			}
+			obj := object{path: strings.TrimPrefix(*blob.Name, b.root)}
+			if blob.Properties != nil {
+				if blob.Properties.ContentLength != nil {
+					obj.size = *blob.Properties.ContentLength
+				}
+				obj.md5 = blob.Properties.ContentMD5
+			}
+			err := fn(obj)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *azureBackend) stat(ctx context.Context, path string) (object, error) {
+	props, err := b.client.NewBlobClient(b.blobName(path)).GetProperties(ctx, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return object{}, errObjectNotFound
+	} else if err != nil {
+		return object{}, err
+	}
+	obj := object{path: path, md5: props.ContentMD5}
+	if props.ContentLength != nil {
+		obj.size = *props.ContentLength
+	}
+	return obj, nil
+}
+
+func (b *azureBackend) open(ctx context.Context, path string) (io.ReadCloser, error) {
+	resp, err := b.client.NewBlobClient(b.blobName(path)).DownloadStream(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *azureBackend) create(ctx context.Context, path string, r io.Reader, size int64) error {
+	_, err := b.client.NewBlockBlobClient(b.blobName(path)).UploadStream(ctx, r, nil)
+	return err
+}
+
+func (b *azureBackend) remove(ctx context.Context, path string) error {
+	_, err := b.client.NewBlobClient(b.blobName(path)).Delete(ctx, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return nil
+	}
+	return err
+}
+
+// copyFrom copies blobs within the same container without downloading
+// them, this is how blobs are moved when fixing their paths.
+func (b *azureBackend) copyFrom(ctx context.Context, src storageBackend, path string) (bool, error) {
+	source, ok := src.(*azureBackend)
+	if !ok || source.client.URL() != b.client.URL() {
+		return false, nil
+	}
+
+	sourceBlobName := source.blobName(path)
+	destBlobName := b.blobName(path)
+	klog.V(3).Infof("transformed source blob name from %q into %q", sourceBlobName, destBlobName)
+
+	// the blob client represents the destination blob, so we use
+	// blob renamed to match the destination.
+	blobClient := b.client.NewBlobClient(destBlobName)
+
+	// the source blob has to be on the same container as the
+	// destination blob for this to work.
+	// it's name MUST be escaped.
+	// we also ensure there's a "/" separating the URL from the
+	// source blob name so the container name doesn't get mixed up
+	// with the source blob name.
+	sourceBlobURL := strings.TrimRight(b.client.URL(), "/") + "/" + url.QueryEscape(sourceBlobName)
+
+	// counter-intuitively, this copy uses the blob which this client
+	// is created for as the destination, and the source is given in
+	// the call to StartCopyFromURL.
+	klog.Infof("starting copy of %q", sourceBlobName)
+	resp, err := blobClient.StartCopyFromURL(ctx, sourceBlobURL, nil)
+	if err != nil {
+		return true, fmt.Errorf("failed to start copy: %v", err)
+	}
+
+	// this code is very difficult to exercise. none of my attempts to
+	// force an asynchronous copy worked, no matter how big the source file
+	// was. I was forced to manipulate the code in a way that exercised
+	// loop a few times to ensure it worked.
+	copyStatus := *resp.CopyStatus
+	for copyStatus == blob.CopyStatusTypePending {
+		// copy still pending - wait an arbitraty amount of time before trying again
+		klog.Infof("waiting 100ms before re-checking copy status for blob %q", destBlobName)
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		props, err := blobClient.GetProperties(ctx, nil)
+		if err != nil {
+			return true, err
+		}
+		copyStatus = *props.CopyStatus
+		if copyStatus == blob.CopyStatusTypeAborted || copyStatus == blob.CopyStatusTypeFailed {
+			err := fmt.Errorf("copy failed, status: %q, blob: %q", copyStatus, destBlobName)
+			if props.CopyStatusDescription != nil {
+				err = fmt.Errorf(
+					"copy failed, status: %q, desc: %q, blob: %q",
+					copyStatus,
+					*props.CopyStatusDescription,
+					destBlobName,
+				)
+			}
+			return true, err
+		}
+	}
+
+	if copyStatus != blob.CopyStatusTypeSuccess {
+		// leave retry up to the client. in the image-registry case, the k8s job
+		// will handle retrying after failures.
+		return true, fmt.Errorf("copy failed with status %q for blob %q", copyStatus, sourceBlobName)
+	}
+	klog.Infof("copy finished for blob %q", sourceBlobName)
+	return true, nil
+}
+
+type configOpts struct {
+	storageAccountName string
+	containerName      string
+	clientID           string
+	tenantID           string
+	clientSecret       string
+	federatedTokenFile string
+	accountKey         string
+	environment        string
+	// realm is the storage endpoint suffix, when not given the one
+	// of the environment is used.
+	realm string
+	// environmentFilePath and environmentFileContents are specific
+	// for Azure Stack Hub
+	environmentFilePath     string
+	environmentFileContents string
+}
+
+func createASHEnvironmentFile(opts *configOpts) error {
+	if len(opts.environmentFilePath) == 0 || len(opts.environmentFileContents) == 0 {
+		klog.Info("Azure Stack Hub environment variables not present in current environment, skipping setup...")
+		return nil
+	}
+	f, err := os.Create(opts.environmentFilePath)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(opts.environmentFileContents)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func getCloudConfig(environment string) (cloud.Configuration, error) {
+	env, err := azure.EnvironmentFromName(environment)
+	if err != nil {
+		return cloud.Configuration{}, err
+	}
+	return cloud.Configuration{
+		ActiveDirectoryAuthorityHost: env.ActiveDirectoryEndpoint,
+		Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+			cloud.ResourceManager: {
+				Audience: env.TokenAudience,
+				Endpoint: env.ResourceManagerEndpoint,
+			},
+		},
+	}, nil
+}
+
+func getConfigOpts() *configOpts {
+	return &configOpts{
+		storageAccountName:      strings.TrimSpace(os.Getenv("AZURE_STORAGE_ACCOUNT_NAME")),
+		containerName:           strings.TrimSpace(os.Getenv("AZURE_CONTAINER_NAME")),
+		clientID:                strings.TrimSpace(os.Getenv("AZURE_CLIENT_ID")),
+		tenantID:                strings.TrimSpace(os.Getenv("AZURE_TENANT_ID")),
+		clientSecret:            strings.TrimSpace(os.Getenv("AZURE_CLIENT_SECRET")),
+		federatedTokenFile:      strings.TrimSpace(os.Getenv("AZURE_FEDERATED_TOKEN_FILE")),
+		accountKey:              strings.TrimSpace(os.Getenv("AZURE_ACCOUNTKEY")),
+		environment:             strings.TrimSpace(os.Getenv("AZURE_ENVIRONMENT")),
+		environmentFilePath:     strings.TrimSpace(os.Getenv("AZURE_ENVIRONMENT_FILEPATH")),
+		environmentFileContents: strings.TrimSpace(os.Getenv("AZURE_ENVIRONMENT_FILECONTENTS")),
+	}
+}
+
+// getCreds build credentials from the given parameters.
+//
+// this function is basically copy of what the operator itself does,
+// as a way to ensure that it will work in the same way as the operator.
+func getClient(cloudConfig cloud.Configuration, opts *configOpts) (*container.Client, error) {
+	env, err := azure.EnvironmentFromName(opts.environment)
+	if err != nil {
+		return nil, err
+	}
+	endpointSuffix := env.StorageEndpointSuffix
+	if len(opts.realm) > 0 {
+		endpointSuffix = opts.realm
+	}
+	containerURL := fmt.Sprintf(
+		"https://%s.blob.%s/%s",
+		opts.storageAccountName,
+		endpointSuffix,
+		opts.containerName,
+	)
+	var client *container.Client
+	clientOpts := azcore.ClientOptions{
+		Cloud: cloudConfig,
+	}
+
+	if len(opts.accountKey) > 0 {
+		cred, err := container.NewSharedKeyCredential(opts.storageAccountName, opts.accountKey)
+		if err != nil {
+			return nil, err
+		}
+		client, err = container.NewClientWithSharedKeyCredential(containerURL, cred, &container.ClientOptions{ClientOptions: clientOpts})
+		if err != nil {
+			return nil, err
+		}
+	} else if len(opts.clientSecret) > 0 {
+		options := azidentity.ClientSecretCredentialOptions{
+			ClientOptions: azcore.ClientOptions{
+				Cloud: cloudConfig,
+			},
+		}
+		cred, err := azidentity.NewClientSecretCredential(opts.tenantID, opts.clientID, opts.clientSecret, &options)
+		if err != nil {
+			return nil, err
+		}
+		client, err = container.NewClient(containerURL, cred, &container.ClientOptions{ClientOptions: clientOpts})
+		if err != nil {
+			return nil, err
+		}
+	} else if len(opts.federatedTokenFile) > 0 {
+		options := azidentity.WorkloadIdentityCredentialOptions{
+			ClientOptions: azcore.ClientOptions{
+				Cloud: cloudConfig,
+			},
+			ClientID:      opts.clientID,
+			TenantID:      opts.tenantID,
+			TokenFilePath: opts.federatedTokenFile,
+		}
+		cred, err := azidentity.NewWorkloadIdentityCredential(&options)
+		if err != nil {
+			return nil, err
+		}
+		client, err = container.NewClient(containerURL, cred, &container.ClientOptions{ClientOptions: clientOpts})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		options := azidentity.DefaultAzureCredentialOptions{
+			ClientOptions: azcore.ClientOptions{
+				Cloud: cloudConfig,
+			},
+		}
+		cred, err := azidentity.NewDefaultAzureCredential(&options)
+		if err != nil {
+			return nil, err
+		}
+		client, err = container.NewClient(containerURL, cred, &container.ClientOptions{ClientOptions: clientOpts})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// validate returns an error when the required options are missing.
+func validate(opts *configOpts) error {
+	if len(opts.clientSecret) == 0 && len(opts.federatedTokenFile) == 0 && len(opts.accountKey) == 0 {
+		return fmt.Errorf("One of AZURE_CLIENT_SECRET or AZURE_FEDERATED_TOKEN_FILE or AZURE_ACCOUNTKEY is required for authentication")
+	}
+	if len(opts.clientID) == 0 && len(opts.accountKey) == 0 {
+		return fmt.Errorf("AZURE_CLIENT_ID is required for authentication")
+	}
+	if len(opts.tenantID) == 0 && len(opts.accountKey) == 0 {
+		return fmt.Errorf("AZURE_TENANT_ID is required for authentication")
+	}
+	if len(opts.storageAccountName) == 0 {
+		return fmt.Errorf("AZURE_STORAGE_ACCOUNT_NAME is required")
+	}
+	if len(opts.containerName) == 0 {
+		return fmt.Errorf("AZURE_CONTAINER_NAME is required")
+	}
+	return nil
+}
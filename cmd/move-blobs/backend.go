@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errObjectNotFound is returned by backends when the requested object does
+// not exist.
+var errObjectNotFound = errors.New("object not found")
+
+// object is an entry of a registry storage.
+type object struct {
+	// path is the location of the object as seen by the registry, i.e.
+	// relative to the storage root and always starting with a slash.
+	path string
+	size int64
+	// md5 is the Content-MD5 of the object, when the backend stores it.
+	md5 []byte
+}
+
+// storageBackend is a storage medium holding a registry tree. Backends map
+// the paths given to them, as seen by the registry, into their own object
+// names.
+type storageBackend interface {
+	// String describes the backend for logging purposes.
+	String() string
+
+	// list calls fn for every object found under prefix.
+	list(ctx context.Context, prefix string, fn func(object) error) error
+
+	// stat returns the object stored at path, or errObjectNotFound.
+	stat(ctx context.Context, path string) (object, error)
+
+	// open returns a reader for the content of the object stored at path.
+	open(ctx context.Context, path string) (io.ReadCloser, error)
+
+	// create stores size bytes read from r at path, replacing any
+	// existing object.
+	create(ctx context.Context, path string, r io.Reader, size int64) error
+
+	// remove deletes the object stored at path. Removing an object that
+	// does not exist is not an error.
+	remove(ctx context.Context, path string) error
+}
+
+// serverSideCopier is implemented by backends able to copy objects from
+// another backend without streaming their content through this process.
+type serverSideCopier interface {
+	// copyFrom copies the object stored at path in src into the same path
+	// of the receiver. It returns false when the copy can't be done
+	// server side, in which case the caller should stream the object.
+	copyFrom(ctx context.Context, src storageBackend, path string) (bool, error)
+}
+
+// envReader reads configuration from environment variables sharing a
+// common prefix.
+type envReader struct {
+	prefix string
+}
+
+func (e envReader) name(key string) string {
+	return e.prefix + key
+}
+
+func (e envReader) get(key string) string {
+	return strings.TrimSpace(os.Getenv(e.name(key)))
+}
+
+func (e envReader) required(key string) (string, error) {
+	value := e.get(key)
+	if value == "" {
+		return "", fmt.Errorf("%s is required", e.name(key))
+	}
+	return value, nil
+}
+
+func (e envReader) bool(key string) (bool, error) {
+	value := e.get(key)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("unable to parse %s: %v", e.name(key), err)
+	}
+	return b, nil
+}
+
+// newBackendFromEnv builds a storage backend out of the registry storage
+// configuration found in the environment variables starting with prefix.
+// The variables are the ones the operator sets for the registry, i.e.
+// <prefix>REGISTRY_STORAGE holds the storage type and the driver parameters
+// are given by <prefix>REGISTRY_STORAGE_<TYPE>_<PARAMETER>.
+func newBackendFromEnv(ctx context.Context, prefix string) (storageBackend, error) {
+	env := envReader{prefix: prefix}
+	storageType, err := env.required("REGISTRY_STORAGE")
+	if err != nil {
+		return nil, err
+	}
+
+	switch storageType {
+	case "filesystem":
+		return newFilesystemBackendFromEnv(env)
+	case "s3":
+		return newS3BackendFromEnv(env)
+	case "gcs":
+		return newGCSBackendFromEnv(ctx, env)
+	case "azure":
+		return newAzureBackendFromEnv(env)
+	case "swift":
+		return newSwiftBackendFromEnv(ctx, env)
+	}
+	return nil, fmt.Errorf("unsupported storage type %q in %s", storageType, env.name("REGISTRY_STORAGE"))
+}
+
+// trimRoot normalizes a storage root directory so it can be prepended to
+// paths, which always start with a slash. The result is either empty or
+// starts with a slash and does not end with one.
+func trimRoot(root string) string {
+	root = strings.Trim(root, "/")
+	if root == "" {
+		return ""
+	}
+	return "/" + root
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// checkpoint keeps track of the objects already copied so an interrupted
+// run can be resumed without looking at them again. The objects are kept
+// in a file, one path per line, that is only ever appended to.
+type checkpoint struct {
+	mu   sync.Mutex
+	file *os.File
+	done map[string]bool
+}
+
+// openCheckpoint loads the checkpoint stored in filename, creating it if it
+// does not exist yet. An empty filename gives a checkpoint that is not
+// persisted.
+func openCheckpoint(filename string) (*checkpoint, error) {
+	c := &checkpoint{done: map[string]bool{}}
+	if filename == "" {
+		return c, nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("unable to open checkpoint file: %v", err)
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				c.done[line] = true
+			}
+		}
+		f.Close()
+		// a partially written last line is harmless: it does not
+		// match any path, so the object is simply looked at again.
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("unable to read checkpoint file: %v", err)
+		}
+	}
+
+	c.file, err = os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open checkpoint file: %v", err)
+	}
+	return c, nil
+}
+
+// isDone returns true if the object stored at path was already copied.
+func (c *checkpoint) isDone(path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done[path]
+}
+
+// markDone records that the object stored at path was copied.
+func (c *checkpoint) markDone(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done[path] = true
+	if c.file == nil {
+		return nil
+	}
+	_, err := fmt.Fprintln(c.file, path)
+	return err
+}
+
+// len returns the number of objects recorded in the checkpoint.
+func (c *checkpoint) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.done)
+}
+
+func (c *checkpoint) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	return c.file.Close()
+}
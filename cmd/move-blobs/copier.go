@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// defaultWorkers is the number of objects copied in parallel when not told
+// otherwise.
+const defaultWorkers = 8
+
+// copier copies a registry tree from a source into a destination backend.
+type copier struct {
+	source      storageBackend
+	destination storageBackend
+	checkpoint  *checkpoint
+	// workers is the number of objects copied in parallel.
+	workers int
+	// dryRun makes the copier only report what would be copied.
+	dryRun bool
+	// deleteSource makes the copier remove the objects from the
+	// source once they are found in the destination.
+	deleteSource bool
+}
+
+// copyResult summarizes a copier run.
+type copyResult struct {
+	mu sync.Mutex
+	// found is the number of objects found in the source.
+	found int
+	// done holds the paths of the objects that are in the destination,
+	// either because they were copied or because they already were.
+	done []string
+	// copied is the number of objects copied, or that would be copied
+	// when running dry.
+	copied int
+	// bytes is the size of the copied objects.
+	bytes int64
+	// skipped is the number of objects found in the destination.
+	skipped int
+	// deleted is the number of objects removed from the source.
+	deleted int
+	// mismatches holds the objects whose copy does not match the
+	// source. Their source is never deleted.
+	mismatches []mismatch
+	errors     []error
+}
+
+// copySummary is the machine readable summary of a copier run.
+type copySummary struct {
+	Source      string     `json:"source"`
+	Destination string     `json:"destination"`
+	DryRun      bool       `json:"dryRun,omitempty"`
+	Found       int        `json:"found"`
+	Copied      int        `json:"copied"`
+	Bytes       int64      `json:"bytes"`
+	Skipped     int        `json:"skipped"`
+	Deleted     int        `json:"deleted"`
+	Mismatches  []mismatch `json:"mismatches"`
+	Errors      []string   `json:"errors"`
+}
+
+func (r *copyResult) summary(c *copier) copySummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := copySummary{
+		Source:      c.source.String(),
+		Destination: c.destination.String(),
+		DryRun:      c.dryRun,
+		Found:       r.found,
+		Copied:      r.copied,
+		Bytes:       r.bytes,
+		Skipped:     r.skipped,
+		Deleted:     r.deleted,
+		Mismatches:  append([]mismatch{}, r.mismatches...),
+		Errors:      []string{},
+	}
+	for _, err := range r.errors {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	return s
+}
+
+func (r *copyResult) addDone(obj object, copied bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done = append(r.done, obj.path)
+	if copied {
+		r.copied++
+		r.bytes += obj.size
+	} else {
+		r.skipped++
+	}
+}
+
+func (r *copyResult) addDeleted() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deleted++
+}
+
+func (r *copyResult) addMismatch(m mismatch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mismatches = append(r.mismatches, m)
+}
+
+func (r *copyResult) addError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, err)
+}
+
+// run copies every object stored under prefix. Errors on individual objects
+// don't stop the run, they are gathered and returned once every object was
+// looked at, which allows for incremental retries.
+func (c *copier) run(ctx context.Context, prefix string) (*copyResult, error) {
+	workers := c.workers
+	if workers < 1 {
+		workers = defaultWorkers
+	}
+	cp := c.checkpoint
+	if cp == nil {
+		cp = &checkpoint{done: map[string]bool{}}
+	}
+
+	result := &copyResult{}
+	objects := make(chan object)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range objects {
+				if err := c.copyObject(ctx, cp, obj, result); err != nil {
+					klog.Warningf("unable to copy %q, moving on: %v", obj.path, err)
+					result.addError(fmt.Errorf("%s: %w", obj.path, err))
+				}
+			}
+		}()
+	}
+
+	klog.Infof("copying objects under %q from %s into %s", prefix, c.source, c.destination)
+	listErr := c.source.list(ctx, prefix, func(obj object) error {
+		result.found++
+		select {
+		case objects <- obj:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(objects)
+	wg.Wait()
+	klog.Infof("found %d objects, %d copied (%d bytes), %d already in the destination", result.found, result.copied, result.bytes, result.skipped)
+
+	if listErr != nil {
+		result.errors = append(result.errors, fmt.Errorf("unable to list objects: %w", listErr))
+	}
+	if len(result.mismatches) > 0 {
+		for _, m := range result.mismatches {
+			klog.Errorf("copy of %q does not match its source: %s", m.Path, m.Reason)
+		}
+		result.errors = append(result.errors, fmt.Errorf("%d objects did not match their source once copied, their source was kept", len(result.mismatches)))
+	}
+	if len(result.errors) > 0 {
+		return result, fmt.Errorf("encountered errors when copying objects: %w", errors.Join(result.errors...))
+	}
+	return result, nil
+}
+
+func (c *copier) copyObject(ctx context.Context, cp *checkpoint, obj object, result *copyResult) error {
+	copied := false
+	if !cp.isDone(obj.path) {
+		// objects already in the destination with the same size were
+		// likely copied by a previous run, they are only verified.
+		dst, err := c.destination.stat(ctx, obj.path)
+		if err != nil && !errors.Is(err, errObjectNotFound) {
+			return fmt.Errorf("unable to stat destination: %w", err)
+		}
+		if err != nil || dst.size != obj.size {
+			if c.dryRun {
+				klog.Infof("would copy %q (%d bytes)", obj.path, obj.size)
+				result.addDone(obj, true)
+				return nil
+			}
+			if err := c.transfer(ctx, obj); err != nil {
+				return err
+			}
+			copied = true
+		}
+		if !c.dryRun {
+			// nothing is recorded as done, nor deleted from the
+			// source, until the copy is known to be good.
+			reason, err := c.verify(ctx, obj)
+			if err != nil {
+				return fmt.Errorf("unable to verify copy: %w", err)
+			}
+			if reason != "" {
+				return c.handleMismatch(ctx, obj, reason, result)
+			}
+			if err := cp.markDone(obj.path); err != nil {
+				return fmt.Errorf("unable to update checkpoint: %w", err)
+			}
+		}
+	}
+
+	if c.deleteSource {
+		if c.dryRun {
+			klog.Infof("would delete %q from the source", obj.path)
+		} else {
+			if err := c.source.remove(ctx, obj.path); err != nil {
+				return fmt.Errorf("failed deleting copied object: %w", err)
+			}
+			klog.Infof("deleted copied object from source %q", obj.path)
+			result.addDeleted()
+		}
+	}
+
+	result.addDone(obj, copied)
+	return nil
+}
+
+// handleMismatch quarantines a copy that does not match its source and
+// records it.
+func (c *copier) handleMismatch(ctx context.Context, obj object, reason string, result *copyResult) error {
+	m := mismatch{Path: obj.path, Reason: reason}
+	quarantinedAs, err := c.quarantine(ctx, obj.path)
+	if err != nil {
+		result.addMismatch(m)
+		return fmt.Errorf("unable to quarantine copy not matching its source (%s): %w", reason, err)
+	}
+	m.QuarantinedAs = quarantinedAs
+	result.addMismatch(m)
+	klog.Warningf("copy of %q does not match its source, quarantined as %q: %s", obj.path, quarantinedAs, reason)
+	return nil
+}
+
+// transfer copies a single object, server side when the destination is
+// able to do so.
+func (c *copier) transfer(ctx context.Context, obj object) error {
+	if ssc, ok := c.destination.(serverSideCopier); ok {
+		handled, err := ssc.copyFrom(ctx, c.source, obj.path)
+		if handled {
+			return err
+		}
+	}
+
+	r, err := c.source.open(ctx, obj.path)
+	if err != nil {
+		return fmt.Errorf("unable to read source: %w", err)
+	}
+	defer r.Close()
+
+	klog.Infof("copying %q (%d bytes)", obj.path, obj.size)
+	if err := c.destination.create(ctx, obj.path, r, obj.size); err != nil {
+		return fmt.Errorf("unable to write destination: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		filename := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCopier(t *testing.T) {
+	ctx := context.Background()
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	files := map[string]string{
+		"/docker/registry/v2/blobs/sha256/1c/1c1f/data":               "layer1",
+		"/docker/registry/v2/blobs/sha256/39/393b/data":               "layer2",
+		"/docker/registry/v2/repositories/foo/_layers/sha256/1c/link": "sha256:1c1f",
+		"/lost+found/unrelated":                                       "not part of the registry",
+	}
+	writeFiles(t, src, files)
+
+	cp, err := openCheckpoint(filepath.Join(t.TempDir(), "checkpoint"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.Close()
+
+	c := &copier{
+		source:      &filesystemBackend{root: src},
+		destination: &filesystemBackend{root: dst},
+		checkpoint:  cp,
+		dryRun:      true,
+	}
+	result, err := c.run(ctx, "/docker/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.copied != 3 {
+		t.Errorf("expected 3 objects to be copied on a dry run, got %d", result.copied)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "docker")); !os.IsNotExist(err) {
+		t.Errorf("dry run should not write into the destination: %v", err)
+	}
+
+	c.dryRun = false
+	result, err = c.run(ctx, "/docker/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.copied != 3 || result.skipped != 0 {
+		t.Errorf("unexpected result: %d copied, %d skipped", result.copied, result.skipped)
+	}
+	sort.Strings(result.done)
+	expectedDone := []string{
+		"/docker/registry/v2/blobs/sha256/1c/1c1f/data",
+		"/docker/registry/v2/blobs/sha256/39/393b/data",
+		"/docker/registry/v2/repositories/foo/_layers/sha256/1c/link",
+	}
+	if len(result.done) != len(expectedDone) {
+		t.Fatalf("unexpected objects: %v", result.done)
+	}
+	for i, path := range expectedDone {
+		if result.done[i] != path {
+			t.Errorf("unexpected object %q, want %q", result.done[i], path)
+		}
+		content, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != files[path] {
+			t.Errorf("unexpected content for %q: %q", path, content)
+		}
+		if _, err := os.Stat(filepath.Join(src, filepath.FromSlash(path))); err != nil {
+			t.Errorf("source should be kept: %v", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, "lost+found")); !os.IsNotExist(err) {
+		t.Errorf("objects outside of the prefix should not be copied: %v", err)
+	}
+
+	// a new run resumes from the checkpoint and copies nothing.
+	cp.Close()
+	cp, err = openCheckpoint(cp.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.len() != 3 {
+		t.Errorf("expected 3 objects in the checkpoint, got %d", cp.len())
+	}
+	c.checkpoint = cp
+	c.deleteSource = true
+	result, err = c.run(ctx, "/docker/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.copied != 0 || result.skipped != 3 {
+		t.Errorf("unexpected result: %d copied, %d skipped", result.copied, result.skipped)
+	}
+	for _, path := range expectedDone {
+		if _, err := os.Stat(filepath.Join(src, filepath.FromSlash(path))); !os.IsNotExist(err) {
+			t.Errorf("source %q should have been deleted: %v", path, err)
+		}
+	}
+}
+
+func TestCopierSkipsCopiedObjects(t *testing.T) {
+	ctx := context.Background()
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	writeFiles(t, src, map[string]string{
+		"/docker/registry/v2/blobs/sha256/1c/1c1f/data": "layer1",
+		"/docker/registry/v2/blobs/sha256/39/393b/data": "layer2",
+	})
+	writeFiles(t, dst, map[string]string{
+		// copied by a previous run without a checkpoint.
+		"/docker/registry/v2/blobs/sha256/1c/1c1f/data": "layer1",
+		// interrupted copy.
+		"/docker/registry/v2/blobs/sha256/39/393b/data": "lay",
+	})
+
+	c := &copier{
+		source:      &filesystemBackend{root: src},
+		destination: &filesystemBackend{root: dst},
+		workers:     1,
+	}
+	result, err := c.run(ctx, "/docker/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.copied != 1 || result.skipped != 1 {
+		t.Errorf("unexpected result: %d copied, %d skipped", result.copied, result.skipped)
+	}
+	content, err := os.ReadFile(filepath.Join(dst, "docker/registry/v2/blobs/sha256/39/393b/data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "layer2" {
+		t.Errorf("unexpected content: %q", content)
+	}
+}
+
+func TestNewBackendFromEnv(t *testing.T) {
+	t.Setenv("SOURCE_REGISTRY_STORAGE", "filesystem")
+	t.Setenv("SOURCE_REGISTRY_STORAGE_FILESYSTEM_ROOTDIRECTORY", "/registry")
+	t.Setenv("DESTINATION_REGISTRY_STORAGE", "emptydir")
+
+	backend, err := newBackendFromEnv(context.Background(), "SOURCE_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs, ok := backend.(*filesystemBackend); !ok || fs.root != "/registry" {
+		t.Errorf("unexpected backend: %#v", backend)
+	}
+
+	if _, err := newBackendFromEnv(context.Background(), "DESTINATION_"); err == nil {
+		t.Errorf("expected an error for an unsupported storage type")
+	}
+	if _, err := newBackendFromEnv(context.Background(), "MISSING_"); err == nil {
+		t.Errorf("expected an error for a missing storage type")
+	}
+}
+
+func TestObjectNames(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		root     string
+		key      func(root, path string) string
+		path     string
+		expected string
+	}{
+		{
+			name:     "s3 without root",
+			key:      func(root, path string) string { return (&s3Backend{root: trimRoot(root)}).key(path) },
+			path:     "/docker/registry/v2/blobs",
+			expected: "docker/registry/v2/blobs",
+		},
+		{
+			name:     "s3 with root",
+			root:     "registry/",
+			key:      func(root, path string) string { return (&s3Backend{root: trimRoot(root)}).key(path) },
+			path:     "/docker/registry/v2/blobs",
+			expected: "registry/docker/registry/v2/blobs",
+		},
+		{
+			name:     "swift",
+			key:      func(root, path string) string { return (&swiftBackend{root: trimRoot(root)}).objectName(path) },
+			path:     "/docker/registry/v2/blobs",
+			expected: "files/docker/registry/v2/blobs",
+		},
+		{
+			name:     "azure",
+			key:      func(root, path string) string { return (&azureBackend{root: root}).blobName(path) },
+			path:     "/docker/registry/v2/blobs",
+			expected: "/docker/registry/v2/blobs",
+		},
+		{
+			name:     "azure path fix source",
+			root:     "docker",
+			key:      func(root, path string) string { return (&azureBackend{root: root}).blobName(path) },
+			path:     "/registry/v2/blobs",
+			expected: "docker/registry/v2/blobs",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if key := tc.key(tc.root, tc.path); key != tc.expected {
+				t.Errorf("got %q, want %q", key, tc.expected)
+			}
+		})
+	}
+
+	s3 := &s3Backend{root: trimRoot("/registry")}
+	if path := s3.path(s3.key("/docker/x")); path != "/docker/x" {
+		t.Errorf("s3 path does not round trip: %q", path)
+	}
+	swift := &swiftBackend{root: trimRoot("prefix")}
+	if path := swift.path(swift.objectName("/docker/x")); path != "/docker/x" {
+		t.Errorf("swift path does not round trip: %q", path)
+	}
+}
+
+// corruptingBackend mimics a destination that does not store what it is
+// given.
+type corruptingBackend struct {
+	*filesystemBackend
+}
+
+func (b *corruptingBackend) create(ctx context.Context, path string, r io.Reader, size int64) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(path, quarantinePrefix) {
+		data[0] ^= 0xff
+	}
+	return b.filesystemBackend.create(ctx, path, bytes.NewReader(data), size)
+}
+
+func TestCopierQuarantinesMismatches(t *testing.T) {
+	ctx := context.Background()
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	layer := "layer1"
+	digest := fmt.Sprintf("%x", sha256.Sum256([]byte(layer)))
+	blob := fmt.Sprintf("/docker/registry/v2/blobs/sha256/%s/%s/data", digest[:2], digest)
+	link := "/docker/registry/v2/repositories/foo/_layers/sha256/" + digest + "/link"
+	writeFiles(t, src, map[string]string{
+		blob: layer,
+		link: "sha256:" + digest,
+	})
+
+	c := &copier{
+		source:       &filesystemBackend{root: src},
+		destination:  &corruptingBackend{&filesystemBackend{root: dst}},
+		deleteSource: true,
+	}
+	result, err := c.run(ctx, "/docker/")
+	if err == nil {
+		t.Fatal("expected an error when copies don't match their source")
+	}
+
+	summary := result.summary(c)
+	if summary.Copied != 0 || summary.Deleted != 0 || len(summary.Mismatches) != 2 {
+		t.Fatalf("unexpected summary: %#v", summary)
+	}
+	sort.Slice(summary.Mismatches, func(i, j int) bool {
+		return summary.Mismatches[i].Path < summary.Mismatches[j].Path
+	})
+	for i, tc := range []struct {
+		path   string
+		reason string
+	}{
+		{path: blob, reason: "digest mismatch"},
+		{path: link, reason: "content mismatch"},
+	} {
+		m := summary.Mismatches[i]
+		if m.Path != tc.path || !strings.HasPrefix(m.Reason, tc.reason) {
+			t.Errorf("unexpected mismatch: %#v", m)
+		}
+		if m.QuarantinedAs != quarantinePrefix+tc.path {
+			t.Errorf("unexpected quarantine location: %q", m.QuarantinedAs)
+		}
+		if _, err := os.Stat(filepath.Join(dst, filepath.FromSlash(m.QuarantinedAs))); err != nil {
+			t.Errorf("copy should have been quarantined: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(dst, filepath.FromSlash(tc.path))); !os.IsNotExist(err) {
+			t.Errorf("copy should have been moved out of the registry tree: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(src, filepath.FromSlash(tc.path))); err != nil {
+			t.Errorf("source should be kept: %v", err)
+		}
+	}
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"quarantinedAs":"`+quarantinePrefix+blob+`"`) {
+		t.Errorf("unexpected summary: %s", data)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// filesystemBackend is a registry tree stored on a local directory, usually
+// a mounted persistent volume.
+type filesystemBackend struct {
+	root string
+}
+
+var _ storageBackend = &filesystemBackend{}
+
+func newFilesystemBackendFromEnv(env envReader) (*filesystemBackend, error) {
+	root, err := env.required("REGISTRY_STORAGE_FILESYSTEM_ROOTDIRECTORY")
+	if err != nil {
+		return nil, err
+	}
+	return &filesystemBackend{root: root}, nil
+}
+
+func (b *filesystemBackend) String() string {
+	return fmt.Sprintf("filesystem %s", b.root)
+}
+
+func (b *filesystemBackend) filename(path string) string {
+	return filepath.Join(b.root, filepath.FromSlash(path))
+}
+
+func (b *filesystemBackend) list(ctx context.Context, prefix string, fn func(object) error) error {
+	// prefix may end in the middle of a name, so we walk its parent
+	// directory and filter out what does not match.
+	dir := b.filename(prefix)
+	if !strings.HasSuffix(prefix, "/") {
+		dir = filepath.Dir(dir)
+	}
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(b.root, name)
+		if err != nil {
+			return err
+		}
+		path := "/" + filepath.ToSlash(rel)
+		if !strings.HasPrefix(path, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(object{path: path, size: info.Size()})
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (b *filesystemBackend) stat(ctx context.Context, path string) (object, error) {
+	info, err := os.Stat(b.filename(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return object{}, errObjectNotFound
+	} else if err != nil {
+		return object{}, err
+	}
+	return object{path: path, size: info.Size()}, nil
+}
+
+func (b *filesystemBackend) open(ctx context.Context, path string) (io.ReadCloser, error) {
+	return os.Open(b.filename(path))
+}
+
+func (b *filesystemBackend) create(ctx context.Context, path string, r io.Reader, size int64) error {
+	name := b.filename(path)
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// the content is written into a temporary file that is renamed once
+	// complete, so an interrupted copy never leaves a truncated object
+	// behind.
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+func (b *filesystemBackend) remove(ctx context.Context, path string) error {
+	err := os.Remove(b.filename(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
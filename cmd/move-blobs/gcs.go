@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	gstorage "cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// gcsBackend is a registry tree stored on a Google Cloud Storage bucket.
+type gcsBackend struct {
+	bucket *gstorage.BucketHandle
+	name   string
+	root   string
+}
+
+var _ storageBackend = &gcsBackend{}
+
+func newGCSBackendFromEnv(ctx context.Context, env envReader) (*gcsBackend, error) {
+	bucket, err := env.required("REGISTRY_STORAGE_GCS_BUCKET")
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []option.ClientOption
+	if keyfile := env.get("REGISTRY_STORAGE_GCS_KEYFILE"); keyfile != "" {
+		opts = append(opts, option.WithCredentialsFile(keyfile))
+	}
+	client, err := gstorage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create gcs client: %v", err)
+	}
+
+	return &gcsBackend{
+		bucket: client.Bucket(bucket),
+		name:   bucket,
+		root:   trimRoot(env.get("REGISTRY_STORAGE_GCS_ROOTDIRECTORY")),
+	}, nil
+}
+
+func (b *gcsBackend) String() string {
+	return fmt.Sprintf("gcs bucket %s", b.name)
+}
+
+// key returns the object name for path the same way the registry gcs
+// driver does, without a leading slash.
+func (b *gcsBackend) key(path string) string {
+	return strings.TrimLeft(b.root+path, "/")
+}
+
+func (b *gcsBackend) path(key string) string {
+	return strings.TrimPrefix("/"+key, b.root)
+}
+
+func (b *gcsBackend) list(ctx context.Context, prefix string, fn func(object) error) error {
+	it := b.bucket.Objects(ctx, &gstorage.Query{Prefix: b.key(prefix)})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(object{path: b.path(attrs.Name), size: attrs.Size, md5: attrs.MD5}); err != nil {
+			return err
+		}
+	}
+}
+
+func (b *gcsBackend) stat(ctx context.Context, path string) (object, error) {
+	attrs, err := b.bucket.Object(b.key(path)).Attrs(ctx)
+	if errors.Is(err, gstorage.ErrObjectNotExist) {
+		return object{}, errObjectNotFound
+	} else if err != nil {
+		return object{}, err
+	}
+	return object{path: path, size: attrs.Size, md5: attrs.MD5}, nil
+}
+
+func (b *gcsBackend) open(ctx context.Context, path string) (io.ReadCloser, error) {
+	return b.bucket.Object(b.key(path)).NewReader(ctx)
+}
+
+func (b *gcsBackend) create(ctx context.Context, path string, r io.Reader, size int64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := b.bucket.Object(b.key(path)).NewWriter(ctx)
+	if _, err := io.Copy(w, r); err != nil {
+		// closing the writer would commit a truncated object, the
+		// upload is aborted by cancelling its context instead.
+		cancel()
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (b *gcsBackend) remove(ctx context.Context, path string) error {
+	err := b.bucket.Object(b.key(path)).Delete(ctx)
+	if errors.Is(err, gstorage.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"math/rand"
@@ -23,6 +24,12 @@ func randStringRunes(n int) string {
 	return string(b)
 }
 
+// blobPath returns the name the registry gives to a blob holding data.
+func blobPath(data string) string {
+	digest := fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+	return fmt.Sprintf("docker/registry/v2/blobs/sha256/%s/%s/data", digest[:2], digest)
+}
+
 func TestMoveBlobs(t *testing.T) {
 	ctx := context.Background()
 	opts := getConfigOpts()
@@ -34,10 +41,12 @@ func TestMoveBlobs(t *testing.T) {
 		"/docker/registry/v2/blobs/sha256/39/393be486280f2dca8858178237fb1918bfa05b6d62386647b51067f128251d4f/data": randStringRunes(4 * 1024 * 1024),
 		"/docker/registry/v2/blobs/sha256/b1/b195d8055f37a88a080652c5008e192d5525c2d5b1c987f5987c9c9bfd12e771/data": randStringRunes(4 * 1024 * 1024),
 	}
-	blobsWithoutLeadingSlash := map[string]string{
-		"docker/registry/v2/blobs/sha256/18/18ca996a454fc86375a6ea7ad01157a6b39e28c32460d36eb1479d42334e57ad/data": randStringRunes(4 * 1024 * 1024),
-		"docker/registry/v2/blobs/sha256/72/72c9e456423548988a55fa920bb35c194d568ca1959ffcc7316c02e2f60ea0ff/data": randStringRunes(4 * 1024 * 1024),
-		"docker/registry/v2/blobs/sha256/fa/fa0975ea1d6b889364d8ae38f84df5e2a8630e26fe49e999aa47e7a4c1b7ee33/data": randStringRunes(4 * 1024 * 1024),
+	// the blobs are verified against the digest in their path once
+	// moved, so their content has to match it.
+	blobsWithoutLeadingSlash := map[string]string{}
+	for i := 0; i < 3; i++ {
+		data := randStringRunes(4 * 1024 * 1024)
+		blobsWithoutLeadingSlash[blobPath(data)] = data
 	}
 
 	cred, err := azblob.NewSharedKeyCredential(opts.storageAccountName, accountKey)
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// defaultProgressInterval is how often a removal reports its progress when
+// not told otherwise.
+const defaultProgressInterval = 30 * time.Second
+
+// remover deletes every object of a registry storage.
+type remover struct {
+	target storageBackend
+	// workers is the number of objects deleted in parallel.
+	workers int
+	// progress receives a line of JSON with the removalProgress every
+	// progressInterval, and once the removal is done.
+	progress         io.Writer
+	progressInterval time.Duration
+}
+
+// removalProgress is the machine readable progress of a removal. The
+// operator reads the last one from the logs of the storage removal job.
+type removalProgress struct {
+	// Found is the number of objects found so far.
+	Found int `json:"found"`
+	// Deleted is the number of objects deleted so far.
+	Deleted int `json:"deleted"`
+	// Listed tells whether every object of the storage was found. Until
+	// it is, the number of remaining objects is a lower bound.
+	Listed bool `json:"listed"`
+	// Errors is the number of objects that could not be deleted.
+	Errors int `json:"errors"`
+}
+
+// removalResult tracks a remover run.
+type removalResult struct {
+	mu       sync.Mutex
+	progress removalProgress
+	errors   []error
+}
+
+func (r *removalResult) snapshot() removalProgress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.progress
+}
+
+func (r *removalResult) addFound() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress.Found++
+}
+
+func (r *removalResult) addDeleted() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress.Deleted++
+}
+
+func (r *removalResult) addError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress.Errors++
+	r.errors = append(r.errors, err)
+}
+
+func (r *removalResult) setListed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress.Listed = true
+}
+
+// run deletes every object stored under prefix. Like the copier, errors on
+// individual objects don't stop the run, they are returned once every
+// object was looked at.
+func (r *remover) run(ctx context.Context, prefix string) (removalProgress, error) {
+	workers := r.workers
+	if workers < 1 {
+		workers = defaultWorkers
+	}
+	interval := r.progressInterval
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+
+	result := &removalResult{}
+	done := make(chan struct{})
+	var reporter sync.WaitGroup
+	reporter.Add(1)
+	go func() {
+		defer reporter.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.report(result.snapshot())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	objects := make(chan object)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range objects {
+				if err := r.target.remove(ctx, obj.path); err != nil {
+					klog.Warningf("unable to delete %q, moving on: %v", obj.path, err)
+					result.addError(fmt.Errorf("%s: %w", obj.path, err))
+					continue
+				}
+				result.addDeleted()
+			}
+		}()
+	}
+
+	klog.Infof("deleting objects under %q from %s", prefix, r.target)
+	listErr := r.target.list(ctx, prefix, func(obj object) error {
+		result.addFound()
+		select {
+		case objects <- obj:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(objects)
+	wg.Wait()
+	if listErr == nil {
+		result.setListed()
+	}
+
+	close(done)
+	reporter.Wait()
+	progress := result.snapshot()
+	r.report(progress)
+	klog.Infof("found %d objects, %d deleted", progress.Found, progress.Deleted)
+
+	errs := result.errors
+	if listErr != nil {
+		errs = append(errs, fmt.Errorf("unable to list objects: %w", listErr))
+	}
+	if len(errs) > 0 {
+		return progress, fmt.Errorf("encountered errors when deleting objects: %w", errors.Join(errs...))
+	}
+	return progress, nil
+}
+
+// report writes progress as a single line of JSON.
+func (r *remover) report(progress removalProgress) {
+	if r.progress == nil {
+		return
+	}
+	data, err := json.Marshal(progress)
+	if err != nil {
+		klog.Errorf("unable to encode removal progress: %v", err)
+		return
+	}
+	data = append(data, '\n')
+	if _, err := r.progress.Write(data); err != nil {
+		klog.Errorf("unable to report removal progress: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRemover(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"/docker/registry/v2/blobs/sha256/1c/1c1f/data":               "layer1",
+		"/docker/registry/v2/repositories/foo/_layers/sha256/1c/link": "sha256:1c1f",
+		"/openshift/ownership.json":                                   "{}",
+	})
+
+	var out bytes.Buffer
+	r := &remover{
+		target:   &filesystemBackend{root: root},
+		progress: &out,
+	}
+	progress, err := r.run(context.Background(), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := removalProgress{Found: 3, Deleted: 3, Listed: true}
+	if progress != expected {
+		t.Errorf("unexpected progress: got %#v, want %#v", progress, expected)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var reported removalProgress
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &reported); err != nil {
+		t.Fatalf("unable to parse the last progress line %q: %v", lines[len(lines)-1], err)
+	}
+	if reported != expected {
+		t.Errorf("unexpected reported progress: got %#v, want %#v", reported, expected)
+	}
+
+	for _, name := range []string{
+		"docker/registry/v2/blobs/sha256/1c/1c1f/data",
+		"openshift/ownership.json",
+	} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be deleted: %v", name, err)
+		}
+	}
+}
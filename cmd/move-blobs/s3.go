@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// s3Backend is a registry tree stored on a S3 compatible bucket. IBM Cloud
+// Object Storage is accessed through this backend as well.
+type s3Backend struct {
+	client   *s3.S3
+	uploader *s3manager.Uploader
+	bucket   string
+	root     string
+	encrypt  bool
+	keyID    string
+}
+
+var _ storageBackend = &s3Backend{}
+
+func newS3BackendFromEnv(env envReader) (*s3Backend, error) {
+	bucket, err := env.required("REGISTRY_STORAGE_S3_BUCKET")
+	if err != nil {
+		return nil, err
+	}
+	forcePathStyle, err := env.bool("REGISTRY_STORAGE_S3_FORCEPATHSTYLE")
+	if err != nil {
+		return nil, err
+	}
+	useDualStack, err := env.bool("REGISTRY_STORAGE_S3_USEDUALSTACK")
+	if err != nil {
+		return nil, err
+	}
+	encrypt, err := env.bool("REGISTRY_STORAGE_S3_ENCRYPT")
+	if err != nil {
+		return nil, err
+	}
+
+	region := env.get("REGISTRY_STORAGE_S3_REGION")
+	awsOptions := session.Options{
+		Config: aws.Config{
+			Region: &region,
+			// a fresh client makes sure the proxy settings of this
+			// process are honoured.
+			HTTPClient: &http.Client{
+				Transport: http.DefaultTransport.(*http.Transport).Clone(),
+			},
+		},
+		SharedConfigState: session.SharedConfigEnable,
+	}
+	if credentialsFile := env.get("REGISTRY_STORAGE_S3_CREDENTIALSCONFIGPATH"); credentialsFile != "" {
+		awsOptions.SharedConfigFiles = []string{credentialsFile}
+	}
+	if regionEndpoint := env.get("REGISTRY_STORAGE_S3_REGIONENDPOINT"); regionEndpoint != "" {
+		awsOptions.Config.WithEndpoint(regionEndpoint)
+	}
+	if forcePathStyle {
+		awsOptions.Config.WithS3ForcePathStyle(true)
+	}
+	if useDualStack {
+		awsOptions.Config.WithUseDualStack(true)
+	}
+
+	sess, err := session.NewSessionWithOptions(awsOptions)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create s3 session: %v", err)
+	}
+
+	return &s3Backend{
+		client:   s3.New(sess),
+		uploader: s3manager.NewUploader(sess),
+		bucket:   bucket,
+		root:     trimRoot(env.get("REGISTRY_STORAGE_S3_ROOTDIRECTORY")),
+		encrypt:  encrypt,
+		keyID:    env.get("REGISTRY_STORAGE_S3_KEYID"),
+	}, nil
+}
+
+func (b *s3Backend) String() string {
+	return fmt.Sprintf("s3 bucket %s", b.bucket)
+}
+
+// key returns the object key for path the same way the registry s3 driver
+// does, without a leading slash.
+func (b *s3Backend) key(path string) string {
+	return strings.TrimLeft(b.root+path, "/")
+}
+
+func (b *s3Backend) path(key string) string {
+	return strings.TrimPrefix("/"+key, b.root)
+}
+
+func (b *s3Backend) list(ctx context.Context, prefix string, fn func(object) error) error {
+	var fnErr error
+	err := b.client.ListObjectsV2PagesWithContext(
+		ctx,
+		&s3.ListObjectsV2Input{
+			Bucket: aws.String(b.bucket),
+			Prefix: aws.String(b.key(prefix)),
+		},
+		func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, obj := range page.Contents {
+				fnErr = fn(object{
+					path: b.path(aws.StringValue(obj.Key)),
+					size: aws.Int64Value(obj.Size),
+				})
+				if fnErr != nil {
+					return false
+				}
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
+func (b *s3Backend) stat(ctx context.Context, path string) (object, error) {
+	resp, err := b.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(path)),
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == "NotFound" {
+		return object{}, errObjectNotFound
+	} else if err != nil {
+		return object{}, err
+	}
+	return object{path: path, size: aws.Int64Value(resp.ContentLength)}, nil
+}
+
+func (b *s3Backend) open(ctx context.Context, path string) (io.ReadCloser, error) {
+	resp, err := b.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(path)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *s3Backend) create(ctx context.Context, path string, r io.Reader, size int64) error {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(path)),
+		Body:   r,
+	}
+	if b.encrypt {
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAes256)
+		if b.keyID != "" {
+			input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+			input.SSEKMSKeyId = aws.String(b.keyID)
+		}
+	}
+	_, err := b.uploader.UploadWithContext(ctx, input)
+	return err
+}
+
+func (b *s3Backend) remove(ctx context.Context, path string) error {
+	_, err := b.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(path)),
+	})
+	return err
+}
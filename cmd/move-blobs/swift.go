@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/gophercloud/gophercloud/v2/openstack/objectstorage/v1/objects"
+	"github.com/gophercloud/gophercloud/v2/pagination"
+)
+
+// swiftBackend is a registry tree stored on an OpenStack Swift container.
+type swiftBackend struct {
+	client    *gophercloud.ServiceClient
+	container string
+	root      string
+}
+
+var _ storageBackend = &swiftBackend{}
+
+func newSwiftBackendFromEnv(ctx context.Context, env envReader) (*swiftBackend, error) {
+	container, err := env.required("REGISTRY_STORAGE_SWIFT_CONTAINER")
+	if err != nil {
+		return nil, err
+	}
+	authURL, err := env.required("REGISTRY_STORAGE_SWIFT_AUTHURL")
+	if err != nil {
+		return nil, err
+	}
+
+	opts := gophercloud.AuthOptions{
+		IdentityEndpoint:            authURL,
+		Username:                    env.get("REGISTRY_STORAGE_SWIFT_USERNAME"),
+		Password:                    env.get("REGISTRY_STORAGE_SWIFT_PASSWORD"),
+		ApplicationCredentialID:     env.get("REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALID"),
+		ApplicationCredentialName:   env.get("REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALNAME"),
+		ApplicationCredentialSecret: env.get("REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET"),
+		TokenID:                     env.get("REGISTRY_STORAGE_SWIFT_TOKENID"),
+		DomainID:                    env.get("REGISTRY_STORAGE_SWIFT_DOMAINID"),
+		DomainName:                  env.get("REGISTRY_STORAGE_SWIFT_DOMAIN"),
+		TenantID:                    env.get("REGISTRY_STORAGE_SWIFT_TENANTID"),
+		TenantName:                  env.get("REGISTRY_STORAGE_SWIFT_TENANT"),
+		// copies may take longer than the lifetime of a token.
+		AllowReauth: true,
+	}
+
+	provider, err := openstack.AuthenticatedClient(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate against OpenStack: %w", err)
+	}
+
+	client, err := openstack.NewObjectStorageV1(provider, gophercloud.EndpointOpts{
+		Region: env.get("REGISTRY_STORAGE_SWIFT_REGION"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the object storage endpoint: %w", err)
+	}
+
+	return &swiftBackend{
+		client:    client,
+		container: container,
+		root:      trimRoot(env.get("REGISTRY_STORAGE_SWIFT_PREFIX")),
+	}, nil
+}
+
+func (b *swiftBackend) String() string {
+	return fmt.Sprintf("swift container %s", b.container)
+}
+
+// objectName returns the object name for path the same way the registry
+// swift driver does, the registry content lives under a "files" pseudo
+// directory.
+func (b *swiftBackend) objectName(path string) string {
+	return strings.TrimLeft(b.root+"/files"+path, "/")
+}
+
+func (b *swiftBackend) path(name string) string {
+	return strings.TrimPrefix("/"+name, b.root+"/files")
+}
+
+func (b *swiftBackend) list(ctx context.Context, prefix string, fn func(object) error) error {
+	pager := objects.List(b.client, b.container, objects.ListOpts{
+		Prefix: b.objectName(prefix),
+	})
+	return pager.EachPage(ctx, func(ctx context.Context, page pagination.Page) (bool, error) {
+		objs, err := objects.ExtractInfo(page)
+		if err != nil {
+			return false, err
+		}
+		for _, obj := range objs {
+			o := object{path: b.path(obj.Name), size: obj.Bytes}
+			// large objects are stored by the registry as a manifest
+			// pointing to segments, their listed size is the size of
+			// the manifest and not the one of the content.
+			if o.size == 0 {
+				if o, err = b.stat(ctx, o.path); err != nil {
+					return false, err
+				}
+			}
+			if err := fn(o); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+}
+
+func (b *swiftBackend) stat(ctx context.Context, path string) (object, error) {
+	header, err := objects.Get(ctx, b.client, b.container, b.objectName(path), nil).Extract()
+	if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return object{}, errObjectNotFound
+	} else if err != nil {
+		return object{}, err
+	}
+	return object{path: path, size: header.ContentLength}, nil
+}
+
+func (b *swiftBackend) open(ctx context.Context, path string) (io.ReadCloser, error) {
+	result := objects.Download(ctx, b.client, b.container, b.objectName(path), nil)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	return result.Body, nil
+}
+
+func (b *swiftBackend) create(ctx context.Context, path string, r io.Reader, size int64) error {
+	// without NoETag the whole object would be read into memory to
+	// compute its checksum before being uploaded.
+	_, err := objects.Create(ctx, b.client, b.container, b.objectName(path), objects.CreateOpts{
+		Content:       r,
+		ContentLength: size,
+		NoETag:        true,
+		ContentType:   "application/octet-stream",
+	}).Extract()
+	if err != nil {
+		return fmt.Errorf("unable to upload %s (%d bytes): %w", path, size, err)
+	}
+	return nil
+}
+
+func (b *swiftBackend) remove(ctx context.Context, path string) error {
+	_, err := objects.Delete(ctx, b.client, b.container, b.objectName(path), nil).Extract()
+	if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// quarantinePrefix is where the copies that don't match their source are
+// moved to, in the destination backend, so they can be inspected.
+const quarantinePrefix = "/move-blobs-quarantine"
+
+// blobDataPath matches the path of the blobs stored by the registry, which
+// are named after the sha256 digest of their content.
+var blobDataPath = regexp.MustCompile(`/blobs/sha256/[0-9a-f]{2}/([0-9a-f]{64})/data$`)
+
+// mismatch describes an object whose copy does not match its source.
+type mismatch struct {
+	Path          string `json:"path"`
+	Reason        string `json:"reason"`
+	QuarantinedAs string `json:"quarantinedAs,omitempty"`
+}
+
+// verify checks the copy of src found in the destination matches it. It
+// returns a non empty reason when it doesn't, errors are only returned when
+// the verification itself could not be done.
+//
+// The size of the objects is always compared. Their content is compared
+// by Content-MD5 when both backends store it, otherwise the sha256 digest
+// of the registry blobs is recomputed and compared with the one in their
+// path. As a last resort the content of both objects is hashed.
+func (c *copier) verify(ctx context.Context, src object) (string, error) {
+	dst, err := c.destination.stat(ctx, src.path)
+	if errors.Is(err, errObjectNotFound) {
+		return "missing from the destination", nil
+	} else if err != nil {
+		return "", fmt.Errorf("unable to stat destination: %w", err)
+	}
+
+	if dst.size != src.size {
+		return fmt.Sprintf("size mismatch: source has %d bytes, destination has %d bytes", src.size, dst.size), nil
+	}
+
+	if len(src.md5) > 0 && len(dst.md5) > 0 {
+		if !bytes.Equal(src.md5, dst.md5) {
+			return fmt.Sprintf("Content-MD5 mismatch: source has %x, destination has %x", src.md5, dst.md5), nil
+		}
+		return "", nil
+	}
+
+	if m := blobDataPath.FindStringSubmatch(src.path); m != nil {
+		digest, err := sha256Sum(ctx, c.destination, src.path)
+		if err != nil {
+			return "", fmt.Errorf("unable to compute destination digest: %w", err)
+		}
+		if digest != m[1] {
+			return fmt.Sprintf("digest mismatch: expected sha256:%s, destination has sha256:%s", m[1], digest), nil
+		}
+		return "", nil
+	}
+
+	srcDigest, err := sha256Sum(ctx, c.source, src.path)
+	if err != nil {
+		return "", fmt.Errorf("unable to compute source digest: %w", err)
+	}
+	dstDigest, err := sha256Sum(ctx, c.destination, src.path)
+	if err != nil {
+		return "", fmt.Errorf("unable to compute destination digest: %w", err)
+	}
+	if srcDigest != dstDigest {
+		return fmt.Sprintf("content mismatch: source has sha256:%s, destination has sha256:%s", srcDigest, dstDigest), nil
+	}
+	return "", nil
+}
+
+// quarantine moves the copy of the object stored at path out of the way,
+// the next run copies it again.
+func (c *copier) quarantine(ctx context.Context, path string) (string, error) {
+	dst, err := c.destination.stat(ctx, path)
+	if errors.Is(err, errObjectNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	r, err := c.destination.open(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	quarantinePath := quarantinePrefix + path
+	if err := c.destination.create(ctx, quarantinePath, r, dst.size); err != nil {
+		return "", err
+	}
+	if err := c.destination.remove(ctx, path); err != nil {
+		return "", err
+	}
+	return quarantinePath, nil
+}
+
+func sha256Sum(ctx context.Context, backend storageBackend, path string) (string, error) {
+	r, err := backend.open(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
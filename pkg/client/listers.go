@@ -48,7 +48,9 @@ type Listers struct {
 	ClusterRoleBindings  krbaclisters.ClusterRoleBindingLister
 	RegistryConfigs      regoplisters.ConfigLister
 	ProxyConfigs         configlisters.ProxyLister
+	ClusterVersions      configlisters.ClusterVersionLister
 	NetworkPolicies      knetworkinglisters.NetworkPolicyNamespaceLister
+	Jobs                 kjoblisters.JobNamespaceLister
 }
 
 type ImagePrunerControllerListers struct {
@@ -87,12 +87,263 @@ const (
 	// medium is configured to automatically cleanup incomplete uploads
 	StorageIncompleteUploadCleanupEnabled = "StorageIncompleteUploadCleanupEnabled"
 
+	// StorageVersioningEnabled denotes whether or not the registry storage
+	// medium keeps the previous versions of the objects it stores
+	StorageVersioningEnabled = "StorageVersioningEnabled"
+
+	// StorageBlobSoftDeleteEnabled denotes whether or not the objects deleted
+	// from the registry storage medium are kept for a while to be recovered
+	StorageBlobSoftDeleteEnabled = "StorageBlobSoftDeleteEnabled"
+
+	// StorageContainerSoftDeleteEnabled denotes whether or not the registry
+	// storage container is kept for a while to be recovered once deleted
+	StorageContainerSoftDeleteEnabled = "StorageContainerSoftDeleteEnabled"
+
+	// StorageReplicationEnabled denotes whether or not the registry storage
+	// medium is replicated to another region
+	StorageReplicationEnabled = "StorageReplicationEnabled"
+
+	// StorageReplicationHealthy denotes whether or not the objects written
+	// to the registry storage medium reach its replica
+	StorageReplicationHealthy = "StorageReplicationHealthy"
+
+	// StorageAccessLoggingEnabled denotes whether or not the access to the
+	// registry storage medium is logged
+	StorageAccessLoggingEnabled = "StorageAccessLoggingEnabled"
+
+	// StoragePolicyApplied denotes whether or not the policy restricting
+	// the access to the registry storage medium is applied to it
+	StoragePolicyApplied = "StoragePolicyApplied"
+
+	// StorageNetworkRulesApplied denotes whether or not the network access
+	// to the registry storage medium is restricted by firewall rules
+	StorageNetworkRulesApplied = "StorageNetworkRulesApplied"
+
+	// StorageCredentialsRotated denotes whether or not the keys the registry
+	// accesses the storage medium with were rotated on schedule
+	StorageCredentialsRotated = "StorageCredentialsRotated"
+
+	// StorageTempURLKeyConfigured denotes whether or not the registry
+	// storage medium has a key the registry signs temporary URLs with to
+	// redirect the clients to it
+	StorageTempURLKeyConfigured = "StorageTempURLKeyConfigured"
+
+	// StoragePlacementPolicyApplied denotes whether or not the registry
+	// storage medium is placed according to the requested storage policy
+	StoragePlacementPolicyApplied = "StoragePlacementPolicyApplied"
+
+	// StorageQuotaEnforced denotes whether or not the registry storage
+	// medium is capped by a quota
+	StorageQuotaEnforced = "StorageQuotaEnforced"
+
+	// StoragePermissionsValid denotes whether or not the credentials used
+	// by the operator are allowed to manage the registry storage medium
+	StoragePermissionsValid = "StoragePermissionsValid"
+
+	// StorageOwnershipConflict denotes whether or not the storage medium is
+	// marked as owned by another cluster
+	StorageOwnershipConflict = "StorageOwnershipConflict"
+
+	// StorageOwnershipDegraded denotes whether or not the operator left in
+	// place a storage medium it could not mark as owned by the cluster
+	StorageOwnershipDegraded = "StorageOwnershipDegraded"
+
+	// StorageReachable denotes whether or not the operator is able to write,
+	// read and delete objects in the registry storage medium
+	StorageReachable = "StorageReachable"
+
+	// StorageUsage reports the amount of data the registry keeps in its
+	// storage medium
+	StorageUsage = "StorageUsage"
+
+	// StorageMigration denotes whether or not the registry content is being
+	// copied from the previously configured storage medium into the current one
+	StorageMigration = "StorageMigration"
+
+	// StorageRemoval denotes whether or not the registry content is being
+	// deleted from the storage medium before the storage itself is removed
+	StorageRemoval = "StorageRemoval"
+
+	// StorageOrphaned denotes whether or not storage mediums owned by the
+	// cluster are left behind without being used by the registry
+	StorageOrphaned = "StorageOrphaned"
+
 	// VersionAnnotation reflects the version of the registry that this deployment
 	// is running.
 	VersionAnnotation = "release.openshift.io/version"
 
 	ImageRegistryOperatorResourceFinalizer = "imageregistry.operator.openshift.io/finalizer"
 
+	// StorageMigrationSourceAnnotation is set on the image registry config
+	// while the registry content is copied from a previous storage medium. It
+	// holds the JSON encoded configuration of the storage being migrated from.
+	StorageMigrationSourceAnnotation = "imageregistry.operator.openshift.io/storage-migration-source"
+
+	// StorageMigrationIDAnnotation identifies the migration (the pair of source
+	// and destination storage mediums) a storage migration job was created for.
+	StorageMigrationIDAnnotation = "imageregistry.operator.openshift.io/storage-migration-id"
+
+	// StorageRemovalTargetAnnotation identifies the storage medium (its bucket
+	// or container) a storage removal job was created for.
+	StorageRemovalTargetAnnotation = "imageregistry.operator.openshift.io/storage-removal-target"
+
+	// StorageOwnershipOverrideAnnotation, when set to "true" on the image
+	// registry config, allows the operator to adopt a storage medium marked
+	// as owned by another cluster.
+	StorageOwnershipOverrideAnnotation = "imageregistry.operator.openshift.io/storage-ownership-override"
+
+	// OrphanedStorageGracePeriodAnnotation, when set on the image registry
+	// config to a duration (e.g. "168h"), allows the operator to delete the
+	// empty storage mediums it owns but does not use once they are older
+	// than the duration. Orphans are only reported when it is not set.
+	OrphanedStorageGracePeriodAnnotation = "imageregistry.operator.openshift.io/orphaned-storage-grace-period"
+
+	// StorageSettingsAnnotation is set by the operator on the image
+	// registry config to the fingerprints, as a JSON object keyed by
+	// condition type, of the inputs the settings of the storage medium
+	// were last applied from, along with the time of the last attempt
+	// that failed. A setting only goes through CreateStorage again when
+	// its inputs change, or when a failed attempt is due for a retry.
+	StorageSettingsAnnotation = "imageregistry.operator.openshift.io/storage-settings"
+
+	// S3BucketVersioningAnnotation, when set on the image registry config,
+	// tells the operator to enable ("true") or suspend ("false") versioning
+	// on the S3 bucket it manages. Versioning is left untouched when it is
+	// not set.
+	S3BucketVersioningAnnotation = "imageregistry.operator.openshift.io/s3-bucket-versioning"
+
+	// S3NoncurrentVersionExpirationDaysAnnotation sets the number of days
+	// the previous versions of the objects are kept in a versioned S3
+	// bucket. Defaults to 30.
+	S3NoncurrentVersionExpirationDaysAnnotation = "imageregistry.operator.openshift.io/s3-noncurrent-version-expiration-days"
+
+	// S3ReplicationRegionAnnotation, when set on the image registry config,
+	// tells the operator to create a replica of the S3 bucket it manages in
+	// the given region and to replicate the bucket into it. The IAM role
+	// assumed by S3 to replicate the objects is read from the
+	// REGISTRY_STORAGE_S3_REPLICATIONROLEARN key of the
+	// image-registry-private-configuration-user secret. Versioning is
+	// enabled on both buckets. The replica is kept when the replication is
+	// disabled or the storage removed.
+	S3ReplicationRegionAnnotation = "imageregistry.operator.openshift.io/s3-replication-region"
+
+	// S3ReplicaKMSKeyIDAnnotation sets the KMS key the replicated objects
+	// are encrypted with. It is required when the bucket is encrypted with
+	// a KMS key.
+	S3ReplicaKMSKeyIDAnnotation = "imageregistry.operator.openshift.io/s3-replica-kms-key-id"
+
+	// S3VPCEndpointIDAnnotation, when set on the image registry config to
+	// the ID of a VPC endpoint, restricts the access to the objects of the
+	// S3 bucket managed by the operator to requests made through it.
+	S3VPCEndpointIDAnnotation = "imageregistry.operator.openshift.io/s3-vpc-endpoint-id"
+
+	// S3RestrictToClusterPrincipalAnnotation, when set to "true" on the
+	// image registry config, restricts the access to the objects of the S3
+	// bucket managed by the operator to the IAM principal of the cluster.
+	S3RestrictToClusterPrincipalAnnotation = "imageregistry.operator.openshift.io/s3-restrict-to-cluster-principal"
+
+	// AWSOwnedTagsAnnotation is set by the operator on the image registry
+	// config to the keys, as a JSON list, of the tags it set on the S3
+	// bucket out of the user provided tags of the Infrastructure object.
+	// The tags removed from the Infrastructure object are only removed
+	// from the bucket if they are listed there.
+	AWSOwnedTagsAnnotation = "imageregistry.operator.openshift.io/aws-owned-tags"
+
+	// GCPOwnedLabelsAnnotation is set by the operator on the image registry
+	// config to the keys, as a JSON list, of the labels it set on the GCS
+	// bucket out of the user provided labels of the Infrastructure object.
+	GCPOwnedLabelsAnnotation = "imageregistry.operator.openshift.io/gcp-owned-labels"
+
+	// GCPOwnedTagsAnnotation is set by the operator on the image registry
+	// config to the NamespacedNames, as a JSON list, of the tag values it
+	// bound to the GCS bucket out of the user provided tags of the
+	// Infrastructure object.
+	GCPOwnedTagsAnnotation = "imageregistry.operator.openshift.io/gcp-owned-tags"
+
+	// S3AccessLogBucketAnnotation, when set on the image registry config,
+	// turns on server access logging of the S3 bucket managed by the
+	// operator into the named bucket. The bucket is created, in the region
+	// of the registry bucket, when it doesn't exist.
+	S3AccessLogBucketAnnotation = "imageregistry.operator.openshift.io/s3-access-log-bucket"
+
+	// S3AccessLogPrefixAnnotation sets the prefix of the access logs in
+	// the access log bucket. It defaults to the name of the registry
+	// bucket.
+	S3AccessLogPrefixAnnotation = "imageregistry.operator.openshift.io/s3-access-log-prefix"
+
+	// S3AccessLogRetentionDaysAnnotation sets the number of days access
+	// logs are kept for. It defaults to 90.
+	S3AccessLogRetentionDaysAnnotation = "imageregistry.operator.openshift.io/s3-access-log-retention-days"
+
+	// AzureEncryptionKeyVaultURIAnnotation and AzureEncryptionKeyNameAnnotation,
+	// when set on the image registry config, have the Azure storage account
+	// managed by the operator encrypted with the named customer-managed key
+	// of the key vault instead of platform-managed keys.
+	AzureEncryptionKeyVaultURIAnnotation = "imageregistry.operator.openshift.io/azure-encryption-key-vault-uri"
+	AzureEncryptionKeyNameAnnotation     = "imageregistry.operator.openshift.io/azure-encryption-key-name"
+
+	// AzureEncryptionKeyVersionAnnotation pins the version of the
+	// customer-managed key. The latest version of the key is used, and
+	// followed when the key is rotated, when it is not set.
+	AzureEncryptionKeyVersionAnnotation = "imageregistry.operator.openshift.io/azure-encryption-key-version"
+
+	// AzureEncryptionIdentityAnnotation is the resource ID of the
+	// user-assigned identity the storage account accesses the key vault
+	// as. It is required with a customer-managed key.
+	AzureEncryptionIdentityAnnotation = "imageregistry.operator.openshift.io/azure-encryption-identity"
+
+	// StorageKeyRotationIntervalAnnotation, when set on the image registry
+	// config to a duration (e.g. "720h"), regenerates the keys the operator
+	// manages for the storage (Azure storage account keys and Swift
+	// temporary URL keys) on that schedule. It can't be shorter than an
+	// hour.
+	StorageKeyRotationIntervalAnnotation = "imageregistry.operator.openshift.io/storage-key-rotation-interval"
+
+	// AzureBlobSoftDeleteRetentionDaysAnnotation enables the soft-delete of
+	// the blobs of the Azure storage account the operator manages, keeping
+	// deleted blobs for the given number of days (1 to 365).
+	AzureBlobSoftDeleteRetentionDaysAnnotation = "imageregistry.operator.openshift.io/azure-blob-soft-delete-retention-days"
+
+	// AzureContainerSoftDeleteRetentionDaysAnnotation enables the
+	// soft-delete of the containers of the Azure storage account the
+	// operator manages, keeping deleted containers for the given number of
+	// days (1 to 365).
+	AzureContainerSoftDeleteRetentionDaysAnnotation = "imageregistry.operator.openshift.io/azure-container-soft-delete-retention-days"
+
+	// AzureNetworkRuleIPRangesAnnotation restricts the public network access
+	// to the Azure storage account the operator manages to a comma separated
+	// list of public IPv4 addresses or CIDRs, such as the egress of the
+	// cluster.
+	AzureNetworkRuleIPRangesAnnotation = "imageregistry.operator.openshift.io/azure-network-rule-ip-ranges"
+
+	// AzureNetworkRuleSubnetsAnnotation restricts the public network access
+	// to the Azure storage account the operator manages to a comma separated
+	// list of subnet resource IDs. The subnets need the Microsoft.Storage
+	// service endpoint.
+	AzureNetworkRuleSubnetsAnnotation = "imageregistry.operator.openshift.io/azure-network-rule-subnets"
+
+	// AzureNetworkRuleBypassAnnotation sets the services whose traffic is
+	// allowed regardless of the network rules set by the
+	// AzureNetworkRuleIPRangesAnnotation and AzureNetworkRuleSubnetsAnnotation
+	// annotations, as a comma separated list of AzureServices, Logging and
+	// Metrics, or None. It defaults to AzureServices.
+	AzureNetworkRuleBypassAnnotation = "imageregistry.operator.openshift.io/azure-network-rule-bypass"
+
+	// SwiftStoragePolicyAnnotation sets the Swift storage policy (e.g. an
+	// erasure-coded one) the container the operator manages is created
+	// with. The storage policy of an existing container can't be changed.
+	SwiftStoragePolicyAnnotation = "imageregistry.operator.openshift.io/swift-storage-policy"
+
+	// SwiftQuotaAnnotation caps the number of bytes stored in the Swift
+	// container the operator manages, as a quantity (e.g. "500Gi").
+	SwiftQuotaAnnotation = "imageregistry.operator.openshift.io/swift-quota"
+
+	// IBMCOSRootKeyCRNAnnotation sets the CRN of the Key Protect or Hyper
+	// Protect Crypto Services root key the IBM COS bucket the operator
+	// manages is encrypted with. The root key of an existing bucket can't
+	// be changed.
+	IBMCOSRootKeyCRNAnnotation = "imageregistry.operator.openshift.io/ibmcos-root-key-crn"
+
 	ChecksumOperatorAnnotation     = "imageregistry.operator.openshift.io/checksum"
 	ChecksumOperatorDepsAnnotation = "imageregistry.operator.openshift.io/dependencies-checksum"
 
@@ -104,6 +355,10 @@ const (
 	HealthzRoute          = "/healthz"
 	HealthzTimeoutSeconds = 5
 
+	// OperatorServiceAccountName is the service account the operator runs
+	// with. It is used by jobs that outlive the registry service account.
+	OperatorServiceAccountName = "cluster-image-registry-operator"
+
 	ImageConfigName   = "cluster"
 	ClusterConfigName = "cluster-config-v1"
 
@@ -127,6 +382,26 @@ const (
 
 	// AzurePathFixJobName is the job name for the azure-path-fix job
 	AzurePathFixJobName = "azure-path-fix"
+
+	// StorageMigrationJobName is the name of the job that copies the registry
+	// content between storage mediums
+	StorageMigrationJobName = "image-registry-storage-migration"
+
+	// StorageMigrationSecretName is the name of the secret holding the
+	// credentials used by the storage migration job
+	StorageMigrationSecretName = "image-registry-storage-migration"
+
+	// StorageUsageJobName is the name of the job that measures the registry
+	// content stored in a persistent volume claim
+	StorageUsageJobName = "image-registry-storage-usage"
+
+	// StorageRemovalJobName is the name of the job that deletes the registry
+	// content from the storage medium being removed
+	StorageRemovalJobName = "image-registry-storage-removal"
+
+	// StorageRemovalSecretName is the name of the secret holding the
+	// credentials used by the storage removal job
+	StorageRemovalSecretName = "image-registry-storage-removal"
 )
 
 var (
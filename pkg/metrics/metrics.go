@@ -33,6 +33,70 @@ var (
 		},
 		[]string{"storage"},
 	)
+	storageBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_bytes",
+			Help: "Number of bytes stored by the image registry in its storage",
+		},
+		[]string{"storage"},
+	)
+	storageObjects = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_objects",
+			Help: "Number of objects (files) stored by the image registry in its storage",
+		},
+		[]string{"storage"},
+	)
+	storageQuotaBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_quota_bytes",
+			Help: "Number of bytes the image registry storage is capped at by its quota",
+		},
+		[]string{"storage"},
+	)
+	storageQuotaUsedBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_storage_quota_used_bytes",
+			Help: "Number of bytes accounted against the quota of the image registry storage",
+		},
+		[]string{"storage"},
+	)
+	storageProbeDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "image_registry_operator_storage_probe_duration_seconds",
+			Help:    "Latency of the operations the operator runs on a canary object to probe the storage. Operation is either 'write', 'read' or 'delete'",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+		},
+		[]string{"storage", "operation"},
+	)
+	storageProbeFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "image_registry_operator_storage_probe_failures_total",
+			Help: "Number of failed operations on the canary object used to probe the storage. Operation is either 'write', 'read' or 'delete'",
+		},
+		[]string{"storage", "operation"},
+	)
+	orphanedStorage = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_operator_orphaned_storage",
+			Help: "Number of storage mediums (buckets or containers) owned by the cluster but not used by the image registry",
+		},
+		[]string{"storage"},
+	)
+	storageReplicationHealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "image_registry_operator_storage_replication_healthy",
+			Help: "Whether the objects written to the registry storage reach its replica (1) or not (0)",
+		},
+		[]string{"storage"},
+	)
+	storageReplicationChecks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "image_registry_operator_storage_replication_checks_total",
+			Help: "Number of checks of the replication of the registry storage. Status is either 'completed', 'pending', 'failed' or 'error'",
+		},
+		[]string{"storage", "status"},
+	)
 )
 
 func init() {
@@ -42,5 +106,14 @@ func init() {
 		azurePrimaryKeyCache,
 		imageStreamTags,
 		storageType,
+		storageBytes,
+		storageObjects,
+		storageQuotaBytes,
+		storageQuotaUsedBytes,
+		storageProbeDuration,
+		storageProbeFailures,
+		orphanedStorage,
+		storageReplicationHealthy,
+		storageReplicationChecks,
 	)
 }
@@ -136,6 +136,67 @@ func ReportStorageType(stype string) {
 	storageType.WithLabelValues(stype).Set(1)
 }
 
+// ReportStorageUsage sets the number of bytes and objects stored by the
+// registry. Measures for a previously used storage are dropped.
+func ReportStorageUsage(stype string, bytes float64, objects float64) {
+	storageBytes.Reset()
+	storageObjects.Reset()
+	storageBytes.WithLabelValues(stype).Set(bytes)
+	storageObjects.WithLabelValues(stype).Set(objects)
+}
+
+// ReportStorageQuota sets the quota of the storage and the number of bytes
+// accounted against it. The quota of a previously used storage is dropped.
+func ReportStorageQuota(stype string, used float64, quota float64) {
+	storageQuotaBytes.Reset()
+	storageQuotaUsedBytes.Reset()
+	storageQuotaBytes.WithLabelValues(stype).Set(quota)
+	storageQuotaUsedBytes.WithLabelValues(stype).Set(used)
+}
+
+// ResetStorageQuota drops the quota of the storage, for when the storage is
+// not capped anymore.
+func ResetStorageQuota() {
+	storageQuotaBytes.Reset()
+	storageQuotaUsedBytes.Reset()
+}
+
+// ObserveStorageProbe records the latency of an operation on the canary object
+// used to probe the storage, and counts it as a failure if it didn't succeed.
+func ObserveStorageProbe(stype, operation string, seconds float64, failed bool) {
+	storageProbeDuration.WithLabelValues(stype, operation).Observe(seconds)
+	if failed {
+		storageProbeFailures.WithLabelValues(stype, operation).Inc()
+	}
+}
+
+// ReportOrphanedStorage sets the number of storage mediums owned by the
+// cluster but not in use by the registry. Counts for a previously used
+// storage are dropped.
+func ReportOrphanedStorage(stype string, count float64) {
+	orphanedStorage.Reset()
+	orphanedStorage.WithLabelValues(stype).Set(count)
+}
+
+// ReportStorageReplication counts a check of the replication of the storage
+// and sets whether the replication is healthy. The health of a previously
+// used storage is dropped.
+func ReportStorageReplication(stype, status string, healthy bool) {
+	storageReplicationChecks.WithLabelValues(stype, status).Inc()
+	storageReplicationHealthy.Reset()
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	storageReplicationHealthy.WithLabelValues(stype).Set(value)
+}
+
+// ResetStorageReplication drops the health of the replication, for when the
+// storage is not replicated anymore.
+func ResetStorageReplication() {
+	storageReplicationHealthy.Reset()
+}
+
 // AzureKeyCacheHit registers a hit on Azure key cache.
 func AzureKeyCacheHit() {
 	azurePrimaryKeyCache.With(map[string]string{"result": "hit"}).Inc()
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -377,3 +378,292 @@ func TestTLSConfiguration(t *testing.T) {
 		})
 	}
 }
+
+func TestReportStorageUsage(t *testing.T) {
+	tlsKey, tlsCRT := generateTempCertificates(t)
+	servingInfo := configv1.HTTPServingInfo{
+		ServingInfo: configv1.ServingInfo{BindAddress: "localhost:5000"},
+	}
+
+	server := NewServer(tlsCRT, tlsKey, servingInfo)
+
+	if err := server.Run(); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer func() {
+		if err := server.Stop(); err != nil {
+			t.Errorf("failed to stop metrics server: %v", err)
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+		Timeout: 100 * time.Millisecond,
+	}
+
+	for _, tc := range []struct {
+		name    string
+		storage string
+		bytes   float64
+		objects float64
+	}{
+		{
+			name:    "s3",
+			storage: "S3",
+			bytes:   2048,
+			objects: 3,
+		},
+		{
+			name:    "storage changed",
+			storage: "PVC",
+			bytes:   1024,
+			objects: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ReportStorageUsage(tc.storage, tc.bytes, tc.objects)
+
+			for metricName, expected := range map[string]float64{
+				"image_registry_storage_bytes":   tc.bytes,
+				"image_registry_storage_objects": tc.objects,
+			} {
+				resp, err := client.Get("https://localhost:5000/metrics")
+				if err != nil {
+					t.Fatalf("error requesting metrics server: %v", err)
+				}
+
+				metrics := findMetricsByCounter(resp.Body, metricName)
+				if len(metrics) != 1 {
+					t.Fatalf("expected one %s metric, found %d", metricName, len(metrics))
+				}
+
+				if label := metrics[0].GetLabel()[0].GetValue(); label != tc.storage {
+					t.Errorf("expected storage %q, found %q", tc.storage, label)
+				}
+				if val := metrics[0].Gauge.GetValue(); val != expected {
+					t.Errorf("expected %s to be %.0f, found %.0f", metricName, expected, val)
+				}
+			}
+		})
+	}
+}
+
+func TestReportStorageQuota(t *testing.T) {
+	tlsKey, tlsCRT := generateTempCertificates(t)
+	servingInfo := configv1.HTTPServingInfo{
+		ServingInfo: configv1.ServingInfo{BindAddress: "localhost:5000"},
+	}
+
+	server := NewServer(tlsCRT, tlsKey, servingInfo)
+
+	if err := server.Run(); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer func() {
+		if err := server.Stop(); err != nil {
+			t.Errorf("failed to stop metrics server: %v", err)
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+		Timeout: 100 * time.Millisecond,
+	}
+
+	ReportStorageQuota("Swift", 900, 1000)
+	for metricName, expected := range map[string]float64{
+		"image_registry_storage_quota_bytes":      1000,
+		"image_registry_storage_quota_used_bytes": 900,
+	} {
+		resp, err := client.Get("https://localhost:5000/metrics")
+		if err != nil {
+			t.Fatalf("error requesting metrics server: %v", err)
+		}
+
+		metrics := findMetricsByCounter(resp.Body, metricName)
+		if len(metrics) != 1 {
+			t.Fatalf("expected one %s metric, found %d", metricName, len(metrics))
+		}
+		if label := metrics[0].GetLabel()[0].GetValue(); label != "Swift" {
+			t.Errorf("expected storage %q, found %q", "Swift", label)
+		}
+		if val := metrics[0].Gauge.GetValue(); val != expected {
+			t.Errorf("expected %s to be %.0f, found %.0f", metricName, expected, val)
+		}
+	}
+
+	ResetStorageQuota()
+	resp, err := client.Get("https://localhost:5000/metrics")
+	if err != nil {
+		t.Fatalf("error requesting metrics server: %v", err)
+	}
+	if metrics := findMetricsByCounter(resp.Body, "image_registry_storage_quota_bytes"); len(metrics) != 0 {
+		t.Errorf("expected no quota metric once reset, found %d", len(metrics))
+	}
+}
+
+func TestReportOrphanedStorage(t *testing.T) {
+	tlsKey, tlsCRT := generateTempCertificates(t)
+	servingInfo := configv1.HTTPServingInfo{
+		ServingInfo: configv1.ServingInfo{BindAddress: "localhost:5000"},
+	}
+
+	server := NewServer(tlsCRT, tlsKey, servingInfo)
+
+	if err := server.Run(); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer func() {
+		if err := server.Stop(); err != nil {
+			t.Errorf("failed to stop metrics server: %v", err)
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+		Timeout: 100 * time.Millisecond,
+	}
+
+	for _, tc := range []struct {
+		name    string
+		storage string
+		count   float64
+	}{
+		{
+			name:    "s3",
+			storage: "S3",
+			count:   2,
+		},
+		{
+			name:    "storage changed",
+			storage: "GCS",
+			count:   0,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ReportOrphanedStorage(tc.storage, tc.count)
+
+			resp, err := client.Get("https://localhost:5000/metrics")
+			if err != nil {
+				t.Fatalf("error requesting metrics server: %v", err)
+			}
+
+			metrics := findMetricsByCounter(resp.Body, "image_registry_operator_orphaned_storage")
+			if len(metrics) != 1 {
+				t.Fatalf("expected one orphaned storage metric, found %d", len(metrics))
+			}
+
+			if label := metrics[0].GetLabel()[0].GetValue(); label != tc.storage {
+				t.Errorf("expected storage %q, found %q", tc.storage, label)
+			}
+			if val := metrics[0].Gauge.GetValue(); val != tc.count {
+				t.Errorf("expected %.0f orphaned storage, found %.0f", tc.count, val)
+			}
+		})
+	}
+}
+
+func TestReportStorageReplication(t *testing.T) {
+	tlsKey, tlsCRT := generateTempCertificates(t)
+	servingInfo := configv1.HTTPServingInfo{
+		ServingInfo: configv1.ServingInfo{BindAddress: "localhost:5000"},
+	}
+
+	server := NewServer(tlsCRT, tlsKey, servingInfo)
+
+	if err := server.Run(); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer func() {
+		if err := server.Stop(); err != nil {
+			t.Errorf("failed to stop metrics server: %v", err)
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+		Timeout: 100 * time.Millisecond,
+	}
+
+	for _, tc := range []struct {
+		name    string
+		status  string
+		healthy bool
+		checks  float64
+	}{
+		{
+			name:    "completed",
+			status:  "completed",
+			healthy: true,
+			checks:  1,
+		},
+		{
+			name:   "failed",
+			status: "failed",
+			checks: 1,
+		},
+		{
+			name:    "completed again",
+			status:  "completed",
+			healthy: true,
+			checks:  2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ReportStorageReplication("S3", tc.status, tc.healthy)
+
+			resp, err := client.Get("https://localhost:5000/metrics")
+			if err != nil {
+				t.Fatalf("error requesting metrics server: %v", err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("error reading metrics: %v", err)
+			}
+
+			metrics := findMetricsByCounter(io.NopCloser(bytes.NewReader(body)), "image_registry_operator_storage_replication_healthy")
+			if len(metrics) != 1 {
+				t.Fatalf("expected one replication health metric, found %d", len(metrics))
+			}
+			expected := 0.0
+			if tc.healthy {
+				expected = 1
+			}
+			if val := metrics[0].Gauge.GetValue(); val != expected {
+				t.Errorf("expected replication health %.0f, found %.0f", expected, val)
+			}
+
+			var checks float64
+			for _, m := range findMetricsByCounter(io.NopCloser(bytes.NewReader(body)), "image_registry_operator_storage_replication_checks_total") {
+				for _, label := range m.GetLabel() {
+					if label.GetName() == "status" && label.GetValue() == tc.status {
+						checks = m.Counter.GetValue()
+					}
+				}
+			}
+			if checks != tc.checks {
+				t.Errorf("expected %.0f %s checks, found %.0f", tc.checks, tc.status, checks)
+			}
+		})
+	}
+}
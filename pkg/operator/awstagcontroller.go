@@ -2,21 +2,26 @@ package operator
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
 	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 	configv1client "github.com/openshift/client-go/config/clientset/versioned/typed/config/v1"
 	configinformers "github.com/openshift/client-go/config/informers/externalversions"
 	imageregistryv1client "github.com/openshift/client-go/imageregistry/clientset/versioned/typed/imageregistry/v1"
@@ -126,8 +131,9 @@ func (c *AWSTagController) eventHandler() cache.ResourceEventHandler {
 			if !ok || infra == nil {
 				return
 			}
-			if infra.Status.PlatformStatus != nil && infra.Status.PlatformStatus.AWS != nil &&
-				len(infra.Status.PlatformStatus.AWS.ResourceTags) != 0 {
+			// tags removed while the operator was not running
+			// are removed from the bucket as well.
+			if infra.Status.PlatformStatus != nil && infra.Status.PlatformStatus.AWS != nil {
 				c.queue.Add(workQueueKey)
 				return
 			}
@@ -205,6 +211,8 @@ func (c *AWSTagController) sync() error {
 // syncTags fetches user tags from Infrastructure resource, which
 // is then compared with the tags configured for the created S3 bucket
 // fetched using the driver object passed and updates if any new tags.
+// The tags previously set out of the Infrastructure resource, and not
+// in it anymore, are removed.
 func (c *AWSTagController) syncTags() error {
 	cr, err := c.imageRegistryConfigClient.Get(
 		context.Background(),
@@ -249,25 +257,101 @@ func (c *AWSTagController) syncTags() error {
 	}
 	klog.Infof("tags read from storage resource: %v", s3TagSet)
 
-	tagUpdatedCount := syncInfraTags(s3TagSet, infraTagSet)
-	if tagUpdatedCount > 0 {
+	updated, removed := syncInfraTags(s3TagSet, infraTagSet, ownedKeys(cr, defaults.AWSOwnedTagsAnnotation))
+	if len(updated) > 0 || len(removed) > 0 {
 		if err := driver.PutStorageTags(s3TagSet); err != nil {
-			klog.Errorf("failed to update/append tagset of %s s3 bucket: %v", driver.ID(), err)
+			klog.Errorf("failed to update tagset of %s s3 bucket: %v", driver.ID(), err)
 			c.event.Warningf("UpdateAWSTags",
-				"Failed to update/append tagset of %s s3 bucket", driver.ID())
+				"Failed to update tagset of %s s3 bucket", driver.ID())
+			return err
 		}
-		klog.Infof("successfully updated/appended %d tags, tagset: %+v", tagUpdatedCount, s3TagSet)
+		klog.Infof("successfully updated %d and removed %d tags, tagset: %+v", len(updated), len(removed), s3TagSet)
 		c.event.Eventf("UpdateAWSTags",
-			"Successfully updated tagset of %s s3 bucket", driver.ID())
+			"Successfully updated tagset of %s s3 bucket: %s", driver.ID(), tagChangesSummary(updated, removed))
 	}
 
+	return recordOwnedKeys(c.imageRegistryConfigClient, cr, map[string][]string{
+		defaults.AWSOwnedTagsAnnotation: sets.List(sets.KeySet(infraTagSet)),
+	})
+}
+
+// ownedKeys returns the keys recorded, as a JSON list, on the annotation of
+// the image registry config. They are the keys of the tags or labels set on
+// the bucket out of the Infrastructure object.
+func ownedKeys(cr *imageregistryv1.Config, annotation string) []string {
+	raw, ok := cr.Annotations[annotation]
+	if !ok {
+		return nil
+	}
+	var keys []string
+	if err := json.Unmarshal([]byte(raw), &keys); err != nil {
+		klog.Warningf("ignoring invalid %s annotation %q: %s", annotation, raw, err)
+		return nil
+	}
+	return keys
+}
+
+// recordOwnedKeys records the keys, by annotation, as the ones owned by the
+// controller on the image registry config, so the tags or labels can be
+// removed from the bucket once they are removed from the Infrastructure
+// object. The config is only updated when an annotation changes, and it is
+// read again on conflicts as other controllers update it too.
+func recordOwnedKeys(client imageregistryv1client.ConfigInterface, cr *imageregistryv1.Config, owned map[string][]string) error {
+	if !ownedKeysChanged(cr, owned) {
+		return nil
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		// Skip using the cache here so we don't have as many
+		// retries due to slow cache updates
+		current, err := client.Get(
+			context.Background(), cr.Name, metav1.GetOptions{},
+		)
+		if err != nil {
+			return err
+		}
+		if !ownedKeysChanged(current, owned) {
+			return nil
+		}
+
+		if current.Annotations == nil {
+			current.Annotations = map[string]string{}
+		}
+		for annotation, keys := range owned {
+			raw, err := json.Marshal(sets.List(sets.New(keys...)))
+			if err != nil {
+				return err
+			}
+			current.Annotations[annotation] = string(raw)
+		}
+		_, err = client.Update(
+			context.Background(), current, metav1.UpdateOptions{},
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record the owned keys: %w", err)
+	}
 	return nil
 }
 
+// ownedKeysChanged tells whether the keys recorded on cr differ from owned.
+func ownedKeysChanged(cr *imageregistryv1.Config, owned map[string][]string) bool {
+	for annotation, keys := range owned {
+		if _, ok := cr.Annotations[annotation]; !ok || !sets.New(ownedKeys(cr, annotation)...).Equal(sets.New(keys...)) {
+			return true
+		}
+	}
+	return false
+}
+
 // filterPlatformStatusTags is for reading and filter user tags present in
 // Platform Status of Infrastructure config.
 func filterPlatformStatusTags(infra *configv1.Infrastructure) map[string]string {
 	infraTagSet := map[string]string{}
+	if infra.Status.PlatformStatus == nil || infra.Status.PlatformStatus.AWS == nil {
+		return infraTagSet
+	}
 	for _, statusTags := range infra.Status.PlatformStatus.AWS.ResourceTags {
 		if err := validateUserTag(statusTags.Key, statusTags.Value); err != nil {
 			klog.Warningf("validation failed for tag(%s:%s): %v", statusTags.Key, statusTags.Value, err)
@@ -279,18 +363,46 @@ func filterPlatformStatusTags(infra *configv1.Infrastructure) map[string]string
 }
 
 // syncInfraTags synchronizes the tags obtained from S3 bucket and Infrastructure CR.
-// this modifies the s3TagSet based on new tags which are added and update the value to a key if it has changed.
-func syncInfraTags(s3TagSet map[string]string, infraTagSet map[string]string) int {
-	tagUpdatedCount := 0
+// this modifies the s3TagSet based on new tags which are added and update the value to a key if it has changed,
+// and removes the owned tags which are not in the Infrastructure CR anymore. It returns the sorted keys of the
+// tags added or updated, and of the tags removed.
+func syncInfraTags(s3TagSet map[string]string, infraTagSet map[string]string, ownedTags []string) ([]string, []string) {
+	var updated, removed []string
 	for key, value := range infraTagSet {
 		val, ok := s3TagSet[key]
 		if !ok || val != value {
 			klog.V(5).Infof("%s tag will be added/updated with value %s", key, value)
 			s3TagSet[key] = value
-			tagUpdatedCount++
+			updated = append(updated, key)
 		}
 	}
-	return tagUpdatedCount
+	for _, key := range ownedTags {
+		if _, ok := infraTagSet[key]; ok {
+			continue
+		}
+		if _, ok := s3TagSet[key]; !ok {
+			continue
+		}
+		klog.V(5).Infof("%s tag will be removed", key)
+		delete(s3TagSet, key)
+		removed = append(removed, key)
+	}
+	sort.Strings(updated)
+	sort.Strings(removed)
+	return updated, removed
+}
+
+// tagChangesSummary describes the tags added or updated, and removed, for
+// the event emitted once they are applied.
+func tagChangesSummary(updated, removed []string) string {
+	var changes []string
+	if len(updated) > 0 {
+		changes = append(changes, fmt.Sprintf("%d added or updated (%s)", len(updated), strings.Join(updated, ", ")))
+	}
+	if len(removed) > 0 {
+		changes = append(changes, fmt.Sprintf("%d removed (%s)", len(removed), strings.Join(removed, ", ")))
+	}
+	return strings.Join(changes, ", ")
 }
 
 // validateUserTag is for validating the user defined tags in Infrastructure CR
@@ -0,0 +1,139 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgotesting "k8s.io/client-go/testing"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	imageregistryfakeclient "github.com/openshift/client-go/imageregistry/clientset/versioned/fake"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestSyncInfraTags(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		s3TagSet        map[string]string
+		infraTagSet     map[string]string
+		ownedTags       []string
+		expectedTagSet  map[string]string
+		expectedUpdated []string
+		expectedRemoved []string
+	}{
+		{
+			name:            "new and changed tags",
+			s3TagSet:        map[string]string{"Name": "registry", "team": "old"},
+			infraTagSet:     map[string]string{"team": "storage", "cost-center": "registry"},
+			expectedTagSet:  map[string]string{"Name": "registry", "team": "storage", "cost-center": "registry"},
+			expectedUpdated: []string{"cost-center", "team"},
+		},
+		{
+			name:            "owned tags removed from the infrastructure",
+			s3TagSet:        map[string]string{"Name": "registry", "team": "storage", "cost-center": "registry"},
+			infraTagSet:     map[string]string{"team": "storage"},
+			ownedTags:       []string{"team", "cost-center"},
+			expectedTagSet:  map[string]string{"Name": "registry", "team": "storage"},
+			expectedRemoved: []string{"cost-center"},
+		},
+		{
+			name:           "tags not owned are kept",
+			s3TagSet:       map[string]string{"Name": "registry", "team": "storage", "owner": "someone"},
+			infraTagSet:    map[string]string{"team": "storage"},
+			ownedTags:      []string{"team"},
+			expectedTagSet: map[string]string{"Name": "registry", "team": "storage", "owner": "someone"},
+		},
+		{
+			name:           "owned tags already removed from the bucket",
+			s3TagSet:       map[string]string{"Name": "registry"},
+			ownedTags:      []string{"team"},
+			expectedTagSet: map[string]string{"Name": "registry"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			updated, removed := syncInfraTags(tt.s3TagSet, tt.infraTagSet, tt.ownedTags)
+			if !reflect.DeepEqual(tt.s3TagSet, tt.expectedTagSet) {
+				t.Errorf("expected tagset %v, got %v", tt.expectedTagSet, tt.s3TagSet)
+			}
+			if !reflect.DeepEqual(updated, tt.expectedUpdated) {
+				t.Errorf("expected updated tags %v, got %v", tt.expectedUpdated, updated)
+			}
+			if !reflect.DeepEqual(removed, tt.expectedRemoved) {
+				t.Errorf("expected removed tags %v, got %v", tt.expectedRemoved, removed)
+			}
+		})
+	}
+}
+
+func TestTagChangesSummary(t *testing.T) {
+	for _, tt := range []struct {
+		updated  []string
+		removed  []string
+		expected string
+	}{
+		{
+			updated:  []string{"cost-center", "team"},
+			expected: "2 added or updated (cost-center, team)",
+		},
+		{
+			removed:  []string{"team"},
+			expected: "1 removed (team)",
+		},
+		{
+			updated:  []string{"cost-center"},
+			removed:  []string{"team"},
+			expected: "1 added or updated (cost-center), 1 removed (team)",
+		},
+	} {
+		if summary := tagChangesSummary(tt.updated, tt.removed); summary != tt.expected {
+			t.Errorf("expected summary %q, got %q", tt.expected, summary)
+		}
+	}
+}
+
+func TestRecordOwnedKeysRetriesOnConflict(t *testing.T) {
+	stale := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            defaults.ImageRegistryResourceName,
+			ResourceVersion: "1",
+		},
+	}
+	current := stale.DeepCopy()
+	current.ResourceVersion = "2"
+	current.Annotations = map[string]string{"other": "controller"}
+
+	regClient := imageregistryfakeclient.NewSimpleClientset(current)
+	conflicts := 1
+	regClient.PrependReactor("update", "configs", func(action clientgotesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			return false, nil, nil
+		}
+		conflicts--
+		return true, nil, kerrors.NewConflict(schema.GroupResource{Resource: "configs"}, defaults.ImageRegistryResourceName, fmt.Errorf("the object has been modified"))
+	})
+
+	if err := recordOwnedKeys(regClient.ImageregistryV1().Configs(), stale, map[string][]string{
+		defaults.AWSOwnedTagsAnnotation: {"team", "cost-center"},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cr, err := regClient.ImageregistryV1().Configs().Get(context.Background(), defaults.ImageRegistryResourceName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"other":                         "controller",
+		defaults.AWSOwnedTagsAnnotation: `["cost-center","team"]`,
+	}
+	if !reflect.DeepEqual(cr.Annotations, expected) {
+		t.Errorf("expected annotations %v, got %v", expected, cr.Annotations)
+	}
+}
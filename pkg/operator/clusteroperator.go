@@ -133,7 +133,16 @@ func (c *ClusterOperatorStatusController) sync() error {
 		c.relatedObjects,
 	)
 
-	return resource.ApplyMutator(mut)
+	if err := resource.ApplyMutator(mut); err != nil {
+		return err
+	}
+
+	// no event is triggered when the inertia period of an unreachable
+	// storage expires, look again once it does.
+	if after := resource.StorageReachableRecheckAfter(cr); after > 0 {
+		c.queue.AddAfter(workqueueKey, after)
+	}
+	return nil
 }
 
 func (c *ClusterOperatorStatusController) Run(stopCh <-chan struct{}) {
@@ -38,6 +38,7 @@ import (
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/object"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 const (
@@ -144,6 +145,11 @@ func NewController(
 			c.listers.NetworkPolicies = informer.Lister().NetworkPolicies(defaults.ImageRegistryOperatorNamespace)
 			return informer.Informer()
 		},
+		func() cache.SharedIndexInformer {
+			informer := kubeInformerFactory.Batch().V1().Jobs()
+			c.listers.Jobs = informer.Lister().Jobs(defaults.ImageRegistryOperatorNamespace)
+			return informer.Informer()
+		},
 		func() cache.SharedIndexInformer {
 			informer := routeInformerFactory.Route().V1().Routes()
 			c.listers.Routes = informer.Lister().Routes(defaults.ImageRegistryOperatorNamespace)
@@ -192,6 +198,12 @@ func NewController(
 		c.cachesToSync = append(c.cachesToSync, informer.HasSynced)
 	}
 
+	// the cluster id is only needed to mark the storage as ours, and it
+	// never changes. we don't need to react to cluster version updates.
+	clusterVersionInformer := configInformerFactory.Config().V1().ClusterVersions()
+	c.listers.ClusterVersions = clusterVersionInformer.Lister()
+	c.cachesToSync = append(c.cachesToSync, clusterVersionInformer.Informer().HasSynced)
+
 	return c, nil
 }
 
@@ -371,6 +383,16 @@ func (c *Controller) sync() error {
 		}
 	}
 
+	// storage settings that could not be applied are applied again once
+	// due, even when nothing else changes in the meantime.
+	if after, ok := util.SettingRetryAfter(cr); ok {
+		c.workqueue.AddAfter(workqueueKey, after)
+	}
+
+	if applyError == resource.ErrStorageRemovalInProgress {
+		c.workqueue.AddAfter(workqueueKey, storageRemovalResyncInterval)
+		return nil
+	}
 	if _, ok := applyError.(permanentError); !ok {
 		return applyError
 	}
@@ -16,8 +16,13 @@ import (
 	regopset "github.com/openshift/client-go/imageregistry/clientset/versioned/typed/imageregistry/v1"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
 )
 
+// storageRemovalResyncInterval is how often the progress of the storage
+// removal job is looked at.
+const storageRemovalResyncInterval = 30 * time.Second
+
 func (c *Controller) RemoveResources(o *imageregistryv1.Config) error {
 	c.setStatusRemoving(o)
 	return c.generator.Remove(o)
@@ -47,6 +52,17 @@ func (c *Controller) finalizeResources(o *imageregistryv1.Config) error {
 	}
 
 	err = c.RemoveResources(o)
+	if err == resource.ErrStorageRemovalInProgress {
+		// the finalizer stays until the storage removal job is done,
+		// in the meantime its progress is kept on the status.
+		if _, err := client.Configs().UpdateStatus(
+			context.TODO(), o, metav1.UpdateOptions{},
+		); err != nil && !kerrors.IsConflict(err) {
+			klog.Errorf("unable to update status %s: %s", utilObjectInfo(o), err)
+		}
+		c.workqueue.AddAfter(workqueueKey, storageRemovalResyncInterval)
+		return nil
+	}
 	if err != nil {
 		c.setStatusRemoveFailed(o, err)
 		return fmt.Errorf("unable to finalize resource: %s", err)
@@ -0,0 +1,310 @@
+package operator
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	configinformers "github.com/openshift/client-go/config/informers/externalversions"
+	imageregistryv1client "github.com/openshift/client-go/imageregistry/clientset/versioned/typed/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/gcs"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// GCPLabelsTagsController keeps the labels and the tags of the GCS bucket in
+// sync with the user-defined labels and tags of the Infrastructure resource.
+// The bucket is only labeled and tagged on creation otherwise.
+type GCPLabelsTagsController struct {
+	imageRegistryConfigClient imageregistryv1client.ConfigInterface
+	listers                   *regopclient.StorageListers
+
+	event        events.Recorder
+	cachesToSync []cache.InformerSynced
+	queue        workqueue.TypedRateLimitingInterface[any]
+}
+
+// NewGCPLabelsTagsController returns a new GCPLabelsTagsController.
+func NewGCPLabelsTagsController(
+	imageRegistryConfigClient imageregistryv1client.ConfigInterface,
+	kubeInformerFactory kubeinformers.SharedInformerFactory,
+	configInformerFactory configinformers.SharedInformerFactory,
+	openshiftConfigKubeInformerFactory kubeinformers.SharedInformerFactory,
+	openshiftConfigManagedKubeInformerFactory kubeinformers.SharedInformerFactory,
+	eventRecorder events.Recorder,
+) (*GCPLabelsTagsController, error) {
+	c := &GCPLabelsTagsController{
+		imageRegistryConfigClient: imageRegistryConfigClient,
+		event:                     eventRecorder,
+		queue: workqueue.NewNamedRateLimitingQueue(
+			workqueue.DefaultTypedControllerRateLimiter[any](),
+			"GCPLabelsTagsController"),
+	}
+
+	infraConfig := configInformerFactory.Config().V1().Infrastructures()
+	secrets := kubeInformerFactory.Core().V1().Secrets()
+	openshiftConfig := openshiftConfigKubeInformerFactory.Core().V1().ConfigMaps()
+	openshiftConfigManaged := openshiftConfigManagedKubeInformerFactory.Core().V1().ConfigMaps()
+	// list of Listers requied by GCS package NewDriver method
+	c.listers = &regopclient.StorageListers{
+		Secrets:                secrets.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+		OpenShiftConfig:        openshiftConfig.Lister().ConfigMaps(defaults.OpenShiftConfigNamespace),
+		OpenShiftConfigManaged: openshiftConfigManaged.Lister().ConfigMaps(defaults.OpenShiftConfigManagedNamespace),
+		Infrastructures:        infraConfig.Lister(),
+	}
+
+	_, err := infraConfig.Informer().AddEventHandler(c.eventHandler())
+	if err != nil {
+		return nil, err
+	}
+	c.cachesToSync = append(c.cachesToSync,
+		infraConfig.Informer().HasSynced,
+		secrets.Informer().HasSynced,
+		openshiftConfig.Informer().HasSynced,
+		openshiftConfigManaged.Informer().HasSynced,
+	)
+	return c, nil
+}
+
+// eventHandler is the callback method for handling events from informer
+func (c *GCPLabelsTagsController) eventHandler() cache.ResourceEventHandler {
+	const workQueueKey = "gcp"
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			infra, ok := obj.(*configv1.Infrastructure)
+			if !ok || infra == nil {
+				return
+			}
+			// labels and tags changed while the operator was not
+			// running are synced as well.
+			if infra.Status.PlatformStatus != nil && infra.Status.PlatformStatus.GCP != nil {
+				c.queue.Add(workQueueKey)
+			}
+		},
+		UpdateFunc: func(prev, cur interface{}) {
+			oldInfra, ok := prev.(*configv1.Infrastructure)
+			if !ok || oldInfra == nil {
+				return
+			}
+			newInfra, ok := cur.(*configv1.Infrastructure)
+			if !ok || newInfra == nil {
+				return
+			}
+			if oldInfra.Status.PlatformStatus == nil || oldInfra.Status.PlatformStatus.GCP == nil ||
+				newInfra.Status.PlatformStatus == nil || newInfra.Status.PlatformStatus.GCP == nil {
+				return
+			}
+			oldGCP, newGCP := oldInfra.Status.PlatformStatus.GCP, newInfra.Status.PlatformStatus.GCP
+			if !reflect.DeepEqual(oldGCP.ResourceLabels, newGCP.ResourceLabels) ||
+				!reflect.DeepEqual(oldGCP.ResourceTags, newGCP.ResourceTags) {
+				c.queue.Add(workQueueKey)
+			}
+		},
+	}
+}
+
+// Run is the main method for starting the GCP labels and tags controller
+func (c *GCPLabelsTagsController) Run(ctx context.Context) {
+	defer k8sruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting GCP Labels and Tags Controller")
+	if !cache.WaitForCacheSync(ctx.Done(), c.cachesToSync...) {
+		return
+	}
+
+	go wait.Until(c.runWorker, time.Second, ctx.Done())
+
+	klog.Infof("Started GCP Labels and Tags Controller")
+	<-ctx.Done()
+	klog.Infof("Shutting down GCP Labels and Tags Controller")
+}
+
+func (c *GCPLabelsTagsController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+// processNextWorkItem is for processing the event received
+// which blocks until a new item is received
+func (c *GCPLabelsTagsController) processNextWorkItem() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(5).Infof("GCPLabelsTagsController: got event from workqueue")
+	if err := c.sync(); err != nil {
+		c.queue.AddRateLimited(workqueueKey)
+		klog.Errorf("GCPLabelsTagsController: failed to process event: %s, requeuing", err)
+	} else {
+		c.queue.Forget(obj)
+		klog.V(5).Infof("GCPLabelsTagsController: event from workqueue successfully processed")
+	}
+	return true
+}
+
+// sync brings the labels and the tags of the GCS bucket in line with the
+// ones of the Infrastructure resource. The labels and the tags previously
+// set out of the Infrastructure resource, and not in it anymore, are
+// removed.
+func (c *GCPLabelsTagsController) sync() error {
+	cr, err := c.imageRegistryConfigClient.Get(
+		context.Background(),
+		defaults.ImageRegistryResourceName,
+		metav1.GetOptions{},
+	)
+	if err != nil {
+		return err
+	}
+
+	// if gcs storage config is missing, must be
+	// non-GCP platform, so not treating it as error
+	if cr.Spec.Storage.GCS == nil || cr.Spec.Storage.GCS.Bucket == "" {
+		return nil
+	}
+
+	// like on creation, only the buckets managed by the operator are
+	// labeled and tagged.
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return nil
+	}
+
+	// make a copy to avoid changing the cached data
+	cr = cr.DeepCopy()
+
+	infra, err := util.GetInfrastructure(c.listers.Infrastructures)
+	if err != nil {
+		klog.Errorf("failed to fetch Infrastructure resource: %v", err)
+		return err
+	}
+
+	ctx := context.Background()
+	driver := gcs.NewDriver(ctx, cr.Spec.Storage.GCS.DeepCopy(), c.listers)
+
+	infraLabels := gcpResourceLabels(infra)
+	if err := c.syncLabels(driver, infraLabels, ownedKeys(cr, defaults.GCPOwnedLabelsAnnotation)); err != nil {
+		return err
+	}
+
+	infraTags := gcs.ResourceTagValues(infra.Status.PlatformStatus)
+	if err := c.syncTags(ctx, cr, infraTags, ownedKeys(cr, defaults.GCPOwnedTagsAnnotation)); err != nil {
+		return err
+	}
+
+	return recordOwnedKeys(c.imageRegistryConfigClient, cr, map[string][]string{
+		defaults.GCPOwnedLabelsAnnotation: sets.List(sets.KeySet(infraLabels)),
+		defaults.GCPOwnedTagsAnnotation:   infraTags,
+	})
+}
+
+// syncLabels adds or updates the labels of the bucket out of the
+// Infrastructure resource, and removes the owned ones not in it anymore.
+func (c *GCPLabelsTagsController) syncLabels(driver gcsLabeler, infraLabels map[string]string, ownedLabels []string) error {
+	bucketLabels, err := driver.GetStorageLabels()
+	if err != nil {
+		klog.Errorf("failed to fetch storage labels: %v", err)
+		return err
+	}
+	klog.V(5).Infof("labels read from storage resource: %v", bucketLabels)
+
+	updated, removed := syncInfraTags(bucketLabels, infraLabels, ownedLabels)
+	if len(updated) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	labels := make(map[string]string, len(updated))
+	for _, key := range updated {
+		labels[key] = bucketLabels[key]
+	}
+	if err := driver.PutStorageLabels(labels, removed); err != nil {
+		klog.Errorf("failed to update labels of %s gcs bucket: %v", driver.ID(), err)
+		c.event.Warningf("UpdateGCPLabels",
+			"Failed to update labels of %s gcs bucket", driver.ID())
+		return err
+	}
+	klog.Infof("successfully updated %d and removed %d labels of %s gcs bucket", len(updated), len(removed), driver.ID())
+	c.event.Eventf("UpdateGCPLabels",
+		"Successfully updated labels of %s gcs bucket: %s", driver.ID(), tagChangesSummary(updated, removed))
+	return nil
+}
+
+// syncTags binds the tags of the Infrastructure resource to the bucket, and
+// removes the bindings of the owned ones not in it anymore.
+func (c *GCPLabelsTagsController) syncTags(ctx context.Context, cr *imageregistryv1.Config, infraTags, ownedTags []string) error {
+	staleTags := staleGCPTags(infraTags, ownedTags)
+	if len(infraTags) == 0 && len(staleTags) == 0 {
+		return nil
+	}
+
+	region := cr.Spec.Storage.GCS.Region
+	if region == "" {
+		cfg, err := gcs.GetConfig(c.listers)
+		if err != nil {
+			return err
+		}
+		region = cfg.Region
+	}
+
+	tagMgr, err := gcs.NewTagManager(ctx, c.listers, region)
+	if err != nil {
+		return err
+	}
+	defer tagMgr.Close()
+
+	bucket := cr.Spec.Storage.GCS.Bucket
+	bound, err := tagMgr.SyncStorageBucketTags(ctx, bucket, infraTags, staleTags)
+	if err != nil {
+		klog.Errorf("failed to update tags of %s gcs bucket: %v", bucket, err)
+		c.event.Warningf("UpdateGCPTags",
+			"Failed to update tags of %s gcs bucket", bucket)
+		return err
+	}
+	if len(bound) > 0 || len(staleTags) > 0 {
+		klog.Infof("successfully bound %d and removed %d tags of %s gcs bucket", len(bound), len(staleTags), bucket)
+		c.event.Eventf("UpdateGCPTags",
+			"Successfully updated tags of %s gcs bucket: %s", bucket, tagChangesSummary(bound, staleTags))
+	}
+	return nil
+}
+
+// gcsLabeler is the part of the GCS driver used to sync the bucket labels.
+type gcsLabeler interface {
+	ID() string
+	GetStorageLabels() (map[string]string, error)
+	PutStorageLabels(map[string]string, []string) error
+}
+
+// gcpResourceLabels returns the user-defined labels present in Platform
+// Status of Infrastructure config.
+func gcpResourceLabels(infra *configv1.Infrastructure) map[string]string {
+	labels := map[string]string{}
+	if infra.Status.PlatformStatus == nil || infra.Status.PlatformStatus.GCP == nil {
+		return labels
+	}
+	for _, label := range infra.Status.PlatformStatus.GCP.ResourceLabels {
+		labels[label.Key] = label.Value
+	}
+	return labels
+}
+
+// staleGCPTags returns the sorted owned tags which are not in the
+// Infrastructure resource anymore.
+func staleGCPTags(infraTags, ownedTags []string) []string {
+	return sets.List(sets.New(ownedTags...).Difference(sets.New(infraTags...)))
+}
@@ -0,0 +1,112 @@
+package operator
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"k8s.io/utils/clock"
+
+	"github.com/openshift/library-go/pkg/operator/events"
+)
+
+type fakeGCSLabeler struct {
+	labels  map[string]string
+	putErr  error
+	put     map[string]string
+	removed []string
+}
+
+func (f *fakeGCSLabeler) ID() string {
+	return "test-bucket"
+}
+
+func (f *fakeGCSLabeler) GetStorageLabels() (map[string]string, error) {
+	return f.labels, nil
+}
+
+func (f *fakeGCSLabeler) PutStorageLabels(labels map[string]string, removed []string) error {
+	f.put = labels
+	f.removed = removed
+	return f.putErr
+}
+
+func TestGCPSyncLabels(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		bucketLabels    map[string]string
+		infraLabels     map[string]string
+		ownedLabels     []string
+		putErr          error
+		expectedPut     map[string]string
+		expectedRemoved []string
+		expectedEvent   string
+		expectErr       bool
+	}{
+		{
+			name:          "new and changed labels",
+			bucketLabels:  map[string]string{"kubernetes-io-cluster-test": "owned", "team": "old"},
+			infraLabels:   map[string]string{"team": "storage", "cost-center": "registry"},
+			expectedPut:   map[string]string{"team": "storage", "cost-center": "registry"},
+			expectedEvent: "Successfully updated labels of test-bucket gcs bucket: 2 added or updated (cost-center, team)",
+		},
+		{
+			name:            "owned labels removed from the infrastructure",
+			bucketLabels:    map[string]string{"kubernetes-io-cluster-test": "owned", "team": "storage", "owner": "someone"},
+			ownedLabels:     []string{"team"},
+			expectedPut:     map[string]string{},
+			expectedRemoved: []string{"team"},
+			expectedEvent:   "Successfully updated labels of test-bucket gcs bucket: 1 removed (team)",
+		},
+		{
+			name:         "labels in sync",
+			bucketLabels: map[string]string{"kubernetes-io-cluster-test": "owned", "team": "storage"},
+			infraLabels:  map[string]string{"team": "storage"},
+			ownedLabels:  []string{"team"},
+		},
+		{
+			name:          "updating labels fails",
+			bucketLabels:  map[string]string{"kubernetes-io-cluster-test": "owned"},
+			infraLabels:   map[string]string{"team": "storage"},
+			putErr:        fmt.Errorf("forbidden"),
+			expectedPut:   map[string]string{"team": "storage"},
+			expectedEvent: "Failed to update labels of test-bucket gcs bucket",
+			expectErr:     true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := events.NewInMemoryRecorder("test", clock.RealClock{})
+			c := &GCPLabelsTagsController{event: recorder}
+			driver := &fakeGCSLabeler{labels: tt.bucketLabels, putErr: tt.putErr}
+
+			err := c.syncLabels(driver, tt.infraLabels, tt.ownedLabels)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("expected error %v, got %v", tt.expectErr, err)
+			}
+			if !reflect.DeepEqual(driver.put, tt.expectedPut) {
+				t.Errorf("expected labels %v to be set, got %v", tt.expectedPut, driver.put)
+			}
+			if !reflect.DeepEqual(driver.removed, tt.expectedRemoved) {
+				t.Errorf("expected labels %v to be removed, got %v", tt.expectedRemoved, driver.removed)
+			}
+
+			var message string
+			if evs := recorder.Events(); len(evs) > 0 {
+				message = evs[len(evs)-1].Message
+			}
+			if message != tt.expectedEvent {
+				t.Errorf("expected event %q, got %q", tt.expectedEvent, message)
+			}
+		})
+	}
+}
+
+func TestStaleGCPTags(t *testing.T) {
+	infraTags := []string{"openshift/team/storage"}
+	ownedTags := []string{"openshift/team/storage", "openshift/cost-center/registry", "openshift/env/dev"}
+
+	expected := []string{"openshift/cost-center/registry", "openshift/env/dev"}
+	if stale := staleGCPTags(infraTags, ownedTags); !reflect.DeepEqual(stale, expected) {
+		t.Errorf("expected stale tags %v, got %v", expected, stale)
+	}
+}
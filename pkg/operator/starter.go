@@ -240,8 +240,79 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 		return err
 	}
 
+	gcpLabelsTagsController, err := NewGCPLabelsTagsController(
+		imageregistryClient.ImageregistryV1().Configs(),
+		kubeInformers,
+		configInformers,
+		kubeInformersForOpenShiftConfig,
+		kubeInformersForOpenShiftConfigManaged,
+		eventRecorder,
+	)
+	if err != nil {
+		return err
+	}
+
 	metricsController := NewMetricsController(imageInformers.Image().V1().ImageStreams())
 
+	storageUsageController := NewStorageUsageController(
+		kubeconfig,
+		kubeClient.BatchV1(),
+		kubeClient.CoreV1(),
+		configOperatorClient,
+		kubeInformers,
+		imageregistryInformers,
+		configInformers,
+		kubeInformersForOpenShiftConfig,
+		kubeInformersForOpenShiftConfigManaged,
+		featureGateAccessor,
+	)
+
+	storageProbeController := NewStorageProbeController(
+		kubeconfig,
+		configOperatorClient,
+		kubeInformers,
+		imageregistryInformers,
+		configInformers,
+		kubeInformersForOpenShiftConfig,
+		kubeInformersForOpenShiftConfigManaged,
+		featureGateAccessor,
+	)
+
+	storageOrphansController := NewStorageOrphansController(
+		kubeconfig,
+		configOperatorClient,
+		kubeInformers,
+		imageregistryInformers,
+		configInformers,
+		kubeInformersForOpenShiftConfig,
+		kubeInformersForOpenShiftConfigManaged,
+		featureGateAccessor,
+	)
+
+	storageReplicationController := NewStorageReplicationController(
+		kubeconfig,
+		configOperatorClient,
+		kubeInformers,
+		imageregistryInformers,
+		configInformers,
+		kubeInformersForOpenShiftConfig,
+		kubeInformersForOpenShiftConfigManaged,
+		featureGateAccessor,
+	)
+
+	storageKeyRotationController := NewStorageKeyRotationController(
+		kubeconfig,
+		kubeClient.CoreV1(),
+		configOperatorClient,
+		kubeInformers,
+		imageregistryInformers,
+		configInformers,
+		kubeInformersForOpenShiftConfig,
+		kubeInformersForOpenShiftConfigManaged,
+		featureGateAccessor,
+		eventRecorder,
+	)
+
 	configObserverController := configobserver.NewConfigObserver(
 		"ImageRegistryConfigObserver",
 		configOperatorClient,
@@ -273,7 +344,13 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 	go azureStackCloudController.Run(ctx)
 	go azurePathFixController.Run(ctx.Done())
 	go awsTagController.Run(ctx)
+	go gcpLabelsTagsController.Run(ctx)
 	go metricsController.Run(ctx)
+	go storageUsageController.Run(ctx)
+	go storageProbeController.Run(ctx)
+	go storageOrphansController.Run(ctx)
+	go storageReplicationController.Run(ctx)
+	go storageKeyRotationController.Run(ctx)
 	go configObserverController.Run(ctx, 1)
 
 	<-ctx.Done()
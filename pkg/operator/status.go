@@ -19,6 +19,7 @@ import (
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
 )
 
 const unavailableDegradedInertia = 5 * time.Minute
@@ -305,6 +306,9 @@ func (c *Controller) syncStatus(
 		if deploy != nil {
 			operatorProgressing.Message = "The deployment is being removed"
 			operatorProgressing.Reason = "DeletingDeployment"
+		} else if applyError == resource.ErrStorageRemovalInProgress {
+			operatorProgressing.Message = "The registry content is being deleted from the storage"
+			operatorProgressing.Reason = "DeletingStorage"
 		} else {
 			operatorProgressing.Status = operatorapiv1.ConditionFalse
 			operatorProgressing.Message = "All registry resources are removed"
@@ -0,0 +1,361 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configinformers "github.com/openshift/client-go/config/informers/externalversions"
+	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+const (
+	// storageKeyRotationResync is how often the rotation of the storage
+	// keys is looked at, it also bounds how quickly a rotation follows the
+	// rollout of the registry.
+	storageKeyRotationResync = 5 * time.Minute
+
+	// storageKeyRotationTimeout bounds the time a single step of the
+	// rotation may take.
+	storageKeyRotationTimeout = time.Minute
+
+	// minStorageKeyRotationInterval is the shortest schedule the keys can
+	// be rotated on.
+	minStorageKeyRotationInterval = time.Hour
+
+	storageKeyRotationReasonRotated    = "KeysRotated"
+	storageKeyRotationReasonRollingOut = "RollingOut"
+	storageKeyRotationReasonFailed     = "RotationFailed"
+)
+
+// StorageKeyRotationController rotates on schedule the keys the registry
+// accesses the storage with, without the registry losing access to it: the
+// standby key is regenerated, the registry is switched to it through its
+// private configuration and, once the registry is rolled out, the key it
+// used before is regenerated.
+type StorageKeyRotationController struct {
+	kubeconfig          *restclient.Config
+	coreClient          coreset.CoreV1Interface
+	operatorClient      v1helpers.OperatorClient
+	configLister        imageregistryv1listers.ConfigLister
+	deploymentLister    appslisters.DeploymentNamespaceLister
+	secretLister        corelisters.SecretNamespaceLister
+	storageListers      *regopclient.StorageListers
+	featureGateAccessor featuregates.FeatureGateAccess
+	event               events.Recorder
+	caches              []cache.InformerSynced
+}
+
+// NewStorageKeyRotationController returns a new StorageKeyRotationController.
+func NewStorageKeyRotationController(
+	kubeconfig *restclient.Config,
+	coreClient coreset.CoreV1Interface,
+	operatorClient v1helpers.OperatorClient,
+	kubeInformerFactory kubeinformers.SharedInformerFactory,
+	regopInformerFactory imageregistryinformers.SharedInformerFactory,
+	configInformerFactory configinformers.SharedInformerFactory,
+	openshiftConfigKubeInformerFactory kubeinformers.SharedInformerFactory,
+	openshiftConfigManagedKubeInformerFactory kubeinformers.SharedInformerFactory,
+	featureGateAccessor featuregates.FeatureGateAccess,
+	eventRecorder events.Recorder,
+) *StorageKeyRotationController {
+	configInformer := regopInformerFactory.Imageregistry().V1().Configs()
+	deploymentInformer := kubeInformerFactory.Apps().V1().Deployments()
+	secretInformer := kubeInformerFactory.Core().V1().Secrets()
+	infraInformer := configInformerFactory.Config().V1().Infrastructures()
+	openshiftConfigInformer := openshiftConfigKubeInformerFactory.Core().V1().ConfigMaps()
+	openshiftConfigManagedInformer := openshiftConfigManagedKubeInformerFactory.Core().V1().ConfigMaps()
+
+	secretLister := secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace)
+	return &StorageKeyRotationController{
+		kubeconfig:       kubeconfig,
+		coreClient:       coreClient,
+		operatorClient:   operatorClient,
+		configLister:     configInformer.Lister(),
+		deploymentLister: deploymentInformer.Lister().Deployments(defaults.ImageRegistryOperatorNamespace),
+		secretLister:     secretLister,
+		storageListers: &regopclient.StorageListers{
+			Secrets:                secretLister,
+			Infrastructures:        infraInformer.Lister(),
+			OpenShiftConfig:        openshiftConfigInformer.Lister().ConfigMaps(defaults.OpenShiftConfigNamespace),
+			OpenShiftConfigManaged: openshiftConfigManagedInformer.Lister().ConfigMaps(defaults.OpenShiftConfigManagedNamespace),
+		},
+		featureGateAccessor: featureGateAccessor,
+		event:               eventRecorder,
+		caches: []cache.InformerSynced{
+			configInformer.Informer().HasSynced,
+			deploymentInformer.Informer().HasSynced,
+			secretInformer.Informer().HasSynced,
+			infraInformer.Informer().HasSynced,
+			openshiftConfigInformer.Informer().HasSynced,
+			openshiftConfigManagedInformer.Informer().HasSynced,
+		},
+	}
+}
+
+// storageKeyRotationInterval returns the schedule the storage keys are
+// rotated on, as set on the image registry config. Zero is returned when
+// the keys are not to be rotated.
+func storageKeyRotationInterval(cr *imageregistryv1.Config) time.Duration {
+	raw, ok := cr.Annotations[defaults.StorageKeyRotationIntervalAnnotation]
+	if !ok {
+		return 0
+	}
+	interval, err := time.ParseDuration(raw)
+	if err != nil || interval < minStorageKeyRotationInterval {
+		klog.Warningf("ignoring invalid %s annotation %q: a duration of at least %s is expected", defaults.StorageKeyRotationIntervalAnnotation, raw, minStorageKeyRotationInterval)
+		return 0
+	}
+	return interval
+}
+
+// sync moves the rotation of the storage keys forward and reports it on the
+// image registry config status.
+func (c *StorageKeyRotationController) sync(ctx context.Context) {
+	cr, err := c.configLister.Get(defaults.ImageRegistryResourceName)
+	if err != nil {
+		klog.Errorf("unable to get image registry config: %s", err)
+		return
+	}
+
+	interval := storageKeyRotationInterval(cr)
+	rotator, err := c.rotator(cr, interval)
+	if err != nil {
+		klog.Errorf("unable to get storage driver: %s", err)
+		return
+	}
+	if rotator == nil {
+		c.removeCondition(ctx, cr)
+		return
+	}
+
+	rotateCtx, cancel := context.WithTimeout(ctx, storageKeyRotationTimeout)
+	defer cancel()
+
+	cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageCredentialsRotated)
+	if next := c.rotate(rotateCtx, rotator, cond, interval); next != nil {
+		c.updateCondition(ctx, cr, *next)
+	}
+}
+
+// rotator returns the driver rotating the storage keys. No driver is
+// returned unless the keys are to be rotated and the operator manages the
+// storage.
+func (c *StorageKeyRotationController) rotator(cr *imageregistryv1.Config, interval time.Duration) (storage.KeyRotator, error) {
+	if interval == 0 || cr.Spec.ManagementState == operatorv1.Removed {
+		return nil, nil
+	}
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return nil, nil
+	}
+
+	driver, err := storage.NewDriver(&cr.Status.Storage, c.kubeconfig, c.storageListers, c.featureGateAccessor)
+	if err == storage.ErrStorageNotConfigured {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rotator, ok := driver.(storage.KeyRotator)
+	if !ok {
+		return nil, nil
+	}
+	return rotator, nil
+}
+
+// rotate runs the next step of the rotation given the StorageCredentialsRotated
+// condition, and returns the condition to report. Nothing is returned when
+// there is no step to run yet.
+func (c *StorageKeyRotationController) rotate(ctx context.Context, rotator storage.KeyRotator, cond *operatorv1.OperatorCondition, interval time.Duration) *operatorv1.OperatorCondition {
+	if cond != nil && cond.Reason == storageKeyRotationReasonRollingOut {
+		return c.completeRotation(ctx, rotator, cond.LastTransitionTime.Time)
+	}
+	if cond != nil && cond.Status == operatorv1.ConditionTrue && time.Since(cond.LastTransitionTime.Time) < interval {
+		return nil
+	}
+	return c.startRotation(ctx, rotator)
+}
+
+// startRotation regenerates the standby key and switches the registry to it.
+func (c *StorageKeyRotationController) startRotation(ctx context.Context, rotator storage.KeyRotator) *operatorv1.OperatorCondition {
+	name, err := rotator.StandbyKey(ctx)
+	if err != nil {
+		return c.rotationFailed(fmt.Errorf("unable to get the standby key: %w", err))
+	}
+	if name == "" {
+		// the registry doesn't access the storage with keys the
+		// operator can regenerate.
+		return nil
+	}
+
+	param, err := rotator.RegenerateKey(ctx, name)
+	if err != nil {
+		return c.rotationFailed(fmt.Errorf("unable to regenerate the standby key %s: %w", name, err))
+	}
+	c.event.Eventf("StorageKeyRegenerated", "Regenerated the standby storage key %s", name)
+
+	if err := c.switchRegistryKey(ctx, param); err != nil {
+		return c.rotationFailed(fmt.Errorf("unable to switch the registry to the storage key %s: %w", name, err))
+	}
+	c.event.Eventf("StorageKeySwitched", "Switched the registry to the storage key %s, waiting for its rollout", name)
+
+	return &operatorv1.OperatorCondition{
+		Type:    defaults.StorageCredentialsRotated,
+		Status:  operatorv1.ConditionUnknown,
+		Reason:  storageKeyRotationReasonRollingOut,
+		Message: fmt.Sprintf("Waiting for the registry to roll out with the storage key %s", name),
+	}
+}
+
+// completeRotation regenerates the key the registry used before the switch
+// once the registry is rolled out with the new key.
+func (c *StorageKeyRotationController) completeRotation(ctx context.Context, rotator storage.KeyRotator, switchedAt time.Time) *operatorv1.OperatorCondition {
+	deploy, err := c.deploymentLister.Get(defaults.ImageRegistryName)
+	if err != nil {
+		klog.Errorf("unable to get the registry deployment: %s", err)
+		return nil
+	}
+	if !deploymentRolledOutSince(deploy, switchedAt) {
+		return nil
+	}
+
+	name, err := rotator.StandbyKey(ctx)
+	if err != nil || name == "" {
+		klog.Errorf("unable to get the storage key no longer used by the registry: %v", err)
+		return nil
+	}
+	if _, err := rotator.RegenerateKey(ctx, name); err != nil {
+		c.event.Warningf("StorageKeyRotationFailed", "Unable to regenerate the storage key %s no longer used by the registry: %s", name, err)
+		return nil
+	}
+	c.event.Eventf("StorageKeyRegenerated", "The registry rolled out, regenerated the storage key %s it no longer uses", name)
+
+	rotatedAt := time.Now().UTC().Format(time.RFC3339)
+	c.event.Eventf("StorageCredentialsRotated", "The storage keys were rotated at %s", rotatedAt)
+	return &operatorv1.OperatorCondition{
+		Type:    defaults.StorageCredentialsRotated,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  storageKeyRotationReasonRotated,
+		Message: fmt.Sprintf("The storage keys were last rotated at %s", rotatedAt),
+	}
+}
+
+func (c *StorageKeyRotationController) rotationFailed(err error) *operatorv1.OperatorCondition {
+	c.event.Warningf("StorageKeyRotationFailed", "%s", err)
+	return &operatorv1.OperatorCondition{
+		Type:    defaults.StorageCredentialsRotated,
+		Status:  operatorv1.ConditionFalse,
+		Reason:  storageKeyRotationReasonFailed,
+		Message: err.Error(),
+	}
+}
+
+// switchRegistryKey sets the parameter holding the new key on the registry
+// private configuration. The registry is rolled out as its private
+// configuration changes.
+func (c *StorageKeyRotationController) switchRegistryKey(ctx context.Context, param envvar.EnvVar) error {
+	value, err := param.EnvValue()
+	if err != nil {
+		return err
+	}
+
+	sec, err := c.secretLister.Get(defaults.ImageRegistryPrivateConfiguration)
+	if err != nil {
+		return err
+	}
+	sec = sec.DeepCopy()
+	if sec.Data == nil {
+		sec.Data = map[string][]byte{}
+	}
+	sec.Data[param.Name] = []byte(value)
+
+	_, err = c.coreClient.Secrets(defaults.ImageRegistryOperatorNamespace).Update(ctx, sec, metav1.UpdateOptions{})
+	return err
+}
+
+// deploymentRolledOutSince tells whether all the replicas of the deployment
+// are updated and available, and whether the rollout completed after the
+// given time.
+func deploymentRolledOutSince(deploy *appsv1.Deployment, since time.Time) bool {
+	if deploy.Status.ObservedGeneration < deploy.Generation {
+		return false
+	}
+	replicas := int32(1)
+	if deploy.Spec.Replicas != nil {
+		replicas = *deploy.Spec.Replicas
+	}
+	if deploy.Status.UpdatedReplicas < replicas || deploy.Status.AvailableReplicas < replicas || deploy.Status.Replicas > deploy.Status.UpdatedReplicas {
+		return false
+	}
+	for _, cond := range deploy.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing {
+			return cond.Reason == "NewReplicaSetAvailable" && !cond.LastUpdateTime.Time.Before(since)
+		}
+	}
+	return false
+}
+
+func (c *StorageKeyRotationController) updateCondition(ctx context.Context, cr *imageregistryv1.Config, next operatorv1.OperatorCondition) {
+	cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageCredentialsRotated)
+	if cond != nil && cond.Status == next.Status && cond.Reason == next.Reason && cond.Message == next.Message {
+		return
+	}
+	if _, _, err := v1helpers.UpdateStatus(
+		ctx,
+		c.operatorClient,
+		v1helpers.UpdateConditionFn(next),
+	); err != nil {
+		klog.Errorf("unable to update %s condition: %s", defaults.StorageCredentialsRotated, err)
+	}
+}
+
+func (c *StorageKeyRotationController) removeCondition(ctx context.Context, cr *imageregistryv1.Config) {
+	if v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageCredentialsRotated) == nil {
+		return
+	}
+	if _, _, err := v1helpers.UpdateStatus(
+		ctx,
+		c.operatorClient,
+		func(oldStatus *operatorv1.OperatorStatus) error {
+			v1helpers.RemoveOperatorCondition(&oldStatus.Conditions, defaults.StorageCredentialsRotated)
+			return nil
+		},
+	); err != nil {
+		klog.Errorf("unable to remove %s condition: %s", defaults.StorageCredentialsRotated, err)
+	}
+}
+
+// Run starts this controller. Runs the main loop in a separate go routine and bails out when
+// the provided context is finished.
+func (c *StorageKeyRotationController) Run(ctx context.Context) {
+	klog.Infof("Starting StorageKeyRotationController")
+	if !cache.WaitForCacheSync(ctx.Done(), c.caches...) {
+		return
+	}
+
+	go wait.UntilWithContext(ctx, c.sync, storageKeyRotationResync)
+	klog.Infof("Started StorageKeyRotationController")
+	<-ctx.Done()
+	klog.Infof("Shutting down StorageKeyRotationController")
+}
@@ -0,0 +1,223 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	kubefakeclient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/ptr"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+)
+
+type fakeKeyRotator struct {
+	active      string
+	values      map[string]string
+	regenerated []string
+	err         error
+}
+
+func (r *fakeKeyRotator) StandbyKey(ctx context.Context) (string, error) {
+	if r.active == "key1" {
+		return "key2", nil
+	}
+	return "key1", nil
+}
+
+func (r *fakeKeyRotator) RegenerateKey(ctx context.Context, name string) (envvar.EnvVar, error) {
+	if r.err != nil {
+		return envvar.EnvVar{}, r.err
+	}
+	r.regenerated = append(r.regenerated, name)
+	r.values[name] += "-new"
+	return envvar.EnvVar{Name: "REGISTRY_STORAGE_AZURE_ACCOUNTKEY", Value: r.values[name], Secret: true}, nil
+}
+
+func TestStorageKeyRotation(t *testing.T) {
+	switchedAt := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	rolledOut := func(at time.Time) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       defaults.ImageRegistryName,
+				Namespace:  defaults.ImageRegistryOperatorNamespace,
+				Generation: 2,
+			},
+			Spec: appsv1.DeploymentSpec{Replicas: ptr.To[int32](2)},
+			Status: appsv1.DeploymentStatus{
+				ObservedGeneration: 2,
+				Replicas:           2,
+				UpdatedReplicas:    2,
+				AvailableReplicas:  2,
+				Conditions: []appsv1.DeploymentCondition{
+					{
+						Type:           appsv1.DeploymentProgressing,
+						Status:         corev1.ConditionTrue,
+						Reason:         "NewReplicaSetAvailable",
+						LastUpdateTime: metav1.NewTime(at),
+					},
+				},
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name                string
+		cond                *operatorv1.OperatorCondition
+		deployment          *appsv1.Deployment
+		rotatorErr          error
+		expectedRegenerated []string
+		expectedSecretKey   string
+		expectedStatus      operatorv1.ConditionStatus
+		expectedReason      string
+	}{
+		{
+			name:                "first rotation",
+			expectedRegenerated: []string{"key2"},
+			expectedSecretKey:   "second-new",
+			expectedStatus:      operatorv1.ConditionUnknown,
+			expectedReason:      "RollingOut",
+		},
+		{
+			name: "rotation due",
+			cond: &operatorv1.OperatorCondition{
+				Status:             operatorv1.ConditionTrue,
+				Reason:             "KeysRotated",
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-48 * time.Hour)),
+			},
+			expectedRegenerated: []string{"key2"},
+			expectedSecretKey:   "second-new",
+			expectedStatus:      operatorv1.ConditionUnknown,
+			expectedReason:      "RollingOut",
+		},
+		{
+			name: "rotation not due",
+			cond: &operatorv1.OperatorCondition{
+				Status:             operatorv1.ConditionTrue,
+				Reason:             "KeysRotated",
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+			},
+			expectedSecretKey: "first",
+		},
+		{
+			name: "registry rolling out",
+			cond: &operatorv1.OperatorCondition{
+				Status:             operatorv1.ConditionUnknown,
+				Reason:             "RollingOut",
+				LastTransitionTime: metav1.NewTime(switchedAt),
+			},
+			deployment:        rolledOut(switchedAt.Add(-time.Hour)),
+			expectedSecretKey: "first",
+		},
+		{
+			name: "registry rolled out",
+			cond: &operatorv1.OperatorCondition{
+				Status:             operatorv1.ConditionUnknown,
+				Reason:             "RollingOut",
+				LastTransitionTime: metav1.NewTime(switchedAt),
+			},
+			deployment:          rolledOut(switchedAt.Add(5 * time.Minute)),
+			expectedRegenerated: []string{"key1"},
+			expectedSecretKey:   "first",
+			expectedStatus:      operatorv1.ConditionTrue,
+			expectedReason:      "KeysRotated",
+		},
+		{
+			name:              "regeneration fails",
+			rotatorErr:        errors.New("forbidden"),
+			expectedSecretKey: "first",
+			expectedStatus:    operatorv1.ConditionFalse,
+			expectedReason:    "RotationFailed",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := []runtime.Object{
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      defaults.ImageRegistryPrivateConfiguration,
+						Namespace: defaults.ImageRegistryOperatorNamespace,
+					},
+					Data: map[string][]byte{
+						"REGISTRY_STORAGE_AZURE_ACCOUNTKEY": []byte("first"),
+					},
+				},
+			}
+			if tt.deployment != nil {
+				objects = append(objects, tt.deployment)
+			}
+			kubeClient := kubefakeclient.NewClientset(objects...)
+			kubeInformers := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+			c := &StorageKeyRotationController{
+				coreClient:       kubeClient.CoreV1(),
+				deploymentLister: kubeInformers.Apps().V1().Deployments().Lister().Deployments(defaults.ImageRegistryOperatorNamespace),
+				secretLister:     kubeInformers.Core().V1().Secrets().Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+				event:            events.NewInMemoryRecorder("test", clock.RealClock{}),
+			}
+			ctx := t.Context()
+			kubeInformers.Start(ctx.Done())
+			kubeInformers.WaitForCacheSync(ctx.Done())
+
+			active := "key1"
+			if tt.cond != nil && tt.cond.Reason == "RollingOut" {
+				// the registry was switched to the secondary key.
+				active = "key2"
+			}
+			rotator := &fakeKeyRotator{
+				active: active,
+				values: map[string]string{"key1": "first", "key2": "second"},
+				err:    tt.rotatorErr,
+			}
+
+			next := c.rotate(ctx, rotator, tt.cond, 24*time.Hour)
+			var status operatorv1.ConditionStatus
+			var reason string
+			if next != nil {
+				status, reason = next.Status, next.Reason
+			}
+			if status != tt.expectedStatus || reason != tt.expectedReason {
+				t.Errorf("expected condition %s %s, got %s %s", tt.expectedStatus, tt.expectedReason, status, reason)
+			}
+			if !reflect.DeepEqual(rotator.regenerated, tt.expectedRegenerated) {
+				t.Errorf("expected keys %v to be regenerated, got %v", tt.expectedRegenerated, rotator.regenerated)
+			}
+
+			sec, err := kubeClient.CoreV1().Secrets(defaults.ImageRegistryOperatorNamespace).Get(ctx, defaults.ImageRegistryPrivateConfiguration, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key := string(sec.Data["REGISTRY_STORAGE_AZURE_ACCOUNTKEY"]); key != tt.expectedSecretKey {
+				t.Errorf("expected the registry to be configured with %q, got %q", tt.expectedSecretKey, key)
+			}
+		})
+	}
+}
+
+func TestStorageKeyRotationInterval(t *testing.T) {
+	for raw, expected := range map[string]time.Duration{
+		"720h":  720 * time.Hour,
+		"30m":   0,
+		"daily": 0,
+	} {
+		cr := &imageregistryv1.Config{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{defaults.StorageKeyRotationIntervalAnnotation: raw},
+			},
+		}
+		if interval := storageKeyRotationInterval(cr); interval != expected {
+			t.Errorf("%s: expected %s, got %s", raw, expected, interval)
+		}
+	}
+}
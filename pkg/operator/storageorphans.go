@@ -0,0 +1,282 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configinformers "github.com/openshift/client-go/config/informers/externalversions"
+	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+// storageOrphansInterval is how often the storage owned by the cluster is
+// searched for orphans.
+const storageOrphansInterval = time.Hour
+
+// StorageOrphansController is a controller that looks for buckets and
+// containers named after and owned by the cluster that the registry does
+// not use anymore. Past naming bugs and failed removals left some of them
+// behind. They are reported through a metric and the StorageOrphaned
+// condition, and the empty ones are deleted once they are older than the
+// grace period set on the image registry config, if any.
+type StorageOrphansController struct {
+	kubeconfig          *restclient.Config
+	operatorClient      v1helpers.OperatorClient
+	configLister        imageregistryv1listers.ConfigLister
+	storageListers      *regopclient.StorageListers
+	featureGateAccessor featuregates.FeatureGateAccess
+	caches              []cache.InformerSynced
+}
+
+// NewStorageOrphansController returns a new StorageOrphansController.
+func NewStorageOrphansController(
+	kubeconfig *restclient.Config,
+	operatorClient v1helpers.OperatorClient,
+	kubeInformerFactory kubeinformers.SharedInformerFactory,
+	regopInformerFactory imageregistryinformers.SharedInformerFactory,
+	configInformerFactory configinformers.SharedInformerFactory,
+	openshiftConfigKubeInformerFactory kubeinformers.SharedInformerFactory,
+	openshiftConfigManagedKubeInformerFactory kubeinformers.SharedInformerFactory,
+	featureGateAccessor featuregates.FeatureGateAccess,
+) *StorageOrphansController {
+	configInformer := regopInformerFactory.Imageregistry().V1().Configs()
+	secretInformer := kubeInformerFactory.Core().V1().Secrets()
+	infraInformer := configInformerFactory.Config().V1().Infrastructures()
+	openshiftConfigInformer := openshiftConfigKubeInformerFactory.Core().V1().ConfigMaps()
+	openshiftConfigManagedInformer := openshiftConfigManagedKubeInformerFactory.Core().V1().ConfigMaps()
+
+	return &StorageOrphansController{
+		kubeconfig:     kubeconfig,
+		operatorClient: operatorClient,
+		configLister:   configInformer.Lister(),
+		storageListers: &regopclient.StorageListers{
+			Secrets:                secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+			Infrastructures:        infraInformer.Lister(),
+			OpenShiftConfig:        openshiftConfigInformer.Lister().ConfigMaps(defaults.OpenShiftConfigNamespace),
+			OpenShiftConfigManaged: openshiftConfigManagedInformer.Lister().ConfigMaps(defaults.OpenShiftConfigManagedNamespace),
+		},
+		featureGateAccessor: featureGateAccessor,
+		caches: []cache.InformerSynced{
+			configInformer.Informer().HasSynced,
+			secretInformer.Informer().HasSynced,
+			infraInformer.Informer().HasSynced,
+			openshiftConfigInformer.Informer().HasSynced,
+			openshiftConfigManagedInformer.Informer().HasSynced,
+		},
+	}
+}
+
+// sync searches for orphans and reports them on the image registry config
+// status.
+func (c *StorageOrphansController) sync(ctx context.Context) {
+	cr, err := c.configLister.Get(defaults.ImageRegistryResourceName)
+	if err != nil {
+		klog.Errorf("unable to get image registry config: %s", err)
+		return
+	}
+
+	collector, stype, err := c.collector(cr)
+	if err != nil {
+		klog.Errorf("unable to get storage driver: %s", err)
+		c.updateCondition(ctx, cr, operatorv1.ConditionUnknown, "DriverError", err.Error())
+		return
+	}
+	if collector == nil {
+		c.removeCondition(ctx, cr)
+		return
+	}
+
+	inUse, err := storageInUse(cr)
+	if err != nil {
+		klog.Errorf("unable to get the storage in use: %s", err)
+		c.updateCondition(ctx, cr, operatorv1.ConditionUnknown, "ListFailed", err.Error())
+		return
+	}
+
+	orphans, err := collectOrphanedStorage(ctx, collector, inUse, orphanedStorageGracePeriod(cr), time.Now())
+	if err != nil {
+		klog.Errorf("unable to list the storage owned by the cluster: %s", err)
+		c.updateCondition(ctx, cr, operatorv1.ConditionUnknown, "ListFailed", fmt.Sprintf("Unable to list the %s storage owned by the cluster: %s", stype, err))
+		return
+	}
+
+	metrics.ReportOrphanedStorage(stype, float64(len(orphans)))
+	if len(orphans) == 0 {
+		c.updateCondition(ctx, cr, operatorv1.ConditionFalse, "NoOrphans", fmt.Sprintf("No %s storage owned by the cluster is left unused", stype))
+		return
+	}
+	c.updateCondition(ctx, cr, operatorv1.ConditionTrue, "OrphansFound", fmt.Sprintf("The %s storage owned by the cluster but not used by the registry: %s", stype, strings.Join(orphans, ", ")))
+}
+
+// collector returns the driver used to search for orphans and the storage
+// type. No driver is returned when the storage does not support it or is
+// not provisioned yet.
+func (c *StorageOrphansController) collector(cr *imageregistryv1.Config) (storage.OrphanCollector, string, error) {
+	if cr.Spec.ManagementState == operatorv1.Removed {
+		return nil, "", nil
+	}
+
+	driver, err := storage.NewDriver(&cr.Status.Storage, c.kubeconfig, c.storageListers, c.featureGateAccessor)
+	if err == storage.ErrStorageNotConfigured {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	collector, ok := driver.(storage.OrphanCollector)
+	if !ok {
+		return nil, "", nil
+	}
+	return collector, storageTypeName(&cr.Status.Storage), nil
+}
+
+// storageInUse returns the names of the buckets and containers the registry
+// uses, or is about to use: the storage configured in the spec and status,
+// and the source of an ongoing storage migration.
+func storageInUse(cr *imageregistryv1.Config) (sets.Set[string], error) {
+	inUse := sets.New[string]()
+	cfgs := []*imageregistryv1.ImageRegistryConfigStorage{&cr.Spec.Storage, &cr.Status.Storage}
+
+	src, err := resource.StorageMigrationSource(cr)
+	if err != nil {
+		return nil, err
+	}
+	if src != nil {
+		cfgs = append(cfgs, src)
+	}
+
+	for _, cfg := range cfgs {
+		var name string
+		switch {
+		case cfg.S3 != nil:
+			name = cfg.S3.Bucket
+		case cfg.GCS != nil:
+			name = cfg.GCS.Bucket
+		case cfg.IBMCOS != nil:
+			name = cfg.IBMCOS.Bucket
+		case cfg.Azure != nil:
+			name = cfg.Azure.Container
+		case cfg.Swift != nil:
+			name = cfg.Swift.Container
+		}
+		if name != "" {
+			inUse.Insert(name)
+		}
+	}
+	return inUse, nil
+}
+
+// orphanedStorageGracePeriod returns the grace period after which empty
+// orphans are deleted. Zero means orphans are never deleted.
+func orphanedStorageGracePeriod(cr *imageregistryv1.Config) time.Duration {
+	raw, ok := cr.Annotations[defaults.OrphanedStorageGracePeriodAnnotation]
+	if !ok {
+		return 0
+	}
+	gracePeriod, err := time.ParseDuration(raw)
+	if err != nil || gracePeriod <= 0 {
+		klog.Warningf("ignoring invalid %s annotation %q: a positive duration is expected", defaults.OrphanedStorageGracePeriodAnnotation, raw)
+		return 0
+	}
+	return gracePeriod
+}
+
+// collectOrphanedStorage returns the sorted names of the storage owned by
+// the cluster and not in use. When a grace period is given, the orphans
+// older than it are deleted if they hold nothing but the objects of the
+// operator and are left out of the returned names.
+func collectOrphanedStorage(ctx context.Context, collector storage.OrphanCollector, inUse sets.Set[string], gracePeriod time.Duration, now time.Time) ([]string, error) {
+	owned, err := collector.ListOwnedStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []string
+	for _, s := range owned {
+		if inUse.Has(s.Name) {
+			continue
+		}
+		if gracePeriod > 0 && now.Sub(s.Created) > gracePeriod {
+			removed, err := collector.RemoveOwnedStorage(ctx, s.Name)
+			if err != nil {
+				klog.Errorf("unable to remove orphaned storage %s: %s", s.Name, err)
+			} else if removed {
+				klog.Infof("removed orphaned storage %s created on %s", s.Name, s.Created.Format(time.RFC3339))
+				continue
+			} else {
+				klog.V(2).Infof("keeping orphaned storage %s as it is not empty", s.Name)
+			}
+		}
+		orphans = append(orphans, s.Name)
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
+
+func (c *StorageOrphansController) updateCondition(ctx context.Context, cr *imageregistryv1.Config, status operatorv1.ConditionStatus, reason, message string) {
+	cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageOrphaned)
+	if cond != nil && cond.Status == status && cond.Reason == reason && cond.Message == message {
+		return
+	}
+	if _, _, err := v1helpers.UpdateStatus(
+		ctx,
+		c.operatorClient,
+		v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+			Type:    defaults.StorageOrphaned,
+			Status:  status,
+			Reason:  reason,
+			Message: message,
+		}),
+	); err != nil {
+		klog.Errorf("unable to update %s condition: %s", defaults.StorageOrphaned, err)
+	}
+}
+
+func (c *StorageOrphansController) removeCondition(ctx context.Context, cr *imageregistryv1.Config) {
+	if v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageOrphaned) == nil {
+		return
+	}
+	if _, _, err := v1helpers.UpdateStatus(
+		ctx,
+		c.operatorClient,
+		func(oldStatus *operatorv1.OperatorStatus) error {
+			v1helpers.RemoveOperatorCondition(&oldStatus.Conditions, defaults.StorageOrphaned)
+			return nil
+		},
+	); err != nil {
+		klog.Errorf("unable to remove %s condition: %s", defaults.StorageOrphaned, err)
+	}
+}
+
+// Run starts this controller. Runs the main loop in a separate go routine and bails out when
+// the provided context is finished.
+func (c *StorageOrphansController) Run(ctx context.Context) {
+	klog.Infof("Starting StorageOrphansController")
+	if !cache.WaitForCacheSync(ctx.Done(), c.caches...) {
+		return
+	}
+
+	go wait.UntilWithContext(ctx, c.sync, storageOrphansInterval)
+	klog.Infof("Started StorageOrphansController")
+	<-ctx.Done()
+	klog.Infof("Shutting down StorageOrphansController")
+}
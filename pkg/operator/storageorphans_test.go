@@ -0,0 +1,84 @@
+package operator
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+type fakeOrphanCollector struct {
+	owned    []util.OwnedStorage
+	nonEmpty sets.Set[string]
+	removed  []string
+}
+
+func (c *fakeOrphanCollector) ListOwnedStorage(ctx context.Context) ([]util.OwnedStorage, error) {
+	return c.owned, nil
+}
+
+func (c *fakeOrphanCollector) RemoveOwnedStorage(ctx context.Context, name string) (bool, error) {
+	if c.nonEmpty.Has(name) {
+		return false, nil
+	}
+	c.removed = append(c.removed, name)
+	return true, nil
+}
+
+func TestCollectOrphanedStorage(t *testing.T) {
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	owned := []util.OwnedStorage{
+		{Name: "infra-image-registry-us-east-1-used", Created: now.Add(-30 * 24 * time.Hour)},
+		{Name: "infra-image-registry-us-east-1-old", Created: now.Add(-30 * 24 * time.Hour)},
+		{Name: "infra-image-registry-us-east-1-content", Created: now.Add(-30 * 24 * time.Hour)},
+		{Name: "infra-image-registry-us-east-1-new", Created: now.Add(-time.Hour)},
+	}
+
+	for _, tc := range []struct {
+		name            string
+		gracePeriod     time.Duration
+		expectedOrphans []string
+		expectedRemoved []string
+	}{
+		{
+			name: "report only",
+			expectedOrphans: []string{
+				"infra-image-registry-us-east-1-content",
+				"infra-image-registry-us-east-1-new",
+				"infra-image-registry-us-east-1-old",
+			},
+		},
+		{
+			name:        "remove empty orphans past the grace period",
+			gracePeriod: 7 * 24 * time.Hour,
+			expectedOrphans: []string{
+				"infra-image-registry-us-east-1-content",
+				"infra-image-registry-us-east-1-new",
+			},
+			expectedRemoved: []string{"infra-image-registry-us-east-1-old"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			collector := &fakeOrphanCollector{
+				owned:    owned,
+				nonEmpty: sets.New("infra-image-registry-us-east-1-content"),
+			}
+			inUse := sets.New("infra-image-registry-us-east-1-used")
+
+			orphans, err := collectOrphanedStorage(context.Background(), collector, inUse, tc.gracePeriod, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(orphans, tc.expectedOrphans) {
+				t.Errorf("unexpected orphans: got %v, want %v", orphans, tc.expectedOrphans)
+			}
+			if !reflect.DeepEqual(collector.removed, tc.expectedRemoved) {
+				t.Errorf("unexpected removed storage: got %v, want %v", collector.removed, tc.expectedRemoved)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configinformers "github.com/openshift/client-go/config/informers/externalversions"
+	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+const (
+	// storageProbeInterval is how often the storage is probed.
+	storageProbeInterval = time.Minute
+
+	// storageProbeTimeout bounds the time a single probe may take.
+	storageProbeTimeout = 30 * time.Second
+
+	// storageProbeKey is the canary object written and read by the probe.
+	storageProbeKey = storage.CanaryPrefix + "canary"
+)
+
+// StorageProbeController is a controller that writes, reads and deletes a
+// small canary object in the registry storage from time to time. It tells
+// whether the storage is reachable with the current credentials, something
+// the registry health checks only report through the readiness of its pods.
+type StorageProbeController struct {
+	kubeconfig          *restclient.Config
+	operatorClient      v1helpers.OperatorClient
+	configLister        imageregistryv1listers.ConfigLister
+	storageListers      *regopclient.StorageListers
+	featureGateAccessor featuregates.FeatureGateAccess
+	caches              []cache.InformerSynced
+}
+
+// NewStorageProbeController returns a new StorageProbeController.
+func NewStorageProbeController(
+	kubeconfig *restclient.Config,
+	operatorClient v1helpers.OperatorClient,
+	kubeInformerFactory kubeinformers.SharedInformerFactory,
+	regopInformerFactory imageregistryinformers.SharedInformerFactory,
+	configInformerFactory configinformers.SharedInformerFactory,
+	openshiftConfigKubeInformerFactory kubeinformers.SharedInformerFactory,
+	openshiftConfigManagedKubeInformerFactory kubeinformers.SharedInformerFactory,
+	featureGateAccessor featuregates.FeatureGateAccess,
+) *StorageProbeController {
+	configInformer := regopInformerFactory.Imageregistry().V1().Configs()
+	secretInformer := kubeInformerFactory.Core().V1().Secrets()
+	infraInformer := configInformerFactory.Config().V1().Infrastructures()
+	openshiftConfigInformer := openshiftConfigKubeInformerFactory.Core().V1().ConfigMaps()
+	openshiftConfigManagedInformer := openshiftConfigManagedKubeInformerFactory.Core().V1().ConfigMaps()
+
+	return &StorageProbeController{
+		kubeconfig:     kubeconfig,
+		operatorClient: operatorClient,
+		configLister:   configInformer.Lister(),
+		storageListers: &regopclient.StorageListers{
+			Secrets:                secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+			Infrastructures:        infraInformer.Lister(),
+			OpenShiftConfig:        openshiftConfigInformer.Lister().ConfigMaps(defaults.OpenShiftConfigNamespace),
+			OpenShiftConfigManaged: openshiftConfigManagedInformer.Lister().ConfigMaps(defaults.OpenShiftConfigManagedNamespace),
+		},
+		featureGateAccessor: featureGateAccessor,
+		caches: []cache.InformerSynced{
+			configInformer.Informer().HasSynced,
+			secretInformer.Informer().HasSynced,
+			infraInformer.Informer().HasSynced,
+			openshiftConfigInformer.Informer().HasSynced,
+			openshiftConfigManagedInformer.Informer().HasSynced,
+		},
+	}
+}
+
+// probe runs the canary operations against the storage in use and reports
+// the outcome on the image registry config status.
+func (c *StorageProbeController) probe(ctx context.Context) {
+	cr, err := c.configLister.Get(defaults.ImageRegistryResourceName)
+	if err != nil {
+		klog.Errorf("unable to get image registry config: %s", err)
+		return
+	}
+
+	prober, stype, err := c.prober(cr)
+	if err != nil {
+		klog.Errorf("unable to get storage driver: %s", err)
+		c.updateCondition(ctx, cr, operatorv1.ConditionUnknown, "DriverError", err.Error())
+		return
+	}
+	if prober == nil {
+		c.removeCondition(ctx, cr)
+		return
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, storageProbeTimeout)
+	defer cancel()
+
+	if reason, err := probeStorage(probeCtx, prober, stype); err != nil {
+		klog.Warningf("storage probe failed: %s", err)
+		c.updateCondition(ctx, cr, operatorv1.ConditionFalse, reason, err.Error())
+		return
+	}
+	c.updateCondition(ctx, cr, operatorv1.ConditionTrue, "ProbeSucceeded", "The operator is able to write, read and delete objects in the storage")
+}
+
+// prober returns the driver used to probe the storage and the storage type.
+// No driver is returned when the storage is not meant to be probed: when
+// it is not provisioned yet, or when it lives in a volume the operator does
+// not mount.
+func (c *StorageProbeController) prober(cr *imageregistryv1.Config) (storage.ObjectStore, string, error) {
+	if cr.Spec.ManagementState == operatorv1.Removed {
+		return nil, "", nil
+	}
+	storageExists := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageExists)
+	if storageExists == nil || storageExists.Status != operatorv1.ConditionTrue {
+		return nil, "", nil
+	}
+	// volumes are not mounted by the operator.
+	if cr.Status.Storage.EmptyDir != nil || cr.Status.Storage.PVC != nil {
+		return nil, "", nil
+	}
+
+	driver, err := storage.NewDriver(&cr.Status.Storage, c.kubeconfig, c.storageListers, c.featureGateAccessor)
+	if err == storage.ErrStorageNotConfigured {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	prober, ok := driver.(storage.ObjectStore)
+	if !ok {
+		return nil, "", nil
+	}
+	return prober, storageTypeName(&cr.Status.Storage), nil
+}
+
+// probeStorage writes, reads back and deletes the canary object. On failure
+// it returns the reason for the StorageReachable condition.
+func probeStorage(ctx context.Context, prober storage.ObjectStore, stype string) (string, error) {
+	observe := func(operation string, f func() error) error {
+		start := time.Now()
+		err := f()
+		metrics.ObserveStorageProbe(stype, operation, time.Since(start).Seconds(), err != nil)
+		return err
+	}
+
+	data := []byte(time.Now().UTC().Format(time.RFC3339Nano))
+	if err := observe("write", func() error {
+		return prober.PutObject(ctx, storageProbeKey, data)
+	}); err != nil {
+		return "WriteFailed", fmt.Errorf("unable to write canary object %s: %w", storageProbeKey, err)
+	}
+
+	var content []byte
+	if err := observe("read", func() (err error) {
+		content, err = prober.GetObject(ctx, storageProbeKey)
+		return err
+	}); err != nil {
+		return "ReadFailed", fmt.Errorf("unable to read canary object %s: %w", storageProbeKey, err)
+	}
+	if !bytes.Equal(content, data) {
+		return "ContentMismatch", fmt.Errorf("canary object %s does not hold what was written", storageProbeKey)
+	}
+
+	if err := observe("delete", func() error {
+		return prober.DeleteObject(ctx, storageProbeKey)
+	}); err != nil {
+		return "DeleteFailed", fmt.Errorf("unable to delete canary object %s: %w", storageProbeKey, err)
+	}
+	return "", nil
+}
+
+func (c *StorageProbeController) updateCondition(ctx context.Context, cr *imageregistryv1.Config, status operatorv1.ConditionStatus, reason, message string) {
+	cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageReachable)
+	if cond != nil && cond.Status == status && cond.Reason == reason && cond.Message == message {
+		return
+	}
+	if _, _, err := v1helpers.UpdateStatus(
+		ctx,
+		c.operatorClient,
+		v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+			Type:    defaults.StorageReachable,
+			Status:  status,
+			Reason:  reason,
+			Message: message,
+		}),
+	); err != nil {
+		klog.Errorf("unable to update %s condition: %s", defaults.StorageReachable, err)
+	}
+}
+
+func (c *StorageProbeController) removeCondition(ctx context.Context, cr *imageregistryv1.Config) {
+	if v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageReachable) == nil {
+		return
+	}
+	if _, _, err := v1helpers.UpdateStatus(
+		ctx,
+		c.operatorClient,
+		func(oldStatus *operatorv1.OperatorStatus) error {
+			v1helpers.RemoveOperatorCondition(&oldStatus.Conditions, defaults.StorageReachable)
+			return nil
+		},
+	); err != nil {
+		klog.Errorf("unable to remove %s condition: %s", defaults.StorageReachable, err)
+	}
+}
+
+// Run starts this controller. Runs the main loop in a separate go routine and bails out when
+// the provided context is finished.
+func (c *StorageProbeController) Run(ctx context.Context) {
+	klog.Infof("Starting StorageProbeController")
+	if !cache.WaitForCacheSync(ctx.Done(), c.caches...) {
+		return
+	}
+
+	go wait.UntilWithContext(ctx, c.probe, storageProbeInterval)
+	klog.Infof("Started StorageProbeController")
+	<-ctx.Done()
+	klog.Infof("Shutting down StorageProbeController")
+}
@@ -0,0 +1,94 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type fakeProber struct {
+	objects map[string][]byte
+	corrupt bool
+	failOn  string
+}
+
+func (p *fakeProber) PutObject(ctx context.Context, key string, data []byte) error {
+	if p.failOn == "write" {
+		return errors.New("access denied")
+	}
+	if p.corrupt {
+		data = append([]byte{}, data[1:]...)
+	}
+	p.objects[key] = data
+	return nil
+}
+
+func (p *fakeProber) GetObject(ctx context.Context, key string) ([]byte, error) {
+	if p.failOn == "read" {
+		return nil, errors.New("timeout")
+	}
+	data, ok := p.objects[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return data, nil
+}
+
+func (p *fakeProber) DeleteObject(ctx context.Context, key string) error {
+	if p.failOn == "delete" {
+		return errors.New("access denied")
+	}
+	delete(p.objects, key)
+	return nil
+}
+
+func TestProbeStorage(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		prober   *fakeProber
+		reason   string
+		leftover bool
+	}{
+		{
+			name:   "reachable",
+			prober: &fakeProber{},
+		},
+		{
+			name:   "write fails",
+			prober: &fakeProber{failOn: "write"},
+			reason: "WriteFailed",
+		},
+		{
+			name:     "read fails",
+			prober:   &fakeProber{failOn: "read"},
+			reason:   "ReadFailed",
+			leftover: true,
+		},
+		{
+			name:     "content mismatch",
+			prober:   &fakeProber{corrupt: true},
+			reason:   "ContentMismatch",
+			leftover: true,
+		},
+		{
+			name:     "delete fails",
+			prober:   &fakeProber{failOn: "delete"},
+			reason:   "DeleteFailed",
+			leftover: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.prober.objects = map[string][]byte{}
+			reason, err := probeStorage(context.Background(), tc.prober, "S3")
+			if reason != tc.reason {
+				t.Errorf("got reason %q, want %q", reason, tc.reason)
+			}
+			if (err != nil) != (tc.reason != "") {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if _, ok := tc.prober.objects[storageProbeKey]; ok != tc.leftover {
+				t.Errorf("canary object left behind: %t, want %t", ok, tc.leftover)
+			}
+		})
+	}
+}
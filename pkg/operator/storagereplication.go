@@ -0,0 +1,218 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configinformers "github.com/openshift/client-go/config/informers/externalversions"
+	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	// storageReplicationInterval is how often the replication is checked.
+	// The canary object written by a check is expected to be replicated
+	// by the next one.
+	storageReplicationInterval = 5 * time.Minute
+
+	// storageReplicationTimeout bounds the time a single check may take.
+	storageReplicationTimeout = 30 * time.Second
+
+	// storageReplicationKey is the canary object whose replication is
+	// checked.
+	storageReplicationKey = storage.CanaryPrefix + "replication-canary"
+)
+
+// StorageReplicationController is a controller that tells whether the
+// objects written to a replicated storage reach the replica. It writes a
+// canary object on every run and looks at the replication status of the
+// one written by the previous run.
+type StorageReplicationController struct {
+	kubeconfig          *restclient.Config
+	operatorClient      v1helpers.OperatorClient
+	configLister        imageregistryv1listers.ConfigLister
+	storageListers      *regopclient.StorageListers
+	featureGateAccessor featuregates.FeatureGateAccess
+	caches              []cache.InformerSynced
+}
+
+// NewStorageReplicationController returns a new StorageReplicationController.
+func NewStorageReplicationController(
+	kubeconfig *restclient.Config,
+	operatorClient v1helpers.OperatorClient,
+	kubeInformerFactory kubeinformers.SharedInformerFactory,
+	regopInformerFactory imageregistryinformers.SharedInformerFactory,
+	configInformerFactory configinformers.SharedInformerFactory,
+	openshiftConfigKubeInformerFactory kubeinformers.SharedInformerFactory,
+	openshiftConfigManagedKubeInformerFactory kubeinformers.SharedInformerFactory,
+	featureGateAccessor featuregates.FeatureGateAccess,
+) *StorageReplicationController {
+	configInformer := regopInformerFactory.Imageregistry().V1().Configs()
+	secretInformer := kubeInformerFactory.Core().V1().Secrets()
+	infraInformer := configInformerFactory.Config().V1().Infrastructures()
+	openshiftConfigInformer := openshiftConfigKubeInformerFactory.Core().V1().ConfigMaps()
+	openshiftConfigManagedInformer := openshiftConfigManagedKubeInformerFactory.Core().V1().ConfigMaps()
+
+	return &StorageReplicationController{
+		kubeconfig:     kubeconfig,
+		operatorClient: operatorClient,
+		configLister:   configInformer.Lister(),
+		storageListers: &regopclient.StorageListers{
+			Secrets:                secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+			Infrastructures:        infraInformer.Lister(),
+			OpenShiftConfig:        openshiftConfigInformer.Lister().ConfigMaps(defaults.OpenShiftConfigNamespace),
+			OpenShiftConfigManaged: openshiftConfigManagedInformer.Lister().ConfigMaps(defaults.OpenShiftConfigManagedNamespace),
+		},
+		featureGateAccessor: featureGateAccessor,
+		caches: []cache.InformerSynced{
+			configInformer.Informer().HasSynced,
+			secretInformer.Informer().HasSynced,
+			infraInformer.Informer().HasSynced,
+			openshiftConfigInformer.Informer().HasSynced,
+			openshiftConfigManagedInformer.Informer().HasSynced,
+		},
+	}
+}
+
+// sync checks the replication of the storage in use and reports it on the
+// image registry config status.
+func (c *StorageReplicationController) sync(ctx context.Context) {
+	cr, err := c.configLister.Get(defaults.ImageRegistryResourceName)
+	if err != nil {
+		klog.Errorf("unable to get image registry config: %s", err)
+		return
+	}
+
+	checker, stype, err := c.checker(cr)
+	if err != nil {
+		klog.Errorf("unable to get storage driver: %s", err)
+		c.updateCondition(ctx, cr, operatorv1.ConditionUnknown, "DriverError", err.Error())
+		return
+	}
+	if checker == nil {
+		metrics.ResetStorageReplication()
+		c.removeCondition(ctx, cr)
+		return
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, storageReplicationTimeout)
+	defer cancel()
+
+	status, reason, message := checkStorageReplication(checkCtx, checker, stype)
+	c.updateCondition(ctx, cr, status, reason, message)
+}
+
+// checker returns the driver used to check the replication and the storage
+// type. No driver is returned unless the operator replicates the storage.
+func (c *StorageReplicationController) checker(cr *imageregistryv1.Config) (storage.ReplicationChecker, string, error) {
+	if cr.Spec.ManagementState == operatorv1.Removed {
+		return nil, "", nil
+	}
+	replication := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageReplicationEnabled)
+	if replication == nil || replication.Status != operatorv1.ConditionTrue {
+		return nil, "", nil
+	}
+
+	driver, err := storage.NewDriver(&cr.Status.Storage, c.kubeconfig, c.storageListers, c.featureGateAccessor)
+	if err == storage.ErrStorageNotConfigured {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	checker, ok := driver.(storage.ReplicationChecker)
+	if !ok {
+		return nil, "", nil
+	}
+	return checker, storageTypeName(&cr.Status.Storage), nil
+}
+
+// checkStorageReplication checks the replication of the canary object and
+// returns the StorageReplicationHealthy condition to report. The outcome is
+// also reported through metrics.
+func checkStorageReplication(ctx context.Context, checker storage.ReplicationChecker, stype string) (operatorv1.ConditionStatus, string, string) {
+	status, err := checker.CheckReplication(ctx, storageReplicationKey)
+	switch {
+	case err != nil:
+		klog.Warningf("storage replication check failed: %s", err)
+		metrics.ReportStorageReplication(stype, "error", false)
+		return operatorv1.ConditionUnknown, "CheckFailed", fmt.Sprintf("Unable to check the replication of the storage: %s", err)
+	case status == util.ReplicationUnknown:
+		// nothing to look at before the next check.
+		return operatorv1.ConditionUnknown, "Checking", "The replication of the canary object is being checked"
+	case status == util.ReplicationCompleted:
+		metrics.ReportStorageReplication(stype, "completed", true)
+		return operatorv1.ConditionTrue, "ReplicationCompleted", "The objects written to the storage reach its replica"
+	case status == util.ReplicationPending:
+		metrics.ReportStorageReplication(stype, "pending", false)
+		return operatorv1.ConditionFalse, "ReplicationLagging", fmt.Sprintf("The canary object %s is not replicated after %s", storageReplicationKey, storageReplicationInterval)
+	default:
+		metrics.ReportStorageReplication(stype, "failed", false)
+		return operatorv1.ConditionFalse, "ReplicationFailed", fmt.Sprintf("The canary object %s could not be replicated, check the replication role permissions", storageReplicationKey)
+	}
+}
+
+func (c *StorageReplicationController) updateCondition(ctx context.Context, cr *imageregistryv1.Config, status operatorv1.ConditionStatus, reason, message string) {
+	cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageReplicationHealthy)
+	if cond != nil && cond.Status == status && cond.Reason == reason && cond.Message == message {
+		return
+	}
+	if _, _, err := v1helpers.UpdateStatus(
+		ctx,
+		c.operatorClient,
+		v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+			Type:    defaults.StorageReplicationHealthy,
+			Status:  status,
+			Reason:  reason,
+			Message: message,
+		}),
+	); err != nil {
+		klog.Errorf("unable to update %s condition: %s", defaults.StorageReplicationHealthy, err)
+	}
+}
+
+func (c *StorageReplicationController) removeCondition(ctx context.Context, cr *imageregistryv1.Config) {
+	if v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageReplicationHealthy) == nil {
+		return
+	}
+	if _, _, err := v1helpers.UpdateStatus(
+		ctx,
+		c.operatorClient,
+		func(oldStatus *operatorv1.OperatorStatus) error {
+			v1helpers.RemoveOperatorCondition(&oldStatus.Conditions, defaults.StorageReplicationHealthy)
+			return nil
+		},
+	); err != nil {
+		klog.Errorf("unable to remove %s condition: %s", defaults.StorageReplicationHealthy, err)
+	}
+}
+
+// Run starts this controller. Runs the main loop in a separate go routine and bails out when
+// the provided context is finished.
+func (c *StorageReplicationController) Run(ctx context.Context) {
+	klog.Infof("Starting StorageReplicationController")
+	if !cache.WaitForCacheSync(ctx.Done(), c.caches...) {
+		return
+	}
+
+	go wait.UntilWithContext(ctx, c.sync, storageReplicationInterval)
+	klog.Infof("Started StorageReplicationController")
+	<-ctx.Done()
+	klog.Infof("Shutting down StorageReplicationController")
+}
@@ -0,0 +1,72 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+type fakeReplicationChecker struct {
+	status util.ReplicationStatus
+	err    error
+	keys   []string
+}
+
+func (c *fakeReplicationChecker) CheckReplication(ctx context.Context, key string) (util.ReplicationStatus, error) {
+	c.keys = append(c.keys, key)
+	return c.status, c.err
+}
+
+func TestCheckStorageReplication(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		checker *fakeReplicationChecker
+		status  operatorv1.ConditionStatus
+		reason  string
+	}{
+		{
+			name:    "first check",
+			checker: &fakeReplicationChecker{status: util.ReplicationUnknown},
+			status:  operatorv1.ConditionUnknown,
+			reason:  "Checking",
+		},
+		{
+			name:    "replicated",
+			checker: &fakeReplicationChecker{status: util.ReplicationCompleted},
+			status:  operatorv1.ConditionTrue,
+			reason:  "ReplicationCompleted",
+		},
+		{
+			name:    "lagging",
+			checker: &fakeReplicationChecker{status: util.ReplicationPending},
+			status:  operatorv1.ConditionFalse,
+			reason:  "ReplicationLagging",
+		},
+		{
+			name:    "failed",
+			checker: &fakeReplicationChecker{status: util.ReplicationFailed},
+			status:  operatorv1.ConditionFalse,
+			reason:  "ReplicationFailed",
+		},
+		{
+			name:    "check fails",
+			checker: &fakeReplicationChecker{err: errors.New("access denied")},
+			status:  operatorv1.ConditionUnknown,
+			reason:  "CheckFailed",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status, reason, message := checkStorageReplication(context.Background(), tc.checker, "S3")
+			if status != tc.status || reason != tc.reason {
+				t.Errorf("expected %s/%s, got %s/%s: %s", tc.status, tc.reason, status, reason, message)
+			}
+			if len(tc.checker.keys) != 1 || tc.checker.keys[0] != storageReplicationKey {
+				t.Errorf("expected the canary object %s to be checked, got %v", storageReplicationKey, tc.checker.keys)
+			}
+		})
+	}
+}
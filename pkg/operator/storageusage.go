@@ -0,0 +1,311 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	batchv1listers "k8s.io/client-go/listers/batch/v1"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configinformers "github.com/openshift/client-go/config/informers/externalversions"
+	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+const (
+	// storageUsageListRate is the number of listing requests per second the
+	// drivers are allowed to send while measuring the storage usage.
+	storageUsageListRate = 10
+
+	// storageUsageJobTimeout is how long we wait for the job measuring a
+	// persistent volume claim to complete.
+	storageUsageJobTimeout = 10 * time.Minute
+)
+
+// StorageUsageController is a controller that runs from time to time and
+// measures the amount of data the registry keeps in its storage. Cloud
+// storage is measured by listing the registry objects, volume claims are
+// walked through a short-lived job.
+type StorageUsageController struct {
+	kubeconfig          *restclient.Config
+	batchClient         batchv1client.BatchV1Interface
+	coreClient          corev1client.CoreV1Interface
+	operatorClient      v1helpers.OperatorClient
+	configLister        imageregistryv1listers.ConfigLister
+	jobLister           batchv1listers.JobNamespaceLister
+	storageListers      *regopclient.StorageListers
+	featureGateAccessor featuregates.FeatureGateAccess
+	limiter             *rate.Limiter
+	caches              []cache.InformerSynced
+}
+
+// NewStorageUsageController returns a new StorageUsageController.
+func NewStorageUsageController(
+	kubeconfig *restclient.Config,
+	batchClient batchv1client.BatchV1Interface,
+	coreClient corev1client.CoreV1Interface,
+	operatorClient v1helpers.OperatorClient,
+	kubeInformerFactory kubeinformers.SharedInformerFactory,
+	regopInformerFactory imageregistryinformers.SharedInformerFactory,
+	configInformerFactory configinformers.SharedInformerFactory,
+	openshiftConfigKubeInformerFactory kubeinformers.SharedInformerFactory,
+	openshiftConfigManagedKubeInformerFactory kubeinformers.SharedInformerFactory,
+	featureGateAccessor featuregates.FeatureGateAccess,
+) *StorageUsageController {
+	configInformer := regopInformerFactory.Imageregistry().V1().Configs()
+	jobInformer := kubeInformerFactory.Batch().V1().Jobs()
+	secretInformer := kubeInformerFactory.Core().V1().Secrets()
+	infraInformer := configInformerFactory.Config().V1().Infrastructures()
+	openshiftConfigInformer := openshiftConfigKubeInformerFactory.Core().V1().ConfigMaps()
+	openshiftConfigManagedInformer := openshiftConfigManagedKubeInformerFactory.Core().V1().ConfigMaps()
+
+	return &StorageUsageController{
+		kubeconfig:     kubeconfig,
+		batchClient:    batchClient,
+		coreClient:     coreClient,
+		operatorClient: operatorClient,
+		configLister:   configInformer.Lister(),
+		jobLister:      jobInformer.Lister().Jobs(defaults.ImageRegistryOperatorNamespace),
+		storageListers: &regopclient.StorageListers{
+			Secrets:                secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+			Infrastructures:        infraInformer.Lister(),
+			OpenShiftConfig:        openshiftConfigInformer.Lister().ConfigMaps(defaults.OpenShiftConfigNamespace),
+			OpenShiftConfigManaged: openshiftConfigManagedInformer.Lister().ConfigMaps(defaults.OpenShiftConfigManagedNamespace),
+		},
+		featureGateAccessor: featureGateAccessor,
+		limiter:             rate.NewLimiter(storageUsageListRate, 1),
+		caches: []cache.InformerSynced{
+			configInformer.Informer().HasSynced,
+			jobInformer.Informer().HasSynced,
+			secretInformer.Informer().HasSynced,
+			infraInformer.Informer().HasSynced,
+			openshiftConfigInformer.Informer().HasSynced,
+			openshiftConfigManagedInformer.Informer().HasSynced,
+		},
+	}
+}
+
+// report measures the storage in use and reports it both as metrics and on
+// the image registry config status.
+func (c *StorageUsageController) report(ctx context.Context) {
+	cr, err := c.configLister.Get(defaults.ImageRegistryResourceName)
+	if err != nil {
+		klog.Errorf("unable to get image registry config: %s", err)
+		return
+	}
+	if cr.Spec.ManagementState == operatorv1.Removed {
+		return
+	}
+
+	stype := storageTypeName(&cr.Status.Storage)
+	if stype == "" || stype == "EmptyDir" {
+		// there is nothing worth measuring in an emptyDir.
+		return
+	}
+
+	bytes, objects, err := c.measure(ctx, cr)
+	if err != nil {
+		klog.Errorf("unable to measure storage usage: %s", err)
+		c.updateCondition(ctx, operatorv1.ConditionUnknown, "MeasureFailed", fmt.Sprintf("Unable to measure the %s storage usage: %s", stype, err))
+		return
+	}
+
+	metrics.ReportStorageUsage(stype, float64(bytes), float64(objects))
+	message := fmt.Sprintf("The registry stores %s in %d objects on %s storage", formatBytes(bytes), objects, stype)
+
+	used, quota, err := c.quota(ctx, cr)
+	if err != nil {
+		klog.Errorf("unable to get storage quota: %s", err)
+	}
+	if quota > 0 {
+		metrics.ReportStorageQuota(stype, float64(used), float64(quota))
+		message += ", " + quotaUsageMessage(used, quota)
+	} else {
+		metrics.ResetStorageQuota()
+	}
+	c.updateCondition(ctx, operatorv1.ConditionTrue, "Measured", message)
+}
+
+// quota returns the number of bytes accounted against the quota of the
+// storage, and the quota. A zero quota is returned when the storage has none
+// or the driver can't tell.
+func (c *StorageUsageController) quota(ctx context.Context, cr *imageregistryv1.Config) (int64, int64, error) {
+	if cr.Status.Storage.PVC != nil {
+		return 0, 0, nil
+	}
+
+	driver, err := storage.NewDriver(&cr.Status.Storage, c.kubeconfig, c.storageListers, c.featureGateAccessor)
+	if err != nil {
+		return 0, 0, err
+	}
+	reporter, ok := driver.(storage.QuotaReporter)
+	if !ok {
+		return 0, 0, nil
+	}
+	return reporter.StorageQuota(ctx)
+}
+
+// quotaUsageMessage tells how much of the quota of the storage is used.
+func quotaUsageMessage(used, quota int64) string {
+	return fmt.Sprintf("%s of its %s quota are used (%.0f%%)", formatBytes(used), formatBytes(quota), 100*float64(used)/float64(quota))
+}
+
+// measure returns the number of bytes and objects the registry keeps in its
+// storage.
+func (c *StorageUsageController) measure(ctx context.Context, cr *imageregistryv1.Config) (int64, int64, error) {
+	if cr.Status.Storage.PVC != nil {
+		return c.measureClaim(ctx, cr)
+	}
+
+	driver, err := storage.NewDriver(&cr.Status.Storage, c.kubeconfig, c.storageListers, c.featureGateAccessor)
+	if err != nil {
+		return 0, 0, err
+	}
+	reporter, ok := driver.(storage.UsageReporter)
+	if !ok {
+		return 0, 0, fmt.Errorf("storage usage is not supported by the driver")
+	}
+	return reporter.StorageUsage(ctx, c.limiter)
+}
+
+// measureClaim runs the job walking the volume claim and waits for its
+// report. The job is removed once it is done.
+func (c *StorageUsageController) measureClaim(ctx context.Context, cr *imageregistryv1.Config) (int64, int64, error) {
+	gen := resource.NewGeneratorStorageUsageJob(c.jobLister, c.batchClient, c.coreClient, cr)
+	if err := resource.ApplyMutator(gen); err != nil {
+		return 0, 0, fmt.Errorf("unable to apply storage usage job: %w", err)
+	}
+	defer func() {
+		propagationPolicy := metav1.DeletePropagationBackground
+		if err := gen.Delete(metav1.DeleteOptions{PropagationPolicy: &propagationPolicy}); err != nil {
+			klog.Errorf("unable to delete storage usage job: %s", err)
+		}
+	}()
+
+	err := wait.PollUntilContextTimeout(ctx, 10*time.Second, storageUsageJobTimeout, true, func(ctx context.Context) (bool, error) {
+		job, err := c.batchClient.Jobs(defaults.ImageRegistryOperatorNamespace).Get(ctx, defaults.StorageUsageJobName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, cond := range job.Status.Conditions {
+			if cond.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch cond.Type {
+			case batchv1.JobComplete:
+				return true, nil
+			case batchv1.JobFailed:
+				return false, fmt.Errorf("storage usage job failed: %s", cond.Message)
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	pods, err := c.coreClient.Pods(defaults.ImageRegistryOperatorNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "job-name=" + defaults.StorageUsageJobName,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Terminated != nil {
+				return resource.ParseStorageUsage(status.State.Terminated.Message)
+			}
+		}
+	}
+	return 0, 0, errors.New("unable to find the storage usage job report")
+}
+
+func (c *StorageUsageController) updateCondition(ctx context.Context, status operatorv1.ConditionStatus, reason, message string) {
+	if _, _, err := v1helpers.UpdateStatus(
+		ctx,
+		c.operatorClient,
+		v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+			Type:    defaults.StorageUsage,
+			Status:  status,
+			Reason:  reason,
+			Message: message,
+		}),
+	); err != nil {
+		klog.Errorf("unable to update %s condition: %s", defaults.StorageUsage, err)
+	}
+}
+
+// storageTypeName returns the name of the configured storage, as it is
+// reported by the storage type metric.
+func storageTypeName(cfg *imageregistryv1.ImageRegistryConfigStorage) string {
+	switch {
+	case cfg.EmptyDir != nil:
+		return "EmptyDir"
+	case cfg.S3 != nil:
+		return "S3"
+	case cfg.Swift != nil:
+		return "Swift"
+	case cfg.GCS != nil:
+		return "GCS"
+	case cfg.IBMCOS != nil:
+		return "IBMCOS"
+	case cfg.Azure != nil:
+		return "Azure"
+	case cfg.PVC != nil:
+		return "PVC"
+	}
+	return ""
+}
+
+// formatBytes returns a human readable representation of a number of bytes.
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit && exp < 5; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// Run starts this controller. Runs the main loop in a separate go routine and bails out when
+// the provided context is finished.
+func (c *StorageUsageController) Run(ctx context.Context) {
+	klog.Infof("Starting StorageUsageController")
+	if !cache.WaitForCacheSync(ctx.Done(), c.caches...) {
+		return
+	}
+
+	go wait.UntilWithContext(ctx, c.report, time.Hour)
+	klog.Infof("Started StorageUsageController")
+	<-ctx.Done()
+	klog.Infof("Shutting down StorageUsageController")
+}
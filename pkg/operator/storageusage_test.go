@@ -0,0 +1,38 @@
+package operator
+
+import (
+	"testing"
+)
+
+func TestFormatBytes(t *testing.T) {
+	for _, tc := range []struct {
+		bytes    int64
+		expected string
+	}{
+		{bytes: 0, expected: "0 B"},
+		{bytes: 1023, expected: "1023 B"},
+		{bytes: 1024, expected: "1.0 KiB"},
+		{bytes: 1536, expected: "1.5 KiB"},
+		{bytes: 5 * 1024 * 1024 * 1024, expected: "5.0 GiB"},
+		{bytes: 3 * 1024 * 1024 * 1024 * 1024 * 1024, expected: "3.0 PiB"},
+	} {
+		if got := formatBytes(tc.bytes); got != tc.expected {
+			t.Errorf("formatBytes(%d) = %q, want %q", tc.bytes, got, tc.expected)
+		}
+	}
+}
+
+func TestQuotaUsageMessage(t *testing.T) {
+	for _, tc := range []struct {
+		used     int64
+		quota    int64
+		expected string
+	}{
+		{used: 0, quota: 1024, expected: "0 B of its 1.0 KiB quota are used (0%)"},
+		{used: 4 * 1024 * 1024 * 1024, quota: 5 * 1024 * 1024 * 1024, expected: "4.0 GiB of its 5.0 GiB quota are used (80%)"},
+	} {
+		if got := quotaUsageMessage(tc.used, tc.quota); got != tc.expected {
+			t.Errorf("quotaUsageMessage(%d, %d) = %q, want %q", tc.used, tc.quota, got, tc.expected)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	appsapi "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
@@ -111,6 +112,44 @@ func unionCondition(unionConditionType string, normalStatus operatorv1.Condition
 	return unionCondition
 }
 
+// storageReachableInertia is how long the storage may fail the operator
+// probes before the operator reports itself as degraded. Short outages of
+// the storage provider are not worth paging anybody.
+const storageReachableInertia = 5 * time.Minute
+
+// storageReachableDegraded turns an unreachable storage into a Degraded
+// condition once it has been unreachable for longer than the inertia period.
+// When it hasn't been so for long enough, it returns how long is left.
+func storageReachableDegraded(conditions []operatorv1.OperatorCondition, now time.Time) (*operatorv1.OperatorCondition, time.Duration) {
+	var reachable *operatorv1.OperatorCondition
+	for i := range conditions {
+		if conditions[i].Type == defaults.StorageReachable {
+			reachable = &conditions[i]
+		}
+	}
+	if reachable == nil || reachable.Status != operatorv1.ConditionFalse {
+		return nil, 0
+	}
+
+	if left := reachable.LastTransitionTime.Add(storageReachableInertia).Sub(now); left > 0 {
+		return nil, left
+	}
+	return &operatorv1.OperatorCondition{
+		Type:               defaults.StorageReachable + "Degraded",
+		Status:             operatorv1.ConditionTrue,
+		LastTransitionTime: reachable.LastTransitionTime,
+		Reason:             reachable.Reason,
+		Message:            reachable.Message,
+	}, 0
+}
+
+// StorageReachableRecheckAfter returns how long until an unreachable storage
+// degrades the operator, zero if it doesn't need to be checked again.
+func StorageReachableRecheckAfter(cr *imageregistryv1.Config) time.Duration {
+	_, left := storageReachableDegraded(cr.Status.Conditions, time.Now())
+	return left
+}
+
 var _ Mutator = &generatorClusterOperator{}
 
 type generatorClusterOperator struct {
@@ -218,6 +257,9 @@ func (gco *generatorClusterOperator) syncConditions(op *configv1.ClusterOperator
 	if gco.imagePruner != nil {
 		conditions = append(conditions, prefixConditions(gco.imagePruner.Status.Conditions, "ImagePruner")...)
 	}
+	if degraded, _ := storageReachableDegraded(gco.cr.Status.Conditions, time.Now()); degraded != nil {
+		conditions = append(conditions, *degraded)
+	}
 
 	oldStatus := op.Status.DeepCopy()
 	configv1helpers.SetStatusCondition(&op.Status.Conditions, unionCondition("Available", operatorv1.ConditionTrue, conditions), clock.RealClock{})
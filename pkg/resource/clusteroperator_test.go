@@ -4,6 +4,7 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	kerror "k8s.io/apimachinery/pkg/api/errors"
@@ -292,3 +293,72 @@ func TestSyncVersions(t *testing.T) {
 		})
 	}
 }
+
+func TestStorageReachableDegraded(t *testing.T) {
+	now := time.Now()
+	for _, tt := range []struct {
+		name       string
+		conditions []operatorv1.OperatorCondition
+		degraded   bool
+		recheck    bool
+	}{
+		{
+			name: "no probe",
+		},
+		{
+			name: "reachable",
+			conditions: []operatorv1.OperatorCondition{
+				{
+					Type:               defaults.StorageReachable,
+					Status:             operatorv1.ConditionTrue,
+					LastTransitionTime: metav1.NewTime(now.Add(-time.Hour)),
+				},
+			},
+		},
+		{
+			name: "unreachable within the inertia period",
+			conditions: []operatorv1.OperatorCondition{
+				{
+					Type:               defaults.StorageReachable,
+					Status:             operatorv1.ConditionFalse,
+					LastTransitionTime: metav1.NewTime(now.Add(-time.Minute)),
+				},
+			},
+			recheck: true,
+		},
+		{
+			name: "unreachable for too long",
+			conditions: []operatorv1.OperatorCondition{
+				{
+					Type:               defaults.StorageReachable,
+					Status:             operatorv1.ConditionFalse,
+					LastTransitionTime: metav1.NewTime(now.Add(-time.Hour)),
+					Reason:             "WriteFailed",
+					Message:            "access denied",
+				},
+			},
+			degraded: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cond, left := storageReachableDegraded(tt.conditions, now)
+			if (cond != nil) != tt.degraded {
+				t.Fatalf("got degraded condition %#v, expected one: %t", cond, tt.degraded)
+			}
+			if (left > 0) != tt.recheck {
+				t.Errorf("got recheck after %s, expected one: %t", left, tt.recheck)
+			}
+			if !tt.degraded {
+				return
+			}
+
+			union := unionCondition("Degraded", operatorv1.ConditionFalse, append(tt.conditions, *cond))
+			if union.Status != cfgapi.ConditionTrue {
+				t.Errorf("expected the operator to be degraded, got %#v", union)
+			}
+			if union.Reason != "StorageReachableWriteFailed" {
+				t.Errorf("unexpected reason %q", union.Reason)
+			}
+		})
+	}
+}
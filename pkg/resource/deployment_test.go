@@ -211,6 +211,10 @@ func (d *testDriver) StorageExists(*imageregistryv1.Config) (bool, error) {
 	panic("StorageExists not implemented")
 }
 
+func (d *testDriver) Validate(*imageregistryv1.Config) error {
+	return nil
+}
+
 func (d *testDriver) VolumeSecrets() (map[string]string, error) {
 	panic("VolumeSecrets not implemented")
 }
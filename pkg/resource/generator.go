@@ -124,9 +124,42 @@ func (g *Generator) List(cr *imageregistryv1.Config) ([]Mutator, error) {
 	mutators = append(mutators, newGeneratorImageRegistryNetworkPolicy(g.eventRecorder, g.listers.NetworkPolicies, g.clients.Networking, g.resourceCache))
 	mutators = append(mutators, g.listRoutes(cr)...)
 
+	if storageMigrationInProgress(cr) {
+		migrationMutators, err := g.listStorageMigration(cr, driver)
+		if err != nil {
+			return nil, err
+		}
+		mutators = append(mutators, migrationMutators...)
+	}
+
 	return mutators, nil
 }
 
+// listStorageMigration returns the mutators for the resources needed to copy
+// the registry content from the previous storage into the current one.
+func (g *Generator) listStorageMigration(cr *imageregistryv1.Config, driver storage.Driver) ([]Mutator, error) {
+	if driver == nil {
+		return nil, nil
+	}
+
+	src, err := StorageMigrationSource(cr)
+	if err != nil {
+		return nil, err
+	}
+	srcDriver, err := storage.NewDriver(src, g.kubeconfig, &g.listers.StorageListers, g.featureGateAccessor)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get driver for the storage being migrated from: %s", err)
+	}
+
+	source := newStorageMigrationSource(srcDriver)
+	destination := newStorageMigrationDestination(driver)
+
+	return []Mutator{
+		newGeneratorStorageMigrationSecret(g.listers.Secrets, g.clients.Core, source, destination),
+		newGeneratorStorageMigrationJob(g.listers.Jobs, g.listers.ProxyConfigs, g.clients.Batch, g.clients.Core, cr, source, destination),
+	}, nil
+}
+
 // syncStorage checks:
 // 1.)  to make sure that an existing storage medium still exists and we can access it
 // 2.)  to see if the storage medium name changed and we need to:
@@ -161,12 +194,30 @@ func (g *Generator) syncStorage(cr *imageregistryv1.Config) error {
 	}
 
 	if runCreate {
-		reconf := g.storageReconfigured(cr, g.kubeconfig, g.listers)
-		if err := driver.CreateStorage(cr); err != nil {
+		if err := validateStoragePermissions(cr, driver); err != nil {
+			return err
+		}
+
+		var owner storageOwner
+		if _, ok := driver.(storage.ObjectStore); ok {
+			if owner, err = g.currentStorageOwner(); err != nil {
+				return fmt.Errorf("unable to get storage owner: %w", err)
+			}
+			if err := checkStorageOwnership(cr, driver, owner); err != nil {
+				return err
+			}
+		}
+
+		prev := cr.Status.Storage.DeepCopy()
+		reconf := g.storageReconfigured(cr)
+		if err := createAndClaimStorage(cr, driver, owner); err != nil {
 			return err
 		}
 		if reconf {
 			metrics.StorageReconfigured()
+			if err := g.startStorageMigration(cr, prev); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -175,16 +226,19 @@ func (g *Generator) syncStorage(cr *imageregistryv1.Config) error {
 
 // storageReconfigured returns true if we are, based on the provided config,
 // starting to use a different underlying storage location.
-func (g *Generator) storageReconfigured(
-	regCfg *imageregistryv1.Config,
-	restCfg *rest.Config,
-	listers *client.Listers,
-) bool {
-	prev, err := storage.NewDriver(&regCfg.Status.Storage, restCfg, &listers.StorageListers, g.featureGateAccessor)
+func (g *Generator) storageReconfigured(cr *imageregistryv1.Config) bool {
+	return g.storageLocationsDiffer(&cr.Status.Storage, &cr.Spec.Storage)
+}
+
+// storageLocationsDiffer returns true if the provided storage configurations
+// point to different underlying storage locations. Configurations we can't
+// build a driver for are not considered to differ.
+func (g *Generator) storageLocationsDiffer(a, b *imageregistryv1.ImageRegistryConfigStorage) bool {
+	prev, err := storage.NewDriver(a, g.kubeconfig, &g.listers.StorageListers, g.featureGateAccessor)
 	if err != nil {
 		return false
 	}
-	cur, err := storage.NewDriver(&regCfg.Spec.Storage, restCfg, &listers.StorageListers, g.featureGateAccessor)
+	cur, err := storage.NewDriver(b, g.kubeconfig, &g.listers.StorageListers, g.featureGateAccessor)
 	if err != nil {
 		return false
 	}
@@ -239,6 +293,10 @@ func (g *Generator) Apply(cr *imageregistryv1.Config) error {
 		return fmt.Errorf("unable to sync storage configuration: %s", err)
 	}
 
+	if err := g.syncStorageMigration(cr); err != nil {
+		return fmt.Errorf("unable to sync storage migration: %s", err)
+	}
+
 	// XXX https://bugzilla.redhat.com/show_bug.cgi?id=1833109
 	// Migrates the old Status.StorageChanged into the new customizable
 	// Spec.Storage.ManagementState if the storage did not do it already.
@@ -307,6 +365,15 @@ func (g *Generator) Remove(cr *imageregistryv1.Config) error {
 		return err
 	}
 
+	// emptying a storage may take longer than any request we are willing
+	// to wait on, it is left to a job. Remove is called again until the
+	// job is done.
+	if storageRemovableByJob(cr, driver) {
+		if err := g.removeStorageContent(cr, driver); err != nil {
+			return err
+		}
+	}
+
 	var derr error
 	var retriable bool
 	err = wait.PollUntilContextTimeout(context.Background(), 1*time.Second, 5*time.Minute, true,
@@ -233,7 +233,9 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 		corev1.EnvVar{Name: "REGISTRY_OPENSHIFT_SERVER_ADDR", Value: fmt.Sprintf("%s.%s.svc:%d", defaults.ServiceName, defaults.ImageRegistryOperatorNamespace, defaults.ContainerPort)},
 	)
 
-	if cr.Spec.ReadOnly {
+	// while the content is being copied from a previous storage medium we
+	// can't accept writes, they would be lost once the copy is done.
+	if cr.Spec.ReadOnly || storageMigrationInProgress(cr) {
 		env = append(env, corev1.EnvVar{Name: "REGISTRY_STORAGE_MAINTENANCE_READONLY", Value: "{enabled: true}"})
 	}
 
@@ -0,0 +1,352 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	storageMigrationReasonInProgress     = "InProgress"
+	storageMigrationReasonCompleted      = "Completed"
+	storageMigrationReasonFailed         = "Failed"
+	storageMigrationReasonNotMigratable  = "SourceNotMigratable"
+	storageMigrationReasonNotRequired    = "NotRequired"
+	storageMigrationMountRoot            = "/storage-migration"
+	storageMigrationCABundleKey          = "ca-bundle.pem"
+	storageMigrationSourceEnvPrefix      = "SOURCE_"
+	storageMigrationDestinationEnvPrefix = "DESTINATION_"
+)
+
+// storageMigrationEndpoint is one of the sides (source or destination) of a
+// storage migration. As both sides may be served by the same kind of storage
+// driver, everything a driver asks for (environment variables, secret keys
+// and volumes) is renamed so the two sides can live in the same pod.
+type storageMigrationEndpoint struct {
+	// name is used to prefix volume names.
+	name string
+	// envPrefix is prepended to environment variables and secret keys.
+	envPrefix string
+	// mountRoot is the directory under which the driver volumes are
+	// mounted.
+	mountRoot string
+	// secretName is the secret holding the sensitive data of the
+	// endpoint.
+	secretName string
+	driver     storage.Driver
+}
+
+func newStorageMigrationSource(driver storage.Driver) *storageMigrationEndpoint {
+	return &storageMigrationEndpoint{
+		name:       "source",
+		envPrefix:  storageMigrationSourceEnvPrefix,
+		mountRoot:  filepath.Join(storageMigrationMountRoot, "source"),
+		secretName: defaults.StorageMigrationSecretName,
+		driver:     driver,
+	}
+}
+
+func newStorageMigrationDestination(driver storage.Driver) *storageMigrationEndpoint {
+	return &storageMigrationEndpoint{
+		name:       "destination",
+		envPrefix:  storageMigrationDestinationEnvPrefix,
+		mountRoot:  filepath.Join(storageMigrationMountRoot, "destination"),
+		secretName: defaults.StorageMigrationSecretName,
+		driver:     driver,
+	}
+}
+
+// configEnv returns the driver configuration with its names prefixed and
+// with any path pointing into one of the driver volumes relocated under the
+// endpoint mount root.
+func (e *storageMigrationEndpoint) configEnv() ([]corev1.EnvVar, error) {
+	configenv, err := e.driver.ConfigEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	_, mounts, err := e.driver.Volumes()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range configenv {
+		configenv[i].Name = e.envPrefix + configenv[i].Name
+		value, ok := configenv[i].Value.(string)
+		if !ok || configenv[i].Secret {
+			continue
+		}
+		for _, mount := range mounts {
+			if value == mount.MountPath || strings.HasPrefix(value, mount.MountPath+"/") {
+				configenv[i].Value = filepath.Join(e.mountRoot, value)
+				break
+			}
+		}
+	}
+
+	return configenv.EnvVars(e.secretName)
+}
+
+// volumes returns the driver volumes renamed and mounted under the endpoint
+// mount root. Volumes sourced from the registry private configuration are
+// pointed to the endpoint secret.
+func (e *storageMigrationEndpoint) volumes() ([]corev1.Volume, []corev1.VolumeMount, error) {
+	volumes, mounts, err := e.driver.Volumes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	volumeSecrets, err := e.driver.VolumeSecrets()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range volumes {
+		secret := volumes[i].Secret
+		if secret != nil && secret.SecretName == defaults.ImageRegistryPrivateConfiguration {
+			secret.SecretName = e.secretName
+			if len(secret.Items) == 0 {
+				keys := make([]string, 0, len(volumeSecrets))
+				for key := range volumeSecrets {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				for _, key := range keys {
+					secret.Items = append(secret.Items, corev1.KeyToPath{Key: key, Path: key})
+				}
+			}
+			for j := range secret.Items {
+				secret.Items[j].Key = e.envPrefix + secret.Items[j].Key
+			}
+		}
+		for j := range mounts {
+			if mounts[j].Name == volumes[i].Name {
+				mounts[j].Name = e.name + "-" + volumes[i].Name
+			}
+		}
+		volumes[i].Name = e.name + "-" + volumes[i].Name
+	}
+
+	for i := range mounts {
+		mounts[i].MountPath = filepath.Join(e.mountRoot, mounts[i].MountPath)
+	}
+
+	return volumes, mounts, nil
+}
+
+// secretData returns the sensitive data the endpoint needs, keyed by the
+// prefixed names used in configEnv and volumes.
+func (e *storageMigrationEndpoint) secretData() (map[string]string, error) {
+	configenv, err := e.driver.ConfigEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	envData, err := configenv.SecretData()
+	if err != nil {
+		return nil, err
+	}
+
+	volumeData, err := e.driver.VolumeSecrets()
+	if err != nil {
+		return nil, err
+	}
+
+	caBundle, _, err := e.driver.CABundle()
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]string{}
+	for k, v := range envData {
+		data[e.envPrefix+k] = v
+	}
+	for k, v := range volumeData {
+		data[e.envPrefix+k] = v
+	}
+	if caBundle != "" {
+		data[e.envPrefix+storageMigrationCABundleKey] = caBundle
+	}
+	return data, nil
+}
+
+// storageMigratable tells whether the content of the given storage can be
+// copied elsewhere. The content of an emptyDir lives and dies with the
+// registry pods, so there is no way for a job to reach it.
+func storageMigratable(cfg *imageregistryv1.ImageRegistryConfigStorage) bool {
+	return cfg.EmptyDir == nil
+}
+
+// storageMigrationInProgress returns true if the registry content is being
+// copied from a previous storage medium.
+func storageMigrationInProgress(cr *imageregistryv1.Config) bool {
+	_, ok := cr.Annotations[defaults.StorageMigrationSourceAnnotation]
+	return ok
+}
+
+// StorageMigrationSource returns the configuration of the storage medium the
+// registry content is being copied from, or nil if there is no migration in
+// progress.
+func StorageMigrationSource(cr *imageregistryv1.Config) (*imageregistryv1.ImageRegistryConfigStorage, error) {
+	raw, ok := cr.Annotations[defaults.StorageMigrationSourceAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	src := &imageregistryv1.ImageRegistryConfigStorage{}
+	if err := json.Unmarshal([]byte(raw), src); err != nil {
+		return nil, fmt.Errorf("unable to decode annotation %s: %s", defaults.StorageMigrationSourceAnnotation, err)
+	}
+	return src, nil
+}
+
+// storageMigrationID returns a digest identifying the current migration, i.e.
+// the pair of storage mediums the content is copied between.
+func storageMigrationID(cr *imageregistryv1.Config) (string, error) {
+	src, err := StorageMigrationSource(cr)
+	if err != nil {
+		return "", err
+	}
+	if src == nil {
+		return "", fmt.Errorf("no storage migration in progress")
+	}
+	dst := cr.Status.Storage.DeepCopy()
+	src.ManagementState = ""
+	dst.ManagementState = ""
+	return strategy.Checksum([]*imageregistryv1.ImageRegistryConfigStorage{src, dst})
+}
+
+// startStorageMigration records prev as the storage the registry content
+// needs to be copied from. If a migration is already in progress the
+// original source is kept: the storage we are moving away from was read-only
+// and holds, at most, a partial copy of it.
+func (g *Generator) startStorageMigration(cr *imageregistryv1.Config, prev *imageregistryv1.ImageRegistryConfigStorage) error {
+	src, err := StorageMigrationSource(cr)
+	if err != nil {
+		return err
+	}
+	if src != nil {
+		prev = src
+	}
+
+	if !storageMigratable(prev) {
+		util.UpdateCondition(cr, defaults.StorageMigration, operatorapiv1.ConditionFalse, storageMigrationReasonNotMigratable, "The content of the previous storage cannot be migrated")
+		return nil
+	}
+
+	// the user may have pointed the registry back to the storage we were
+	// migrating from, in which case there is nothing left to copy.
+	if !g.storageLocationsDiffer(prev, &cr.Status.Storage) {
+		klog.Infof("storage migration no longer required, registry is back to its original storage")
+		delete(cr.Annotations, defaults.StorageMigrationSourceAnnotation)
+		util.UpdateCondition(cr, defaults.StorageMigration, operatorapiv1.ConditionFalse, storageMigrationReasonNotRequired, "The registry is using its original storage")
+		return nil
+	}
+
+	raw, err := json.Marshal(prev)
+	if err != nil {
+		return err
+	}
+	if cr.Annotations == nil {
+		cr.Annotations = map[string]string{}
+	}
+	cr.Annotations[defaults.StorageMigrationSourceAnnotation] = string(raw)
+
+	klog.Infof("starting migration of the registry content from the previous storage")
+	util.UpdateCondition(cr, defaults.StorageMigration, operatorapiv1.ConditionTrue, storageMigrationReasonInProgress, "The registry content is being copied from the previous storage, the registry is read-only until it finishes")
+	return nil
+}
+
+// syncStorageMigration inspects the storage migration job and updates the
+// StorageMigration condition accordingly. Once the job completes the
+// migration resources are removed and the registry goes back to read-write.
+func (g *Generator) syncStorageMigration(cr *imageregistryv1.Config) error {
+	if !storageMigrationInProgress(cr) {
+		return nil
+	}
+
+	id, err := storageMigrationID(cr)
+	if err != nil {
+		return err
+	}
+
+	job, err := g.listers.Jobs.Get(defaults.StorageMigrationJobName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// a job created for a different pair of storage mediums is going to be
+	// recreated by its mutator, its outcome means nothing to us.
+	if job.Annotations[defaults.StorageMigrationIDAnnotation] != id {
+		return nil
+	}
+
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			return g.finishStorageMigration(cr)
+		case batchv1.JobFailed:
+			util.UpdateCondition(
+				cr,
+				defaults.StorageMigration,
+				operatorapiv1.ConditionFalse,
+				storageMigrationReasonFailed,
+				fmt.Sprintf(
+					"The storage migration job failed: %s. Delete job %s to retry or remove the %s annotation to give up on the migration",
+					cond.Message, defaults.StorageMigrationJobName, defaults.StorageMigrationSourceAnnotation,
+				),
+			)
+			return nil
+		}
+	}
+
+	util.UpdateCondition(cr, defaults.StorageMigration, operatorapiv1.ConditionTrue, storageMigrationReasonInProgress, "The registry content is being copied from the previous storage, the registry is read-only until it finishes")
+	return nil
+}
+
+// finishStorageMigration removes the storage migration job and its secret and
+// drops the migration source annotation from the config.
+func (g *Generator) finishStorageMigration(cr *imageregistryv1.Config) error {
+	gracePeriod := int64(0)
+	propagationPolicy := metaapi.DeletePropagationForeground
+	opts := metaapi.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+		PropagationPolicy:  &propagationPolicy,
+	}
+	if err := g.clients.Batch.Jobs(defaults.ImageRegistryOperatorNamespace).Delete(
+		context.TODO(), defaults.StorageMigrationJobName, opts,
+	); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err := g.clients.Core.Secrets(defaults.ImageRegistryOperatorNamespace).Delete(
+		context.TODO(), defaults.StorageMigrationSecretName, opts,
+	); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	delete(cr.Annotations, defaults.StorageMigrationSourceAnnotation)
+	klog.Infof("migration of the registry content from the previous storage completed")
+	util.UpdateCondition(cr, defaults.StorageMigration, operatorapiv1.ConditionFalse, storageMigrationReasonCompleted, "The registry content has been copied from the previous storage")
+	return nil
+}
@@ -0,0 +1,178 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+// fakeMigrationDriver mimics a driver that keeps its credentials in a file
+// mounted from the registry private configuration secret.
+type fakeMigrationDriver struct {
+	storage.Driver
+}
+
+func (d *fakeMigrationDriver) CABundle() (string, bool, error) {
+	return "ca-data", false, nil
+}
+
+func (d *fakeMigrationDriver) ConfigEnv() (envvar.List, error) {
+	return envvar.List{
+		{Name: "REGISTRY_STORAGE", Value: "fake"},
+		{Name: "REGISTRY_STORAGE_FAKE_CREDENTIALSPATH", Value: "/var/run/secrets/cloud/credentials"},
+		{Name: "REGISTRY_STORAGE_FAKE_SECRETKEY", Value: "secret", Secret: true},
+	}, nil
+}
+
+func (d *fakeMigrationDriver) Volumes() ([]corev1.Volume, []corev1.VolumeMount, error) {
+	vol := corev1.Volume{
+		Name: defaults.ImageRegistryPrivateConfiguration,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: defaults.ImageRegistryPrivateConfiguration,
+			},
+		},
+	}
+	mount := corev1.VolumeMount{
+		Name:      vol.Name,
+		MountPath: "/var/run/secrets/cloud",
+		ReadOnly:  true,
+	}
+	return []corev1.Volume{vol}, []corev1.VolumeMount{mount}, nil
+}
+
+func (d *fakeMigrationDriver) VolumeSecrets() (map[string]string, error) {
+	return map[string]string{"credentials": "creds"}, nil
+}
+
+func TestStorageMigrationEndpoint(t *testing.T) {
+	endpoint := newStorageMigrationSource(&fakeMigrationDriver{})
+
+	envs, err := endpoint.configEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedEnvs := []corev1.EnvVar{
+		{Name: "SOURCE_REGISTRY_STORAGE", Value: "fake"},
+		{Name: "SOURCE_REGISTRY_STORAGE_FAKE_CREDENTIALSPATH", Value: "/storage-migration/source/var/run/secrets/cloud/credentials"},
+		{
+			Name: "SOURCE_REGISTRY_STORAGE_FAKE_SECRETKEY",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: defaults.StorageMigrationSecretName,
+					},
+					Key: "SOURCE_REGISTRY_STORAGE_FAKE_SECRETKEY",
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(envs, expectedEnvs) {
+		t.Errorf("unexpected envs: got %#v, want %#v", envs, expectedEnvs)
+	}
+
+	volumes, mounts, err := endpoint.volumes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedVolumes := []corev1.Volume{
+		{
+			Name: "source-" + defaults.ImageRegistryPrivateConfiguration,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: defaults.StorageMigrationSecretName,
+					Items: []corev1.KeyToPath{
+						{Key: "SOURCE_credentials", Path: "credentials"},
+					},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(volumes, expectedVolumes) {
+		t.Errorf("unexpected volumes: got %#v, want %#v", volumes, expectedVolumes)
+	}
+	expectedMounts := []corev1.VolumeMount{
+		{
+			Name:      "source-" + defaults.ImageRegistryPrivateConfiguration,
+			MountPath: "/storage-migration/source/var/run/secrets/cloud",
+			ReadOnly:  true,
+		},
+	}
+	if !reflect.DeepEqual(mounts, expectedMounts) {
+		t.Errorf("unexpected mounts: got %#v, want %#v", mounts, expectedMounts)
+	}
+
+	data, err := endpoint.secretData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedData := map[string]string{
+		"SOURCE_REGISTRY_STORAGE_FAKE_SECRETKEY": "secret",
+		"SOURCE_credentials":                     "creds",
+		"SOURCE_ca-bundle.pem":                   "ca-data",
+	}
+	if !reflect.DeepEqual(data, expectedData) {
+		t.Errorf("unexpected secret data: got %#v, want %#v", data, expectedData)
+	}
+}
+
+func TestStorageMigrationID(t *testing.T) {
+	cr := &imageregistryv1.Config{}
+	cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
+		S3: &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "new-bucket"},
+	}
+
+	if storageMigrationInProgress(cr) {
+		t.Fatal("migration should not be in progress without the source annotation")
+	}
+	if _, err := storageMigrationID(cr); err == nil {
+		t.Fatal("expected an error when no migration is in progress")
+	}
+
+	cr.Annotations = map[string]string{
+		defaults.StorageMigrationSourceAnnotation: `{"managementState":"Managed","s3":{"bucket":"old-bucket"}}`,
+	}
+	if !storageMigrationInProgress(cr) {
+		t.Fatal("migration should be in progress")
+	}
+
+	src, err := StorageMigrationSource(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.S3 == nil || src.S3.Bucket != "old-bucket" {
+		t.Errorf("unexpected migration source: %#v", src)
+	}
+
+	id, err := storageMigrationID(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the management state does not affect where the content lives.
+	cr.Status.Storage.ManagementState = imageregistryv1.StorageManagementStateUnmanaged
+	if sameID, err := storageMigrationID(cr); err != nil {
+		t.Fatal(err)
+	} else if sameID != id {
+		t.Errorf("migration id changed with the management state")
+	}
+
+	cr.Status.Storage.S3.Bucket = "another-bucket"
+	if otherID, err := storageMigrationID(cr); err != nil {
+		t.Fatal(err)
+	} else if otherID == id {
+		t.Errorf("migration id did not change with the destination")
+	}
+
+	cr.Annotations[defaults.StorageMigrationSourceAnnotation] = "{"
+	if _, err := StorageMigrationSource(cr); err == nil {
+		t.Errorf("expected an error decoding an invalid annotation")
+	}
+}
@@ -0,0 +1,332 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+
+	configapiv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	securityv1 "github.com/openshift/api/security/v1"
+	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+var _ Mutator = &generatorStorageMigrationJob{}
+
+// storageMigrationCheckpointDir is where the storage migration job keeps
+// track of the objects it already copied.
+const storageMigrationCheckpointDir = "/var/lib/move-blobs"
+
+// generatorStorageMigrationJob manages the job that copies the registry
+// content from the previous storage medium into the current one.
+type generatorStorageMigrationJob struct {
+	lister      batchlisters.JobNamespaceLister
+	proxyLister configlisters.ProxyLister
+	client      batchset.BatchV1Interface
+	coreClient  coreset.CoreV1Interface
+	cr          *imageregistryv1.Config
+	source      *storageMigrationEndpoint
+	destination *storageMigrationEndpoint
+}
+
+func newGeneratorStorageMigrationJob(
+	lister batchlisters.JobNamespaceLister,
+	proxyLister configlisters.ProxyLister,
+	client batchset.BatchV1Interface,
+	coreClient coreset.CoreV1Interface,
+	cr *imageregistryv1.Config,
+	source *storageMigrationEndpoint,
+	destination *storageMigrationEndpoint,
+) *generatorStorageMigrationJob {
+	return &generatorStorageMigrationJob{
+		lister:      lister,
+		proxyLister: proxyLister,
+		client:      client,
+		coreClient:  coreClient,
+		cr:          cr,
+		source:      source,
+		destination: destination,
+	}
+}
+
+func (gsmj *generatorStorageMigrationJob) Type() runtime.Object {
+	return &batchv1.Job{}
+}
+
+func (gsmj *generatorStorageMigrationJob) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gsmj *generatorStorageMigrationJob) GetName() string {
+	return defaults.StorageMigrationJobName
+}
+
+func (gsmj *generatorStorageMigrationJob) expected() (runtime.Object, error) {
+	id, err := storageMigrationID(gsmj.cr)
+	if err != nil {
+		return nil, err
+	}
+
+	securityContext, err := generateSecurityContext(gsmj.coreClient, gsmj.GetNamespace())
+	if err != nil {
+		return nil, fmt.Errorf("generate security context for storage migration job: %s", err)
+	}
+
+	envs, volumes, mounts, err := storageJobPodConfig(gsmj.proxyLister, gsmj.cr, defaults.StorageMigrationSecretName, gsmj.source, gsmj.destination)
+	if err != nil {
+		return nil, err
+	}
+
+	// the checkpoint survives container restarts, so a copy interrupted
+	// by a failure does not start over.
+	checkpointVolume := corev1.Volume{
+		Name: "checkpoint",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+	volumes = append(volumes, checkpointVolume)
+	mounts = append(mounts, corev1.VolumeMount{Name: checkpointVolume.Name, MountPath: storageMigrationCheckpointDir})
+
+	backoffLimit := int32(6)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gsmj.GetName(),
+			Namespace: gsmj.GetNamespace(),
+			Annotations: map[string]string{
+				defaults.StorageMigrationIDAnnotation: id,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						securityv1.RequiredSCCAnnotation: "restricted-v2",
+					},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyOnFailure,
+					ServiceAccountName: defaults.ServiceAccountName,
+					PriorityClassName:  "system-cluster-critical",
+					SecurityContext:    securityContext,
+					Containers: []corev1.Container{
+						{
+							Name:  gsmj.GetName(),
+							Image: os.Getenv("OPERATOR_IMAGE"),
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("100m"),
+									corev1.ResourceMemory: resource.MustParse("256Mi"),
+								},
+							},
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+							Env:                      envs,
+							VolumeMounts:             mounts,
+							Command:                  []string{"/bin/sh"},
+							Args: []string{
+								"-c",
+								fmt.Sprintf(
+									"%s && /usr/bin/move-blobs --source-env-prefix=%s --destination-env-prefix=%s --checkpoint-file=%s/checkpoint",
+									storageJobTrustExtractScript, gsmj.source.envPrefix, gsmj.destination.envPrefix, storageMigrationCheckpointDir,
+								),
+							},
+						},
+					},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+
+	return job, nil
+}
+
+func (gsmj *generatorStorageMigrationJob) Get() (runtime.Object, error) {
+	return gsmj.lister.Get(gsmj.GetName())
+}
+
+func (gsmj *generatorStorageMigrationJob) Create() (runtime.Object, error) {
+	return commonCreate(gsmj, func(obj runtime.Object) (runtime.Object, error) {
+		return gsmj.client.Jobs(gsmj.GetNamespace()).Create(
+			context.TODO(), obj.(*batchv1.Job), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (gsmj *generatorStorageMigrationJob) Update(o runtime.Object) (runtime.Object, bool, error) {
+	// jobs can't be updated in place, so if the existing job was created
+	// for a different migration or with a different configuration we
+	// recreate it. the copy is resumable, whatever was already copied is
+	// not copied again.
+	exp, err := gsmj.expected()
+	if err != nil {
+		return nil, false, err
+	}
+	expectedJob := exp.(*batchv1.Job)
+	job := o.(*batchv1.Job)
+
+	sameMigration := job.Annotations[defaults.StorageMigrationIDAnnotation] == expectedJob.Annotations[defaults.StorageMigrationIDAnnotation]
+	sameEnvs := reflect.DeepEqual(expectedJob.Spec.Template.Spec.Containers[0].Env, job.Spec.Template.Spec.Containers[0].Env)
+	if sameMigration && sameEnvs {
+		return o, false, nil
+	}
+
+	gracePeriod := int64(0)
+	propagationPolicy := metav1.DeletePropagationForeground
+	opts := metav1.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+		PropagationPolicy:  &propagationPolicy,
+	}
+	if err := gsmj.Delete(opts); err != nil {
+		return nil, false, err
+	}
+	createdObj, err := gsmj.Create()
+	if err != nil {
+		return nil, false, err
+	}
+	return createdObj, true, nil
+}
+
+func (gsmj *generatorStorageMigrationJob) Delete(opts metav1.DeleteOptions) error {
+	return gsmj.client.Jobs(gsmj.GetNamespace()).Delete(
+		context.TODO(), gsmj.GetName(), opts,
+	)
+}
+
+func (gsmj *generatorStorageMigrationJob) Owned() bool {
+	return true
+}
+
+// storageJobTrustExtractScript builds the trust store of a storage job out of
+// the certificate authorities mounted by storageJobPodConfig.
+const storageJobTrustExtractScript = "mkdir -p /etc/pki/ca-trust/extracted/edk2 /etc/pki/ca-trust/extracted/java /etc/pki/ca-trust/extracted/openssl /etc/pki/ca-trust/extracted/pem && update-ca-trust extract"
+
+// storageJobPodConfig returns the environment variables, volumes and mounts a
+// job running move-blobs needs to reach the storage behind the endpoints. It
+// includes the proxy configuration and the certificate authorities to trust.
+// Sensitive data is read from secretName.
+func storageJobPodConfig(
+	proxyLister configlisters.ProxyLister,
+	cr *imageregistryv1.Config,
+	secretName string,
+	endpoints ...*storageMigrationEndpoint,
+) ([]corev1.EnvVar, []corev1.Volume, []corev1.VolumeMount, error) {
+	clusterProxy, err := proxyLister.Get(defaults.ClusterProxyResourceName)
+	if errors.IsNotFound(err) {
+		clusterProxy = &configapiv1.Proxy{}
+	} else if err != nil {
+		return nil, nil, nil, fmt.Errorf("unable to get cluster proxy configuration: %v", err)
+	}
+
+	var envs []corev1.EnvVar
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+	var caBundleItems []corev1.KeyToPath
+	for _, endpoint := range endpoints {
+		endpointEnvs, err := endpoint.configEnv()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("unable to get %s storage configuration: %s", endpoint.name, err)
+		}
+		envs = append(envs, endpointEnvs...)
+
+		endpointVolumes, endpointMounts, err := endpoint.volumes()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("unable to get %s storage volumes: %s", endpoint.name, err)
+		}
+		volumes = append(volumes, endpointVolumes...)
+		mounts = append(mounts, endpointMounts...)
+
+		caBundle, _, err := endpoint.driver.CABundle()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("unable to get %s storage ca bundle: %s", endpoint.name, err)
+		}
+		if caBundle != "" {
+			caBundleItems = append(caBundleItems, corev1.KeyToPath{
+				Key:  endpoint.envPrefix + storageMigrationCABundleKey,
+				Path: endpoint.name + "-" + storageMigrationCABundleKey,
+			})
+		}
+	}
+
+	if cr.Spec.Proxy.HTTP != "" {
+		envs = append(envs, corev1.EnvVar{Name: "HTTP_PROXY", Value: cr.Spec.Proxy.HTTP})
+	} else if clusterProxy.Status.HTTPProxy != "" {
+		envs = append(envs, corev1.EnvVar{Name: "HTTP_PROXY", Value: clusterProxy.Status.HTTPProxy})
+	}
+
+	if cr.Spec.Proxy.HTTPS != "" {
+		envs = append(envs, corev1.EnvVar{Name: "HTTPS_PROXY", Value: cr.Spec.Proxy.HTTPS})
+	} else if clusterProxy.Status.HTTPSProxy != "" {
+		envs = append(envs, corev1.EnvVar{Name: "HTTPS_PROXY", Value: clusterProxy.Status.HTTPSProxy})
+	}
+
+	if cr.Spec.Proxy.NoProxy != "" {
+		envs = append(envs, corev1.EnvVar{Name: "NO_PROXY", Value: cr.Spec.Proxy.NoProxy})
+	} else if clusterProxy.Status.NoProxy != "" {
+		envs = append(envs, corev1.EnvVar{Name: "NO_PROXY", Value: clusterProxy.Status.NoProxy})
+	}
+
+	// Storage certificate authorities are added as high-priority trust
+	// anchors, the same way we do it for the registry itself.
+	if len(caBundleItems) > 0 {
+		vol := corev1.Volume{
+			Name: "storage-ca-bundles",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: secretName,
+					Items:      caBundleItems,
+				},
+			},
+		}
+		volumes = append(volumes, vol)
+		mounts = append(mounts, corev1.VolumeMount{Name: vol.Name, MountPath: "/etc/pki/ca-trust/source/anchors"})
+	}
+
+	// Cluster trusted certificate authorities - mount to /usr/share/pki/ca-trust-source/ to add
+	// CAs as low-priority trust sources.
+	optional := true
+	trustedCAVolume := corev1.Volume{
+		Name: "trusted-ca",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: defaults.TrustedCAName,
+				},
+				Items: []corev1.KeyToPath{
+					{
+						Key:  "ca-bundle.crt",
+						Path: "anchors/ca-bundle.crt",
+					},
+				},
+				Optional: &optional,
+			},
+		},
+	}
+	caTrustExtractedVolume := corev1.Volume{
+		Name: "ca-trust-extracted",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+	volumes = append(volumes, trustedCAVolume, caTrustExtractedVolume)
+	mounts = append(mounts,
+		corev1.VolumeMount{Name: trustedCAVolume.Name, MountPath: "/usr/share/pki/ca-trust-source"},
+		corev1.VolumeMount{Name: caTrustExtractedVolume.Name, MountPath: "/etc/pki/ca-trust/extracted"},
+	)
+
+	return envs, volumes, mounts, nil
+}
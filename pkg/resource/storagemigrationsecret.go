@@ -0,0 +1,116 @@
+package resource
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+var _ Mutator = &generatorStorageMigrationSecret{}
+
+// generatorStorageMigrationSecret manages the secret holding the credentials
+// of the storage mediums a storage job works with: both the source and the
+// destination of a storage migration, or the storage being emptied before
+// its removal.
+type generatorStorageMigrationSecret struct {
+	lister    corelisters.SecretNamespaceLister
+	client    coreset.CoreV1Interface
+	name      string
+	endpoints []*storageMigrationEndpoint
+}
+
+func newGeneratorStorageMigrationSecret(
+	lister corelisters.SecretNamespaceLister,
+	client coreset.CoreV1Interface,
+	source *storageMigrationEndpoint,
+	destination *storageMigrationEndpoint,
+) *generatorStorageMigrationSecret {
+	return &generatorStorageMigrationSecret{
+		lister:    lister,
+		client:    client,
+		name:      defaults.StorageMigrationSecretName,
+		endpoints: []*storageMigrationEndpoint{source, destination},
+	}
+}
+
+func newGeneratorStorageRemovalSecret(
+	lister corelisters.SecretNamespaceLister,
+	client coreset.CoreV1Interface,
+	target *storageMigrationEndpoint,
+) *generatorStorageMigrationSecret {
+	return &generatorStorageMigrationSecret{
+		lister:    lister,
+		client:    client,
+		name:      defaults.StorageRemovalSecretName,
+		endpoints: []*storageMigrationEndpoint{target},
+	}
+}
+
+func (gsms *generatorStorageMigrationSecret) Type() runtime.Object {
+	return &corev1.Secret{}
+}
+
+func (gsms *generatorStorageMigrationSecret) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gsms *generatorStorageMigrationSecret) GetName() string {
+	return gsms.name
+}
+
+func (gsms *generatorStorageMigrationSecret) expected() (runtime.Object, error) {
+	data := map[string]string{}
+	for _, endpoint := range gsms.endpoints {
+		endpointData, err := endpoint.secretData()
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range endpointData {
+			data[k] = v
+		}
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gsms.GetName(),
+			Namespace: gsms.GetNamespace(),
+		},
+		StringData: data,
+	}, nil
+}
+
+func (gsms *generatorStorageMigrationSecret) Get() (runtime.Object, error) {
+	return gsms.lister.Get(gsms.GetName())
+}
+
+func (gsms *generatorStorageMigrationSecret) Create() (runtime.Object, error) {
+	return commonCreate(gsms, func(obj runtime.Object) (runtime.Object, error) {
+		return gsms.client.Secrets(gsms.GetNamespace()).Create(
+			context.TODO(), obj.(*corev1.Secret), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (gsms *generatorStorageMigrationSecret) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(gsms, o, func(obj runtime.Object) (runtime.Object, error) {
+		return gsms.client.Secrets(gsms.GetNamespace()).Update(
+			context.TODO(), obj.(*corev1.Secret), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (gsms *generatorStorageMigrationSecret) Delete(opts metav1.DeleteOptions) error {
+	return gsms.client.Secrets(gsms.GetNamespace()).Delete(
+		context.TODO(), gsms.GetName(), opts,
+	)
+}
+
+func (gsms *generatorStorageMigrationSecret) Owned() bool {
+	return true
+}
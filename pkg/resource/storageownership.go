@@ -0,0 +1,170 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	storageOwnershipReasonOwned       = "Owned"
+	storageOwnershipReasonConflict    = "OwnedByAnotherCluster"
+	storageOwnershipReasonOverridden  = "OwnershipOverridden"
+	storageOwnershipReasonCheckFailed = "CheckFailed"
+	storageOwnershipReasonClaimFailed = "ClaimFailed"
+)
+
+// storageOwner identifies the cluster a storage medium belongs to. It is
+// what the ownership marker holds.
+type storageOwner struct {
+	InfrastructureName string `json:"infrastructureName"`
+	ClusterID          string `json:"clusterID"`
+}
+
+// sameCluster tells whether two owners are the same cluster. The cluster id
+// is preferred as infrastructure names may be reused.
+func (o storageOwner) sameCluster(other storageOwner) bool {
+	if o.ClusterID != "" && other.ClusterID != "" {
+		return o.ClusterID == other.ClusterID
+	}
+	return o.InfrastructureName == other.InfrastructureName
+}
+
+func (o storageOwner) String() string {
+	if o.ClusterID == "" {
+		return o.InfrastructureName
+	}
+	return fmt.Sprintf("%s (cluster id %s)", o.InfrastructureName, o.ClusterID)
+}
+
+// errStorageOwnershipConflict is returned when the storage is marked as
+// owned by another cluster.
+var errStorageOwnershipConflict = errors.New("storage is owned by another cluster")
+
+// currentStorageOwner returns the ownership marker for this cluster.
+func (g *Generator) currentStorageOwner() (storageOwner, error) {
+	infra, err := util.GetInfrastructure(g.listers.Infrastructures)
+	if err != nil {
+		return storageOwner{}, err
+	}
+	owner := storageOwner{InfrastructureName: infra.Status.InfrastructureName}
+
+	cv, err := g.listers.ClusterVersions.Get("version")
+	if err != nil && !kerrors.IsNotFound(err) {
+		return storageOwner{}, fmt.Errorf("unable to get cluster version: %w", err)
+	} else if err == nil {
+		owner.ClusterID = string(cv.Spec.ClusterID)
+	}
+	return owner, nil
+}
+
+// checkStorageOwnership refuses storage mediums marked as owned by another
+// cluster, unless the override annotation is set. It reports the outcome
+// through the StorageOwnershipConflict condition.
+func checkStorageOwnership(cr *imageregistryv1.Config, driver storage.Driver, owner storageOwner) error {
+	store, ok := driver.(storage.ObjectStore)
+	if !ok || driver.ID() == "" {
+		return nil
+	}
+
+	data, err := store.GetObject(context.TODO(), storage.OwnershipMarkerKey)
+	if errors.Is(err, util.ErrObjectNotFound) {
+		return nil
+	} else if err != nil {
+		util.UpdateCondition(cr, defaults.StorageOwnershipConflict, operatorapiv1.ConditionUnknown, storageOwnershipReasonCheckFailed, fmt.Sprintf("Unable to read the ownership marker of %s: %s", driver.ID(), err))
+		return fmt.Errorf("unable to read storage ownership marker: %w", err)
+	}
+
+	var marker storageOwner
+	if err := json.Unmarshal(data, &marker); err != nil {
+		// a marker we can't make sense of is not ours.
+		klog.Warningf("unable to parse the ownership marker of %s: %s", driver.ID(), err)
+	}
+	if marker.sameCluster(owner) {
+		util.UpdateCondition(cr, defaults.StorageOwnershipConflict, operatorapiv1.ConditionFalse, storageOwnershipReasonOwned, fmt.Sprintf("The storage %s is owned by this cluster", driver.ID()))
+		return nil
+	}
+
+	if cr.Annotations[defaults.StorageOwnershipOverrideAnnotation] == "true" {
+		klog.Warningf("adopting storage %s owned by %s as requested by the %s annotation", driver.ID(), marker, defaults.StorageOwnershipOverrideAnnotation)
+		util.UpdateCondition(cr, defaults.StorageOwnershipConflict, operatorapiv1.ConditionFalse, storageOwnershipReasonOverridden, fmt.Sprintf("The storage %s was owned by %s and has been adopted as requested", driver.ID(), marker))
+		return nil
+	}
+
+	util.UpdateCondition(cr, defaults.StorageOwnershipConflict, operatorapiv1.ConditionTrue, storageOwnershipReasonConflict, fmt.Sprintf("The storage %s is owned by %s. Configure another storage, or set the %s annotation to \"true\" to adopt it", driver.ID(), marker, defaults.StorageOwnershipOverrideAnnotation))
+	return fmt.Errorf("%w: %s is owned by %s", errStorageOwnershipConflict, driver.ID(), marker)
+}
+
+// claimStorageOwnership checks the ownership of a storage medium that has
+// just been created or adopted and marks it as ours.
+func claimStorageOwnership(cr *imageregistryv1.Config, driver storage.Driver, owner storageOwner) error {
+	store, ok := driver.(storage.ObjectStore)
+	if !ok {
+		return nil
+	}
+	if err := checkStorageOwnership(cr, driver, owner); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(owner)
+	if err != nil {
+		return err
+	}
+	if err := store.PutObject(context.TODO(), storage.OwnershipMarkerKey, data); err != nil {
+		util.UpdateCondition(cr, defaults.StorageOwnershipConflict, operatorapiv1.ConditionUnknown, storageOwnershipReasonCheckFailed, fmt.Sprintf("Unable to write the ownership marker of %s: %s", driver.ID(), err))
+		return fmt.Errorf("unable to write storage ownership marker: %w", err)
+	}
+	if util.FetchCondition(cr, defaults.StorageOwnershipConflict).Reason != storageOwnershipReasonOverridden {
+		util.UpdateCondition(cr, defaults.StorageOwnershipConflict, operatorapiv1.ConditionFalse, storageOwnershipReasonOwned, fmt.Sprintf("The storage %s is owned by this cluster", driver.ID()))
+	}
+	return nil
+}
+
+// createAndClaimStorage creates the storage medium and marks it as ours.
+// Names may only be known once the storage is created, its ownership is
+// checked again before claiming it: a storage we can't claim must not be
+// used, and the image registry config is restored. The storage is only
+// removed when the driver tells it created it. Storage reused by the driver,
+// such as a bucket of the same name, may hold data: it is left in place and
+// reported through the StorageOwnershipDegraded condition.
+func createAndClaimStorage(cr *imageregistryv1.Config, driver storage.Driver, owner storageOwner) error {
+	prevSpec := cr.Spec.Storage.DeepCopy()
+	prevStatus := cr.Status.Storage.DeepCopy()
+	if err := driver.CreateStorage(cr); err != nil {
+		return err
+	}
+
+	err := claimStorageOwnership(cr, driver, owner)
+	if err == nil {
+		util.UpdateCondition(cr, defaults.StorageOwnershipDegraded, operatorapiv1.ConditionFalse, storageOwnershipReasonOwned, fmt.Sprintf("The storage %s is owned by this cluster", driver.ID()))
+		return nil
+	}
+
+	created := false
+	if reporter, ok := driver.(storage.CreationReporter); ok {
+		created = reporter.StorageCreated()
+	}
+	if !created {
+		klog.Warningf("leaving in place the storage %s that can't be claimed: %s", driver.ID(), err)
+		util.UpdateCondition(cr, defaults.StorageOwnershipDegraded, operatorapiv1.ConditionTrue, storageOwnershipReasonClaimFailed, fmt.Sprintf("The storage %s already existed and can't be claimed, it was left in place: %s", driver.ID(), err))
+	} else if _, rerr := driver.RemoveStorage(cr); rerr != nil {
+		klog.Errorf("unable to remove the storage %s that can't be claimed: %s", driver.ID(), rerr)
+		util.UpdateCondition(cr, defaults.StorageOwnershipDegraded, operatorapiv1.ConditionTrue, storageOwnershipReasonClaimFailed, fmt.Sprintf("The storage %s was created but can't be claimed, and removing it failed: %s", driver.ID(), rerr))
+	} else {
+		klog.Warningf("removed the storage %s that was created but can't be claimed: %s", driver.ID(), err)
+	}
+	cr.Spec.Storage = *prevSpec
+	cr.Status.Storage = *prevStatus
+	return err
+}
@@ -0,0 +1,254 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+type fakeObjectStoreDriver struct {
+	storage.Driver
+	objects map[string][]byte
+}
+
+func (d *fakeObjectStoreDriver) ID() string {
+	return "bucket"
+}
+
+func (d *fakeObjectStoreDriver) PutObject(ctx context.Context, key string, data []byte) error {
+	d.objects[key] = data
+	return nil
+}
+
+func (d *fakeObjectStoreDriver) GetObject(ctx context.Context, key string) ([]byte, error) {
+	data, ok := d.objects[key]
+	if !ok {
+		return nil, util.ObjectNotFound(key, errors.New("no such key"))
+	}
+	return data, nil
+}
+
+func (d *fakeObjectStoreDriver) DeleteObject(ctx context.Context, key string) error {
+	delete(d.objects, key)
+	return nil
+}
+
+func TestClaimStorageOwnership(t *testing.T) {
+	us := storageOwner{InfrastructureName: "us-abcde", ClusterID: "1111"}
+	them := storageOwner{InfrastructureName: "them-fghij", ClusterID: "2222"}
+
+	for _, tc := range []struct {
+		name           string
+		marker         *storageOwner
+		override       bool
+		expectErr      bool
+		expectedStatus operatorapiv1.ConditionStatus
+		expectedReason string
+		expectedOwner  storageOwner
+	}{
+		{
+			name:           "no marker",
+			expectedStatus: operatorapiv1.ConditionFalse,
+			expectedReason: storageOwnershipReasonOwned,
+			expectedOwner:  us,
+		},
+		{
+			name:           "owned by us",
+			marker:         &us,
+			expectedStatus: operatorapiv1.ConditionFalse,
+			expectedReason: storageOwnershipReasonOwned,
+			expectedOwner:  us,
+		},
+		{
+			name:           "owned by another cluster",
+			marker:         &them,
+			expectErr:      true,
+			expectedStatus: operatorapiv1.ConditionTrue,
+			expectedReason: storageOwnershipReasonConflict,
+			expectedOwner:  them,
+		},
+		{
+			name:           "owned by another cluster with override",
+			marker:         &them,
+			override:       true,
+			expectedStatus: operatorapiv1.ConditionFalse,
+			expectedReason: storageOwnershipReasonOverridden,
+			expectedOwner:  us,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := &fakeObjectStoreDriver{objects: map[string][]byte{}}
+			if tc.marker != nil {
+				data, err := json.Marshal(tc.marker)
+				if err != nil {
+					t.Fatal(err)
+				}
+				driver.objects[storage.OwnershipMarkerKey] = data
+			}
+
+			cr := &imageregistryv1.Config{}
+			if tc.override {
+				cr.ObjectMeta = metav1.ObjectMeta{
+					Annotations: map[string]string{
+						defaults.StorageOwnershipOverrideAnnotation: "true",
+					},
+				}
+			}
+
+			err := claimStorageOwnership(cr, driver, us)
+			if (err != nil) != tc.expectErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tc.expectErr && !errors.Is(err, errStorageOwnershipConflict) {
+				t.Errorf("expected a conflict error, got %v", err)
+			}
+
+			cond := util.FetchCondition(cr, defaults.StorageOwnershipConflict)
+			if cond.Status != tc.expectedStatus || cond.Reason != tc.expectedReason {
+				t.Errorf("unexpected condition: %#v", cond)
+			}
+
+			var owner storageOwner
+			if err := json.Unmarshal(driver.objects[storage.OwnershipMarkerKey], &owner); err != nil {
+				t.Fatal(err)
+			}
+			if owner != tc.expectedOwner {
+				t.Errorf("unexpected marker: got %#v, want %#v", owner, tc.expectedOwner)
+			}
+		})
+	}
+}
+
+type fakeCreatedStorageDriver struct {
+	fakeObjectStoreDriver
+	exists  bool
+	created bool
+	putErr  error
+	removed bool
+}
+
+func (d *fakeCreatedStorageDriver) CreateStorage(cr *imageregistryv1.Config) error {
+	// like the drivers reusing a bucket of the same name, existing
+	// storage is managed too.
+	cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
+	cr.Status.Storage = *cr.Spec.Storage.DeepCopy()
+	d.created = !d.exists
+	d.exists = true
+	return nil
+}
+
+func (d *fakeCreatedStorageDriver) StorageCreated() bool {
+	return d.created
+}
+
+func (d *fakeCreatedStorageDriver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
+	d.removed = true
+	d.exists = false
+	return false, nil
+}
+
+func (d *fakeCreatedStorageDriver) PutObject(ctx context.Context, key string, data []byte) error {
+	if d.putErr != nil {
+		return d.putErr
+	}
+	return d.fakeObjectStoreDriver.PutObject(ctx, key, data)
+}
+
+func TestCreateAndClaimStorage(t *testing.T) {
+	us := storageOwner{InfrastructureName: "us-abcde", ClusterID: "1111"}
+	them := storageOwner{InfrastructureName: "them-fghij", ClusterID: "2222"}
+
+	for _, tc := range []struct {
+		name           string
+		exists         bool
+		marker         *storageOwner
+		putErr         error
+		expectErr      bool
+		expectRemoved  bool
+		expectDegraded bool
+	}{
+		{
+			name: "created and claimed",
+		},
+		{
+			name:   "reused and claimed",
+			exists: true,
+		},
+		{
+			name:          "created but can't be claimed",
+			putErr:        errors.New("access denied"),
+			expectErr:     true,
+			expectRemoved: true,
+		},
+		{
+			name:           "reused but can't be claimed",
+			exists:         true,
+			putErr:         errors.New("access denied"),
+			expectErr:      true,
+			expectDegraded: true,
+		},
+		{
+			name:           "reused and owned by another cluster",
+			exists:         true,
+			marker:         &them,
+			expectErr:      true,
+			expectDegraded: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := &fakeCreatedStorageDriver{
+				fakeObjectStoreDriver: fakeObjectStoreDriver{objects: map[string][]byte{}},
+				exists:                tc.exists,
+				putErr:                tc.putErr,
+			}
+			if tc.marker != nil {
+				data, err := json.Marshal(tc.marker)
+				if err != nil {
+					t.Fatal(err)
+				}
+				driver.objects[storage.OwnershipMarkerKey] = data
+			}
+
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "bucket"},
+					},
+				},
+			}
+			prev := cr.DeepCopy()
+
+			err := createAndClaimStorage(cr, driver, us)
+			if (err != nil) != tc.expectErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if driver.removed != tc.expectRemoved {
+				t.Errorf("expected the storage to be removed: %t, got %t", tc.expectRemoved, driver.removed)
+			}
+			degraded := util.FetchCondition(cr, defaults.StorageOwnershipDegraded).Status == operatorapiv1.ConditionTrue
+			if degraded != tc.expectDegraded {
+				t.Errorf("expected the %s condition to be true: %t, got %t", defaults.StorageOwnershipDegraded, tc.expectDegraded, degraded)
+			}
+			if !tc.expectErr {
+				if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+					t.Errorf("expected the created storage to be managed, got %q", cr.Spec.Storage.ManagementState)
+				}
+				return
+			}
+			if !reflect.DeepEqual(cr.Spec.Storage, prev.Spec.Storage) || !reflect.DeepEqual(cr.Status.Storage, prev.Status.Storage) {
+				t.Errorf("expected the storage config to be restored, got spec %#v and status %#v", cr.Spec.Storage, cr.Status.Storage)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	storagePermissionsReasonValid            = "PermissionsValid"
+	storagePermissionsReasonDenied           = "PermissionDenied"
+	storagePermissionsReasonValidationFailed = "ValidationFailed"
+)
+
+// validateStoragePermissions runs the driver preflight checks and reports
+// their outcome through the StoragePermissionsValid condition. An error is
+// returned when the storage should not be touched.
+func validateStoragePermissions(cr *imageregistryv1.Config, driver storage.Driver) error {
+	err := driver.Validate(cr)
+	if err == nil {
+		util.UpdateCondition(cr, defaults.StoragePermissionsValid, operatorapiv1.ConditionTrue, storagePermissionsReasonValid, "The storage credentials hold the required permissions")
+		return nil
+	}
+
+	if errors.Is(err, util.ErrPermissionDenied) {
+		util.UpdateCondition(cr, defaults.StoragePermissionsValid, operatorapiv1.ConditionFalse, storagePermissionsReasonDenied, err.Error())
+	} else {
+		util.UpdateCondition(cr, defaults.StoragePermissionsValid, operatorapiv1.ConditionUnknown, storagePermissionsReasonValidationFailed, fmt.Sprintf("Unable to validate the storage permissions: %s", err))
+	}
+	return fmt.Errorf("unable to validate storage permissions: %w", err)
+}
@@ -0,0 +1,62 @@
+package resource
+
+import (
+	"errors"
+	"testing"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+type fakeValidatingDriver struct {
+	storage.Driver
+	err error
+}
+
+func (d *fakeValidatingDriver) Validate(cr *imageregistryv1.Config) error {
+	return d.err
+}
+
+func TestValidateStoragePermissions(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		err            error
+		expectedStatus operatorapiv1.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:           "permissions granted",
+			expectedStatus: operatorapiv1.ConditionTrue,
+			expectedReason: storagePermissionsReasonValid,
+		},
+		{
+			name:           "permission denied",
+			err:            util.PermissionDenied("unable to list objects in bucket %s", "foo"),
+			expectedStatus: operatorapiv1.ConditionFalse,
+			expectedReason: storagePermissionsReasonDenied,
+		},
+		{
+			name:           "validation failed",
+			err:            errors.New("connection refused"),
+			expectedStatus: operatorapiv1.ConditionUnknown,
+			expectedReason: storagePermissionsReasonValidationFailed,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			err := validateStoragePermissions(cr, &fakeValidatingDriver{err: tc.err})
+			if (err != nil) != (tc.err != nil) {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			cond := util.FetchCondition(cr, defaults.StoragePermissionsValid)
+			if cond.Status != tc.expectedStatus || cond.Reason != tc.expectedReason {
+				t.Errorf("unexpected condition: %#v", cond)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package resource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	storageRemovalReasonInProgress = "InProgress"
+	storageRemovalReasonCompleted  = "Completed"
+	storageRemovalReasonFailed     = "Failed"
+	storageRemovalEnvPrefix        = "TARGET_"
+	storageRemovalMountRoot        = "/storage-removal"
+
+	// storageRemovalLogLines is the number of log lines of the storage
+	// removal job searched for its progress.
+	storageRemovalLogLines = int64(20)
+)
+
+// ErrStorageRemovalInProgress is returned while the storage removal job is
+// deleting the registry content. The storage itself is removed once it is
+// done.
+var ErrStorageRemovalInProgress = errors.New("the registry content is being deleted from the storage")
+
+// storageRemovalProgress is the progress the storage removal job reports, as
+// a line of JSON, on its standard output.
+type storageRemovalProgress struct {
+	Found   int64 `json:"found"`
+	Deleted int64 `json:"deleted"`
+	// Listed tells whether every object of the storage was found. Until
+	// it is, the number of remaining objects is a lower bound.
+	Listed bool  `json:"listed"`
+	Errors int64 `json:"errors"`
+}
+
+func (p storageRemovalProgress) String() string {
+	remaining := p.Found - p.Deleted
+	if p.Listed {
+		return fmt.Sprintf("%d objects deleted, %d remaining", p.Deleted, remaining)
+	}
+	return fmt.Sprintf("%d objects deleted, at least %d remaining", p.Deleted, remaining)
+}
+
+// parseStorageRemovalProgress returns the last progress found in the logs of
+// the storage removal job.
+func parseStorageRemovalProgress(logs []byte) (storageRemovalProgress, bool) {
+	lines := bytes.Split(bytes.TrimSpace(logs), []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := bytes.TrimSpace(lines[i])
+		if !bytes.HasPrefix(line, []byte("{")) {
+			continue
+		}
+		var progress storageRemovalProgress
+		if err := json.Unmarshal(line, &progress); err == nil {
+			return progress, true
+		}
+	}
+	return storageRemovalProgress{}, false
+}
+
+func newStorageRemovalTarget(driver storage.Driver) *storageMigrationEndpoint {
+	return &storageMigrationEndpoint{
+		name:       "target",
+		envPrefix:  storageRemovalEnvPrefix,
+		mountRoot:  filepath.Join(storageRemovalMountRoot, "target"),
+		secretName: defaults.StorageRemovalSecretName,
+		driver:     driver,
+	}
+}
+
+// storageRemovableByJob tells whether the registry content is deleted by the
+// storage removal job before the storage is removed. Only object storage
+// managed by the operator is, there is nothing worth a job in the volumes.
+func storageRemovableByJob(cr *imageregistryv1.Config, driver storage.Driver) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false
+	}
+	cfg := &cr.Status.Storage
+	if cfg.S3 == nil && cfg.GCS == nil && cfg.Azure == nil && cfg.Swift == nil && cfg.IBMCOS == nil {
+		return false
+	}
+	return driver.ID() != ""
+}
+
+// removeStorageContent runs the storage removal job and reports its progress
+// through the StorageRemoval condition. It returns ErrStorageRemovalInProgress
+// until the job completes, at which point the job and its secret are
+// deleted.
+func (g *Generator) removeStorageContent(cr *imageregistryv1.Config, driver storage.Driver) error {
+	target := newStorageRemovalTarget(driver)
+	for _, gen := range []Mutator{
+		newGeneratorStorageRemovalSecret(g.listers.Secrets, g.clients.Core, target),
+		newGeneratorStorageRemovalJob(g.listers.Jobs, g.listers.ProxyConfigs, g.clients.Batch, g.clients.Core, cr, target),
+	} {
+		if err := ApplyMutator(gen); err != nil {
+			return fmt.Errorf("unable to apply storage removal resources: %s", err)
+		}
+	}
+
+	job, err := g.listers.Jobs.Get(defaults.StorageRemovalJobName)
+	if kerrors.IsNotFound(err) {
+		util.UpdateCondition(cr, defaults.StorageRemoval, operatorapiv1.ConditionTrue, storageRemovalReasonInProgress, fmt.Sprintf("The registry content is being deleted from %s", driver.ID()))
+		return ErrStorageRemovalInProgress
+	} else if err != nil {
+		return err
+	}
+
+	progress, ok := g.storageRemovalProgress()
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			if err := g.finishStorageRemoval(); err != nil {
+				return err
+			}
+			klog.Infof("registry content deleted from %s", driver.ID())
+			util.UpdateCondition(cr, defaults.StorageRemoval, operatorapiv1.ConditionFalse, storageRemovalReasonCompleted, fmt.Sprintf("The registry content has been deleted from %s", driver.ID()))
+			return nil
+		case batchv1.JobFailed:
+			message := fmt.Sprintf("The storage removal job failed: %s", cond.Message)
+			if ok {
+				message += fmt.Sprintf(" (%s)", progress)
+			}
+			util.UpdateCondition(cr, defaults.StorageRemoval, operatorapiv1.ConditionFalse, storageRemovalReasonFailed, fmt.Sprintf("%s. Delete job %s to retry", message, defaults.StorageRemovalJobName))
+			return fmt.Errorf("storage removal job failed: %s", cond.Message)
+		}
+	}
+
+	message := fmt.Sprintf("The registry content is being deleted from %s", driver.ID())
+	if ok {
+		message += fmt.Sprintf(": %s", progress)
+	}
+	util.UpdateCondition(cr, defaults.StorageRemoval, operatorapiv1.ConditionTrue, storageRemovalReasonInProgress, message)
+	return ErrStorageRemovalInProgress
+}
+
+// storageRemovalProgress reads the last progress reported by the most recent
+// pod of the storage removal job.
+func (g *Generator) storageRemovalProgress() (storageRemovalProgress, bool) {
+	pods, err := g.clients.Core.Pods(defaults.ImageRegistryOperatorNamespace).List(context.TODO(), metaapi.ListOptions{
+		LabelSelector: "job-name=" + defaults.StorageRemovalJobName,
+	})
+	if err != nil {
+		klog.Warningf("unable to list the storage removal job pods: %s", err)
+		return storageRemovalProgress{}, false
+	}
+
+	var latest *corev1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if latest == nil || latest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			latest = pod
+		}
+	}
+	if latest == nil {
+		return storageRemovalProgress{}, false
+	}
+
+	tailLines := storageRemovalLogLines
+	logs, err := g.clients.Core.Pods(defaults.ImageRegistryOperatorNamespace).GetLogs(latest.Name, &corev1.PodLogOptions{
+		TailLines: &tailLines,
+	}).DoRaw(context.TODO())
+	if err != nil {
+		klog.V(4).Infof("unable to get the logs of pod %s: %s", latest.Name, err)
+		return storageRemovalProgress{}, false
+	}
+	return parseStorageRemovalProgress(logs)
+}
+
+// finishStorageRemoval deletes the storage removal job and its secret.
+func (g *Generator) finishStorageRemoval() error {
+	propagationPolicy := metaapi.DeletePropagationBackground
+	opts := metaapi.DeleteOptions{
+		PropagationPolicy: &propagationPolicy,
+	}
+	if err := g.clients.Batch.Jobs(defaults.ImageRegistryOperatorNamespace).Delete(
+		context.TODO(), defaults.StorageRemovalJobName, opts,
+	); err != nil && !kerrors.IsNotFound(err) {
+		return err
+	}
+	if err := g.clients.Core.Secrets(defaults.ImageRegistryOperatorNamespace).Delete(
+		context.TODO(), defaults.StorageRemovalSecretName, opts,
+	); err != nil && !kerrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
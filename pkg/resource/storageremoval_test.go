@@ -0,0 +1,47 @@
+package resource
+
+import (
+	"testing"
+)
+
+func TestParseStorageRemovalProgress(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		logs     string
+		found    bool
+		expected string
+	}{
+		{
+			name: "no progress yet",
+			logs: "I1016 10:00:00.000000       1 remover.go:130] deleting objects under \"/\" from s3 bucket\n",
+		},
+		{
+			name: "listing",
+			logs: "I1016 10:00:00.000000       1 remover.go:130] deleting objects under \"/\" from s3 bucket\n" +
+				"{\"found\":1000,\"deleted\":10,\"listed\":false,\"errors\":0}\n" +
+				"{\"found\":3000,\"deleted\":1200,\"listed\":false,\"errors\":0}\n" +
+				"W1016 10:00:40.000000       1 remover.go:118] unable to delete \"/docker/foo\", moving on: timeout\n",
+			found:    true,
+			expected: "1200 objects deleted, at least 1800 remaining",
+		},
+		{
+			name:     "listed",
+			logs:     "{\"found\":3500,\"deleted\":3000,\"listed\":true,\"errors\":1}\n",
+			found:    true,
+			expected: "3000 objects deleted, 500 remaining",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			progress, found := parseStorageRemovalProgress([]byte(tc.logs))
+			if found != tc.found {
+				t.Fatalf("expected found to be %t, got %t", tc.found, found)
+			}
+			if !found {
+				return
+			}
+			if progress.String() != tc.expected {
+				t.Errorf("got %q, want %q", progress, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	securityv1 "github.com/openshift/api/security/v1"
+	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+var _ Mutator = &generatorStorageRemovalJob{}
+
+// generatorStorageRemovalJob manages the job that deletes the registry
+// content from the storage medium being removed.
+type generatorStorageRemovalJob struct {
+	lister      batchlisters.JobNamespaceLister
+	proxyLister configlisters.ProxyLister
+	client      batchset.BatchV1Interface
+	coreClient  coreset.CoreV1Interface
+	cr          *imageregistryv1.Config
+	target      *storageMigrationEndpoint
+}
+
+func newGeneratorStorageRemovalJob(
+	lister batchlisters.JobNamespaceLister,
+	proxyLister configlisters.ProxyLister,
+	client batchset.BatchV1Interface,
+	coreClient coreset.CoreV1Interface,
+	cr *imageregistryv1.Config,
+	target *storageMigrationEndpoint,
+) *generatorStorageRemovalJob {
+	return &generatorStorageRemovalJob{
+		lister:      lister,
+		proxyLister: proxyLister,
+		client:      client,
+		coreClient:  coreClient,
+		cr:          cr,
+		target:      target,
+	}
+}
+
+func (gsrj *generatorStorageRemovalJob) Type() runtime.Object {
+	return &batchv1.Job{}
+}
+
+func (gsrj *generatorStorageRemovalJob) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gsrj *generatorStorageRemovalJob) GetName() string {
+	return defaults.StorageRemovalJobName
+}
+
+func (gsrj *generatorStorageRemovalJob) expected() (runtime.Object, error) {
+	securityContext, err := generateSecurityContext(gsrj.coreClient, gsrj.GetNamespace())
+	if err != nil {
+		return nil, fmt.Errorf("generate security context for storage removal job: %s", err)
+	}
+
+	envs, volumes, mounts, err := storageJobPodConfig(gsrj.proxyLister, gsrj.cr, defaults.StorageRemovalSecretName, gsrj.target)
+	if err != nil {
+		return nil, err
+	}
+
+	backoffLimit := int32(6)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gsrj.GetName(),
+			Namespace: gsrj.GetNamespace(),
+			Annotations: map[string]string{
+				defaults.StorageRemovalTargetAnnotation: gsrj.target.driver.ID(),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						securityv1.RequiredSCCAnnotation: "restricted-v2",
+					},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyOnFailure,
+					// the registry service account is removed along with
+					// the registry, before the storage is.
+					ServiceAccountName: defaults.OperatorServiceAccountName,
+					PriorityClassName:  "system-cluster-critical",
+					SecurityContext:    securityContext,
+					Containers: []corev1.Container{
+						{
+							Name:  gsrj.GetName(),
+							Image: os.Getenv("OPERATOR_IMAGE"),
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("100m"),
+									corev1.ResourceMemory: resource.MustParse("128Mi"),
+								},
+							},
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+							Env:                      envs,
+							VolumeMounts:             mounts,
+							Command:                  []string{"/bin/sh"},
+							Args: []string{
+								"-c",
+								fmt.Sprintf(
+									"%s && /usr/bin/move-blobs --remove-env-prefix=%s",
+									storageJobTrustExtractScript, gsrj.target.envPrefix,
+								),
+							},
+						},
+					},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+
+	return job, nil
+}
+
+func (gsrj *generatorStorageRemovalJob) Get() (runtime.Object, error) {
+	return gsrj.lister.Get(gsrj.GetName())
+}
+
+func (gsrj *generatorStorageRemovalJob) Create() (runtime.Object, error) {
+	return commonCreate(gsrj, func(obj runtime.Object) (runtime.Object, error) {
+		return gsrj.client.Jobs(gsrj.GetNamespace()).Create(
+			context.TODO(), obj.(*batchv1.Job), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (gsrj *generatorStorageRemovalJob) Update(o runtime.Object) (runtime.Object, bool, error) {
+	// jobs can't be updated in place. a job created for another storage
+	// medium, or with a different configuration, is recreated. whatever
+	// it deleted is not coming back, so nothing is lost.
+	exp, err := gsrj.expected()
+	if err != nil {
+		return nil, false, err
+	}
+	expectedJob := exp.(*batchv1.Job)
+	job := o.(*batchv1.Job)
+
+	sameTarget := job.Annotations[defaults.StorageRemovalTargetAnnotation] == expectedJob.Annotations[defaults.StorageRemovalTargetAnnotation]
+	sameEnvs := reflect.DeepEqual(expectedJob.Spec.Template.Spec.Containers[0].Env, job.Spec.Template.Spec.Containers[0].Env)
+	if sameTarget && sameEnvs {
+		return o, false, nil
+	}
+
+	gracePeriod := int64(0)
+	propagationPolicy := metav1.DeletePropagationForeground
+	opts := metav1.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+		PropagationPolicy:  &propagationPolicy,
+	}
+	if err := gsrj.Delete(opts); err != nil {
+		return nil, false, err
+	}
+	createdObj, err := gsrj.Create()
+	if err != nil {
+		return nil, false, err
+	}
+	return createdObj, true, nil
+}
+
+func (gsrj *generatorStorageRemovalJob) Delete(opts metav1.DeleteOptions) error {
+	return gsrj.client.Jobs(gsrj.GetNamespace()).Delete(
+		context.TODO(), gsrj.GetName(), opts,
+	)
+}
+
+func (gsrj *generatorStorageRemovalJob) Owned() bool {
+	return true
+}
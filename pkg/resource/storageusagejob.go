@@ -0,0 +1,225 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	securityv1 "github.com/openshift/api/security/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+var _ Mutator = &generatorStorageUsageJob{}
+
+// storageUsageScript walks the registry root and writes the number of bytes
+// and files it holds into the termination message.
+const storageUsageScript = `if [ -d /registry/docker ]; then find /registry/docker -type f -printf '%s\n' | awk '{ b += $1; n++ } END { printf "%d %d", b, n }'; else printf "0 0"; fi > /dev/termination-log`
+
+// generatorStorageUsageJob manages the short-lived job that measures the
+// registry content kept in a persistent volume claim.
+type generatorStorageUsageJob struct {
+	lister     batchlisters.JobNamespaceLister
+	client     batchset.BatchV1Interface
+	coreClient coreset.CoreV1Interface
+	cr         *imageregistryv1.Config
+}
+
+func NewGeneratorStorageUsageJob(
+	lister batchlisters.JobNamespaceLister,
+	client batchset.BatchV1Interface,
+	coreClient coreset.CoreV1Interface,
+	cr *imageregistryv1.Config,
+) *generatorStorageUsageJob {
+	return &generatorStorageUsageJob{
+		lister:     lister,
+		client:     client,
+		coreClient: coreClient,
+		cr:         cr,
+	}
+}
+
+func (gsuj *generatorStorageUsageJob) Type() runtime.Object {
+	return &batchv1.Job{}
+}
+
+func (gsuj *generatorStorageUsageJob) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gsuj *generatorStorageUsageJob) GetName() string {
+	return defaults.StorageUsageJobName
+}
+
+func (gsuj *generatorStorageUsageJob) claimName() (string, error) {
+	if gsuj.cr.Status.Storage.PVC == nil || gsuj.cr.Status.Storage.PVC.Claim == "" {
+		return "", fmt.Errorf("persistent volume claim not yet provisioned")
+	}
+	return gsuj.cr.Status.Storage.PVC.Claim, nil
+}
+
+func (gsuj *generatorStorageUsageJob) expected() (runtime.Object, error) {
+	claim, err := gsuj.claimName()
+	if err != nil {
+		return nil, err
+	}
+
+	securityContext, err := generateSecurityContext(gsuj.coreClient, gsuj.GetNamespace())
+	if err != nil {
+		return nil, fmt.Errorf("generate security context for storage usage job: %s", err)
+	}
+
+	backoffLimit := int32(2)
+	ttl := int32(3600)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gsuj.GetName(),
+			Namespace: gsuj.GetNamespace(),
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttl,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						securityv1.RequiredSCCAnnotation: "restricted-v2",
+					},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: defaults.ServiceAccountName,
+					SecurityContext:    securityContext,
+					// ReadWriteOnce volumes can only be attached to a
+					// single node, run next to the registry if we can.
+					Affinity: &corev1.Affinity{
+						PodAffinity: &corev1.PodAffinity{
+							PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+								{
+									Weight: 100,
+									PodAffinityTerm: corev1.PodAffinityTerm{
+										LabelSelector: &metav1.LabelSelector{
+											MatchLabels: defaults.DeploymentLabels,
+										},
+										TopologyKey: "kubernetes.io/hostname",
+									},
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  gsuj.GetName(),
+							Image: os.Getenv("OPERATOR_IMAGE"),
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("10m"),
+									corev1.ResourceMemory: resource.MustParse("50Mi"),
+								},
+							},
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "registry-storage",
+									MountPath: "/registry",
+									ReadOnly:  true,
+								},
+							},
+							Command: []string{"/bin/sh"},
+							Args:    []string{"-c", storageUsageScript},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "registry-storage",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: claim,
+									ReadOnly:  true,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return job, nil
+}
+
+func (gsuj *generatorStorageUsageJob) Get() (runtime.Object, error) {
+	return gsuj.lister.Get(gsuj.GetName())
+}
+
+func (gsuj *generatorStorageUsageJob) Create() (runtime.Object, error) {
+	return commonCreate(gsuj, func(obj runtime.Object) (runtime.Object, error) {
+		return gsuj.client.Jobs(gsuj.GetNamespace()).Create(
+			context.TODO(), obj.(*batchv1.Job), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (gsuj *generatorStorageUsageJob) Update(o runtime.Object) (runtime.Object, bool, error) {
+	// jobs can't be updated in place. a job measuring a claim that is no
+	// longer in use is recreated, otherwise we let it run to completion.
+	claim, err := gsuj.claimName()
+	if err != nil {
+		return nil, false, err
+	}
+	job := o.(*batchv1.Job)
+	for _, vol := range job.Spec.Template.Spec.Volumes {
+		if vol.PersistentVolumeClaim != nil && vol.PersistentVolumeClaim.ClaimName == claim {
+			return o, false, nil
+		}
+	}
+
+	propagationPolicy := metav1.DeletePropagationForeground
+	if err := gsuj.Delete(metav1.DeleteOptions{PropagationPolicy: &propagationPolicy}); err != nil {
+		return nil, false, err
+	}
+	createdObj, err := gsuj.Create()
+	if err != nil {
+		return nil, false, err
+	}
+	return createdObj, true, nil
+}
+
+func (gsuj *generatorStorageUsageJob) Delete(opts metav1.DeleteOptions) error {
+	return gsuj.client.Jobs(gsuj.GetNamespace()).Delete(
+		context.TODO(), gsuj.GetName(), opts,
+	)
+}
+
+func (gsuj *generatorStorageUsageJob) Owned() bool {
+	return true
+}
+
+// ParseStorageUsage parses the termination message of the storage usage job,
+// the number of bytes and objects separated by a space.
+func ParseStorageUsage(message string) (int64, int64, error) {
+	fields := strings.Fields(message)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected storage usage report %q", message)
+	}
+	bytes, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to parse the number of bytes in %q: %w", message, err)
+	}
+	objects, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to parse the number of objects in %q: %w", message, err)
+	}
+	return bytes, objects, nil
+}
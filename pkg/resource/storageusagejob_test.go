@@ -0,0 +1,35 @@
+package resource
+
+import (
+	"testing"
+)
+
+func TestParseStorageUsage(t *testing.T) {
+	for _, tc := range []struct {
+		message string
+		bytes   int64
+		objects int64
+		err     bool
+	}{
+		{message: "0 0"},
+		{message: "1048576 12\n", bytes: 1048576, objects: 12},
+		{message: "", err: true},
+		{message: "12", err: true},
+		{message: "du: cannot read directory", err: true},
+	} {
+		bytes, objects, err := ParseStorageUsage(tc.message)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", tc.message)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.message, err)
+			continue
+		}
+		if bytes != tc.bytes || objects != tc.objects {
+			t.Errorf("%q: got %d bytes and %d objects, want %d and %d", tc.message, bytes, objects, tc.bytes, tc.objects)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package azure
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
@@ -20,6 +21,7 @@ import (
 	autorestazure "github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/Azure/msi-dataplane/pkg/dataplane"
+	"golang.org/x/time/rate"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -50,6 +52,10 @@ const (
 	storageExistsReasonAccountDeleted    = "AccountDeleted"
 	storageExistsReasonAccountNotFound   = "AccountNotFound"
 	azureCredentialsKey                  = "AzureCredentials"
+
+	// registryRootPrefix is where the registry keeps its content in the
+	// container.
+	registryRootPrefix = "/docker/"
 )
 
 // globalAzureCredentials caches User Assigned Managed Identity (UAMI) credentials across driver instances so that
@@ -182,7 +188,7 @@ func (d *driver) createStorageAccount(storageClient azureclient.StorageAccountCl
 func (d *driver) getAccountPrimaryKey(storageClient azureclient.StorageAccountClient, resourceGroupName, accountName string) (string, error) {
 	key, err := primaryKey.get(d.Context, storageClient, resourceGroupName, accountName)
 	if err != nil {
-		wrappedErr := fmt.Errorf("failed to get keys for the storage account %s: %s", accountName, err)
+		wrappedErr := fmt.Errorf("failed to get keys for the storage account %s: %w", accountName, err)
 		if respErr, ok := err.(*azcore.ResponseError); ok {
 			if respErr.StatusCode == http.StatusNotFound {
 				return "", &errDoesNotExist{Err: wrappedErr}
@@ -224,6 +230,13 @@ func (d *driver) createStorageContainer(environment autorestazure.Environment, a
 	return err
 }
 
+// isContainerAlreadyExists returns true if the legacy storage api refused
+// to create a container because it already exists.
+func isContainerAlreadyExists(err error) bool {
+	e, ok := err.(azblob.StorageError)
+	return ok && e.ServiceCode() == azblob.ServiceCodeContainerAlreadyExists
+}
+
 func (d *driver) deleteStorageContainer(environment autorestazure.Environment, accountName, key, containerName string) error {
 	container, err := d.getStorageContainer(environment, accountName, key, containerName)
 	if err != nil {
@@ -253,6 +266,9 @@ type driver struct {
 	// policies is for new Azure Client Pipeline execution.
 	// Added as a member to the struct to allow injection for testing.
 	policies []policy.Policy
+
+	// created is set by CreateStorage when it created the container.
+	created bool
 }
 
 // NewDriver creates a new storage driver for Azure Blob Storage.
@@ -330,7 +346,7 @@ func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 		}
 		storageClient := azureclient.NewStorageAccountClient(azClient, d.Config.CloudName)
 
-		key, err = d.getAccountPrimaryKey(storageClient, cfg.ResourceGroup, d.Config.AccountName)
+		key, err = d.getRegistryAccountKey(storageClient, cfg.ResourceGroup, d.Config.AccountName)
 		if err != nil {
 			return nil, err
 		}
@@ -338,7 +354,7 @@ func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 
 	if key != "" {
 		envs = append(envs,
-			envvar.EnvVar{Name: "REGISTRY_STORAGE_AZURE_ACCOUNTKEY", Value: key, Secret: true},
+			envvar.EnvVar{Name: accountKeyEnvName, Value: key, Secret: true},
 		)
 	}
 
@@ -508,7 +524,7 @@ func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
 
 // StorageChanged checks if the storage configuration has changed.
 func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
-	return !reflect.DeepEqual(cr.Status.Storage.Azure, cr.Spec.Storage.Azure)
+	return !reflect.DeepEqual(cr.Status.Storage.Azure, cr.Spec.Storage.Azure) || encryptionChanged(cr) || lifecycleChanged(cr) || networkRulesChanged(cr)
 }
 
 func (d *driver) assurePrivateAccount(cfg *Azure, infra *configv1.Infrastructure, tagset map[string]*string, accountName string) (string, error) {
@@ -696,16 +712,19 @@ func (d *driver) assureContainerViaTrack2SDK(cfg *Azure) (string, bool, error) {
 		return "", false, err
 	}
 	if d.Config.Container == "" {
-		containerName, err := util.GenerateStorageName(d.Listers, "")
+		containerName, err := util.GenerateDeterministicStorageName(d.Listers, "")
 		if err != nil {
 			return "", false, err
 		}
 
+		// the container may have been created by a previous attempt whose
+		// config update was lost, it lives in our account so we reuse it.
 		if err = blobClient.CreateStorageContainer(
 			d.Context, containerName,
-		); err != nil {
+		); err != nil && !bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
 			return "", false, err
 		}
+		d.created = err == nil
 
 		return containerName, true, nil
 	}
@@ -723,6 +742,7 @@ func (d *driver) assureContainerViaTrack2SDK(cfg *Azure) (string, bool, error) {
 	); err != nil {
 		return "", false, err
 	}
+	d.created = true
 	return d.Config.Container, true, nil
 }
 
@@ -747,16 +767,19 @@ func (d *driver) assureContainer(cfg *Azure) (string, bool, error) {
 	}
 
 	if d.Config.Container == "" {
-		containerName, err := util.GenerateStorageName(d.Listers, "")
+		containerName, err := util.GenerateDeterministicStorageName(d.Listers, "")
 		if err != nil {
 			return "", false, err
 		}
 
+		// the container may have been created by a previous attempt whose
+		// config update was lost, it lives in our account so we reuse it.
 		if err = d.createStorageContainer(
 			environment, d.Config.AccountName, key, containerName,
-		); err != nil {
+		); err != nil && !isContainerAlreadyExists(err) {
 			return "", false, err
 		}
+		d.created = err == nil
 
 		return containerName, true, nil
 	}
@@ -774,6 +797,7 @@ func (d *driver) assureContainer(cfg *Azure) (string, bool, error) {
 	); err != nil {
 		return "", false, err
 	}
+	d.created = true
 	return d.Config.Container, true, nil
 }
 
@@ -820,6 +844,83 @@ func (d *driver) processUPI(cr *imageregistryv1.Config) {
 	)
 }
 
+// Validate checks the roles assigned to our credentials allow us to read the
+// configured storage account, to list its keys when we don't have one, and
+// to access the container. Accounts that don't exist yet are not checked,
+// CreateStorage creates them.
+func (d *driver) Validate(cr *imageregistryv1.Config) error {
+	if d.Config.AccountName == "" {
+		return nil
+	}
+
+	cfg, err := GetConfig(d.Listers.Secrets, d.Listers.Infrastructures)
+	if err != nil {
+		return err
+	}
+
+	environment, err := getEnvironmentByName(d.Config.CloudName)
+	if err != nil {
+		return err
+	}
+
+	azClient, err := d.newAzClient(cfg, environment, nil)
+	if err != nil {
+		return err
+	}
+
+	isAzureStack := azureclient.IsAzureStackCloud(d.Config.CloudName)
+	if !isAzureStack {
+		exists, err := azClient.StorageAccountExists(d.Context, cfg.ResourceGroup, d.Config.AccountName)
+		if azureclient.IsAuthorizationError(err) {
+			return util.PermissionDenied("unable to read storage account %s: %s", d.Config.AccountName, err)
+		} else if err != nil {
+			return err
+		}
+		if !exists {
+			return nil
+		}
+	}
+
+	key := cfg.AccountKey
+	if key == "" && (isAzureStack || cfg.FederatedTokenFile == "") {
+		storageClient := azureclient.NewStorageAccountClient(azClient, d.Config.CloudName)
+		key, err = d.getKey(cfg, storageClient)
+		if _, ok := err.(*errDoesNotExist); ok {
+			return nil
+		} else if azureclient.IsAuthorizationError(err) {
+			return util.PermissionDenied("unable to list the keys of storage account %s: %s", d.Config.AccountName, err)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if d.Config.Container == "" {
+		return nil
+	}
+
+	if isAzureStack {
+		_, err = d.containerExists(d.Context, environment, d.Config.AccountName, key, d.Config.Container)
+		if e, ok := err.(azblob.StorageError); ok && e.Response() != nil && e.Response().StatusCode == http.StatusForbidden {
+			return util.PermissionDenied("unable to access storage container %s: %s", d.Config.Container, e.ServiceCode())
+		}
+		return err
+	}
+
+	u, err := getBlobServiceURL(environment, d.Config.AccountName)
+	if err != nil {
+		return err
+	}
+	blobClient, err := azClient.NewBlobClient(environment, d.Config.AccountName, key, fmt.Sprintf("%s://%s/", u.Scheme, u.Host))
+	if err != nil {
+		return err
+	}
+	_, err = blobClient.ContainerExists(d.Context, d.Config.AccountName, d.Config.Container)
+	if azureclient.IsAuthorizationError(err) {
+		return util.PermissionDenied("unable to access storage container %s: %s", d.Config.Container, err)
+	}
+	return err
+}
+
 // CreateStorage attempts to create a storage account and a storage container.
 func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	cfg, err := GetConfig(d.Listers.Secrets, d.Listers.Infrastructures)
@@ -942,6 +1043,12 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		}
 	}
 
+	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		d.reconcileEncryption(cr, cfg, storageAccountName)
+		d.reconcileLifecycle(cr, cfg, storageAccountName)
+		d.reconcileNetworkRules(cr, cfg, storageAccountName)
+	}
+
 	cr.Spec.Storage.Azure = d.Config.DeepCopy()
 	cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
 		Azure: d.Config.DeepCopy(),
@@ -1118,6 +1225,16 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err erro
 		d.Config.NetworkAccess = nil
 	}
 
+	// the network rules set by the operator would deny the access to the
+	// containers of the storage account if it was kept.
+	if networkRulesApplied(cr) {
+		if err := azClient.UpdateStorageAccountNetworkRules(d.Context, cfg.ResourceGroup, d.Config.AccountName, nil); err != nil {
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to remove the network rules of the storage account: %s", err))
+			return false, err
+		}
+		util.UpdateCondition(cr, defaults.StorageNetworkRulesApplied, operatorapiv1.ConditionFalse, networkRulesReasonNone, accountNetworkRulesMessage(nil, nil))
+	}
+
 	if d.Config.Container != "" {
 		var accountNotFound bool
 		if azureclient.IsAzureStackCloud(d.Config.CloudName) {
@@ -1147,6 +1264,194 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err erro
 	return false, nil
 }
 
+// containerClient returns a client for the registry container. Azure Stack
+// Hub is only supported by the legacy SDK, its container URL is returned
+// instead.
+func (d *driver) containerClient(ctx context.Context) (*azureclient.BlobClient, *azblob.ContainerURL, error) {
+	cfg, err := GetConfig(d.Listers.Secrets, d.Listers.Infrastructures)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	environment, err := getEnvironmentByName(d.Config.CloudName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	azClient, err := d.newAzClient(cfg, environment, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	isAzureStack := azureclient.IsAzureStackCloud(d.Config.CloudName)
+	key := cfg.AccountKey
+	if key == "" && (isAzureStack || cfg.FederatedTokenFile == "") {
+		storageClient := azureclient.NewStorageAccountClient(azClient, d.Config.CloudName)
+		key, err = d.getKey(cfg, storageClient)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if isAzureStack {
+		container, err := d.getStorageContainer(environment, d.Config.AccountName, key, d.Config.Container)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, &container, nil
+	}
+
+	u, err := getBlobServiceURL(environment, d.Config.AccountName)
+	if err != nil {
+		return nil, nil, err
+	}
+	blobClient, err := azClient.NewBlobClient(environment, d.Config.AccountName, key, fmt.Sprintf("%s://%s/", u.Scheme, u.Host))
+	if err != nil {
+		return nil, nil, err
+	}
+	return blobClient, nil, nil
+}
+
+// StorageUsage returns the number of bytes and blobs stored by the registry
+// in the container. The limiter is waited on before every listing request.
+func (d *driver) StorageUsage(ctx context.Context, limiter *rate.Limiter) (int64, int64, error) {
+	if azureclient.IsAzureStackCloud(d.Config.CloudName) {
+		return 0, 0, fmt.Errorf("storage usage is not supported on Azure Stack Hub")
+	}
+
+	blobClient, _, err := d.containerClient(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return blobClient.ContainerUsage(ctx, d.Config.Container, registryRootPrefix, limiter)
+}
+
+// PutObject writes data into the blob key. It is used to probe the container.
+func (d *driver) PutObject(ctx context.Context, key string, data []byte) error {
+	blobClient, container, err := d.containerClient(ctx)
+	if err != nil {
+		return err
+	}
+	if container != nil {
+		_, err = azblob.UploadBufferToBlockBlob(ctx, data, container.NewBlockBlobURL(key), azblob.UploadToBlockBlobOptions{})
+		return err
+	}
+	return blobClient.PutBlob(ctx, d.Config.Container, key, data)
+}
+
+// GetObject reads the content of the blob key. It is used to probe the
+// container.
+func (d *driver) GetObject(ctx context.Context, key string) ([]byte, error) {
+	if d.Config.AccountName == "" || d.Config.Container == "" {
+		return nil, util.ObjectNotFound(key, fmt.Errorf("storage container not provisioned"))
+	}
+	blobClient, container, err := d.containerClient(ctx)
+	if _, ok := err.(*errDoesNotExist); ok {
+		return nil, util.ObjectNotFound(key, err)
+	} else if err != nil {
+		return nil, err
+	}
+	if container != nil {
+		resp, err := container.NewBlobURL(key).Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
+		if e, ok := err.(azblob.StorageError); ok && e.Response() != nil && e.Response().StatusCode == http.StatusNotFound {
+			return nil, util.ObjectNotFound(key, err)
+		} else if err != nil {
+			return nil, err
+		}
+		body := resp.Body(azblob.RetryReaderOptions{})
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+	data, err := blobClient.GetBlob(ctx, d.Config.Container, key)
+	if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound) {
+		return nil, util.ObjectNotFound(key, err)
+	}
+	return data, err
+}
+
+// DeleteObject removes the blob key. It is used to probe the container.
+func (d *driver) DeleteObject(ctx context.Context, key string) error {
+	blobClient, container, err := d.containerClient(ctx)
+	if err != nil {
+		return err
+	}
+	if container != nil {
+		_, err = container.NewBlobURL(key).Delete(ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+		return err
+	}
+	return blobClient.DeleteBlob(ctx, d.Config.Container, key)
+}
+
+// ListOwnedStorage returns the containers of the storage account that are
+// named after the cluster. Containers carry no tags, the account they live
+// in is what is tagged as owned by the cluster.
+func (d *driver) ListOwnedStorage(ctx context.Context) ([]util.OwnedStorage, error) {
+	if azureclient.IsAzureStackCloud(d.Config.CloudName) {
+		return nil, fmt.Errorf("listing owned storage is not supported on Azure Stack Hub")
+	}
+	if d.Config.AccountName == "" {
+		return nil, nil
+	}
+	prefix, err := util.OwnedStorageNamePrefix(d.Listers)
+	if err != nil {
+		return nil, err
+	}
+
+	blobClient, _, err := d.containerClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	containers, err := blobClient.ListContainers(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var owned []util.OwnedStorage
+	for name, modified := range containers {
+		// the creation time of a container is not exposed, the last
+		// modification of its properties is as close as we get.
+		owned = append(owned, util.OwnedStorage{
+			Name:    name,
+			Created: modified,
+		})
+	}
+	return owned, nil
+}
+
+// RemoveOwnedStorage deletes the container name when it holds nothing but
+// the ownership marker and the canary blobs. Containers holding any other
+// blob, registry content or not, are left untouched.
+func (d *driver) RemoveOwnedStorage(ctx context.Context, name string) (bool, error) {
+	if azureclient.IsAzureStackCloud(d.Config.CloudName) {
+		return false, fmt.Errorf("removing owned storage is not supported on Azure Stack Hub")
+	}
+
+	blobClient, _, err := d.containerClient(ctx)
+	if err != nil {
+		return false, err
+	}
+	empty := true
+	if err := blobClient.ListBlobs(ctx, name, func(blob string) bool {
+		empty = util.IsOperatorObject(blob)
+		return empty
+	}); err != nil {
+		return false, err
+	}
+	if !empty {
+		return false, nil
+	}
+	if err := blobClient.DeleteStorageContainer(ctx, name); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// StorageCreated tells whether CreateStorage created the container, rather
+// than reusing one that already existed.
+func (d *driver) StorageCreated() bool {
+	return d.created
+}
+
 // ID return the underlying storage identificator, on this case the Azure
 // container name.
 func (d *driver) ID() string {
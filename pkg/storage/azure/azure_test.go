@@ -37,6 +37,7 @@ import (
 	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/azure/azureclient"
 )
 
 const mockTenantID = "00000000-0000-0000-0000-000000000000"
@@ -941,6 +942,7 @@ func Test_assureContainer(t *testing.T) {
 			Name: "cluster",
 		},
 		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-cluster-abc12",
 			PlatformStatus: &configv1.PlatformStatus{
 				Type: configv1.AzurePlatformType,
 				Azure: &configv1.AzurePlatformStatus{
@@ -1059,12 +1061,29 @@ func Test_assureContainer(t *testing.T) {
 			},
 		},
 		{
-			name:      "generate container with success",
-			generated: true,
+			name:          "generate container with success",
+			containerName: "test-cluster-abc12-image-registry",
+			generated:     true,
 			mockResponses: []*http.Response{
 				mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`),
 			},
 		},
+		{
+			name:          "generated container already exists (retry after conflict)",
+			containerName: "test-cluster-abc12-image-registry",
+			generated:     true,
+			mockResponses: []*http.Response{
+				mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`),
+			},
+			httpSender: func(req int) func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
+				return func(_ context.Context, _ pipeline.Request) (pipeline.Response, error) {
+					r := mocks.NewResponseWithStatus("", http.StatusConflict)
+					r.Header = map[string][]string{}
+					r.Header.Add("x-ms-error-code", "ContainerAlreadyExists")
+					return pipeline.NewHTTPResponse(r), nil
+				}
+			},
+		},
 		{
 			name: "invalid environment",
 			err:  `There is no cloud environment matching the name "INVALID"`,
@@ -1280,6 +1299,7 @@ func Test_storageManagementStateNonAzureStackHub(t *testing.T) {
 			Name: "cluster",
 		},
 		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-cluster-abc12",
 			PlatformStatus: &configv1.PlatformStatus{
 				Type: configv1.AzurePlatformType,
 				Azure: &configv1.AzurePlatformStatus{
@@ -1427,6 +1447,36 @@ func Test_storageManagementStateNonAzureStackHub(t *testing.T) {
 				}
 			}(),
 		},
+		{
+			name: "user providing account name (generated container already exists)",
+			registryConfig: &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{
+							AccountName: "foobar456",
+						},
+					},
+				},
+			},
+			checkFn: func(cr *imageregistryv1.Config) {
+				if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+					t.Errorf("expected to be managed, %q instead", cr.Spec.Storage.ManagementState)
+				}
+				if cr.Spec.Storage.Azure.Container != "test-cluster-abc12-image-registry" {
+					t.Errorf("unexpected container %s", cr.Spec.Storage.Azure.Container)
+				}
+			},
+			mockResponses: func() []*http.Response {
+				containerExistsResp := mocks.NewResponseWithStatus("Conflict", http.StatusConflict)
+				containerExistsResp.Header = http.Header{}
+				containerExistsResp.Header.Add("x-ms-error-code", "ContainerAlreadyExists")
+				return []*http.Response{
+					mocks.NewResponseWithContent(`{"nameAvailable":false}`),                                               // CheckNameAvailability - account exists
+					mocks.NewResponseWithContent(`{"keys":[{"keyName":"key1","value":"firstKey","permissions":"Full"}]}`), // ListKeys
+					containerExistsResp, // Container create - created by a previous attempt
+				}
+			}(),
+		},
 		{
 			name: "do not overwrite management state already set by user",
 			registryConfig: &imageregistryv1.Config{
@@ -1649,3 +1699,934 @@ func TestEnsureUAMICredentials_CacheUsage(t *testing.T) {
 		t.Errorf("expected same credential from cache, got different tokens: %q vs %q", token1.Token, token2.Token)
 	}
 }
+
+// requestCapturingDoer records the requests sent while providing mock
+// responses, by method and path suffix.
+type requestCapturingDoer struct {
+	responses map[string]mockResponse
+	requests  []capturedRequest
+}
+
+type capturedRequest struct {
+	method string
+	path   string
+	body   map[string]interface{}
+}
+
+func (m *requestCapturingDoer) Do(r *policy.Request) (*http.Response, error) {
+	req := capturedRequest{method: r.Raw().Method, path: r.Raw().URL.Path}
+	if r.Raw().Body != nil {
+		bodyBytes, _ := io.ReadAll(r.Raw().Body)
+		r.Raw().Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+		_ = json.Unmarshal(bodyBytes, &req.body)
+	}
+	m.requests = append(m.requests, req)
+
+	resp := mockResponse{statusCode: http.StatusOK, body: `{}`}
+	for key, r := range m.responses {
+		method, suffix, _ := strings.Cut(key, " ")
+		if req.method == method && strings.HasSuffix(req.path, suffix) {
+			resp = r
+		}
+	}
+	return &http.Response{
+		StatusCode: resp.statusCode,
+		Request:    r.Raw(),
+		Body:       io.NopCloser(bytes.NewBufferString(resp.body)),
+		Header:     http.Header{},
+	}, nil
+}
+
+func TestCreateStorageEncryption(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-cluster-abc12",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AzurePlatformType,
+				Azure: &configv1.AzurePlatformStatus{
+					ResourceGroupName: "resourcegroup",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"azure_subscription_id": []byte("subscription_id"),
+			"azure_client_id":       []byte("client_id"),
+			"azure_tenant_id":       []byte(mockTenantID),
+			"azure_client_secret":   []byte("client_secret"),
+			"azure_resourcegroup":   []byte("resourcegroup"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	identity := "/subscriptions/subscription_id/resourceGroups/resourcegroup/providers/Microsoft.ManagedIdentity/userAssignedIdentities/registry"
+	customerManagedKey := map[string]string{
+		defaults.AzureEncryptionKeyVaultURIAnnotation: "https://registry-keys.vault.azure.net/",
+		defaults.AzureEncryptionKeyNameAnnotation:     "registry",
+		defaults.AzureEncryptionIdentityAnnotation:    identity,
+	}
+
+	for _, tt := range []struct {
+		name            string
+		annotations     map[string]string
+		account         string
+		expectedStatus  operatorapiv1.ConditionStatus
+		expectedReason  string
+		expectedMessage string
+		expectedPatch   map[string]interface{}
+	}{
+		{
+			name:            "platform-managed keys",
+			account:         `{"name":"account","properties":{"encryption":{"keySource":"Microsoft.Storage"}}}`,
+			expectedStatus:  operatorapiv1.ConditionTrue,
+			expectedReason:  "PlatformManagedKeys",
+			expectedMessage: "Storage account is encrypted with platform-managed keys",
+		},
+		{
+			name:            "customer-managed key",
+			annotations:     customerManagedKey,
+			account:         `{"name":"account","identity":{"type":"SystemAssigned"},"properties":{"encryption":{"keySource":"Microsoft.Storage"}}}`,
+			expectedStatus:  operatorapiv1.ConditionTrue,
+			expectedReason:  "CustomerManagedKey",
+			expectedMessage: "Storage account is encrypted with the latest version of key registry of key vault https://registry-keys.vault.azure.net/, accessed as " + identity,
+			expectedPatch: map[string]interface{}{
+				"identity": map[string]interface{}{
+					"type": "SystemAssigned,UserAssigned",
+					"userAssignedIdentities": map[string]interface{}{
+						identity: map[string]interface{}{},
+					},
+				},
+				"properties": map[string]interface{}{
+					"encryption": map[string]interface{}{
+						"keySource": "Microsoft.Keyvault",
+						"keyvaultproperties": map[string]interface{}{
+							"keyvaulturi": "https://registry-keys.vault.azure.net/",
+							"keyname":     "registry",
+							"keyversion":  "",
+						},
+						"identity": map[string]interface{}{
+							"userAssignedIdentity": identity,
+						},
+						"services": map[string]interface{}{
+							"blob": map[string]interface{}{"enabled": true},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:        "customer-managed key already set",
+			annotations: customerManagedKey,
+			account: `{"name":"account","properties":{"encryption":{"keySource":"Microsoft.Keyvault",` +
+				`"keyvaultproperties":{"keyvaulturi":"https://registry-keys.vault.azure.net","keyname":"registry","keyversion":""},` +
+				`"identity":{"userAssignedIdentity":"` + identity + `"}}}}`,
+			expectedStatus:  operatorapiv1.ConditionTrue,
+			expectedReason:  "CustomerManagedKey",
+			expectedMessage: "Storage account is encrypted with the latest version of key registry of key vault https://registry-keys.vault.azure.net/, accessed as " + identity,
+		},
+		{
+			name: "key vault outside of the cloud",
+			annotations: map[string]string{
+				defaults.AzureEncryptionKeyVaultURIAnnotation: "https://registry-keys.vault.example.com",
+				defaults.AzureEncryptionKeyNameAnnotation:     "registry",
+				defaults.AzureEncryptionIdentityAnnotation:    identity,
+			},
+			expectedStatus:  operatorapiv1.ConditionFalse,
+			expectedReason:  "InvalidKeyReference",
+			expectedMessage: `Invalid customer-managed key: the key vault URI "https://registry-keys.vault.example.com" is not in the vault.azure.net domain of the AzurePublicCloud cloud`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: tt.annotations,
+				},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						ManagementState: imageregistryv1.StorageManagementStateManaged,
+						Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{
+							AccountName: "account",
+							Container:   "container",
+						},
+					},
+				},
+			}
+
+			doer := &requestCapturingDoer{
+				responses: map[string]mockResponse{
+					"POST /checkNameAvailability":  {statusCode: http.StatusOK, body: `{"nameAvailable":false}`},
+					"POST /listKeys":               {statusCode: http.StatusOK, body: `{"keys":[{"keyName":"key1","value":"firstKey","permissions":"Full"}]}`},
+					"GET /storageAccounts/account": {statusCode: http.StatusOK, body: tt.account},
+				},
+			}
+			drv := NewDriver(context.Background(), cr.Spec.Storage.Azure, &listers.StorageListers)
+			drv.policies = []policy.Policy{doer}
+
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var cond operatorapiv1.OperatorCondition
+			for _, c := range cr.Status.Conditions {
+				if c.Type == defaults.StorageEncrypted {
+					cond = c
+				}
+			}
+			if cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason || cond.Message != tt.expectedMessage {
+				t.Errorf("unexpected %s condition: %s %s: %s", defaults.StorageEncrypted, cond.Status, cond.Reason, cond.Message)
+			}
+			// invalid keys are not retried until they are changed
+			if encryptionChanged(cr) {
+				t.Errorf("unexpected encryption changed: %t", encryptionChanged(cr))
+			}
+
+			var patch map[string]interface{}
+			for _, req := range doer.requests {
+				if req.method == http.MethodPatch {
+					patch = req.body
+				}
+			}
+			if !reflect.DeepEqual(patch, tt.expectedPatch) {
+				t.Errorf("unexpected storage account update: %s", cmp.Diff(tt.expectedPatch, patch))
+			}
+		})
+	}
+}
+
+func TestValidateAccountEncryption(t *testing.T) {
+	identity := "/subscriptions/subscription_id/resourceGroups/resourcegroup/providers/Microsoft.ManagedIdentity/userAssignedIdentities/registry"
+	for _, tt := range []struct {
+		name string
+		enc  azureclient.StorageAccountEncryption
+		err  string
+	}{
+		{
+			name: "pinned key version",
+			enc: azureclient.StorageAccountEncryption{
+				KeyVaultURI:          "https://registry-keys.vault.azure.net",
+				KeyName:              "registry",
+				KeyVersion:           "0123456789abcdef0123456789abcdef",
+				UserAssignedIdentity: identity,
+			},
+		},
+		{
+			name: "key URI instead of key vault URI",
+			enc: azureclient.StorageAccountEncryption{
+				KeyVaultURI:          "https://registry-keys.vault.azure.net/keys/registry",
+				KeyName:              "registry",
+				UserAssignedIdentity: identity,
+			},
+			err: `the key vault URI "https://registry-keys.vault.azure.net/keys/registry" is not the https URI of a key vault`,
+		},
+		{
+			name: "invalid key name",
+			enc: azureclient.StorageAccountEncryption{
+				KeyVaultURI:          "https://registry-keys.vault.azure.net",
+				KeyName:              "registry_key",
+				UserAssignedIdentity: identity,
+			},
+			err: `the key name "registry_key" is not a valid key vault key name`,
+		},
+		{
+			name: "invalid key version",
+			enc: azureclient.StorageAccountEncryption{
+				KeyVaultURI:          "https://registry-keys.vault.azure.net",
+				KeyName:              "registry",
+				KeyVersion:           "latest",
+				UserAssignedIdentity: identity,
+			},
+			err: `the key version "latest" is not a valid key vault key version`,
+		},
+		{
+			name: "missing identity",
+			enc: azureclient.StorageAccountEncryption{
+				KeyVaultURI: "https://registry-keys.vault.azure.net",
+				KeyName:     "registry",
+			},
+			err: `the identity "" is not the resource ID of a user-assigned identity`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAccountEncryption(&tt.enc, autorestazure.PublicCloud)
+			if (err == nil && tt.err != "") || (err != nil && err.Error() != tt.err) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestCreateStorageLifecycle(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-cluster-abc12",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AzurePlatformType,
+				Azure: &configv1.AzurePlatformStatus{
+					ResourceGroupName: "resourcegroup",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"azure_subscription_id": []byte("subscription_id"),
+			"azure_client_id":       []byte("client_id"),
+			"azure_tenant_id":       []byte(mockTenantID),
+			"azure_client_secret":   []byte("client_secret"),
+			"azure_resourcegroup":   []byte("resourcegroup"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	uploadCleanupRule := map[string]interface{}{
+		"name":    "openshift-image-registry-incomplete-uploads",
+		"type":    "Lifecycle",
+		"enabled": true,
+		"definition": map[string]interface{}{
+			"filters": map[string]interface{}{
+				"blobTypes":   []interface{}{"appendBlob"},
+				"prefixMatch": []interface{}{"container/docker/registry/v2/repositories/"},
+			},
+			"actions": map[string]interface{}{
+				"baseBlob": map[string]interface{}{
+					"delete": map[string]interface{}{"daysAfterModificationGreaterThan": float64(1)},
+				},
+			},
+		},
+	}
+	otherRule := map[string]interface{}{
+		"name":    "archive",
+		"type":    "Lifecycle",
+		"enabled": true,
+		"definition": map[string]interface{}{
+			"filters": map[string]interface{}{
+				"blobTypes": []interface{}{"blockBlob"},
+			},
+			"actions": map[string]interface{}{
+				"baseBlob": map[string]interface{}{
+					"tierToArchive": map[string]interface{}{"daysAfterModificationGreaterThan": float64(30)},
+				},
+			},
+		},
+	}
+	policyWith := func(rules ...interface{}) string {
+		body, _ := json.Marshal(map[string]interface{}{
+			"properties": map[string]interface{}{
+				"policy": map[string]interface{}{"rules": rules},
+			},
+		})
+		return string(body)
+	}
+	staleRule := map[string]interface{}{
+		"name":       "openshift-image-registry-incomplete-uploads",
+		"type":       "Lifecycle",
+		"enabled":    false,
+		"definition": uploadCleanupRule["definition"],
+	}
+
+	for _, tt := range []struct {
+		name                       string
+		annotations                map[string]string
+		conditions                 []operatorapiv1.OperatorCondition
+		policy                     mockResponse
+		blobService                string
+		expectedPolicy             map[string]interface{}
+		expectedBlobService        map[string]interface{}
+		expectedBlobCondition      string
+		expectedContainerCondition string
+	}{
+		{
+			name:                       "no management policy",
+			policy:                     mockResponse{statusCode: http.StatusNotFound, body: `{"error":{"code":"ManagementPolicyNotFound"}}`},
+			expectedPolicy:             map[string]interface{}{"properties": map[string]interface{}{"policy": map[string]interface{}{"rules": []interface{}{uploadCleanupRule}}}},
+			expectedBlobCondition:      "False SoftDeleteDisabled: Soft-delete of blobs is not enabled by the operator",
+			expectedContainerCondition: "False SoftDeleteDisabled: Soft-delete of containers is not enabled by the operator",
+		},
+		{
+			name:                       "stale rule among other rules",
+			policy:                     mockResponse{statusCode: http.StatusOK, body: policyWith(otherRule, staleRule)},
+			expectedPolicy:             map[string]interface{}{"properties": map[string]interface{}{"policy": map[string]interface{}{"rules": []interface{}{otherRule, uploadCleanupRule}}}},
+			expectedBlobCondition:      "False SoftDeleteDisabled: Soft-delete of blobs is not enabled by the operator",
+			expectedContainerCondition: "False SoftDeleteDisabled: Soft-delete of containers is not enabled by the operator",
+		},
+		{
+			name: "soft-delete requested",
+			annotations: map[string]string{
+				defaults.AzureBlobSoftDeleteRetentionDaysAnnotation:      "7",
+				defaults.AzureContainerSoftDeleteRetentionDaysAnnotation: "14",
+			},
+			policy:      mockResponse{statusCode: http.StatusOK, body: policyWith(uploadCleanupRule)},
+			blobService: `{"properties":{"deleteRetentionPolicy":{"enabled":true,"days":3}}}`,
+			expectedBlobService: map[string]interface{}{
+				"properties": map[string]interface{}{
+					"deleteRetentionPolicy":          map[string]interface{}{"enabled": true, "days": float64(7)},
+					"containerDeleteRetentionPolicy": map[string]interface{}{"enabled": true, "days": float64(14)},
+				},
+			},
+			expectedBlobCondition:      "True SoftDeleteEnabled: Deleted blobs are kept for 7 days",
+			expectedContainerCondition: "True SoftDeleteEnabled: Deleted containers are kept for 14 days",
+		},
+		{
+			name: "soft-delete already set",
+			annotations: map[string]string{
+				defaults.AzureBlobSoftDeleteRetentionDaysAnnotation: "7",
+			},
+			policy:                     mockResponse{statusCode: http.StatusOK, body: policyWith(uploadCleanupRule)},
+			blobService:                `{"properties":{"deleteRetentionPolicy":{"enabled":true,"days":7},"containerDeleteRetentionPolicy":{"enabled":true,"days":30}}}`,
+			expectedBlobCondition:      "True SoftDeleteEnabled: Deleted blobs are kept for 7 days",
+			expectedContainerCondition: "False SoftDeleteDisabled: Soft-delete of containers is not enabled by the operator",
+		},
+		{
+			name: "soft-delete enabled by the operator no longer requested",
+			annotations: map[string]string{
+				defaults.AzureContainerSoftDeleteRetentionDaysAnnotation: "0",
+			},
+			conditions: []operatorapiv1.OperatorCondition{
+				{Type: defaults.StorageBlobSoftDeleteEnabled, Status: operatorapiv1.ConditionTrue, Reason: "SoftDeleteEnabled"},
+				{Type: defaults.StorageContainerSoftDeleteEnabled, Status: operatorapiv1.ConditionTrue, Reason: "SoftDeleteEnabled"},
+			},
+			policy:      mockResponse{statusCode: http.StatusOK, body: policyWith(uploadCleanupRule)},
+			blobService: `{"properties":{"deleteRetentionPolicy":{"enabled":true,"days":7},"containerDeleteRetentionPolicy":{"enabled":true,"days":14}}}`,
+			expectedBlobService: map[string]interface{}{
+				"properties": map[string]interface{}{
+					"deleteRetentionPolicy":          map[string]interface{}{"enabled": false},
+					"containerDeleteRetentionPolicy": map[string]interface{}{"enabled": false},
+				},
+			},
+			expectedBlobCondition:      "False SoftDeleteDisabled: Soft-delete of blobs is not enabled by the operator",
+			expectedContainerCondition: "False SoftDeleteDisabled: Soft-delete of containers is not enabled by the operator",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: tt.annotations,
+				},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						ManagementState: imageregistryv1.StorageManagementStateManaged,
+						Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{
+							AccountName: "account",
+							Container:   "container",
+						},
+					},
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					OperatorStatus: operatorapiv1.OperatorStatus{
+						Conditions: tt.conditions,
+					},
+				},
+			}
+
+			blobService := tt.blobService
+			if blobService == "" {
+				blobService = `{"properties":{}}`
+			}
+			doer := &requestCapturingDoer{
+				responses: map[string]mockResponse{
+					"POST /checkNameAvailability":     {statusCode: http.StatusOK, body: `{"nameAvailable":false}`},
+					"POST /listKeys":                  {statusCode: http.StatusOK, body: `{"keys":[{"keyName":"key1","value":"firstKey","permissions":"Full"}]}`},
+					"GET /storageAccounts/account":    {statusCode: http.StatusOK, body: `{"name":"account","properties":{"encryption":{"keySource":"Microsoft.Storage"}}}`},
+					"GET /managementPolicies/default": tt.policy,
+					"GET /blobServices/default":       {statusCode: http.StatusOK, body: blobService},
+				},
+			}
+			drv := NewDriver(context.Background(), cr.Spec.Storage.Azure, &listers.StorageListers)
+			drv.policies = []policy.Policy{doer}
+
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			conditions := map[string]string{}
+			for _, c := range cr.Status.Conditions {
+				conditions[c.Type] = fmt.Sprintf("%s %s: %s", c.Status, c.Reason, c.Message)
+			}
+			for conditionType, expected := range map[string]string{
+				defaults.StorageIncompleteUploadCleanupEnabled: "True EnableCleanupSuccessful: Default cleanup of incomplete uploads after one (1) day was successfully enabled",
+				defaults.StorageBlobSoftDeleteEnabled:          tt.expectedBlobCondition,
+				defaults.StorageContainerSoftDeleteEnabled:     tt.expectedContainerCondition,
+			} {
+				if conditions[conditionType] != expected {
+					t.Errorf("expected %s condition %q, got %q", conditionType, expected, conditions[conditionType])
+				}
+			}
+			if lifecycleChanged(cr) {
+				t.Errorf("expected the lifecycle to be applied")
+			}
+			changed := cr.DeepCopy()
+			changed.Annotations = map[string]string{
+				defaults.AzureBlobSoftDeleteRetentionDaysAnnotation: "3",
+				defaults.StorageSettingsAnnotation:                  cr.Annotations[defaults.StorageSettingsAnnotation],
+			}
+			if !lifecycleChanged(changed) {
+				t.Errorf("expected the soft-delete change to be detected")
+			}
+
+			var policyUpdate, blobServiceUpdate map[string]interface{}
+			for _, req := range doer.requests {
+				if req.method != http.MethodPut {
+					continue
+				}
+				switch {
+				case strings.HasSuffix(req.path, "/managementPolicies/default"):
+					policyUpdate = req.body
+				case strings.HasSuffix(req.path, "/blobServices/default"):
+					blobServiceUpdate = req.body
+				}
+			}
+			if !reflect.DeepEqual(policyUpdate, tt.expectedPolicy) {
+				t.Errorf("unexpected management policy update: %s", cmp.Diff(tt.expectedPolicy, policyUpdate))
+			}
+			if !reflect.DeepEqual(blobServiceUpdate, tt.expectedBlobService) {
+				t.Errorf("unexpected blob service update: %s", cmp.Diff(tt.expectedBlobService, blobServiceUpdate))
+			}
+		})
+	}
+}
+
+func TestCreateStorageNetworkRules(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-cluster-abc12",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AzurePlatformType,
+				Azure: &configv1.AzurePlatformStatus{
+					ResourceGroupName: "resourcegroup",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"azure_subscription_id": []byte("subscription_id"),
+			"azure_client_id":       []byte("client_id"),
+			"azure_tenant_id":       []byte(mockTenantID),
+			"azure_client_secret":   []byte("client_secret"),
+			"azure_resourcegroup":   []byte("resourcegroup"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	subnetID := "/subscriptions/subscription_id/resourceGroups/resourcegroup/providers/Microsoft.Network/virtualNetworks/vnet/subnets/worker"
+	appliedRules := fmt.Sprintf(`{"defaultAction":"Deny","bypass":"AzureServices","ipRules":[{"value":"203.0.113.0/24","action":"Allow"},{"value":"198.51.100.7","action":"Allow"}],"virtualNetworkRules":[{"id":%q,"action":"Allow"}]}`, strings.ToLower(subnetID))
+	appliedMessage := "Public network access to the storage account is restricted to IP ranges [203.0.113.0/24, 198.51.100.7] and subnets [" + subnetID + "], bypassed by AzureServices"
+
+	for _, tt := range []struct {
+		name              string
+		annotations       map[string]string
+		conditions        []operatorapiv1.OperatorCondition
+		networkRules      string
+		expectedUpdate    map[string]interface{}
+		expectedCondition string
+	}{
+		{
+			name:              "no network rules",
+			expectedCondition: "False NoNetworkRules: No network rules are set on the storage account by the operator",
+		},
+		{
+			name: "network rules requested",
+			annotations: map[string]string{
+				defaults.AzureNetworkRuleIPRangesAnnotation: "203.0.113.0/24, 198.51.100.7/32",
+				defaults.AzureNetworkRuleSubnetsAnnotation:  subnetID,
+			},
+			expectedUpdate: map[string]interface{}{
+				"properties": map[string]interface{}{
+					"networkAcls": map[string]interface{}{
+						"defaultAction": "Deny",
+						"bypass":        "AzureServices",
+						"ipRules": []interface{}{
+							map[string]interface{}{"value": "203.0.113.0/24", "action": "Allow"},
+							map[string]interface{}{"value": "198.51.100.7", "action": "Allow"},
+						},
+						"virtualNetworkRules": []interface{}{
+							map[string]interface{}{"id": subnetID, "action": "Allow"},
+						},
+					},
+				},
+			},
+			expectedCondition: "True NetworkRulesApplied: " + appliedMessage,
+		},
+		{
+			name: "network rules already set",
+			annotations: map[string]string{
+				defaults.AzureNetworkRuleIPRangesAnnotation: "198.51.100.7,203.0.113.0/24",
+				defaults.AzureNetworkRuleSubnetsAnnotation:  subnetID,
+			},
+			networkRules:      appliedRules,
+			expectedCondition: "True NetworkRulesApplied: Public network access to the storage account is restricted to IP ranges [198.51.100.7, 203.0.113.0/24] and subnets [" + subnetID + "], bypassed by AzureServices",
+		},
+		{
+			name: "logging bypass requested",
+			annotations: map[string]string{
+				defaults.AzureNetworkRuleIPRangesAnnotation: "198.51.100.7",
+				defaults.AzureNetworkRuleBypassAnnotation:   "logging,azureservices",
+			},
+			expectedUpdate: map[string]interface{}{
+				"properties": map[string]interface{}{
+					"networkAcls": map[string]interface{}{
+						"defaultAction": "Deny",
+						"bypass":        "Logging, AzureServices",
+						"ipRules": []interface{}{
+							map[string]interface{}{"value": "198.51.100.7", "action": "Allow"},
+						},
+						"virtualNetworkRules": []interface{}{},
+					},
+				},
+			},
+			expectedCondition: "True NetworkRulesApplied: Public network access to the storage account is restricted to IP ranges [198.51.100.7] and subnets [], bypassed by Logging, AzureServices",
+		},
+		{
+			name: "network rules no longer requested",
+			conditions: []operatorapiv1.OperatorCondition{
+				{Type: defaults.StorageNetworkRulesApplied, Status: operatorapiv1.ConditionTrue, Reason: "NetworkRulesApplied", Message: appliedMessage},
+			},
+			networkRules: appliedRules,
+			expectedUpdate: map[string]interface{}{
+				"properties": map[string]interface{}{
+					"networkAcls": map[string]interface{}{
+						"defaultAction":       "Allow",
+						"bypass":              "AzureServices",
+						"ipRules":             []interface{}{},
+						"virtualNetworkRules": []interface{}{},
+					},
+				},
+			},
+			expectedCondition: "False NoNetworkRules: No network rules are set on the storage account by the operator",
+		},
+		{
+			name: "private IP range",
+			annotations: map[string]string{
+				defaults.AzureNetworkRuleIPRangesAnnotation: "10.0.0.0/16",
+			},
+			expectedCondition: `False InvalidNetworkRules: Invalid network rules: "10.0.0.0/16" is not a public IP range`,
+		},
+		{
+			name: "invalid subnet",
+			annotations: map[string]string{
+				defaults.AzureNetworkRuleSubnetsAnnotation: "worker",
+			},
+			expectedCondition: `False InvalidNetworkRules: Invalid network rules: "worker" is not the resource ID of a subnet`,
+		},
+		{
+			name: "invalid bypass",
+			annotations: map[string]string{
+				defaults.AzureNetworkRuleIPRangesAnnotation: "198.51.100.7",
+				defaults.AzureNetworkRuleBypassAnnotation:   "AzureServices,Backup",
+			},
+			expectedCondition: `False InvalidNetworkRules: Invalid network rules: "Backup" is not a service the network rules can be bypassed for`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: tt.annotations,
+				},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						ManagementState: imageregistryv1.StorageManagementStateManaged,
+						Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{
+							AccountName: "account",
+							Container:   "container",
+						},
+					},
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					OperatorStatus: operatorapiv1.OperatorStatus{
+						Conditions: tt.conditions,
+					},
+				},
+			}
+
+			account := `{"name":"account","properties":{"encryption":{"keySource":"Microsoft.Storage"}}}`
+			if tt.networkRules != "" {
+				account = `{"name":"account","properties":{"encryption":{"keySource":"Microsoft.Storage"},"networkAcls":` + tt.networkRules + `}}`
+			}
+			doer := &requestCapturingDoer{
+				responses: map[string]mockResponse{
+					"POST /checkNameAvailability":  {statusCode: http.StatusOK, body: `{"nameAvailable":false}`},
+					"POST /listKeys":               {statusCode: http.StatusOK, body: `{"keys":[{"keyName":"key1","value":"firstKey","permissions":"Full"}]}`},
+					"GET /storageAccounts/account": {statusCode: http.StatusOK, body: account},
+				},
+			}
+			drv := NewDriver(context.Background(), cr.Spec.Storage.Azure, &listers.StorageListers)
+			drv.policies = []policy.Policy{doer}
+
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var condition string
+			for _, c := range cr.Status.Conditions {
+				if c.Type == defaults.StorageNetworkRulesApplied {
+					condition = fmt.Sprintf("%s %s: %s", c.Status, c.Reason, c.Message)
+				}
+			}
+			if condition != tt.expectedCondition {
+				t.Errorf("expected condition %q, got %q", tt.expectedCondition, condition)
+			}
+			if networkRulesChanged(cr) {
+				t.Errorf("expected the network rules to be applied")
+			}
+
+			var update map[string]interface{}
+			for _, req := range doer.requests {
+				if req.method != http.MethodPatch || !strings.HasSuffix(req.path, "/storageAccounts/account") {
+					continue
+				}
+				if properties, ok := req.body["properties"].(map[string]interface{}); ok && properties["networkAcls"] != nil {
+					update = req.body
+				}
+			}
+			if !reflect.DeepEqual(update, tt.expectedUpdate) {
+				t.Errorf("unexpected storage account update: %s", cmp.Diff(tt.expectedUpdate, update))
+			}
+		})
+	}
+}
+
+func TestRegistryAccountKey(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		deployed        string
+		expectedKey     string
+		expectedStandby string
+	}{
+		{
+			name:            "registry not configured yet",
+			expectedKey:     "firstKey",
+			expectedStandby: "key2",
+		},
+		{
+			name:            "registry configured with the primary key",
+			deployed:        "firstKey",
+			expectedKey:     "firstKey",
+			expectedStandby: "key2",
+		},
+		{
+			name:            "registry switched to the secondary key",
+			deployed:        "secondKey",
+			expectedKey:     "secondKey",
+			expectedStandby: "key1",
+		},
+		{
+			name:            "registry configured with a regenerated key",
+			deployed:        "staleKey",
+			expectedKey:     "firstKey",
+			expectedStandby: "key2",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := cirofake.NewFixturesBuilder()
+			builder.AddInfraConfig(&configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Status: configv1.InfrastructureStatus{
+					PlatformStatus: &configv1.PlatformStatus{
+						Type: configv1.AzurePlatformType,
+						Azure: &configv1.AzurePlatformStatus{
+							ResourceGroupName: "resourcegroup",
+						},
+					},
+				},
+			})
+			builder.AddSecrets(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.CloudCredentialsName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string][]byte{
+					"azure_subscription_id": []byte("subscription_id"),
+					"azure_client_id":       []byte("client_id"),
+					"azure_tenant_id":       []byte(mockTenantID),
+					"azure_client_secret":   []byte("client_secret"),
+					"azure_resourcegroup":   []byte("resourcegroup"),
+				},
+			})
+			if tt.deployed != "" {
+				builder.AddSecrets(&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      defaults.ImageRegistryPrivateConfiguration,
+						Namespace: defaults.ImageRegistryOperatorNamespace,
+					},
+					Data: map[string][]byte{
+						"REGISTRY_STORAGE_AZURE_ACCOUNTKEY": []byte(tt.deployed),
+					},
+				})
+			}
+			listers := builder.BuildListers()
+
+			doer := &requestCapturingDoer{
+				responses: map[string]mockResponse{
+					"POST /listKeys": {statusCode: http.StatusOK, body: `{"keys":[{"keyName":"key1","value":"firstKey","permissions":"Full"},{"keyName":"key2","value":"secondKey","permissions":"Full"}]}`},
+				},
+			}
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{
+				AccountName: "account",
+				Container:   "container",
+			}, &listers.StorageListers)
+			drv.policies = []policy.Policy{doer}
+			primaryKey = cachedKey{}
+			accountKeys = cachedKeys{}
+
+			envvars, err := drv.ConfigEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e := findEnvVar(envvars, "REGISTRY_STORAGE_AZURE_ACCOUNTKEY"); e == nil || e.Value != tt.expectedKey {
+				t.Errorf("expected the registry to use key %q, got %v", tt.expectedKey, e)
+			}
+
+			standby, err := drv.StandbyKey(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if standby != tt.expectedStandby {
+				t.Errorf("expected standby key %s, got %s", tt.expectedStandby, standby)
+			}
+		})
+	}
+}
+
+// blobListingDoer serves the blobs of a container, filtered by the prefix of
+// the listing requests, and records whether the container was deleted.
+type blobListingDoer struct {
+	blobs   []string
+	deleted bool
+}
+
+func (m *blobListingDoer) Do(r *policy.Request) (*http.Response, error) {
+	req := r.Raw()
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Request:    req,
+		Body:       io.NopCloser(bytes.NewBufferString(`{}`)),
+		Header:     http.Header{},
+	}
+	switch {
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/listKeys"):
+		resp.Body = io.NopCloser(bytes.NewBufferString(`{"keys":[{"keyName":"key1","value":"firstKey","permissions":"Full"}]}`))
+	case req.Method == http.MethodGet && req.URL.Query().Get("comp") == "list":
+		var items strings.Builder
+		for _, name := range m.blobs {
+			if strings.HasPrefix(name, req.URL.Query().Get("prefix")) {
+				fmt.Fprintf(&items, "<Blob><Name>%s</Name><Properties></Properties></Blob>", name)
+			}
+		}
+		resp.Header.Set("Content-Type", "application/xml")
+		resp.Body = io.NopCloser(bytes.NewBufferString(`<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs>` + items.String() + `</Blobs><NextMarker/></EnumerationResults>`))
+	case req.Method == http.MethodDelete && req.URL.Query().Get("restype") == "container":
+		m.deleted = true
+		resp.StatusCode = http.StatusAccepted
+	}
+	return resp, nil
+}
+
+func TestRemoveOwnedStorage(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-cluster-abc12",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AzurePlatformType,
+				Azure: &configv1.AzurePlatformStatus{
+					ResourceGroupName: "resourcegroup",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"azure_subscription_id": []byte("subscription_id"),
+			"azure_client_id":       []byte("client_id"),
+			"azure_tenant_id":       []byte(mockTenantID),
+			"azure_client_secret":   []byte("client_secret"),
+			"azure_resourcegroup":   []byte("resourcegroup"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	for _, tt := range []struct {
+		name            string
+		blobs           []string
+		expectedRemoved bool
+	}{
+		{
+			name:            "empty container",
+			expectedRemoved: true,
+		},
+		{
+			name:  "registry content under /docker/",
+			blobs: []string{"/docker/registry/v2/blobs/sha256/1c/1c1f/data"},
+		},
+		{
+			name:  "registry content whose paths were not fixed",
+			blobs: []string{"docker/registry/v2/blobs/sha256/1c/1c1f/data"},
+		},
+		{
+			name: "ownership marker and canary blobs",
+			blobs: []string{
+				"openshift-image-registry-operator/canary",
+				"openshift-image-registry-operator/replication-canary",
+				"openshift-image-registry-owner.json",
+			},
+			expectedRemoved: true,
+		},
+		{
+			name: "registry content under a custom root directory",
+			blobs: []string{
+				"openshift-image-registry-owner.json",
+				"/registry/docker/registry/v2/blobs/sha256/1c/1c1f/data",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			doer := &blobListingDoer{blobs: tt.blobs}
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{
+				AccountName: "account",
+				Container:   "container",
+			}, &listers.StorageListers)
+			drv.policies = []policy.Policy{doer}
+
+			removed, err := drv.RemoveOwnedStorage(context.Background(), "orphan")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if removed != tt.expectedRemoved || doer.deleted != tt.expectedRemoved {
+				t.Errorf("expected the container to be removed: %t, got %t (deleted: %t)", tt.expectedRemoved, removed, doer.deleted)
+			}
+		})
+	}
+}
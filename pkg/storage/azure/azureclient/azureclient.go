@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -22,9 +23,12 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/go-autorest/autorest"
 	autorestazure "github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/Azure/msi-dataplane/pkg/dataplane"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
@@ -334,6 +338,128 @@ func (c *Client) UpdateStorageAccountNetworkAccess(ctx context.Context, resource
 	return nil
 }
 
+// StorageAccountNetworkRules are the firewall rules of the public endpoint of
+// a storage account: only the IP ranges (IPv4 addresses or CIDRs) and the
+// subnets (resource IDs) are allowed, along with the traffic of the Bypass
+// services ("AzureServices", "Logging", "Metrics" or "None").
+type StorageAccountNetworkRules struct {
+	IPRanges  []string
+	SubnetIDs []string
+	Bypass    string
+}
+
+// UpdateStorageAccountNetworkRules sets the firewall rules of the storage
+// account. With no rules, every network is allowed again. The account is
+// only updated when its rules differ.
+func (c *Client) UpdateStorageAccountNetworkRules(ctx context.Context, resourceGroupName, accountName string, rules *StorageAccountNetworkRules) error {
+	account, err := c.getStorageAccount(ctx, resourceGroupName, accountName)
+	if rules == nil && c.is404(err) {
+		// no network is denied access to an account that doesn't exist.
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var current *armstorage.NetworkRuleSet
+	if account.Properties != nil {
+		current = account.Properties.NetworkRuleSet
+	}
+	if networkRulesMatch(current, rules) {
+		return nil
+	}
+
+	creds, err := c.getCreds(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	client, err := armstorage.NewAccountsClient(c.opts.SubscriptionID, creds, &arm.ClientOptions{
+		ClientOptions: *c.clientOpts,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create accounts client: %w", err)
+	}
+
+	defaultAction := armstorage.DefaultActionAllow
+	bypass := armstorage.BypassAzureServices
+	ruleSet := &armstorage.NetworkRuleSet{
+		DefaultAction:       &defaultAction,
+		Bypass:              &bypass,
+		IPRules:             []*armstorage.IPRule{},
+		VirtualNetworkRules: []*armstorage.VirtualNetworkRule{},
+	}
+	if rules != nil {
+		defaultAction = armstorage.DefaultActionDeny
+		bypass = armstorage.Bypass(rules.Bypass)
+		for _, r := range rules.IPRanges {
+			ruleSet.IPRules = append(ruleSet.IPRules, &armstorage.IPRule{
+				IPAddressOrRange: to.StringPtr(r),
+				Action:           to.StringPtr("Allow"),
+			})
+		}
+		for _, id := range rules.SubnetIDs {
+			ruleSet.VirtualNetworkRules = append(ruleSet.VirtualNetworkRules, &armstorage.VirtualNetworkRule{
+				VirtualNetworkResourceID: to.StringPtr(id),
+				Action:                   to.StringPtr("Allow"),
+			})
+		}
+	}
+	params := armstorage.AccountUpdateParameters{
+		Properties: &armstorage.AccountPropertiesUpdateParameters{
+			NetworkRuleSet: ruleSet,
+		},
+	}
+	if _, err := client.Update(ctx, resourceGroupName, accountName, params, nil); err != nil {
+		return err
+	}
+	klog.Infof("network rules of azure storage account %s have been updated", accountName)
+	return nil
+}
+
+// networkRulesMatch tells whether the network rule set of a storage account
+// is the one set for the rules.
+func networkRulesMatch(current *armstorage.NetworkRuleSet, rules *StorageAccountNetworkRules) bool {
+	if current == nil || current.DefaultAction == nil {
+		return rules == nil
+	}
+	if rules == nil {
+		return *current.DefaultAction == armstorage.DefaultActionAllow &&
+			len(current.IPRules) == 0 && len(current.VirtualNetworkRules) == 0
+	}
+	if *current.DefaultAction != armstorage.DefaultActionDeny || current.Bypass == nil ||
+		!bypassServices(string(*current.Bypass)).Equal(bypassServices(rules.Bypass)) {
+		return false
+	}
+
+	var ipRanges, subnetIDs []string
+	for _, r := range current.IPRules {
+		if r != nil {
+			ipRanges = append(ipRanges, to.String(r.IPAddressOrRange))
+		}
+	}
+	for _, r := range current.VirtualNetworkRules {
+		if r != nil {
+			subnetIDs = append(subnetIDs, strings.ToLower(to.String(r.VirtualNetworkResourceID)))
+		}
+	}
+	wantSubnetIDs := make([]string, 0, len(rules.SubnetIDs))
+	for _, id := range rules.SubnetIDs {
+		wantSubnetIDs = append(wantSubnetIDs, strings.ToLower(id))
+	}
+	return sets.New(ipRanges...).Equal(sets.New(rules.IPRanges...)) &&
+		sets.New(subnetIDs...).Equal(sets.New(wantSubnetIDs...))
+}
+
+// bypassServices returns the services of a network rule set bypass, such as
+// "Logging, Metrics".
+func bypassServices(bypass string) sets.Set[string] {
+	services := sets.New[string]()
+	for _, s := range strings.Split(bypass, ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			services.Insert(s)
+		}
+	}
+	return services
+}
+
 func (c *Client) DisableStorageAccountAccessKeyAccess(ctx context.Context, resourceGroupName, accountName string) error {
 	creds, err := c.getCreds(ctx)
 	if err != nil {
@@ -357,6 +483,315 @@ func (c *Client) DisableStorageAccountAccessKeyAccess(ctx context.Context, resou
 	return nil
 }
 
+// StorageAccountEncryption is the customer-managed key of a key vault a
+// storage account is encrypted with, and the user-assigned identity the
+// account accesses the key vault as. An empty KeyVersion follows the latest
+// version of the key.
+type StorageAccountEncryption struct {
+	KeyVaultURI          string
+	KeyName              string
+	KeyVersion           string
+	UserAssignedIdentity string
+}
+
+// UpdateStorageAccountEncryption encrypts the storage account with the
+// customer-managed key, or with platform-managed keys when enc is nil. The
+// account is only updated when it is encrypted otherwise.
+func (c *Client) UpdateStorageAccountEncryption(ctx context.Context, resourceGroupName, accountName string, enc *StorageAccountEncryption) error {
+	account, err := c.getStorageAccount(ctx, resourceGroupName, accountName)
+	if err != nil {
+		return err
+	}
+	if storageAccountEncryptedWith(account, enc) {
+		return nil
+	}
+
+	creds, err := c.getCreds(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	client, err := armstorage.NewAccountsClient(c.opts.SubscriptionID, creds, &arm.ClientOptions{
+		ClientOptions: *c.clientOpts,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create accounts client: %w", err)
+	}
+
+	keySource := armstorage.KeySourceMicrosoftStorage
+	encryption := &armstorage.Encryption{
+		KeySource: &keySource,
+		Services: &armstorage.EncryptionServices{
+			Blob: &armstorage.EncryptionService{Enabled: to.BoolPtr(true)},
+		},
+	}
+	params := armstorage.AccountUpdateParameters{
+		Properties: &armstorage.AccountPropertiesUpdateParameters{
+			Encryption: encryption,
+		},
+	}
+	if enc != nil {
+		keySource = armstorage.KeySourceMicrosoftKeyvault
+		encryption.KeyVaultProperties = &armstorage.KeyVaultProperties{
+			KeyVaultURI: to.StringPtr(enc.KeyVaultURI),
+			KeyName:     to.StringPtr(enc.KeyName),
+			KeyVersion:  to.StringPtr(enc.KeyVersion),
+		}
+		encryption.EncryptionIdentity = &armstorage.EncryptionIdentity{
+			EncryptionUserAssignedIdentity: to.StringPtr(enc.UserAssignedIdentity),
+		}
+		// the system-assigned identity of the account, if any, is kept.
+		identityType := armstorage.IdentityTypeUserAssigned
+		if account.Identity != nil && account.Identity.Type != nil &&
+			(*account.Identity.Type == armstorage.IdentityTypeSystemAssigned ||
+				*account.Identity.Type == armstorage.IdentityTypeSystemAssignedUserAssigned) {
+			identityType = armstorage.IdentityTypeSystemAssignedUserAssigned
+		}
+		params.Identity = &armstorage.Identity{
+			Type: &identityType,
+			UserAssignedIdentities: map[string]*armstorage.UserAssignedIdentity{
+				enc.UserAssignedIdentity: {},
+			},
+		}
+	}
+	if _, err := client.Update(ctx, resourceGroupName, accountName, params, nil); err != nil {
+		return err
+	}
+	klog.Infof("encryption of azure storage account %s has been updated", accountName)
+	return nil
+}
+
+// storageAccountEncryptedWith tells whether the storage account is encrypted
+// with the customer-managed key, or with platform-managed keys when enc is
+// nil.
+func storageAccountEncryptedWith(account armstorage.Account, enc *StorageAccountEncryption) bool {
+	var current *armstorage.Encryption
+	if account.Properties != nil {
+		current = account.Properties.Encryption
+	}
+	keyVault := current != nil && current.KeySource != nil && *current.KeySource == armstorage.KeySourceMicrosoftKeyvault
+	if enc == nil {
+		return !keyVault
+	}
+	if !keyVault || current.KeyVaultProperties == nil || current.EncryptionIdentity == nil {
+		return false
+	}
+	props := current.KeyVaultProperties
+	return strings.EqualFold(strings.TrimSuffix(to.String(props.KeyVaultURI), "/"), strings.TrimSuffix(enc.KeyVaultURI, "/")) &&
+		to.String(props.KeyName) == enc.KeyName &&
+		to.String(props.KeyVersion) == enc.KeyVersion &&
+		strings.EqualFold(to.String(current.EncryptionIdentity.EncryptionUserAssignedIdentity), enc.UserAssignedIdentity)
+}
+
+// BlobDeleteRule is a lifecycle rule of the management policy of a storage
+// account. It deletes the blobs of the given types under any of the
+// prefixes, which start with the container name, once they are not modified
+// for more than DaysAfterModification days.
+type BlobDeleteRule struct {
+	Name                  string
+	BlobTypes             []string
+	PrefixMatch           []string
+	DaysAfterModification int32
+}
+
+// PutBlobDeleteRule adds the rule to the management policy of the storage
+// account, replacing the rule of the same name. The other rules of the
+// policy are kept, and the policy is only updated when the rule differs.
+func (c *Client) PutBlobDeleteRule(ctx context.Context, resourceGroupName, accountName string, rule BlobDeleteRule) error {
+	creds, err := c.getCreds(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	client, err := armstorage.NewManagementPoliciesClient(c.opts.SubscriptionID, creds, &arm.ClientOptions{
+		ClientOptions: *c.clientOpts,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create management policies client: %w", err)
+	}
+
+	var rules []*armstorage.ManagementPolicyRule
+	resp, err := client.Get(ctx, resourceGroupName, accountName, armstorage.ManagementPolicyNameDefault, nil)
+	if err != nil && !c.is404(err) {
+		return fmt.Errorf("failed to get the management policy: %w", err)
+	}
+	if err == nil && resp.Properties != nil && resp.Properties.Policy != nil {
+		rules = resp.Properties.Policy.Rules
+	}
+
+	desired := blobDeleteRule(rule)
+	found := false
+	for i, r := range rules {
+		if r == nil || to.String(r.Name) != rule.Name {
+			continue
+		}
+		if blobDeleteRuleMatches(r, rule) {
+			return nil
+		}
+		rules[i] = desired
+		found = true
+	}
+	if !found {
+		rules = append(rules, desired)
+	}
+
+	policy := armstorage.ManagementPolicy{
+		Properties: &armstorage.ManagementPolicyProperties{
+			Policy: &armstorage.ManagementPolicySchema{Rules: rules},
+		},
+	}
+	if _, err := client.CreateOrUpdate(ctx, resourceGroupName, accountName, armstorage.ManagementPolicyNameDefault, policy, nil); err != nil {
+		return err
+	}
+	klog.Infof("rule %s of the management policy of azure storage account %s has been updated", rule.Name, accountName)
+	return nil
+}
+
+func blobDeleteRule(rule BlobDeleteRule) *armstorage.ManagementPolicyRule {
+	var blobTypes, prefixes []*string
+	for _, t := range rule.BlobTypes {
+		blobTypes = append(blobTypes, to.StringPtr(t))
+	}
+	for _, p := range rule.PrefixMatch {
+		prefixes = append(prefixes, to.StringPtr(p))
+	}
+	ruleType := armstorage.RuleTypeLifecycle
+	return &armstorage.ManagementPolicyRule{
+		Name:    to.StringPtr(rule.Name),
+		Type:    &ruleType,
+		Enabled: to.BoolPtr(true),
+		Definition: &armstorage.ManagementPolicyDefinition{
+			Filters: &armstorage.ManagementPolicyFilter{
+				BlobTypes:   blobTypes,
+				PrefixMatch: prefixes,
+			},
+			Actions: &armstorage.ManagementPolicyAction{
+				BaseBlob: &armstorage.ManagementPolicyBaseBlob{
+					Delete: &armstorage.DateAfterModification{
+						DaysAfterModificationGreaterThan: to.Float32Ptr(float32(rule.DaysAfterModification)),
+					},
+				},
+			},
+		},
+	}
+}
+
+// blobDeleteRuleMatches tells whether the rule of the management policy is
+// enabled and only deletes the blobs the delete rule is about.
+func blobDeleteRuleMatches(r *armstorage.ManagementPolicyRule, rule BlobDeleteRule) bool {
+	if !to.Bool(r.Enabled) || r.Definition == nil || r.Definition.Filters == nil || r.Definition.Actions == nil {
+		return false
+	}
+	filters, actions := r.Definition.Filters, r.Definition.Actions
+	if len(filters.BlobIndexMatch) != 0 || actions.Snapshot != nil || actions.Version != nil {
+		return false
+	}
+	if !stringPtrsEqual(filters.BlobTypes, rule.BlobTypes) || !stringPtrsEqual(filters.PrefixMatch, rule.PrefixMatch) {
+		return false
+	}
+	base := actions.BaseBlob
+	if base == nil || base.Delete == nil || base.TierToArchive != nil || base.TierToCold != nil || base.TierToCool != nil || base.TierToHot != nil {
+		return false
+	}
+	return base.Delete.DaysAfterCreationGreaterThan == nil &&
+		base.Delete.DaysAfterLastAccessTimeGreaterThan == nil &&
+		to.Float32(base.Delete.DaysAfterModificationGreaterThan) == float32(rule.DaysAfterModification)
+}
+
+func stringPtrsEqual(ptrs []*string, values []string) bool {
+	if len(ptrs) != len(values) {
+		return false
+	}
+	for i, p := range ptrs {
+		if to.String(p) != values[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SoftDeleteRetention is the soft-delete of the blobs, or of the
+// containers, of a storage account. Deleted items are kept for Days days
+// when it is enabled.
+type SoftDeleteRetention struct {
+	Enabled bool
+	Days    int32
+}
+
+// UpdateBlobServiceSoftDelete sets the soft-delete of the blobs and of the
+// containers of the storage account. A nil retention leaves the matching
+// soft-delete as it is. The blob service is only updated when its
+// soft-delete differs.
+func (c *Client) UpdateBlobServiceSoftDelete(ctx context.Context, resourceGroupName, accountName string, blobs, containers *SoftDeleteRetention) error {
+	creds, err := c.getCreds(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	client, err := armstorage.NewBlobServicesClient(c.opts.SubscriptionID, creds, &arm.ClientOptions{
+		ClientOptions: *c.clientOpts,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create blob services client: %w", err)
+	}
+
+	resp, err := client.GetServiceProperties(ctx, resourceGroupName, accountName, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get the blob service properties: %w", err)
+	}
+	current := resp.BlobServiceProperties.BlobServiceProperties
+	if current == nil {
+		current = &armstorage.BlobServicePropertiesProperties{}
+	}
+	if softDeleteRetentionMatches(current.DeleteRetentionPolicy, blobs) &&
+		softDeleteRetentionMatches(current.ContainerDeleteRetentionPolicy, containers) {
+		return nil
+	}
+
+	params := armstorage.BlobServiceProperties{
+		BlobServiceProperties: &armstorage.BlobServicePropertiesProperties{
+			DeleteRetentionPolicy:          deleteRetentionPolicy(blobs),
+			ContainerDeleteRetentionPolicy: deleteRetentionPolicy(containers),
+		},
+	}
+	if _, err := client.SetServiceProperties(ctx, resourceGroupName, accountName, params, nil); err != nil {
+		return err
+	}
+	klog.Infof("soft-delete of azure storage account %s has been updated", accountName)
+	return nil
+}
+
+func softDeleteRetentionMatches(policy *armstorage.DeleteRetentionPolicy, retention *SoftDeleteRetention) bool {
+	if retention == nil {
+		return true
+	}
+	enabled := policy != nil && to.Bool(policy.Enabled)
+	if !retention.Enabled {
+		return !enabled
+	}
+	return enabled && to.Int32(policy.Days) == retention.Days
+}
+
+func deleteRetentionPolicy(retention *SoftDeleteRetention) *armstorage.DeleteRetentionPolicy {
+	if retention == nil {
+		return nil
+	}
+	policy := &armstorage.DeleteRetentionPolicy{Enabled: to.BoolPtr(retention.Enabled)}
+	if retention.Enabled {
+		policy.Days = to.Int32Ptr(retention.Days)
+	}
+	return policy
+}
+
+// StorageAccountExists returns true if the storage account can be read. It
+// requires the Microsoft.Storage/storageAccounts/read permission.
+func (c *Client) StorageAccountExists(ctx context.Context, resourceGroupName, accountName string) (bool, error) {
+	_, err := c.getStorageAccount(ctx, resourceGroupName, accountName)
+	if c.is404(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // IsStorageAccountPrivate gets a storage account and returns true if public
 // network access is disabled, or false if public network access is enabled.
 // Public network access is enabled by default in Azure. In case of any
@@ -956,7 +1391,7 @@ func (client *BlobClient) ContainerExists(ctx context.Context, accountName, cont
 	_, err := c.GetProperties(ctx, &container.GetPropertiesOptions{})
 	if err != nil {
 		if !bloberror.HasCode(err, bloberror.ContainerNotFound) {
-			return false, fmt.Errorf("unable to get the storage container %s: %s", containerName, err)
+			return false, fmt.Errorf("unable to get the storage container %s: %w", containerName, err)
 		} else {
 			return false, nil
 		}
@@ -964,6 +1399,98 @@ func (client *BlobClient) ContainerExists(ctx context.Context, accountName, cont
 	return true, nil
 }
 
+// ContainerUsage returns the number of bytes and blobs stored in the
+// container under prefix. The limiter is waited on before every listing
+// request.
+func (client *BlobClient) ContainerUsage(ctx context.Context, containerName, prefix string, limiter *rate.Limiter) (int64, int64, error) {
+	var size, count int64
+	pager := client.client.NewListBlobsFlatPager(containerName, &azblob.ListBlobsFlatOptions{
+		Prefix: &prefix,
+	})
+	for pager.More() {
+		if err := limiter.Wait(ctx); err != nil {
+			return 0, 0, err
+		}
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return 0, 0, fmt.Errorf("unable to list the blobs in storage container %s: %w", containerName, err)
+		}
+		for _, blob := range page.Segment.BlobItems {
+			if blob.Properties != nil && blob.Properties.ContentLength != nil {
+				size += *blob.Properties.ContentLength
+			}
+			count++
+		}
+	}
+	return size, count, nil
+}
+
+// ListContainers returns the containers of the account whose names start
+// with prefix, along with the time they were last modified.
+func (client *BlobClient) ListContainers(ctx context.Context, prefix string) (map[string]time.Time, error) {
+	containers := map[string]time.Time{}
+	pager := client.client.NewListContainersPager(&azblob.ListContainersOptions{
+		Prefix: &prefix,
+	})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the storage containers: %w", err)
+		}
+		for _, item := range page.ContainerItems {
+			if item.Name == nil {
+				continue
+			}
+			var modified time.Time
+			if item.Properties != nil && item.Properties.LastModified != nil {
+				modified = *item.Properties.LastModified
+			}
+			containers[*item.Name] = modified
+		}
+	}
+	return containers, nil
+}
+
+// ListBlobs calls fn with the name of the blobs in the container until fn
+// returns false or there is no blob left.
+func (client *BlobClient) ListBlobs(ctx context.Context, containerName string, fn func(name string) bool) error {
+	pager := client.client.NewListBlobsFlatPager(containerName, &azblob.ListBlobsFlatOptions{})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to list the blobs in storage container %s: %w", containerName, err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name != nil && !fn(*item.Name) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// PutBlob writes data into the blob name of the container.
+func (client *BlobClient) PutBlob(ctx context.Context, containerName, name string, data []byte) error {
+	_, err := client.client.UploadBuffer(ctx, containerName, name, data, &azblob.UploadBufferOptions{})
+	return err
+}
+
+// GetBlob reads the content of the blob name of the container.
+func (client *BlobClient) GetBlob(ctx context.Context, containerName, name string) ([]byte, error) {
+	resp, err := client.client.DownloadStream(ctx, containerName, name, &azblob.DownloadStreamOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// DeleteBlob removes the blob name from the container.
+func (client *BlobClient) DeleteBlob(ctx context.Context, containerName, name string) error {
+	_, err := client.client.DeleteBlob(ctx, containerName, name, &azblob.DeleteBlobOptions{})
+	return err
+}
+
 func (client *BlobClient) CreateStorageContainer(ctx context.Context, containerName string) error {
 	_, err := client.client.CreateContainer(ctx, containerName, &azblob.CreateContainerOptions{})
 	return err
@@ -983,6 +1510,21 @@ type StorageAccountCreateOptions struct {
 	Tags              map[string]*string
 }
 
+// IsAuthorizationError returns true if err was caused by the credentials not
+// being allowed to perform a request.
+func IsAuthorizationError(err error) bool {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode == http.StatusUnauthorized || respErr.StatusCode == http.StatusForbidden
+	}
+	var detailedErr autorest.DetailedError
+	if errors.As(err, &detailedErr) {
+		statusCode, ok := detailedErr.StatusCode.(int)
+		return ok && (statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden)
+	}
+	return false
+}
+
 // IsAzureStackCloud checks if the cloud name indicates Azure Stack Hub.
 func IsAzureStackCloud(name string) bool {
 	return strings.EqualFold(name, "AZURESTACKCLOUD")
@@ -17,6 +17,19 @@ type StorageAccountClient interface {
 
 	// GetPrimaryKey retrieves the primary access key for the storage account.
 	GetPrimaryKey(ctx context.Context, resourceGroup, accountName string) (string, error)
+
+	// GetKeys retrieves the access keys (key1 and key2) of the storage
+	// account.
+	GetKeys(ctx context.Context, resourceGroup, accountName string) ([]AccountKey, error)
+
+	// RegenerateKey regenerates the named access key of the storage account.
+	RegenerateKey(ctx context.Context, resourceGroup, accountName, keyName string) error
+}
+
+// AccountKey is an access key of a storage account.
+type AccountKey struct {
+	Name  string
+	Value string
 }
 
 // NewStorageAccountClient returns the appropriate implementation based on cloud type.
@@ -115,6 +115,46 @@ func (c *legacyStorageClient) GetPrimaryKey(ctx context.Context, resourceGroup,
 	return *firstKey.Value, nil
 }
 
+func (c *legacyStorageClient) GetKeys(ctx context.Context, resourceGroup, accountName string) ([]AccountKey, error) {
+	client, err := c.getAccountsClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create accounts client: %w", err)
+	}
+
+	result, err := client.ListKeys(ctx, resourceGroup, accountName, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage account keys: %w", err)
+	}
+
+	var keys []AccountKey
+	if result.Keys != nil {
+		for _, key := range *result.Keys {
+			if key.KeyName == nil || key.Value == nil {
+				continue
+			}
+			keys = append(keys, AccountKey{Name: *key.KeyName, Value: *key.Value})
+		}
+	}
+	return keys, nil
+}
+
+func (c *legacyStorageClient) RegenerateKey(ctx context.Context, resourceGroup, accountName, keyName string) error {
+	client, err := c.getAccountsClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create accounts client: %w", err)
+	}
+
+	_, err = client.RegenerateKey(ctx, resourceGroup, accountName, storage.AccountRegenerateKeyParameters{
+		KeyName: to.StringPtr(keyName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to regenerate storage account key %s: %w", keyName, err)
+	}
+
+	klog.Infof("key %s of azure storage account %s has been regenerated", keyName, accountName)
+	return nil
+}
+
 // getAccountsClient creates a Track 1 SDK accounts client with proper auth.
 func (c *legacyStorageClient) getAccountsClient(ctx context.Context) (storage.AccountsClient, error) {
 	client := storage.NewAccountsClientWithBaseURI(c.base.opts.Environment.ResourceManagerEndpoint, c.base.opts.SubscriptionID)
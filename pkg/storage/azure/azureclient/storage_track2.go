@@ -143,3 +143,53 @@ func (c *armStorageClient) GetPrimaryKey(ctx context.Context, resourceGroup, acc
 	}
 	return *resp.Keys[0].Value, nil
 }
+
+func (c *armStorageClient) GetKeys(ctx context.Context, resourceGroup, accountName string) ([]AccountKey, error) {
+	creds, err := c.base.getCreds(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials: %w", err)
+	}
+	client, err := armstorage.NewAccountsClient(c.base.opts.SubscriptionID, creds, &arm.ClientOptions{
+		ClientOptions: *c.base.clientOpts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create accounts client: %w", err)
+	}
+
+	resp, err := client.ListKeys(ctx, resourceGroup, accountName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage account keys: %w", err)
+	}
+
+	var keys []AccountKey
+	for _, key := range resp.Keys {
+		if key == nil || key.KeyName == nil || key.Value == nil {
+			continue
+		}
+		keys = append(keys, AccountKey{Name: *key.KeyName, Value: *key.Value})
+	}
+	return keys, nil
+}
+
+func (c *armStorageClient) RegenerateKey(ctx context.Context, resourceGroup, accountName, keyName string) error {
+	creds, err := c.base.getCreds(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	client, err := armstorage.NewAccountsClient(c.base.opts.SubscriptionID, creds, &arm.ClientOptions{
+		ClientOptions: *c.base.clientOpts,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create accounts client: %w", err)
+	}
+
+	_, err = client.RegenerateKey(ctx, resourceGroup, accountName, armstorage.AccountRegenerateKeyParameters{
+		KeyName: to.StringPtr(keyName),
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to regenerate storage account key %s: %w", keyName, err)
+	}
+
+	klog.Infof("key %s of azure storage account %s has been regenerated", keyName, accountName)
+	return nil
+}
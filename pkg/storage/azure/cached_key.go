@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/azure/azureclient"
 )
 
 // cacheExpiration is the cache expiration duration in minutes.
@@ -14,11 +15,19 @@ const cacheExpiration time.Duration = 20 * time.Minute
 // primaryKey keeps account primary key in a cache.
 var primaryKey cachedKey
 
+// accountKeys keeps all the account keys in a cache.
+var accountKeys cachedKeys
+
 // KeyFetcher abstracts storage account key retrieval.
 type KeyFetcher interface {
 	GetPrimaryKey(ctx context.Context, resourceGroup, account string) (string, error)
 }
 
+// KeysFetcher abstracts the retrieval of all the storage account keys.
+type KeysFetcher interface {
+	GetKeys(ctx context.Context, resourceGroup, account string) ([]azureclient.AccountKey, error)
+}
+
 // cachedKey holds an API access key in memory for five minutes.
 type cachedKey struct {
 	mtx           sync.Mutex
@@ -53,3 +62,53 @@ func (k *cachedKey) get(
 	k.expire = time.Now().Add(cacheExpiration)
 	return k.value, nil
 }
+
+// invalidate drops the cached key, it is fetched again on next get.
+func (k *cachedKey) invalidate() {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	k.expire = time.Time{}
+}
+
+// cachedKeys holds all the API access keys of an account in memory, like
+// cachedKey does for the primary one.
+type cachedKeys struct {
+	mtx           sync.Mutex
+	resourceGroup string
+	account       string
+	values        []azureclient.AccountKey
+	expire        time.Time
+}
+
+// get returns the cached keys if they are not expired yet, if expired fetches
+// the keys remotely using provided KeysFetcher.
+func (k *cachedKeys) get(
+	ctx context.Context, fetcher KeysFetcher, resourceGroup, account string,
+) ([]azureclient.AccountKey, error) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	if k.resourceGroup == resourceGroup && k.account == account && time.Now().Before(k.expire) {
+		metrics.AzureKeyCacheHit()
+		return k.values, nil
+	}
+	metrics.AzureKeyCacheMiss()
+
+	keys, err := fetcher.GetKeys(ctx, resourceGroup, account)
+	if err != nil {
+		return nil, err
+	}
+
+	k.resourceGroup = resourceGroup
+	k.account = account
+	k.values = keys
+	k.expire = time.Now().Add(cacheExpiration)
+	return k.values, nil
+}
+
+// invalidate drops the cached keys, they are fetched again on next get.
+func (k *cachedKeys) invalidate() {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	k.expire = time.Time{}
+}
@@ -0,0 +1,160 @@
+package azure
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/azure/azureclient"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	storageEncryptedReasonPlatformManaged = "PlatformManagedKeys"
+	storageEncryptedReasonCustomerManaged = "CustomerManagedKey"
+	storageEncryptedReasonInvalidKey      = "InvalidKeyReference"
+)
+
+var (
+	// keyNameRe matches the names of key vault keys.
+	keyNameRe = regexp.MustCompile(`^[0-9A-Za-z-]{1,127}$`)
+
+	// keyVersionRe matches the versions of key vault keys.
+	keyVersionRe = regexp.MustCompile(`^[0-9A-Fa-f]{32}$`)
+
+	// userAssignedIdentityRe matches the resource IDs of user-assigned
+	// identities.
+	userAssignedIdentityRe = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.ManagedIdentity/userAssignedIdentities/[^/]+$`)
+)
+
+// accountEncryption returns the customer-managed key the storage account is
+// to be encrypted with, as set on the image registry config. Nothing is
+// returned when the account is to be encrypted with platform-managed keys.
+func accountEncryption(cr *imageregistryv1.Config) *azureclient.StorageAccountEncryption {
+	enc := &azureclient.StorageAccountEncryption{
+		KeyVaultURI:          strings.TrimSpace(cr.Annotations[defaults.AzureEncryptionKeyVaultURIAnnotation]),
+		KeyName:              strings.TrimSpace(cr.Annotations[defaults.AzureEncryptionKeyNameAnnotation]),
+		KeyVersion:           strings.TrimSpace(cr.Annotations[defaults.AzureEncryptionKeyVersionAnnotation]),
+		UserAssignedIdentity: strings.TrimSpace(cr.Annotations[defaults.AzureEncryptionIdentityAnnotation]),
+	}
+	if *enc == (azureclient.StorageAccountEncryption{}) {
+		return nil
+	}
+	return enc
+}
+
+// validateAccountEncryption checks the key reference and the identity of the
+// customer-managed key are well formed, and that the key vault is in the
+// cloud environment of the storage account.
+func validateAccountEncryption(enc *azureclient.StorageAccountEncryption, environment autorestazure.Environment) error {
+	u, err := url.Parse(enc.KeyVaultURI)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || strings.Trim(u.Path, "/") != "" {
+		return fmt.Errorf("the key vault URI %q is not the https URI of a key vault", enc.KeyVaultURI)
+	}
+	if suffix := environment.KeyVaultDNSSuffix; suffix != "" && !strings.HasSuffix(strings.ToLower(u.Hostname()), "."+suffix) {
+		return fmt.Errorf("the key vault URI %q is not in the %s domain of the %s cloud", enc.KeyVaultURI, suffix, environment.Name)
+	}
+	if !keyNameRe.MatchString(enc.KeyName) {
+		return fmt.Errorf("the key name %q is not a valid key vault key name", enc.KeyName)
+	}
+	if enc.KeyVersion != "" && !keyVersionRe.MatchString(enc.KeyVersion) {
+		return fmt.Errorf("the key version %q is not a valid key vault key version", enc.KeyVersion)
+	}
+	if !userAssignedIdentityRe.MatchString(enc.UserAssignedIdentity) {
+		return fmt.Errorf("the identity %q is not the resource ID of a user-assigned identity", enc.UserAssignedIdentity)
+	}
+	return nil
+}
+
+func accountEncryptionMessage(enc *azureclient.StorageAccountEncryption) string {
+	if enc == nil {
+		return "Storage account is encrypted with platform-managed keys"
+	}
+	version := "the latest version"
+	if enc.KeyVersion != "" {
+		version = "version " + enc.KeyVersion
+	}
+	return fmt.Sprintf(
+		"Storage account is encrypted with %s of key %s of key vault %s, accessed as %s",
+		version, enc.KeyName, enc.KeyVaultURI, enc.UserAssignedIdentity,
+	)
+}
+
+// encryptionInputs returns the fingerprint of the encryption of the storage
+// account set on the image registry config.
+func encryptionInputs(enc *azureclient.StorageAccountEncryption) string {
+	return util.SettingInputs(enc)
+}
+
+// encryptionChanged tells whether the encryption of the storage account the
+// operator should manage is not the one last applied to the account, or
+// whether applying it failed and is due for a retry.
+func encryptionChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false
+	}
+	return util.SettingChanged(cr, defaults.StorageEncrypted, encryptionInputs(accountEncryption(cr)), encryptionInputs(nil))
+}
+
+// reconcileEncryption encrypts the storage account with the customer-managed
+// key set on the image registry config, or with platform-managed keys when
+// there is none, and reports it through the StorageEncrypted condition.
+// Invalid keys are not retried until they are changed.
+func (d *driver) reconcileEncryption(cr *imageregistryv1.Config, cfg *Azure, accountName string) {
+	enc := accountEncryption(cr)
+	inputs := encryptionInputs(enc)
+
+	environment, err := getEnvironmentByName(d.Config.CloudName)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapiv1.ConditionFalse, storageExistsReasonConfigError, err.Error())
+		util.RecordSetting(cr, defaults.StorageEncrypted, inputs, err)
+		return
+	}
+
+	if azureclient.IsAzureStackCloud(d.Config.CloudName) {
+		// Azure Stack Hub storage accounts are always encrypted with
+		// platform-managed keys.
+		if enc != nil {
+			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapiv1.ConditionFalse, storageEncryptedReasonInvalidKey, "Customer-managed keys are not supported on Azure Stack Hub")
+			util.RecordSetting(cr, defaults.StorageEncrypted, inputs, nil)
+			return
+		}
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapiv1.ConditionTrue, storageEncryptedReasonPlatformManaged, accountEncryptionMessage(nil))
+		util.RecordSetting(cr, defaults.StorageEncrypted, inputs, nil)
+		return
+	}
+
+	if enc != nil {
+		if err := validateAccountEncryption(enc, environment); err != nil {
+			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapiv1.ConditionFalse, storageEncryptedReasonInvalidKey, fmt.Sprintf("Invalid customer-managed key: %s", err))
+			util.RecordSetting(cr, defaults.StorageEncrypted, inputs, nil)
+			return
+		}
+	}
+
+	azClient, err := d.newAzClient(cfg, environment, nil)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapiv1.ConditionFalse, storageExistsReasonAzureError, fmt.Sprintf("Unable to set the encryption of the storage account: %s", err))
+		util.RecordSetting(cr, defaults.StorageEncrypted, inputs, err)
+		return
+	}
+	if err := azClient.UpdateStorageAccountEncryption(d.Context, cfg.ResourceGroup, accountName, enc); err != nil {
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapiv1.ConditionFalse, storageExistsReasonAzureError, fmt.Sprintf("Unable to set the encryption of the storage account: %s", err))
+		util.RecordSetting(cr, defaults.StorageEncrypted, inputs, err)
+		return
+	}
+
+	reason := storageEncryptedReasonPlatformManaged
+	if enc != nil {
+		reason = storageEncryptedReasonCustomerManaged
+	}
+	util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapiv1.ConditionTrue, reason, accountEncryptionMessage(enc))
+	util.RecordSetting(cr, defaults.StorageEncrypted, inputs, nil)
+}
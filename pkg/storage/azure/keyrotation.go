@@ -0,0 +1,153 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/azure/azureclient"
+)
+
+// accountKeyEnvName is the registry configuration parameter holding the key
+// the registry accesses the storage account with.
+const accountKeyEnvName = "REGISTRY_STORAGE_AZURE_ACCOUNTKEY"
+
+// deployedAccountKey returns the key the registry is configured with in its
+// private configuration, if any.
+func (d *driver) deployedAccountKey() (string, error) {
+	sec, err := d.Listers.Secrets.Get(defaults.ImageRegistryPrivateConfiguration)
+	if kerrors.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("unable to get the registry private configuration: %w", err)
+	}
+	data, ok := sec.Data[accountKeyEnvName]
+	if !ok {
+		return "", nil
+	}
+	// the parameters of the private configuration are YAML encoded.
+	var key string
+	if err := yaml.Unmarshal(data, &key); err != nil {
+		return "", fmt.Errorf("unable to decode %s of the registry private configuration: %w", accountKeyEnvName, err)
+	}
+	return key, nil
+}
+
+// getRegistryAccountKey returns the key the registry is to access the
+// storage account with. The key the registry is configured with is kept
+// while it is a key of the account, so that the registry sticks to the key
+// a rotation switched it to. The primary key is used otherwise.
+func (d *driver) getRegistryAccountKey(storageClient azureclient.StorageAccountClient, resourceGroupName, accountName string) (string, error) {
+	key, err := d.getAccountPrimaryKey(storageClient, resourceGroupName, accountName)
+	if err != nil {
+		return "", err
+	}
+
+	deployed, err := d.deployedAccountKey()
+	if err != nil {
+		return "", err
+	}
+	if deployed == "" || deployed == key {
+		return key, nil
+	}
+
+	keys, err := accountKeys.get(d.Context, storageClient, resourceGroupName, accountName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get keys for the storage account %s: %w", accountName, err)
+	}
+	for _, k := range keys {
+		if k.Value == deployed {
+			return deployed, nil
+		}
+	}
+	return key, nil
+}
+
+// keyRotationClient returns the client managing the keys of the storage
+// account. No client is returned when the registry doesn't access the
+// storage account with its keys: a key is provided by the user, or
+// workload identity is used.
+func (d *driver) keyRotationClient() (azureclient.StorageAccountClient, *Azure, error) {
+	cfg, err := GetConfig(d.Listers.Secrets, d.Listers.Infrastructures)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.AccountKey != "" || cfg.FederatedTokenFile != "" || d.Config.AccountName == "" {
+		return nil, nil, nil
+	}
+
+	environment, err := getEnvironmentByName(d.Config.CloudName)
+	if err != nil {
+		return nil, nil, err
+	}
+	azClient, err := d.newAzClient(cfg, environment, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return azureclient.NewStorageAccountClient(azClient, d.Config.CloudName), cfg, nil
+}
+
+// StandbyKey returns the name of the key of the storage account the
+// registry is not configured with.
+func (d *driver) StandbyKey(ctx context.Context) (string, error) {
+	storageClient, cfg, err := d.keyRotationClient()
+	if err != nil || storageClient == nil {
+		return "", err
+	}
+
+	keys, err := storageClient.GetKeys(ctx, cfg.ResourceGroup, d.Config.AccountName)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) != 2 {
+		return "", fmt.Errorf("expected 2 keys for the storage account %s, got %d", d.Config.AccountName, len(keys))
+	}
+
+	deployed, err := d.deployedAccountKey()
+	if err != nil {
+		return "", err
+	}
+	// the registry uses the primary key unless it was switched to the
+	// secondary one.
+	if keys[1].Value == deployed {
+		return keys[0].Name, nil
+	}
+	return keys[1].Name, nil
+}
+
+// RegenerateKey regenerates the named key of the storage account and
+// returns the registry configuration parameter switching the registry to
+// it.
+func (d *driver) RegenerateKey(ctx context.Context, name string) (envvar.EnvVar, error) {
+	storageClient, cfg, err := d.keyRotationClient()
+	if err != nil {
+		return envvar.EnvVar{}, err
+	}
+	if storageClient == nil {
+		return envvar.EnvVar{}, fmt.Errorf("the registry does not access the storage account %s with its keys", d.Config.AccountName)
+	}
+
+	err = storageClient.RegenerateKey(ctx, cfg.ResourceGroup, d.Config.AccountName, name)
+	// the regeneration may have happened even if it failed.
+	primaryKey.invalidate()
+	accountKeys.invalidate()
+	if err != nil {
+		return envvar.EnvVar{}, err
+	}
+
+	keys, err := accountKeys.get(ctx, storageClient, cfg.ResourceGroup, d.Config.AccountName)
+	if err != nil {
+		return envvar.EnvVar{}, err
+	}
+	for _, k := range keys {
+		if k.Name == name {
+			return envvar.EnvVar{Name: accountKeyEnvName, Value: k.Value, Secret: true}, nil
+		}
+	}
+	return envvar.EnvVar{}, fmt.Errorf("key %s of the storage account %s not found", name, d.Config.AccountName)
+}
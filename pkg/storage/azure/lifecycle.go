@@ -0,0 +1,190 @@
+package azure
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/azure/azureclient"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	// uploadCleanupRuleName is the name of the rule of the management
+	// policy of the storage account that deletes incomplete uploads.
+	uploadCleanupRuleName = "openshift-image-registry-incomplete-uploads"
+
+	// repositoriesPrefix is where the registry keeps its repositories,
+	// upload directories included, in the container.
+	repositoriesPrefix = "docker/registry/v2/repositories/"
+
+	// incompleteUploadsAgeDays is the age of the incomplete uploads deleted
+	// by the management policy.
+	incompleteUploadsAgeDays = 1
+
+	// appendBlobType is the type of the blobs the registry writes uploads
+	// into. Under repositoriesPrefix, nothing but the uploaded data is
+	// written to append blobs: the links to layers and manifests are block
+	// blobs.
+	appendBlobType = "appendBlob"
+
+	maxSoftDeleteRetentionDays = 365
+
+	uploadCleanupReasonEnabled = "EnableCleanupSuccessful"
+	softDeleteReasonEnabled    = "SoftDeleteEnabled"
+	softDeleteReasonDisabled   = "SoftDeleteDisabled"
+	lifecycleReasonUnsupported = "NotSupported"
+)
+
+// uploadCleanupRule returns the rule of the management policy deleting the
+// uploads of the container that are not written to for a while.
+func uploadCleanupRule(container string) azureclient.BlobDeleteRule {
+	return azureclient.BlobDeleteRule{
+		Name:                  uploadCleanupRuleName,
+		BlobTypes:             []string{appendBlobType},
+		PrefixMatch:           []string{container + "/" + repositoriesPrefix},
+		DaysAfterModification: incompleteUploadsAgeDays,
+	}
+}
+
+func uploadCleanupMessage() string {
+	return "Default cleanup of incomplete uploads after one (1) day was successfully enabled"
+}
+
+// softDeleteRetentionDays returns the number of days the soft-delete set by
+// the annotation of the image registry config keeps deleted items for, zero
+// when soft-delete is not requested.
+func softDeleteRetentionDays(cr *imageregistryv1.Config, annotation string) int32 {
+	raw, ok := cr.Annotations[annotation]
+	if !ok {
+		return 0
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 32)
+	if err != nil || n <= 0 || n > maxSoftDeleteRetentionDays {
+		klog.Warningf("ignoring invalid %s annotation %q: a number of days between 1 and %d is expected", annotation, raw, maxSoftDeleteRetentionDays)
+		return 0
+	}
+	return int32(n)
+}
+
+func softDeleteMessage(items string, days int32) string {
+	if days == 0 {
+		return fmt.Sprintf("Soft-delete of %s is not enabled by the operator", items)
+	}
+	return fmt.Sprintf("Deleted %s are kept for %d days", items, days)
+}
+
+// softDeleteRetention returns the soft-delete to set on the storage account
+// for the requested retention. When none is requested, the soft-delete of
+// the account is only turned off if the operator turned it on, as reported
+// by the condition.
+func softDeleteRetention(cr *imageregistryv1.Config, conditionType string, days int32) *azureclient.SoftDeleteRetention {
+	if days > 0 {
+		return &azureclient.SoftDeleteRetention{Enabled: true, Days: days}
+	}
+	if util.FetchCondition(cr, conditionType).Reason == softDeleteReasonEnabled {
+		return &azureclient.SoftDeleteRetention{}
+	}
+	return nil
+}
+
+// lifecycleChanged tells whether the cleanup of incomplete uploads or the
+// soft-delete set on the image registry config are not the ones last
+// applied to the storage account the operator should manage, or whether
+// applying them failed and is due for a retry.
+func lifecycleChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false
+	}
+	if cr.Spec.Storage.Azure != nil && azureclient.IsAzureStackCloud(cr.Spec.Storage.Azure.CloudName) {
+		return false
+	}
+	blobDays := softDeleteRetentionDays(cr, defaults.AzureBlobSoftDeleteRetentionDaysAnnotation)
+	containerDays := softDeleteRetentionDays(cr, defaults.AzureContainerSoftDeleteRetentionDaysAnnotation)
+	return util.SettingChanged(cr, defaults.StorageIncompleteUploadCleanupEnabled, util.SettingInputs(), util.SettingInputs()) ||
+		util.SettingChanged(cr, defaults.StorageBlobSoftDeleteEnabled, util.SettingInputs(blobDays), util.SettingInputs(int32(0))) ||
+		util.SettingChanged(cr, defaults.StorageContainerSoftDeleteEnabled, util.SettingInputs(containerDays), util.SettingInputs(int32(0)))
+}
+
+// reconcileLifecycle sets the management policy rule deleting incomplete
+// uploads and the soft-delete of blobs and containers on the storage
+// account, and reports them through the StorageIncompleteUploadCleanupEnabled,
+// StorageBlobSoftDeleteEnabled and StorageContainerSoftDeleteEnabled
+// conditions.
+func (d *driver) reconcileLifecycle(cr *imageregistryv1.Config, cfg *Azure, accountName string) {
+	conditionTypes := []string{
+		defaults.StorageIncompleteUploadCleanupEnabled,
+		defaults.StorageBlobSoftDeleteEnabled,
+		defaults.StorageContainerSoftDeleteEnabled,
+	}
+
+	if azureclient.IsAzureStackCloud(d.Config.CloudName) {
+		for _, conditionType := range conditionTypes {
+			util.UpdateCondition(cr, conditionType, operatorapiv1.ConditionFalse, lifecycleReasonUnsupported, "Lifecycle management and soft-delete are not supported on Azure Stack Hub")
+		}
+		return
+	}
+
+	blobDays := softDeleteRetentionDays(cr, defaults.AzureBlobSoftDeleteRetentionDaysAnnotation)
+	containerDays := softDeleteRetentionDays(cr, defaults.AzureContainerSoftDeleteRetentionDaysAnnotation)
+	inputs := map[string]string{
+		defaults.StorageIncompleteUploadCleanupEnabled: util.SettingInputs(),
+		defaults.StorageBlobSoftDeleteEnabled:          util.SettingInputs(blobDays),
+		defaults.StorageContainerSoftDeleteEnabled:     util.SettingInputs(containerDays),
+	}
+
+	environment, err := getEnvironmentByName(d.Config.CloudName)
+	if err != nil {
+		for _, conditionType := range conditionTypes {
+			util.UpdateCondition(cr, conditionType, operatorapiv1.ConditionFalse, storageExistsReasonConfigError, err.Error())
+			util.RecordSetting(cr, conditionType, inputs[conditionType], err)
+		}
+		return
+	}
+	azClient, err := d.newAzClient(cfg, environment, nil)
+	if err != nil {
+		for _, conditionType := range conditionTypes {
+			util.UpdateCondition(cr, conditionType, operatorapiv1.ConditionFalse, storageExistsReasonAzureError, fmt.Sprintf("Unable to get the Azure client: %s", err))
+			util.RecordSetting(cr, conditionType, inputs[conditionType], err)
+		}
+		return
+	}
+
+	err = azClient.PutBlobDeleteRule(d.Context, cfg.ResourceGroup, accountName, uploadCleanupRule(d.Config.Container))
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapiv1.ConditionFalse, storageExistsReasonAzureError, fmt.Sprintf("Unable to set the cleanup of incomplete uploads: %s", err))
+	} else {
+		util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapiv1.ConditionTrue, uploadCleanupReasonEnabled, uploadCleanupMessage())
+	}
+	util.RecordSetting(cr, defaults.StorageIncompleteUploadCleanupEnabled, inputs[defaults.StorageIncompleteUploadCleanupEnabled], err)
+
+	err = azClient.UpdateBlobServiceSoftDelete(
+		d.Context, cfg.ResourceGroup, accountName,
+		softDeleteRetention(cr, defaults.StorageBlobSoftDeleteEnabled, blobDays),
+		softDeleteRetention(cr, defaults.StorageContainerSoftDeleteEnabled, containerDays),
+	)
+	for _, sd := range []struct {
+		conditionType string
+		items         string
+		days          int32
+	}{
+		{defaults.StorageBlobSoftDeleteEnabled, "blobs", blobDays},
+		{defaults.StorageContainerSoftDeleteEnabled, "containers", containerDays},
+	} {
+		switch {
+		case err != nil:
+			util.UpdateCondition(cr, sd.conditionType, operatorapiv1.ConditionFalse, storageExistsReasonAzureError, fmt.Sprintf("Unable to set the soft-delete of %s: %s", sd.items, err))
+		case sd.days > 0:
+			util.UpdateCondition(cr, sd.conditionType, operatorapiv1.ConditionTrue, softDeleteReasonEnabled, softDeleteMessage(sd.items, sd.days))
+		default:
+			util.UpdateCondition(cr, sd.conditionType, operatorapiv1.ConditionFalse, softDeleteReasonDisabled, softDeleteMessage(sd.items, 0))
+		}
+		util.RecordSetting(cr, sd.conditionType, inputs[sd.conditionType], err)
+	}
+}
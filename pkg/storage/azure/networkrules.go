@@ -0,0 +1,220 @@
+package azure
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/azure/azureclient"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	networkRulesReasonApplied = "NetworkRulesApplied"
+	networkRulesReasonNone    = "NoNetworkRules"
+	networkRulesReasonInvalid = "InvalidNetworkRules"
+
+	defaultNetworkRulesBypass = "AzureServices"
+)
+
+var (
+	// subnetIDRe matches the resource IDs of subnets.
+	subnetIDRe = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.Network/virtualNetworks/[^/]+/subnets/[^/]+$`)
+
+	// bypassServices are the services whose traffic can bypass the network
+	// rules, by lowercase name.
+	bypassServices = map[string]string{
+		"azureservices": "AzureServices",
+		"logging":       "Logging",
+		"metrics":       "Metrics",
+	}
+)
+
+// splitList returns the non-empty, trimmed items of a comma separated list.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseIPRange returns the IP range of a network rule in the form Azure
+// keeps it: an IPv4 address, or a public IPv4 CIDR of at most 30 bits.
+func parseIPRange(s string) (string, error) {
+	ip, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		ip = net.ParseIP(s)
+		if ip == nil {
+			return "", fmt.Errorf("%q is neither an IP address nor a CIDR", s)
+		}
+		ipnet = &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}
+	}
+	if ip.To4() == nil {
+		return "", fmt.Errorf("%q is not an IPv4 address or CIDR", s)
+	}
+	if ip.IsPrivate() || ip.IsLoopback() {
+		return "", fmt.Errorf("%q is not a public IP range", s)
+	}
+	switch ones, _ := ipnet.Mask.Size(); {
+	case ones == 32:
+		return ip.String(), nil
+	case ones == 31:
+		return "", fmt.Errorf("%q is a /31 CIDR, list its addresses instead", s)
+	default:
+		return ipnet.String(), nil
+	}
+}
+
+// parseBypass returns the bypass of the network rules in the form Azure
+// keeps it, such as "AzureServices, Logging".
+func parseBypass(s string) (string, error) {
+	items := splitList(s)
+	if len(items) == 1 && strings.EqualFold(items[0], "None") {
+		return "None", nil
+	}
+	if len(items) == 0 {
+		return "", fmt.Errorf("no bypass is set, None is expected to bypass no service")
+	}
+	var services []string
+	for _, item := range items {
+		service, ok := bypassServices[strings.ToLower(item)]
+		if !ok {
+			return "", fmt.Errorf("%q is not a service the network rules can be bypassed for", item)
+		}
+		services = append(services, service)
+	}
+	return strings.Join(services, ", "), nil
+}
+
+// accountNetworkRules returns the network rules to set on the storage
+// account, as set on the image registry config. Nothing is returned when
+// every network is to be allowed.
+func accountNetworkRules(cr *imageregistryv1.Config, config *imageregistryv1.ImageRegistryConfigStorageAzure) (*azureclient.StorageAccountNetworkRules, error) {
+	ipRanges := splitList(cr.Annotations[defaults.AzureNetworkRuleIPRangesAnnotation])
+	subnetIDs := splitList(cr.Annotations[defaults.AzureNetworkRuleSubnetsAnnotation])
+	if len(ipRanges) == 0 && len(subnetIDs) == 0 {
+		return nil, nil
+	}
+
+	if config != nil && config.NetworkAccess != nil && config.NetworkAccess.Type == imageregistryv1.AzureNetworkAccessTypeInternal {
+		return nil, fmt.Errorf("the public network access of the storage account is disabled, it is served by a private endpoint")
+	}
+	if config != nil && azureclient.IsAzureStackCloud(config.CloudName) {
+		return nil, fmt.Errorf("network rules are not supported on Azure Stack Hub")
+	}
+
+	rules := &azureclient.StorageAccountNetworkRules{Bypass: defaultNetworkRulesBypass}
+	for _, r := range ipRanges {
+		ipRange, err := parseIPRange(r)
+		if err != nil {
+			return nil, err
+		}
+		rules.IPRanges = append(rules.IPRanges, ipRange)
+	}
+	for _, id := range subnetIDs {
+		if !subnetIDRe.MatchString(id) {
+			return nil, fmt.Errorf("%q is not the resource ID of a subnet", id)
+		}
+		rules.SubnetIDs = append(rules.SubnetIDs, id)
+	}
+	if raw, ok := cr.Annotations[defaults.AzureNetworkRuleBypassAnnotation]; ok {
+		bypass, err := parseBypass(raw)
+		if err != nil {
+			return nil, err
+		}
+		rules.Bypass = bypass
+	}
+	return rules, nil
+}
+
+func accountNetworkRulesMessage(rules *azureclient.StorageAccountNetworkRules, err error) string {
+	if err != nil {
+		return fmt.Sprintf("Invalid network rules: %s", err)
+	}
+	if rules == nil {
+		return "No network rules are set on the storage account by the operator"
+	}
+	return fmt.Sprintf(
+		"Public network access to the storage account is restricted to IP ranges [%s] and subnets [%s], bypassed by %s",
+		strings.Join(rules.IPRanges, ", "), strings.Join(rules.SubnetIDs, ", "), rules.Bypass,
+	)
+}
+
+// networkRulesInputs returns the fingerprint of the network rules of the
+// storage account set on the image registry config, invalid ones included.
+func networkRulesInputs(rules *azureclient.StorageAccountNetworkRules, err error) string {
+	if err != nil {
+		return util.SettingInputs(err.Error())
+	}
+	return util.SettingInputs(rules)
+}
+
+// networkRulesChanged tells whether the network rules of the storage account
+// the operator should manage are not the ones last applied to the account,
+// or whether applying them failed and is due for a retry.
+func networkRulesChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false
+	}
+	rules, err := accountNetworkRules(cr, cr.Spec.Storage.Azure)
+	return util.SettingChanged(cr, defaults.StorageNetworkRulesApplied, networkRulesInputs(rules, err), networkRulesInputs(nil, nil))
+}
+
+// networkRulesApplied tells whether the operator restricted the network
+// access to the storage account with network rules.
+func networkRulesApplied(cr *imageregistryv1.Config) bool {
+	return util.FetchCondition(cr, defaults.StorageNetworkRulesApplied).Reason == networkRulesReasonApplied
+}
+
+// reconcileNetworkRules sets the network rules on the storage account, as
+// set on the image registry config, and reports them through the
+// StorageNetworkRulesApplied condition. The rules of the account are only
+// removed if the operator set them.
+func (d *driver) reconcileNetworkRules(cr *imageregistryv1.Config, cfg *Azure, accountName string) {
+	rules, err := accountNetworkRules(cr, d.Config)
+	inputs := networkRulesInputs(rules, err)
+	if err != nil {
+		// invalid rules are not retried until they are changed
+		util.UpdateCondition(cr, defaults.StorageNetworkRulesApplied, operatorapiv1.ConditionFalse, networkRulesReasonInvalid, accountNetworkRulesMessage(nil, err))
+		util.RecordSetting(cr, defaults.StorageNetworkRulesApplied, inputs, nil)
+		return
+	}
+	if rules == nil && !networkRulesApplied(cr) {
+		util.UpdateCondition(cr, defaults.StorageNetworkRulesApplied, operatorapiv1.ConditionFalse, networkRulesReasonNone, accountNetworkRulesMessage(nil, nil))
+		util.RecordSetting(cr, defaults.StorageNetworkRulesApplied, inputs, nil)
+		return
+	}
+
+	environment, err := getEnvironmentByName(d.Config.CloudName)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageNetworkRulesApplied, operatorapiv1.ConditionFalse, storageExistsReasonConfigError, err.Error())
+		util.RecordSetting(cr, defaults.StorageNetworkRulesApplied, inputs, err)
+		return
+	}
+	azClient, err := d.newAzClient(cfg, environment, nil)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageNetworkRulesApplied, operatorapiv1.ConditionFalse, storageExistsReasonAzureError, fmt.Sprintf("Unable to set the network rules of the storage account: %s", err))
+		util.RecordSetting(cr, defaults.StorageNetworkRulesApplied, inputs, err)
+		return
+	}
+	if err := azClient.UpdateStorageAccountNetworkRules(d.Context, cfg.ResourceGroup, accountName, rules); err != nil {
+		util.UpdateCondition(cr, defaults.StorageNetworkRulesApplied, operatorapiv1.ConditionFalse, storageExistsReasonAzureError, fmt.Sprintf("Unable to set the network rules of the storage account: %s", err))
+		util.RecordSetting(cr, defaults.StorageNetworkRulesApplied, inputs, err)
+		return
+	}
+
+	util.RecordSetting(cr, defaults.StorageNetworkRulesApplied, inputs, nil)
+	if rules == nil {
+		util.UpdateCondition(cr, defaults.StorageNetworkRulesApplied, operatorapiv1.ConditionFalse, networkRulesReasonNone, accountNetworkRulesMessage(nil, nil))
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageNetworkRulesApplied, operatorapiv1.ConditionTrue, networkRulesReasonApplied, accountNetworkRulesMessage(rules, nil))
+}
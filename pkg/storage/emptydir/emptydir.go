@@ -73,6 +73,11 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 	return false
 }
 
+// Validate is a no-op, there are no credentials involved.
+func (d *driver) Validate(cr *imageregistryv1.Config) error {
+	return nil
+}
+
 func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	if cr.Spec.Storage.ManagementState == "" {
 		cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
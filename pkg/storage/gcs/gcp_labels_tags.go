@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
 	"time"
 
 	configv1 "github.com/openshift/api/config/v1"
@@ -65,6 +67,7 @@ var UserTagsNotDefined = errors.New("user did not define any tags")
 // TagService is the interface that wraps methods for resource tag operations.
 type TagService interface {
 	AddTagsToStorageBucket(context.Context, *imageregistryv1.Config) error
+	SyncStorageBucketTags(context.Context, string, []string, []string) ([]string, error)
 	Close()
 }
 
@@ -72,6 +75,7 @@ type TagService interface {
 type TagBindingsService interface {
 	DeduplicateTags(context.Context, string, []string) []string
 	CreateTagBindings(context.Context, string, []string) error
+	DeleteTagBindings(context.Context, string, []string) error
 	Close()
 }
 
@@ -213,6 +217,12 @@ func getInfraResourceTagsList(platformStatus *configv1.PlatformStatus) []configv
 	return nil
 }
 
+// ResourceTagValues returns the NamespacedNames of the tagValues of the
+// user-defined tags present in the status sub-resource of Infrastructure.
+func ResourceTagValues(platformStatus *configv1.PlatformStatus) []string {
+	return toTagValueList(getInfraResourceTagsList(platformStatus))
+}
+
 // getTagsToBind returns list of user tags defined in status subresource of
 // infrastructure/cluster resource, after removing the tags which already exist
 // on the gcp resource.
@@ -251,6 +261,38 @@ func (c *tagBindingsClient) wait(ctx context.Context, op *rscmgr.CreateTagBindin
 	return err
 }
 
+// deleteTagBinding is a method that wraps GAPI DeleteTagBinding.
+func (c *tagBindingsClient) deleteTagBinding(ctx context.Context, resourceName, tagValue string) (*rscmgr.DeleteTagBindingOperation, error) {
+	return c.TagBindingsClient.DeleteTagBinding(ctx, &rscmgrpb.DeleteTagBindingRequest{
+		Name: fmt.Sprintf("tagBindings/%s/%s", url.PathEscape(resourceName), tagValue),
+	})
+}
+
+// waitDelete is a method that wraps GAPI Wait of a tag binding deletion.
+func (c *tagBindingsClient) waitDelete(ctx context.Context, op *rscmgr.DeleteTagBindingOperation) error {
+	return op.Wait(ctx)
+}
+
+// boundTagValues returns the tagValues bound to the resource, keyed by their
+// NamespacedNames. The tags inherited from the parent resources are left out.
+func (c *tagBindingsClient) boundTagValues(ctx context.Context, resourceName string) (map[string]string, error) {
+	bound := map[string]string{}
+	bindings := c.listEffectiveTags(ctx, resourceName)
+	for {
+		binding, err := bindings.Next()
+		if errors.Is(err, iterator.Done) {
+			return bound, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if binding.GetInherited() {
+			continue
+		}
+		bound[binding.GetNamespacedTagValue()] = binding.GetTagValue()
+	}
+}
+
 // CreateTagBindings creates the tag bindings for the resource.
 func (c *tagBindingsClient) CreateTagBindings(ctx context.Context, resourceName string, tags []string) error {
 	// GCP has a rate limit of 600 requests per minute, restricting
@@ -291,6 +333,59 @@ func (c *tagBindingsClient) CreateTagBindings(ctx context.Context, resourceName
 	return nil
 }
 
+// DeleteTagBindings deletes the tag bindings of the resource. The tags not
+// bound to the resource, or inherited from its parent, are skipped.
+func (c *tagBindingsClient) DeleteTagBindings(ctx context.Context, resourceName string, tags []string) error {
+	bound, err := c.boundTagValues(ctx, resourceName)
+	if err != nil {
+		return fmt.Errorf("failed to list the tags bound to %s resource: %w", resourceName, err)
+	}
+
+	// GCP has a rate limit of 600 requests per minute, restricting
+	// here to 8 requests per second.
+	limiter := newRequestLimiter(gcpTagsRequestRateLimit, gcpTagsRequestTokenBucketSize, true)
+
+	errFlag := false
+	for _, tag := range tags {
+		tagValue, ok := bound[tag]
+		if !ok {
+			klog.V(5).Infof("tag %s is not bound to %s resource", tag, resourceName)
+			continue
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			errFlag = true
+			klog.Errorf("rate limiting request to remove %s tag from %s resource failed: %v",
+				tag, resourceName, err)
+			continue
+		}
+
+		result, err := c.deleteTagBinding(ctx, resourceName, tagValue)
+		if err != nil {
+			var gErr *apierror.APIError
+			if errors.As(err, &gErr) && gErr.HTTPCode() == http.StatusNotFound {
+				klog.V(5).Infof("tag %s already removed from %s resource", tag, resourceName)
+				continue
+			}
+			errFlag = true
+			klog.Errorf("request to remove %s tag from %s resource failed: %v", tag, resourceName, err)
+			continue
+		}
+
+		if err = c.waitDelete(ctx, result); err != nil {
+			errFlag = true
+			klog.Errorf("failed to remove %s tag from %s resource: %v", tag, resourceName, err)
+			continue
+		}
+		klog.Infof("successfully removed %s tag from %s resource", tag, resourceName)
+	}
+	if errFlag {
+		return fmt.Errorf("failed to remove tag(s) from %s resource", resourceName)
+	}
+
+	return nil
+}
+
 // addTagsToStorageBucket adds the user-defined tags in the Infrastructure resource
 // to the passed GCP bucket resource.
 func (t *tagServiceManager) addTagsToStorageBucket(ctx context.Context, cr *imageregistryv1.Config) error {
@@ -375,6 +470,31 @@ func (t *tagServiceManager) AddTagsToStorageBucket(ctx context.Context, cr *imag
 	return t.addTagsToStorageBucket(ctx, cr)
 }
 
+// SyncStorageBucketTags binds the tags to the passed GCP bucket resource,
+// unless they already are, and removes the bindings of the stale tags. It
+// returns the sorted list of the tags newly bound.
+func (t *tagServiceManager) SyncStorageBucketTags(ctx context.Context, bucketName string, tags, staleTags []string) ([]string, error) {
+	bucketFullName := fmt.Sprintf(bucketParentPathFmt, bucketName)
+
+	var bound []string
+	if len(tags) > 0 {
+		bound = t.tagBindingsClient.DeduplicateTags(ctx, bucketFullName, tags)
+	}
+	if len(bound) > 0 {
+		if err := t.tagBindingsClient.CreateTagBindings(ctx, bucketFullName, bound); err != nil {
+			return nil, err
+		}
+	}
+	if len(staleTags) > 0 {
+		if err := t.tagBindingsClient.DeleteTagBindings(ctx, bucketFullName, staleTags); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(bound)
+	return bound, nil
+}
+
 // updateTagCondition will update or add the `StorageTagged` condition.
 func updateTagCondition(cr *imageregistryv1.Config, err error) error {
 	if err != nil {
@@ -41,6 +41,8 @@ var fakeResourceTags = map[string]string{
 	"openshift/test3/test3": "tagValues/281476018424673",
 	"openshift/test4/test4": "tagValues/281476661334958",
 	"openshift/test5/test5": "tagValues/281475302386112",
+	"openshift/test6/test6": "tagValues/281479184329571",
+	"openshift/test7/test7": "tagValues/281480426097383",
 }
 
 // fakeTagBindingsClient is for faking tag binding operations on fake resources.
@@ -49,6 +51,7 @@ type fakeTagBindingsClient struct {
 
 	MockDeduplicateTags   func(parent string, tagList []string) []string
 	MockCreateTagBindings func(parent string, tags []string) error
+	MockDeleteTagBindings func(parent string, tags []string) error
 	MockClose             func()
 }
 
@@ -70,13 +73,19 @@ func (f *fakeTagBindingsClient) CreateTagBindings(ctx context.Context, parent st
 	return f.MockCreateTagBindings(parent, tags)
 }
 
+func (f *fakeTagBindingsClient) DeleteTagBindings(ctx context.Context, parent string, tags []string) error {
+	return f.MockDeleteTagBindings(parent, tags)
+}
+
 func (f *fakeTagBindingsClient) Close() {
 	f.MockClose()
 }
 
 func getFakeListEffectiveTagsResp() []byte {
 	return []byte(`{"effectiveTags":[{"tagValue":"tagValues/281483998077332","namespacedTagValue":"openshift/test3/test3","tagKey":"tagKeys/281482830535601","namespacedTagKey":"openshift/test3","inherited":true,"tagKeyParentName":"projects/openshift"},
-{"tagValue":"tagValues/281478395625645","namespacedTagValue":"openshift/test1/test1","tagKey":"tagKeys/281478395625645","namespacedTagKey":"openshift/test1","inherited":true,"tagKeyParentName":"projects/openshift"}]}`)
+{"tagValue":"tagValues/281478395625645","namespacedTagValue":"openshift/test1/test1","tagKey":"tagKeys/281478395625645","namespacedTagKey":"openshift/test1","inherited":true,"tagKeyParentName":"projects/openshift"},
+{"tagValue":"tagValues/281479184329571","namespacedTagValue":"openshift/test6/test6","tagKey":"tagKeys/281479184329571","namespacedTagKey":"openshift/test6","tagKeyParentName":"projects/openshift"},
+{"tagValue":"tagValues/281480426097383","namespacedTagValue":"openshift/test7/test7","tagKey":"tagKeys/281480426097383","namespacedTagKey":"openshift/test7","tagKeyParentName":"projects/openshift"}]}`)
 }
 
 func getFakeListEffectiveTagsForbiddenErrorResp(resource string) []byte {
@@ -101,6 +110,10 @@ func getFakeCreateTagBindingForbiddenErrorResp(tagValue, tagValueNamespacedName
 	return []byte(fmt.Sprintf(`{"error":{"code":403,"message":"Permission denied on resource '%s' (or it may not exist)","status":"PERMISSION_DENIED","details":[{"@type":"type.googleapis.com/google.rpc.PreconditionFailure","violations":[{"type":"PERMISSION_DENIED","subject":"//cloudresourcemanager.googleapis.com/%s","description":"Permission Denied"}]}]}}`, tagValueNamespacedName, tagValue))
 }
 
+func getFakeDeleteTagBindingResp() []byte {
+	return []byte(`{"name":"operations/rctb.delete","done":true,"response":{"@type":"type.googleapis.com/google.protobuf.Empty"}}`)
+}
+
 func getFakeTagValue(tagValueNamespacedName string) string {
 	return fakeResourceTags[tagValueNamespacedName]
 }
@@ -161,6 +174,31 @@ func fakeCreateTagBindingHandler(retFailureFor interface{}, w http.ResponseWrite
 	_, _ = w.Write(getFakeCreateTagBindingResp(req.Parent, req.TagValue, req.TagValueNamespacedName))
 }
 
+func fakeDeleteTagBindingHandler(retFailureFor interface{}, w http.ResponseWriter, r *http.Request) {
+	// the binding name ends with the tagValue.
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 2 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	tagValue := strings.Join(parts[len(parts)-2:], "/")
+
+	scenarios := retFailureFor.(map[string]int)
+	for tagValueNamespacedName, value := range fakeResourceTags {
+		if value != tagValue {
+			continue
+		}
+		switch scenarios[tagValueNamespacedName] {
+		case http.StatusForbidden:
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write(getFakeCreateTagBindingForbiddenErrorResp(tagValue, tagValueNamespacedName))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(getFakeDeleteTagBindingResp())
+}
+
 func fakeAPIServerHandler(retFailureFor interface{}) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		uri := r.URL.RequestURI()
@@ -169,6 +207,8 @@ func fakeAPIServerHandler(retFailureFor interface{}) http.HandlerFunc {
 			fakeListEffectiveTagsHandler(retFailureFor, w, r)
 		case strings.HasPrefix(uri, "/v3/tagBindings?"):
 			fakeCreateTagBindingHandler(retFailureFor, w, r)
+		case r.Method == http.MethodDelete && strings.HasPrefix(uri, "/v3/tagBindings/"):
+			fakeDeleteTagBindingHandler(retFailureFor, w, r)
 		default:
 			w.WriteHeader(http.StatusNotFound)
 		}
@@ -708,3 +748,145 @@ func TestDeduplicateTags(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteTagBindings(t *testing.T) {
+	ctx := context.Background()
+
+	server := NewFakeGAPIServer(map[string]int{
+		fmt.Sprintf(bucketParentPathFmt, "test-bucket3"): http.StatusForbidden,
+		"openshift/test7/test7":                          http.StatusForbidden,
+	})
+	defer server.Close()
+
+	tagClient := NewTestTagBindingsClient(t, ctx, server.Client(), server.URL)
+	defer tagClient.Close()
+
+	for _, tt := range []struct {
+		name          string
+		bucketName    string
+		tagsList      []string
+		expectedError string
+	}{
+		{
+			name:       "removed tags bound to the resource",
+			bucketName: "test-bucket1",
+			tagsList: []string{
+				"openshift/test6/test6",
+			},
+		},
+		{
+			name:       "inherited and not bound tags are skipped",
+			bucketName: "test-bucket1",
+			tagsList: []string{
+				"openshift/test1/test1",
+				"openshift/test2/test2",
+			},
+		},
+		{
+			name:       "removing tags fails with permission error",
+			bucketName: "test-bucket1",
+			tagsList: []string{
+				"openshift/test6/test6",
+				"openshift/test7/test7",
+			},
+			expectedError: `failed to remove tag(s) from //storage.googleapis.com/projects/_/buckets/test-bucket1 resource`,
+		},
+		{
+			name:       "fetching effective tags fails with permission error",
+			bucketName: "test-bucket3",
+			tagsList: []string{
+				"openshift/test6/test6",
+			},
+			expectedError: `failed to list the tags bound to //storage.googleapis.com/projects/_/buckets/test-bucket3 resource`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := fmt.Sprintf(bucketParentPathFmt, tt.bucketName)
+			err := tagClient.DeleteTagBindings(ctx, parent, tt.tagsList)
+			if (tt.expectedError == "") != (err == nil) || (err != nil && !strings.HasPrefix(err.Error(), tt.expectedError)) {
+				t.Errorf("DeleteTagBindings(): error: want: %v, got: %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestSyncStorageBucketTags(t *testing.T) {
+	ctx := context.Background()
+
+	var created, deleted []string
+	tagMgr := &tagServiceManager{
+		tagBindingsClient: &fakeTagBindingsClient{
+			t: t,
+			MockDeduplicateTags: func(parent string, tagList []string) []string {
+				var tags []string
+				for _, tag := range tagList {
+					if tag != "openshift/test1/test1" {
+						tags = append(tags, tag)
+					}
+				}
+				return tags
+			},
+			MockCreateTagBindings: func(parent string, tags []string) error {
+				created = append(created, tags...)
+				return nil
+			},
+			MockDeleteTagBindings: func(parent string, tags []string) error {
+				if parent == fmt.Sprintf(bucketParentPathFmt, "test-bucket2") {
+					return fmt.Errorf("failed to remove tag(s) from %s resource", parent)
+				}
+				deleted = append(deleted, tags...)
+				return nil
+			},
+			MockClose: func() {},
+		},
+	}
+
+	for _, tt := range []struct {
+		name            string
+		bucketName      string
+		tags            []string
+		staleTags       []string
+		expectedBound   []string
+		expectedCreated []string
+		expectedDeleted []string
+		expectedError   string
+	}{
+		{
+			name:            "new tags are bound and stale tags are removed",
+			bucketName:      "test-bucket1",
+			tags:            []string{"openshift/test4/test4", "openshift/test1/test1", "openshift/test2/test2"},
+			staleTags:       []string{"openshift/test3/test3"},
+			expectedBound:   []string{"openshift/test2/test2", "openshift/test4/test4"},
+			expectedCreated: []string{"openshift/test4/test4", "openshift/test2/test2"},
+			expectedDeleted: []string{"openshift/test3/test3"},
+		},
+		{
+			name:       "tags already bound",
+			bucketName: "test-bucket1",
+			tags:       []string{"openshift/test1/test1"},
+		},
+		{
+			name:          "removing stale tags fails",
+			bucketName:    "test-bucket2",
+			staleTags:     []string{"openshift/test3/test3"},
+			expectedError: `failed to remove tag(s) from //storage.googleapis.com/projects/_/buckets/test-bucket2 resource`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			created, deleted = nil, nil
+			bound, err := tagMgr.SyncStorageBucketTags(ctx, tt.bucketName, tt.tags, tt.staleTags)
+			if !errorAsExpected(tt.expectedError, err) {
+				t.Errorf("SyncStorageBucketTags(): error: want: %v, got: %v", tt.expectedError, err)
+			}
+			if !reflect.DeepEqual(bound, tt.expectedBound) {
+				t.Errorf("SyncStorageBucketTags(): bound tags: want: %v, got: %v", tt.expectedBound, bound)
+			}
+			if !reflect.DeepEqual(created, tt.expectedCreated) {
+				t.Errorf("SyncStorageBucketTags(): created tags: want: %v, got: %v", tt.expectedCreated, created)
+			}
+			if !reflect.DeepEqual(deleted, tt.expectedDeleted) {
+				t.Errorf("SyncStorageBucketTags(): deleted tags: want: %v, got: %v", tt.expectedDeleted, deleted)
+			}
+		})
+	}
+}
@@ -3,18 +3,23 @@ package gcs
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"reflect"
 	"strconv"
+	"time"
 
 	gstorage "cloud.google.com/go/storage"
 	goauth2 "golang.org/x/oauth2/google"
+	"golang.org/x/time/rate"
 	gapi "google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	goption "google.golang.org/api/option"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog/v2"
 
 	configapiv1 "github.com/openshift/api/config/v1"
@@ -27,6 +32,39 @@ import (
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
+const (
+	// registryRootPrefix is where the registry keeps its content in the bucket.
+	registryRootPrefix = "docker/"
+
+	// repositoriesPrefix is where the registry keeps the repositories, their
+	// upload directories included.
+	repositoriesPrefix = registryRootPrefix + "registry/v2/repositories/"
+
+	// incompleteUploadsAgeDays is the age of the incomplete uploads deleted
+	// by the bucket lifecycle.
+	incompleteUploadsAgeDays = 1
+
+	bucketReadyInterval = 2 * time.Second
+	bucketReadyTimeout  = time.Minute
+)
+
+// uploadObjectSuffixes match the objects of the upload directories (under
+// _uploads) among the objects under repositoriesPrefix: the uploaded data
+// and the upload start time. Nothing else under repositoriesPrefix ends
+// like them, the lifecycle conditions can't match the directories
+// themselves.
+var uploadObjectSuffixes = []string{"/data", "/startedat"}
+
+// requiredPermissions are the bucket permissions the registry and the
+// operator need.
+var requiredPermissions = []string{
+	"storage.buckets.get",
+	"storage.objects.create",
+	"storage.objects.delete",
+	"storage.objects.get",
+	"storage.objects.list",
+}
+
 type GCS struct {
 	KeyfileData string
 	Region      string
@@ -40,6 +78,9 @@ type driver struct {
 
 	// httpClient is used only during tests.
 	httpClient *http.Client
+
+	// created is set by CreateStorage when it created the bucket.
+	created bool
 }
 
 func NewDriver(ctx context.Context, c *imageregistryv1.ImageRegistryConfigStorageGCS, listers *regopclient.StorageListers) *driver {
@@ -214,9 +255,53 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 		return true
 	}
 
+	// CreateStorage enforces the access to, and the lifecycle of, managed
+	// buckets. Their inputs never change, they only go through it again
+	// when enforcing them failed and is due for a retry.
+	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		for _, conditionType := range []string{defaults.StoragePublicAccessBlocked, defaults.StorageIncompleteUploadCleanupEnabled} {
+			if util.SettingChanged(cr, conditionType, util.SettingInputs(), util.SettingInputs()) {
+				return true
+			}
+		}
+	}
+
 	return false
 }
 
+// Validate checks we hold the permissions needed on the configured bucket.
+// Buckets that don't exist yet are not checked, CreateStorage creates them.
+func (d *driver) Validate(cr *imageregistryv1.Config) error {
+	if len(d.Config.Bucket) == 0 {
+		return nil
+	}
+
+	client, err := d.getGCSClient()
+	if err != nil {
+		return err
+	}
+	bucket := client.Bucket(d.Config.Bucket)
+
+	_, err = bucket.Attrs(d.Context)
+	if err == gstorage.ErrBucketNotExist {
+		return nil
+	} else if gerr, ok := err.(*gapi.Error); ok && gerr.Code == http.StatusForbidden {
+		return util.PermissionDenied("unable to get bucket %s: %s", d.Config.Bucket, gerr.Message)
+	} else if err != nil {
+		return err
+	}
+
+	granted, err := bucket.IAM().TestPermissions(d.Context, requiredPermissions)
+	if err != nil {
+		return err
+	}
+	missing := sets.New(requiredPermissions...).Delete(granted...)
+	if missing.Len() > 0 {
+		return util.PermissionDenied("missing permissions on bucket %s: %v", d.Config.Bucket, sets.List(missing))
+	}
+	return nil
+}
+
 func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	gclient, err := d.getGCSClient()
 	if err != nil {
@@ -258,9 +343,11 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		}
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "GCS Bucket Exists", "User supplied GCS bucket exists and is accessible")
 	} else {
-		// If the bucket name is blank, let's generate one
+		// If the bucket name is blank, let's generate one. The name is
+		// deterministic so a retry after a failed config update finds the
+		// bucket created by the previous attempt instead of leaking it.
 		if len(d.Config.Bucket) == 0 {
-			if d.Config.Bucket, err = util.GenerateStorageName(d.Listers, d.Config.Region); err != nil {
+			if d.Config.Bucket, err = util.GenerateDeterministicStorageName(d.Listers, d.Config.Region); err != nil {
 				return err
 			}
 		}
@@ -274,8 +361,21 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		klog.V(1).Infof("createStorage: %v list of labels will be applied to %s bucket", labels, d.Config.Bucket)
 		bucketAttrs.Labels = labels
 
-		if err := bucket.Create(d.Context, d.Config.ProjectID, &bucketAttrs); err != nil {
-			if gerr, ok := err.(*gapi.Error); ok {
+		err = bucket.Create(d.Context, d.Config.ProjectID, &bucketAttrs)
+		d.created = err == nil
+		if err != nil {
+			if gerr, ok := err.(*gapi.Error); ok && gerr.Code == http.StatusConflict {
+				// GCS answers with a conflict both when the bucket is ours
+				// and when the name is taken by somebody else. A bucket we
+				// can read is the one created by a previous attempt, the
+				// ownership marker protects us from adopting another
+				// cluster's bucket.
+				if _, aerr := bucket.Attrs(d.Context); aerr != nil {
+					util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Unable to Access Bucket", fmt.Sprintf("The bucket %s exists, but is owned by another project", d.Config.Bucket))
+					return fmt.Errorf("bucket %s exists but is owned by another project: %w", d.Config.Bucket, err)
+				}
+				klog.Infof("bucket %s already owned by us, reusing", d.Config.Bucket)
+			} else if gerr, ok := err.(*gapi.Error); ok {
 				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, strconv.Itoa(gerr.Code), gerr.Error())
 				return err
 			} else {
@@ -299,7 +399,34 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		}
 	}
 
-	// TODO: Wait until the bucket exists
+	// Wait until the bucket exists
+	if err := d.waitForBucket(bucket); err != nil {
+		reportError(cr, defaults.StorageExists, err)
+		return err
+	}
+
+	// Enforce uniform bucket-level access and public access prevention
+	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		err := d.blockPublicAccess(bucket)
+		if err != nil {
+			reportError(cr, defaults.StoragePublicAccessBlocked, err)
+		} else {
+			util.UpdateCondition(cr, defaults.StoragePublicAccessBlocked, operatorapi.ConditionTrue, "Public Access Block Successful", "Uniform bucket-level access and public access prevention were successfully enforced on the GCS bucket")
+		}
+		util.RecordSetting(cr, defaults.StoragePublicAccessBlocked, util.SettingInputs(), err)
+	}
+
+	// Enable default incomplete upload cleanup after one (1) day. The
+	// lifecycle rules set by others are kept.
+	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		err := d.putLifecycleRules(bucket, registryLifecycleRules())
+		if err != nil {
+			reportError(cr, defaults.StorageIncompleteUploadCleanupEnabled, err)
+		} else {
+			util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionTrue, "Enable Cleanup Successful", "Default cleanup of incomplete uploads after one (1) day was successfully enabled")
+		}
+		util.RecordSetting(cr, defaults.StorageIncompleteUploadCleanupEnabled, util.SettingInputs(), err)
+	}
 
 	// Set KMS Key ID for encryption on the bucket (if specified)
 	// Data is encrypted by default on GCS: https://cloud.google.com/storage/docs/encryption/
@@ -347,6 +474,104 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	return nil
 }
 
+// reportError sets the condition conditionType to false, with the reason
+// and the message of err.
+func reportError(cr *imageregistryv1.Config, conditionType string, err error) {
+	if gerr, ok := err.(*gapi.Error); ok {
+		util.UpdateCondition(cr, conditionType, operatorapi.ConditionFalse, strconv.Itoa(gerr.Code), gerr.Error())
+	} else {
+		util.UpdateCondition(cr, conditionType, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+	}
+}
+
+// waitForBucket waits until the bucket can be read, newly created buckets
+// may not be right away.
+func (d *driver) waitForBucket(bucket *gstorage.BucketHandle) error {
+	var lastErr error
+	err := wait.PollUntilContextTimeout(d.Context, bucketReadyInterval, bucketReadyTimeout, true, func(ctx context.Context) (bool, error) {
+		_, lastErr = bucket.Attrs(ctx)
+		if lastErr == gstorage.ErrBucketNotExist {
+			return false, nil
+		}
+		return lastErr == nil, lastErr
+	})
+	if err != nil && lastErr != nil {
+		return lastErr
+	}
+	return err
+}
+
+// blockPublicAccess enforces uniform bucket-level access, access to the
+// bucket and its objects is only granted through IAM, and public access
+// prevention.
+func (d *driver) blockPublicAccess(bucket *gstorage.BucketHandle) error {
+	_, err := bucket.Update(d.Context, gstorage.BucketAttrsToUpdate{
+		UniformBucketLevelAccess: &gstorage.UniformBucketLevelAccess{
+			Enabled: true,
+		},
+		PublicAccessPrevention: gstorage.PublicAccessPreventionEnforced,
+	})
+	return err
+}
+
+// registryLifecycleRules returns the lifecycle rules the operator sets on
+// the bucket: incomplete multipart uploads are aborted, and the objects of
+// the upload directories deleted, after a day.
+func registryLifecycleRules() []gstorage.LifecycleRule {
+	return []gstorage.LifecycleRule{
+		{
+			Action: gstorage.LifecycleAction{
+				Type: gstorage.AbortIncompleteMPUAction,
+			},
+			Condition: gstorage.LifecycleCondition{
+				AgeInDays: incompleteUploadsAgeDays,
+			},
+		},
+		{
+			Action: gstorage.LifecycleAction{
+				Type: gstorage.DeleteAction,
+			},
+			Condition: gstorage.LifecycleCondition{
+				AgeInDays:     incompleteUploadsAgeDays,
+				MatchesPrefix: []string{repositoriesPrefix},
+				MatchesSuffix: uploadObjectSuffixes,
+			},
+		},
+	}
+}
+
+// putLifecycleRules adds rules to the lifecycle of the bucket. The rules
+// are told apart by their action and the objects they match, those the
+// operator sets replace the ones it set before, others are kept.
+func (d *driver) putLifecycleRules(bucket *gstorage.BucketHandle, rules []gstorage.LifecycleRule) error {
+	attrs, err := bucket.Attrs(d.Context)
+	if err != nil {
+		return err
+	}
+
+	key := func(r gstorage.LifecycleRule) string {
+		return fmt.Sprintf("%s/%v/%v", r.Action.Type, r.Condition.MatchesPrefix, r.Condition.MatchesSuffix)
+	}
+	ours := sets.New[string]()
+	for _, r := range rules {
+		ours.Insert(key(r))
+	}
+	var merged []gstorage.LifecycleRule
+	for _, r := range attrs.Lifecycle.Rules {
+		if !ours.Has(key(r)) {
+			merged = append(merged, r)
+		}
+	}
+	merged = append(merged, rules...)
+
+	_, err = bucket.Update(d.Context, gstorage.BucketAttrsToUpdate{
+		Lifecycle: &gstorage.Lifecycle{
+			Rules: merged,
+		},
+	})
+	return err
+}
+
 func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
 		return false, nil
@@ -391,6 +616,204 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 	return true, nil
 }
 
+// StorageUsage returns the number of bytes and objects stored by the registry
+// in the bucket. The limiter is waited on before every listing request.
+func (d *driver) StorageUsage(ctx context.Context, limiter *rate.Limiter) (int64, int64, error) {
+	client, err := d.getGCSClient()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	query := &gstorage.Query{Prefix: registryRootPrefix}
+	if err := query.SetAttrSelection([]string{"Size"}); err != nil {
+		return 0, 0, err
+	}
+
+	var size, objects int64
+	pager := iterator.NewPager(client.Bucket(d.Config.Bucket).Objects(ctx, query), 1000, "")
+	for {
+		if err := limiter.Wait(ctx); err != nil {
+			return 0, 0, err
+		}
+		var page []*gstorage.ObjectAttrs
+		token, err := pager.NextPage(&page)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, attrs := range page {
+			size += attrs.Size
+			objects++
+		}
+		if token == "" {
+			return size, objects, nil
+		}
+	}
+}
+
+// PutObject writes data into key. It is used to probe the bucket.
+func (d *driver) PutObject(ctx context.Context, key string, data []byte) error {
+	client, err := d.getGCSClient()
+	if err != nil {
+		return err
+	}
+	w := client.Bucket(d.Config.Bucket).Object(key).NewWriter(ctx)
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// GetObject reads the content of key. It is used to probe the bucket.
+func (d *driver) GetObject(ctx context.Context, key string) ([]byte, error) {
+	client, err := d.getGCSClient()
+	if err != nil {
+		return nil, err
+	}
+	r, err := client.Bucket(d.Config.Bucket).Object(key).NewReader(ctx)
+	if err == gstorage.ErrObjectNotExist || err == gstorage.ErrBucketNotExist {
+		return nil, util.ObjectNotFound(key, err)
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// DeleteObject removes key. It is used to probe the bucket.
+func (d *driver) DeleteObject(ctx context.Context, key string) error {
+	client, err := d.getGCSClient()
+	if err != nil {
+		return err
+	}
+	return client.Bucket(d.Config.Bucket).Object(key).Delete(ctx)
+}
+
+// ListOwnedStorage returns the buckets of the project named after the
+// cluster and labeled as owned by it.
+func (d *driver) ListOwnedStorage(ctx context.Context) ([]util.OwnedStorage, error) {
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := util.OwnedStorageNamePrefix(d.Listers)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := d.getGCSClient()
+	if err != nil {
+		return nil, err
+	}
+	projectID := d.Config.ProjectID
+	if len(projectID) == 0 {
+		cfg, err := GetConfig(d.Listers)
+		if err != nil {
+			return nil, err
+		}
+		projectID = cfg.ProjectID
+	}
+
+	ownerLabel := fmt.Sprintf(ocpDefaultLabelFmt, infra.Status.InfrastructureName)
+	var owned []util.OwnedStorage
+	it := client.Buckets(ctx, projectID)
+	it.Prefix = prefix
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return owned, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if attrs.Labels[ownerLabel] != "owned" {
+			continue
+		}
+		owned = append(owned, util.OwnedStorage{
+			Name:    attrs.Name,
+			Created: attrs.Created,
+		})
+	}
+}
+
+// RemoveOwnedStorage deletes the bucket name when it holds nothing but the
+// ownership marker and the canary objects. Buckets holding anything else,
+// like registry content under a custom root directory, are left untouched.
+// Noncurrent object versions are looked at too, the content they keep can
+// still be restored.
+func (d *driver) RemoveOwnedStorage(ctx context.Context, name string) (bool, error) {
+	client, err := d.getGCSClient()
+	if err != nil {
+		return false, err
+	}
+	bucket := client.Bucket(name)
+
+	var objects []*gstorage.ObjectAttrs
+	it := bucket.Objects(ctx, &gstorage.Query{Versions: true})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return false, err
+		}
+		if !util.IsOperatorObject(attrs.Name) {
+			return false, nil
+		}
+		objects = append(objects, attrs)
+	}
+
+	for _, attrs := range objects {
+		if err := bucket.Object(attrs.Name).Generation(attrs.Generation).Delete(ctx); err != nil {
+			return false, err
+		}
+	}
+	if err := bucket.Delete(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetStorageLabels returns the labels of the GCS bucket.
+func (d *driver) GetStorageLabels() (map[string]string, error) {
+	gclient, err := d.getGCSClient()
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := gclient.Bucket(d.Config.Bucket).Attrs(d.Context)
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{}
+	for key, value := range attrs.Labels {
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// PutStorageLabels sets the labels on the GCS bucket and removes the ones
+// with the removed keys. The other labels of the bucket are left untouched.
+func (d *driver) PutStorageLabels(labels map[string]string, removed []string) error {
+	gclient, err := d.getGCSClient()
+	if err != nil {
+		return err
+	}
+	var attrs gstorage.BucketAttrsToUpdate
+	for key, value := range labels {
+		attrs.SetLabel(key, value)
+	}
+	for _, key := range removed {
+		attrs.DeleteLabel(key)
+	}
+	_, err = gclient.Bucket(d.Config.Bucket).Update(d.Context, attrs)
+	return err
+}
+
+// StorageCreated tells whether CreateStorage created the bucket, rather than
+// reusing one it already owned.
+func (d *driver) StorageCreated() bool {
+	return d.created
+}
+
 // ID return the underlying storage identificator, on this case the bucket name.
 func (d *driver) ID() string {
 	return d.Config.Bucket
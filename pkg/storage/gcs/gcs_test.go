@@ -4,19 +4,25 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 
+	gstorage "cloud.google.com/go/storage"
+	"github.com/google/go-cmp/cmp"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
 
 	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 // tripper is injected on gcs client to simulate api responses.
@@ -30,6 +36,13 @@ func (r *tripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	defer func() {
 		r.req++
 	}()
+	// requests past the expected ones succeed.
+	if r.req >= len(r.responseCodes) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(bytes.NewBufferString("{}")),
+		}, nil
+	}
 	return &http.Response{
 		StatusCode: r.responseCodes[r.req],
 		Body:       io.NopCloser(bytes.NewBufferString(r.responseBodies[r.req])),
@@ -191,3 +204,448 @@ func TestStorageManagementState(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateStorageDeterministicNaming(t *testing.T) {
+	accountConfigJSON, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "project-id",
+		"private_key_id": "key-id",
+		"client_email":   "service-account-email",
+		"client_id":      "client-id",
+	})
+	if err != nil {
+		t.Fatalf("error marshalling config json: %v", err)
+	}
+
+	infraName := "test-cluster-abc12"
+	expectedBucket := infraName + "-" + defaults.ImageRegistryName + "-us-east1"
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: infraName,
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.GCPPlatformType,
+				GCP: &configv1.GCPPlatformStatus{
+					Region:    "us-east1",
+					ProjectID: "project-id",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"service_account.json": accountConfigJSON,
+		},
+	})
+	listers := builder.BuildListers()
+
+	for _, tt := range []struct {
+		name           string
+		responseCodes  []int
+		responseBodies []string
+		err            string
+	}{
+		{
+			name:           "bucket created",
+			responseCodes:  []int{http.StatusOK},
+			responseBodies: []string{`{}`},
+		},
+		{
+			name:           "bucket already owned by us (retry after conflict)",
+			responseCodes:  []int{http.StatusConflict, http.StatusOK},
+			responseBodies: []string{`{"error":{"code":409,"message":"you already own it"}}`, `{}`},
+		},
+		{
+			name:           "bucket owned by another project",
+			responseCodes:  []int{http.StatusConflict, http.StatusForbidden},
+			responseBodies: []string{`{"error":{"code":409,"message":"not available"}}`, `{"error":{"code":403}}`},
+			err:            "owned by another project",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &tripper{}
+			for i, code := range tt.responseCodes {
+				rt.AddResponse(code, tt.responseBodies[i])
+			}
+
+			// the first attempt generates the name, the config update is
+			// lost and the retry starts over from an empty bucket name.
+			config := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						GCS: &imageregistryv1.ImageRegistryConfigStorageGCS{},
+					},
+				},
+			}
+			drv := NewDriver(context.Background(), config.Spec.Storage.GCS.DeepCopy(), &listers.StorageListers)
+			drv.httpClient = &http.Client{Transport: rt}
+
+			err := drv.CreateStorage(config)
+			if len(tt.err) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error to be %q, %v received instead", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if config.Spec.Storage.GCS.Bucket != expectedBucket {
+				t.Errorf("expected bucket %q in spec, got %q", expectedBucket, config.Spec.Storage.GCS.Bucket)
+			}
+			if config.Status.Storage.GCS == nil || config.Status.Storage.GCS.Bucket != expectedBucket {
+				t.Errorf("expected bucket %q in status, got %#v", expectedBucket, config.Status.Storage.GCS)
+			}
+			if config.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+				t.Errorf("expected storage to be managed, %q instead", config.Spec.Storage.ManagementState)
+			}
+		})
+	}
+}
+
+// bucketTripper is injected on gcs client to serve the attributes of a
+// bucket and record the updates made to it.
+type bucketTripper struct {
+	attrs   string
+	patches []map[string]interface{}
+}
+
+func (r *bucketTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodPatch {
+		body := map[string]interface{}{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			return nil, err
+		}
+		r.patches = append(r.patches, body)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewBufferString(r.attrs)),
+	}, nil
+}
+
+func TestCreateStorageBucketAccessAndLifecycle(t *testing.T) {
+	accountConfigJSON, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "project-id",
+		"private_key_id": "key-id",
+		"client_email":   "service-account-email",
+		"client_id":      "client-id",
+	})
+	if err != nil {
+		t.Fatalf("error marshalling config json: %v", err)
+	}
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.GCPPlatformType,
+				GCP:  &configv1.GCPPlatformStatus{},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"service_account.json": accountConfigJSON,
+		},
+	})
+	listers := builder.BuildListers()
+
+	// a rule set by someone else, and the upload cleanup set with another
+	// age by a previous version.
+	rt := &bucketTripper{
+		attrs: `{"name":"abucket","lifecycle":{"rule":[` +
+			`{"action":{"type":"SetStorageClass","storageClass":"NEARLINE"},"condition":{"age":30}},` +
+			`{"action":{"type":"Delete"},"condition":{"age":7,"matchesPrefix":["docker/registry/v2/repositories/"],"matchesSuffix":["/data","/startedat"]}}` +
+			`]}}`,
+	}
+
+	config := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				ManagementState: imageregistryv1.StorageManagementStateManaged,
+				GCS: &imageregistryv1.ImageRegistryConfigStorageGCS{
+					Bucket: "abucket",
+				},
+			},
+		},
+	}
+	drv := NewDriver(context.Background(), config.Spec.Storage.GCS, &listers.StorageListers)
+	drv.httpClient = &http.Client{Transport: rt}
+
+	if err := drv.CreateStorage(config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, conditionType := range []string{defaults.StoragePublicAccessBlocked, defaults.StorageIncompleteUploadCleanupEnabled} {
+		if cond := util.FetchCondition(config, conditionType); cond.Status != operatorapi.ConditionTrue {
+			t.Errorf("expected %s to be true, got %s: %s", conditionType, cond.Reason, cond.Message)
+		}
+	}
+
+	var iamConfiguration, lifecycle interface{}
+	for _, patch := range rt.patches {
+		if v, ok := patch["iamConfiguration"]; ok {
+			iamConfiguration = v
+		}
+		if v, ok := patch["lifecycle"]; ok {
+			lifecycle = v
+		}
+	}
+	expectedIAMConfiguration := map[string]interface{}{
+		"uniformBucketLevelAccess": map[string]interface{}{"enabled": true},
+		"publicAccessPrevention":   "enforced",
+	}
+	if !reflect.DeepEqual(iamConfiguration, expectedIAMConfiguration) {
+		t.Errorf("unexpected iam configuration: %s", cmp.Diff(expectedIAMConfiguration, iamConfiguration))
+	}
+
+	rules, _ := lifecycle.(map[string]interface{})["rule"].([]interface{})
+	var actions []string
+	for _, rule := range rules {
+		r := rule.(map[string]interface{})
+		action := r["action"].(map[string]interface{})["type"].(string)
+		if age := r["condition"].(map[string]interface{})["age"].(float64); action != "SetStorageClass" && age != incompleteUploadsAgeDays {
+			t.Errorf("expected %s rule age to be %d, got %v", action, incompleteUploadsAgeDays, age)
+		}
+		actions = append(actions, action)
+	}
+	expectedActions := []string{"SetStorageClass", gstorage.AbortIncompleteMPUAction, gstorage.DeleteAction}
+	if !reflect.DeepEqual(actions, expectedActions) {
+		t.Errorf("unexpected lifecycle rules: %s", cmp.Diff(expectedActions, actions))
+	}
+}
+
+func TestStorageChangedBucketAccessAndLifecycle(t *testing.T) {
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				ManagementState: imageregistryv1.StorageManagementStateManaged,
+				GCS: &imageregistryv1.ImageRegistryConfigStorageGCS{
+					Bucket: "abucket",
+				},
+			},
+		},
+		Status: imageregistryv1.ImageRegistryStatus{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				GCS: &imageregistryv1.ImageRegistryConfigStorageGCS{
+					Bucket: "abucket",
+				},
+			},
+		},
+	}
+	util.UpdateCondition(cr, defaults.StorageTagged, operatorapi.ConditionTrue, "Tag Successful", "")
+	drv := NewDriver(context.Background(), cr.Spec.Storage.GCS, nil)
+
+	// existing buckets don't go through CreateStorage on upgrade
+	if drv.StorageChanged(cr) {
+		t.Errorf("unexpected storage change before the bucket access and lifecycle were enforced")
+	}
+
+	// failures are retried after a while, not on the next sync
+	util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionFalse, "Forbidden", "access denied")
+	util.RecordSetting(cr, defaults.StorageIncompleteUploadCleanupEnabled, util.SettingInputs(), errors.New("access denied"))
+	if drv.StorageChanged(cr) {
+		t.Errorf("unexpected storage change right after enforcing the lifecycle failed")
+	}
+}
+
+func TestStorageLabels(t *testing.T) {
+	accountConfigJSON, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "project-id",
+		"private_key_id": "key-id",
+		"client_email":   "service-account-email",
+		"client_id":      "client-id",
+	})
+	if err != nil {
+		t.Fatalf("error marshalling config json: %v", err)
+	}
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.GCPPlatformType,
+				GCP:  &configv1.GCPPlatformStatus{},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"service_account.json": accountConfigJSON,
+		},
+	})
+	listers := builder.BuildListers()
+
+	rt := &bucketTripper{
+		attrs: `{"name":"abucket","labels":{"kubernetes-io-cluster-test":"owned","team":"registry"}}`,
+	}
+	drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageGCS{Bucket: "abucket"}, &listers.StorageListers)
+	drv.httpClient = &http.Client{Transport: rt}
+
+	labels, err := drv.GetStorageLabels()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedLabels := map[string]string{"kubernetes-io-cluster-test": "owned", "team": "registry"}
+	if !reflect.DeepEqual(labels, expectedLabels) {
+		t.Errorf("unexpected labels: %s", cmp.Diff(expectedLabels, labels))
+	}
+
+	if err := drv.PutStorageLabels(map[string]string{"cost-center": "storage"}, []string{"team"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rt.patches) != 1 {
+		t.Fatalf("expected the bucket to be patched once, got %d patches", len(rt.patches))
+	}
+	expectedPatch := map[string]interface{}{
+		"labels": map[string]interface{}{"cost-center": "storage", "team": nil},
+	}
+	if !reflect.DeepEqual(rt.patches[0], expectedPatch) {
+		t.Errorf("unexpected patch: %s", cmp.Diff(expectedPatch, rt.patches[0]))
+	}
+}
+
+// objectListingTripper is injected on gcs client to serve the objects of a
+// bucket and record the objects and buckets deleted.
+type objectListingTripper struct {
+	objects []string
+	deleted []string
+}
+
+func (r *objectListingTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := "{}"
+	switch {
+	case req.Method == http.MethodGet && strings.HasSuffix(req.URL.Path, "/o"):
+		var items []map[string]string
+		for _, name := range r.objects {
+			items = append(items, map[string]string{"name": name, "generation": "1"})
+		}
+		data, err := json.Marshal(map[string]interface{}{"items": items})
+		if err != nil {
+			return nil, err
+		}
+		body = string(data)
+	case req.Method == http.MethodDelete:
+		r.deleted = append(r.deleted, strings.TrimPrefix(req.URL.Path, "/storage/v1/b/"))
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewBufferString(body)),
+	}, nil
+}
+
+func TestRemoveOwnedStorage(t *testing.T) {
+	accountConfigJSON, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "project-id",
+		"private_key_id": "key-id",
+		"client_email":   "service-account-email",
+		"client_id":      "client-id",
+	})
+	if err != nil {
+		t.Fatalf("error marshalling config json: %v", err)
+	}
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.GCPPlatformType,
+				GCP:  &configv1.GCPPlatformStatus{},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"service_account.json": accountConfigJSON,
+		},
+	})
+	listers := builder.BuildListers()
+
+	for _, tt := range []struct {
+		name            string
+		objects         []string
+		expectedDeleted []string
+	}{
+		{
+			name:            "empty bucket",
+			expectedDeleted: []string{"orphan"},
+		},
+		{
+			name: "ownership marker and canary objects",
+			objects: []string{
+				"openshift-image-registry-operator/canary",
+				"openshift-image-registry-owner.json",
+			},
+			expectedDeleted: []string{
+				"orphan/o/openshift-image-registry-operator/canary",
+				"orphan/o/openshift-image-registry-owner.json",
+				"orphan",
+			},
+		},
+		{
+			name: "registry content",
+			objects: []string{
+				"docker/registry/v2/blobs/sha256/1c/1c1f/data",
+				"openshift-image-registry-owner.json",
+			},
+		},
+		{
+			name: "registry content under a custom root directory",
+			objects: []string{
+				"openshift-image-registry-owner.json",
+				"registry/docker/registry/v2/blobs/sha256/1c/1c1f/data",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &objectListingTripper{objects: tt.objects}
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageGCS{Bucket: "abucket"}, &listers.StorageListers)
+			drv.httpClient = &http.Client{Transport: rt}
+
+			removed, err := drv.RemoveOwnedStorage(context.Background(), "orphan")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if removed != (len(tt.expectedDeleted) > 0) {
+				t.Errorf("expected the bucket to be removed: %t, got %t", len(tt.expectedDeleted) > 0, removed)
+			}
+			if !reflect.DeepEqual(rt.deleted, tt.expectedDeleted) {
+				t.Errorf("unexpected deletions: %s", cmp.Diff(tt.expectedDeleted, rt.deleted))
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package ibmcos
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/IBM/ibm-cos-sdk-go/aws"
+	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
+	"github.com/IBM/ibm-cos-sdk-go/service/s3"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	incompleteUploadsRuleID = "cleanup-incomplete-multipart-registry-uploads"
+
+	// errCodeNoSuchLifecycleConfiguration is returned when getting the
+	// lifecycle configuration of a bucket without any
+	errCodeNoSuchLifecycleConfiguration = "NoSuchLifecycleConfiguration"
+
+	// rootKeyEncryptionAlgorithm is the algorithm objects are encrypted
+	// with when the bucket is bound to a root key, the only one COS
+	// supports.
+	rootKeyEncryptionAlgorithm = "AES256"
+)
+
+// rootKeyServices are the key management services COS can bind buckets to
+// root keys of.
+var rootKeyServices = map[string]bool{
+	"kms":       true, // Key Protect
+	"hs-crypto": true, // Hyper Protect Crypto Services
+}
+
+// requestedRootKeyCRN returns the CRN of the root key the bucket is to be
+// encrypted with, as set on the image registry config. Nothing is returned
+// when the bucket is to be encrypted with keys managed by COS.
+func requestedRootKeyCRN(cr *imageregistryv1.Config) (string, error) {
+	crn := strings.TrimSpace(cr.Annotations[defaults.IBMCOSRootKeyCRNAnnotation])
+	if crn == "" {
+		return "", nil
+	}
+
+	// crn:v1:<cloud>:<type>:<service>:<location>:<scope>:<instance>:key:<id>
+	parts := strings.Split(crn, ":")
+	if len(parts) != 10 || parts[0] != "crn" || parts[8] != "key" || parts[9] == "" {
+		return "", fmt.Errorf("%q is not the CRN of a root key", crn)
+	}
+	if !rootKeyServices[parts[4]] {
+		return "", fmt.Errorf("%q is not a root key of Key Protect or Hyper Protect Crypto Services", crn)
+	}
+	return crn, nil
+}
+
+// rootKeyRequest opens the messages of the StorageEncrypted condition, it
+// tells the root key they were reported for.
+func rootKeyRequest(requested string) string {
+	if requested == "" {
+		return "No root key is requested"
+	}
+	return fmt.Sprintf("The root key %s is requested", requested)
+}
+
+func bucketEncryptionMessage(requested, actual string) string {
+	encryption := "keys managed by IBM COS"
+	if actual != "" {
+		encryption = fmt.Sprintf("the root key %s", actual)
+	}
+	if requested != "" && requested != actual {
+		return fmt.Sprintf("%s, but the bucket is encrypted with %s: the root key of a bucket can't be changed once it is created", rootKeyRequest(requested), encryption)
+	}
+	return fmt.Sprintf("%s, the bucket is encrypted with %s", rootKeyRequest(requested), encryption)
+}
+
+func invalidRootKeyMessage(err error) string {
+	return fmt.Sprintf("Invalid root key: %s", err)
+}
+
+// encryptionInputs returns the fingerprint of the root key set on the image
+// registry config, invalid ones included.
+func encryptionInputs(cr *imageregistryv1.Config) string {
+	requested, err := requestedRootKeyCRN(cr)
+	if err != nil {
+		return util.SettingInputs(err.Error())
+	}
+	return util.SettingInputs(requested)
+}
+
+// encryptionChanged tells whether the encryption of the bucket the operator
+// should manage was not checked against the requested root key, or whether
+// checking it failed and is due for a retry.
+func encryptionChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false
+	}
+	return util.SettingChanged(cr, defaults.StorageEncrypted, encryptionInputs(cr), util.SettingInputs(""))
+}
+
+// incompleteUploadCleanupChanged tells whether enabling the cleanup of
+// incomplete multipart uploads on the bucket the operator should manage
+// failed and is due for a retry.
+func incompleteUploadCleanupChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false
+	}
+	return util.SettingChanged(cr, defaults.StorageIncompleteUploadCleanupEnabled, util.SettingInputs(), util.SettingInputs())
+}
+
+// reportBucketEncryption reports whether the bucket is encrypted with the
+// requested root key through the StorageEncrypted condition. The root key of
+// a bucket is set when it is created, it can't be changed.
+func (d *driver) reportBucketEncryption(cr *imageregistryv1.Config, client *s3.S3) {
+	inputs := encryptionInputs(cr)
+	requested, err := requestedRootKeyCRN(cr)
+	if err != nil {
+		// invalid root keys are not checked again until they are changed
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, "Invalid Root Key", invalidRootKeyMessage(err))
+		util.RecordSetting(cr, defaults.StorageEncrypted, inputs, nil)
+		return
+	}
+
+	out, err := client.HeadBucketWithContext(d.Context, &s3.HeadBucketInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	util.RecordSetting(cr, defaults.StorageEncrypted, inputs, err)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionUnknown, aerr.Code(), aerr.Error())
+		} else {
+			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		}
+		return
+	}
+
+	var actual string
+	if aws.BoolValue(out.IBMSSEKPEnabled) {
+		actual = aws.StringValue(out.IBMSSEKPCrkId)
+	}
+	if requested != "" && requested != actual {
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, "Root Key Mismatch", bucketEncryptionMessage(requested, actual))
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, "Encryption Successful", bucketEncryptionMessage(requested, actual))
+}
+
+// enableIncompleteUploadCleanup enables the cleanup of incomplete multipart
+// uploads after one (1) day, and reports it through the
+// StorageIncompleteUploadCleanupEnabled condition.
+func (d *driver) enableIncompleteUploadCleanup(cr *imageregistryv1.Config, client *s3.S3) {
+	err := d.putIncompleteUploadsRule(client)
+	util.RecordSetting(cr, defaults.StorageIncompleteUploadCleanupEnabled, util.SettingInputs(), err)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+		} else {
+			util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+		}
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionTrue, "Enable Cleanup Successful", "Default cleanup of incomplete multipart uploads after one (1) day was successfully enabled")
+}
+
+// putIncompleteUploadsRule adds the rule cleaning up incomplete multipart
+// uploads to the lifecycle configuration of the bucket, replacing the rule
+// with the same ID. Other rules are kept. Nothing is changed when a rule
+// set by others already cleans up incomplete multipart uploads, as COS may
+// only allow one rule per bucket.
+func (d *driver) putIncompleteUploadsRule(client *s3.S3) error {
+	var existing []*s3.LifecycleRule
+	out, err := client.GetBucketLifecycleConfigurationWithContext(d.Context, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if !ok || aerr.Code() != errCodeNoSuchLifecycleConfiguration {
+			return err
+		}
+	} else {
+		existing = out.Rules
+	}
+
+	rules := make([]*s3.LifecycleRule, 0, len(existing)+1)
+	for _, rule := range existing {
+		if aws.StringValue(rule.ID) == incompleteUploadsRuleID {
+			continue
+		}
+		if rule.AbortIncompleteMultipartUpload != nil && aws.StringValue(rule.Status) == "Enabled" {
+			klog.Infof("incomplete multipart uploads of bucket %s are already cleaned up by lifecycle rule %s", d.Config.Bucket, aws.StringValue(rule.ID))
+			return nil
+		}
+		rules = append(rules, rule)
+	}
+	rules = append(rules, &s3.LifecycleRule{
+		ID:     aws.String(incompleteUploadsRuleID),
+		Status: aws.String("Enabled"),
+		Filter: &s3.LifecycleRuleFilter{
+			Prefix: aws.String(""),
+		},
+		AbortIncompleteMultipartUpload: &s3.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int64(1),
+		},
+	})
+
+	_, err = client.PutBucketLifecycleConfigurationWithContext(d.Context, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket: aws.String(d.Config.Bucket),
+		LifecycleConfiguration: &s3.LifecycleConfiguration{
+			Rules: rules,
+		},
+	})
+	return err
+}
@@ -4,14 +4,17 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"time"
 
 	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/time/rate"
 	"k8s.io/apimachinery/pkg/api/errors"
 
 	corev1 "k8s.io/api/core/v1"
@@ -52,6 +55,10 @@ const (
 	cosEndpointTemplate           = "s3.%s.cloud-object-storage.appdomain.cloud"
 	imageRegistrySecretDataKey    = "credentials"
 	imageRegistrySecretMountpoint = "/var/run/secrets/cloud"
+
+	// registryRootPrefix is where the registry keeps its content in the
+	// bucket.
+	registryRootPrefix = "docker/"
 )
 
 type driver struct {
@@ -72,6 +79,9 @@ type driver struct {
 	cosServiceEndpoint string
 	rcServiceEndpoint  string
 	rmServiceEndpoint  string
+
+	// created is set by CreateStorage when it created the bucket.
+	created bool
 }
 
 // NewDriver creates a new IBM COS storage driver.
@@ -155,6 +165,44 @@ func (d *driver) UpdateEffectiveConfig() (*imageregistryv1.ImageRegistryConfigSt
 	return effectiveConfig, nil
 }
 
+// Validate checks we are allowed to access the configured bucket and to list
+// its content. Buckets that don't exist yet are not checked, CreateStorage
+// creates them.
+func (d *driver) Validate(cr *imageregistryv1.Config) error {
+	if len(d.Config.Bucket) == 0 || len(d.Config.ServiceInstanceCRN) == 0 {
+		return nil
+	}
+
+	client, err := d.getIBMCOSClient(d.Config.ServiceInstanceCRN)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.HeadBucketWithContext(d.Context, &s3.HeadBucketInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchBucket, "NotFound":
+			return nil
+		case "Forbidden", "AccessDenied":
+			return util.PermissionDenied("unable to access IBM COS bucket %s: %s", d.Config.Bucket, aerr.Code())
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = client.ListObjectsV2WithContext(d.Context, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(d.Config.Bucket),
+		MaxKeys: aws.Int64(1),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "AccessDenied" {
+		return util.PermissionDenied("unable to list objects in IBM COS bucket %s: %s", d.Config.Bucket, aerr.Message())
+	}
+	return err
+}
+
 // CreateStorage attempts to create an IBM COS service instance,
 // resource key, and bucket.
 func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
@@ -413,34 +461,56 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		}
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "IBM COS Bucket Exists", "User supplied IBM COS bucket exists and is accessible")
 	} else {
-		// Attempt to create new bucket
+		// Attempt to create new bucket. Generated names are deterministic
+		// so a retry after a failed config update reuses the bucket created
+		// by the previous attempt instead of leaking it.
 		if len(d.Config.Bucket) == 0 {
-			if d.Config.Bucket, err = util.GenerateStorageName(d.Listers, d.Config.Location); err != nil {
+			if d.Config.Bucket, err = util.GenerateDeterministicStorageName(d.Listers, d.Config.Location); err != nil {
 				return err
 			}
 		}
 
+		// The root key of a bucket can only be set when it is created
+		rootKeyCRN, err := requestedRootKeyCRN(cr)
+		if err != nil {
+			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, "Invalid Root Key", invalidRootKeyMessage(err))
+			return err
+		}
+
 		// Get COS client
 		client, err := d.getIBMCOSClient(d.Config.ServiceInstanceCRN)
 		if err != nil {
 			return err
 		}
 
-		// Create COS bucket
-		_, err = client.CreateBucketWithContext(
-			d.Context,
-			&s3.CreateBucketInput{
-				Bucket: aws.String(d.Config.Bucket),
-				CreateBucketConfiguration: &s3.CreateBucketConfiguration{
-					LocationConstraint: aws.String(fmt.Sprintf("%s-smart", d.Config.Location)),
-				},
+		// Create COS bucket, encrypted with the requested root key if any
+		input := &s3.CreateBucketInput{
+			Bucket: aws.String(d.Config.Bucket),
+			CreateBucketConfiguration: &s3.CreateBucketConfiguration{
+				LocationConstraint: aws.String(fmt.Sprintf("%s-smart", d.Config.Location)),
 			},
-		)
+		}
+		if rootKeyCRN != "" {
+			input.IBMSSEKPCustomerRootKeyCrn = aws.String(rootKeyCRN)
+			input.IBMSSEKPEncryptionAlgorithm = aws.String(rootKeyEncryptionAlgorithm)
+		}
+		_, err = client.CreateBucketWithContext(d.Context, input)
+		d.created = err == nil
 		if err != nil {
 			if aerr, ok := err.(awserr.Error); ok {
-				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+				switch aerr.Code() {
+				case s3.ErrCodeBucketAlreadyOwnedByYou:
+					klog.Infof("bucket %s already owned by us, reusing", d.Config.Bucket)
+				case s3.ErrCodeBucketAlreadyExists:
+					util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Unable to Access Bucket", fmt.Sprintf("The bucket %s exists, but is owned by another account", d.Config.Bucket))
+					return fmt.Errorf("bucket %s exists but is owned by another account", d.Config.Bucket)
+				default:
+					util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+					return err
+				}
+			} else {
+				return err
 			}
-			return err
 		}
 
 		// Wait until the bucket exists
@@ -466,6 +536,17 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "Creation Successful", "IBM COS bucket was successfully created")
 	}
 
+	// Report the encryption of the bucket, and enable default incomplete
+	// multipart upload cleanup after one (1) day
+	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		client, err := d.getIBMCOSClient(d.Config.ServiceInstanceCRN)
+		if err != nil {
+			return err
+		}
+		d.reportBucketEncryption(cr, client)
+		d.enableIncompleteUploadCleanup(cr, client)
+	}
+
 	return nil
 }
 
@@ -649,6 +730,170 @@ func (d *driver) getResourceManagerService() (*resourcemanagerv2.ResourceManager
 	return service, nil
 }
 
+// StorageUsage returns the number of bytes and objects stored by the registry
+// in the bucket. The limiter is waited on before every listing request.
+func (d *driver) StorageUsage(ctx context.Context, limiter *rate.Limiter) (int64, int64, error) {
+	client, err := d.getIBMCOSClient(d.Config.ServiceInstanceCRN)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var size, objects int64
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(d.Config.Bucket),
+		Prefix: aws.String(registryRootPrefix),
+	}
+	for {
+		if err := limiter.Wait(ctx); err != nil {
+			return 0, 0, err
+		}
+		output, err := client.ListObjectsV2WithContext(ctx, input)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, obj := range output.Contents {
+			size += aws.Int64Value(obj.Size)
+			objects++
+		}
+		if !aws.BoolValue(output.IsTruncated) {
+			return size, objects, nil
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+}
+
+// PutObject writes data into key. It is used to probe the bucket.
+func (d *driver) PutObject(ctx context.Context, key string, data []byte) error {
+	client, err := d.getIBMCOSClient(d.Config.ServiceInstanceCRN)
+	if err != nil {
+		return err
+	}
+	_, err = client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+// GetObject reads the content of key. It is used to probe the bucket.
+func (d *driver) GetObject(ctx context.Context, key string) ([]byte, error) {
+	client, err := d.getIBMCOSClient(d.Config.ServiceInstanceCRN)
+	if err != nil {
+		return nil, err
+	}
+	output, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(key),
+	})
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == s3.ErrCodeNoSuchBucket) {
+		return nil, util.ObjectNotFound(key, err)
+	} else if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+	return io.ReadAll(output.Body)
+}
+
+// DeleteObject removes key. It is used to probe the bucket.
+func (d *driver) DeleteObject(ctx context.Context, key string) error {
+	client, err := d.getIBMCOSClient(d.Config.ServiceInstanceCRN)
+	if err != nil {
+		return err
+	}
+	_, err = client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// ListOwnedStorage returns the buckets of the service instance that are
+// named after the cluster.
+func (d *driver) ListOwnedStorage(ctx context.Context) ([]util.OwnedStorage, error) {
+	if len(d.Config.ServiceInstanceCRN) == 0 {
+		return nil, nil
+	}
+	prefix, err := util.OwnedStorageNamePrefix(d.Listers)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := d.getIBMCOSClient(d.Config.ServiceInstanceCRN)
+	if err != nil {
+		return nil, err
+	}
+	output, err := client.ListBucketsWithContext(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	var owned []util.OwnedStorage
+	for _, bucket := range output.Buckets {
+		name := aws.StringValue(bucket.Name)
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		owned = append(owned, util.OwnedStorage{
+			Name:    name,
+			Created: aws.TimeValue(bucket.CreationDate),
+		})
+	}
+	return owned, nil
+}
+
+// RemoveOwnedStorage deletes the bucket name when it holds nothing but the
+// ownership marker and the canary objects. Buckets holding anything else,
+// like registry content under a custom root directory, are left untouched.
+func (d *driver) RemoveOwnedStorage(ctx context.Context, name string) (bool, error) {
+	client, err := d.getIBMCOSClient(d.Config.ServiceInstanceCRN)
+	if err != nil {
+		return false, err
+	}
+
+	var objects []s3manager.BatchDeleteObject
+	empty := true
+	err = client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(name),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			if !util.IsOperatorObject(aws.StringValue(object.Key)) {
+				empty = false
+				return false
+			}
+			objects = append(objects, s3manager.BatchDeleteObject{
+				Object: &s3.DeleteObjectInput{
+					Bucket: aws.String(name),
+					Key:    object.Key,
+				},
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return false, err
+	}
+	if !empty {
+		return false, nil
+	}
+
+	if err := s3manager.NewBatchDeleteWithClient(client).Delete(ctx, &s3manager.DeleteObjectsIterator{Objects: objects}); err != nil {
+		return false, err
+	}
+	if _, err := client.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{
+		Bucket: aws.String(name),
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// StorageCreated tells whether CreateStorage created the bucket, rather than
+// reusing one it already owned.
+func (d *driver) StorageCreated() bool {
+	return d.created
+}
+
 // ID returns the underlying storage identifier, in this case the bucket name.
 func (d *driver) ID() string {
 	return d.Config.Bucket
@@ -754,7 +999,10 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, "IBMCOS Configuration Changed", "IBMCOS storage is in an unknown state")
 		return true
 	}
-	return false
+
+	// CreateStorage reports the encryption and enables the cleanup of
+	// incomplete uploads of the bucket
+	return encryptionChanged(cr) || incompleteUploadCleanupChanged(cr)
 }
 
 // StorageExists checks if an IBM COS bucket with the given name exists
@@ -3,9 +3,11 @@ package ibmcos
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	corev1 "k8s.io/api/core/v1"
@@ -16,10 +18,12 @@ import (
 	"github.com/IBM/platform-services-go-sdk/resourcemanagerv2"
 	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
 
 	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 func TestConfigEnv(t *testing.T) {
@@ -145,6 +149,9 @@ func TestStorageManagementState(t *testing.T) {
 				http.StatusOK,
 				http.StatusOK,
 				http.StatusOK,
+				http.StatusOK,
+				http.StatusOK,
+				http.StatusOK,
 			},
 			responseBodies: []string{
 				`{"resources": [{ "id": "rg-test-id"}]}`,
@@ -153,6 +160,9 @@ func TestStorageManagementState(t *testing.T) {
 				`{"crn": "crn:test:resource-key:0"}`,
 				`{}`,
 				`{}`,
+				`{}`,
+				`{}`,
+				`{}`,
 			},
 		},
 		{
@@ -201,6 +211,9 @@ func TestStorageManagementState(t *testing.T) {
 				http.StatusOK,
 				http.StatusOK,
 				http.StatusOK,
+				http.StatusOK,
+				http.StatusOK,
+				http.StatusOK,
 			},
 			responseBodies: []string{
 				`{"crn": "crn:test:instance:2", "resource_group_id": "rg-test-id", "state": "active"}`,
@@ -208,6 +221,9 @@ func TestStorageManagementState(t *testing.T) {
 				`{"crn": "crn:test:resource-key:2"}`,
 				`{}`,
 				`{}`,
+				`{}`,
+				`{}`,
+				`{}`,
 			},
 		},
 		{
@@ -256,6 +272,9 @@ func TestStorageManagementState(t *testing.T) {
 				http.StatusOK,
 				http.StatusOK,
 				http.StatusOK,
+				http.StatusOK,
+				http.StatusOK,
+				http.StatusOK,
 			},
 			responseBodies: []string{
 				`{"state": "removed"}`,
@@ -265,6 +284,9 @@ func TestStorageManagementState(t *testing.T) {
 				`{"crn": "crn:test:resource-key:4"}`,
 				`{}`,
 				`{}`,
+				`{}`,
+				`{}`,
+				`{}`,
 			},
 		},
 		{
@@ -287,6 +309,9 @@ func TestStorageManagementState(t *testing.T) {
 				http.StatusNotFound,
 				http.StatusOK,
 				http.StatusOK,
+				http.StatusOK,
+				http.StatusOK,
+				http.StatusOK,
 			},
 			responseBodies: []string{
 				`{"crn": "crn:test:instance:5", "resource_group_id": "rg-test-id", "state": "active"}`,
@@ -295,6 +320,9 @@ func TestStorageManagementState(t *testing.T) {
 				`{}`,
 				`{}`,
 				`{}`,
+				`{}`,
+				`{}`,
+				`{}`,
 			},
 		},
 	} {
@@ -347,25 +375,490 @@ func TestStorageManagementState(t *testing.T) {
 	}
 }
 
+func TestCreateStorageDeterministicNaming(t *testing.T) {
+	infraName := "test-cluster-abc12"
+	expectedBucket := infraName + "-" + defaults.ImageRegistryName + "-us-east"
+
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: infraName,
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.IBMCloudPlatformType,
+				IBMCloud: &configv1.IBMCloudPlatformStatus{
+					Location:          "us-east",
+					ResourceGroupName: "rg-test",
+				},
+			},
+		},
+	})
+	testBuilder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"ibmcloud_api_key": []byte("test-api-key"),
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	s3Error := func(code string) string {
+		return `<?xml version="1.0" encoding="UTF-8"?><Error><Code>` + code + `</Code><Message>error</Message></Error>`
+	}
+
+	for _, tt := range []struct {
+		name           string
+		responseCodes  []int
+		responseBodies []string
+		err            string
+	}{
+		{
+			name:          "bucket created",
+			responseCodes: []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusOK, http.StatusOK, http.StatusOK, http.StatusOK, http.StatusOK},
+			responseBodies: []string{
+				`{"crn": "crn:test:instance", "resource_group_id": "rg-test-id", "state": "active"}`,
+				`{"name": "rg-test"}`,
+				`{"crn": "crn:test:resource-key"}`,
+				`{}`,
+				`{}`,
+				`{}`,
+				`{}`,
+				`{}`,
+			},
+		},
+		{
+			name:          "bucket already owned by us (retry after conflict)",
+			responseCodes: []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusConflict, http.StatusOK, http.StatusOK, http.StatusOK, http.StatusOK},
+			responseBodies: []string{
+				`{"crn": "crn:test:instance", "resource_group_id": "rg-test-id", "state": "active"}`,
+				`{"name": "rg-test"}`,
+				`{"crn": "crn:test:resource-key"}`,
+				s3Error("BucketAlreadyOwnedByYou"),
+				`{}`,
+				`{}`,
+				`{}`,
+				`{}`,
+			},
+		},
+		{
+			name:          "bucket owned by another account",
+			responseCodes: []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusConflict},
+			responseBodies: []string{
+				`{"crn": "crn:test:instance", "resource_group_id": "rg-test-id", "state": "active"}`,
+				`{"name": "rg-test"}`,
+				`{"crn": "crn:test:resource-key"}`,
+				s3Error("BucketAlreadyExists"),
+			},
+			err: "owned by another account",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &tripper{}
+			for i, code := range tt.responseCodes {
+				rt.AddResponse(code, tt.responseBodies[i])
+			}
+
+			// the first attempt generates the name, the config update is
+			// lost and the retry starts over from an empty bucket name.
+			config := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						IBMCOS: &imageregistryv1.ImageRegistryConfigStorageIBMCOS{
+							ServiceInstanceCRN: "crn:test:instance",
+						},
+					},
+				},
+			}
+
+			drv := NewDriver(context.Background(), config.Spec.Storage.IBMCOS.DeepCopy(), &listers.StorageListers)
+			drv.AccountID = "test-account-id"
+			drv.roundTripper = rt
+			drv.resourceController = &resourcecontrollerv2.ResourceControllerV2{
+				Service: &core.BaseService{
+					Client: &http.Client{Transport: rt},
+					Options: &core.ServiceOptions{
+						URL:           "http://nowhere.cloud",
+						Authenticator: &core.NoAuthAuthenticator{},
+					},
+				},
+			}
+			drv.resourceManager = &resourcemanagerv2.ResourceManagerV2{
+				Service: &core.BaseService{
+					Client: &http.Client{Transport: rt},
+					Options: &core.ServiceOptions{
+						URL:           "http://nowhere.cloud",
+						Authenticator: &core.NoAuthAuthenticator{},
+					},
+				},
+			}
+
+			err := drv.CreateStorage(config)
+			if len(tt.err) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error to be %q, %v received instead", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if config.Spec.Storage.IBMCOS.Bucket != expectedBucket {
+				t.Errorf("expected bucket %q in spec, got %q", expectedBucket, config.Spec.Storage.IBMCOS.Bucket)
+			}
+			if config.Status.Storage.IBMCOS == nil || config.Status.Storage.IBMCOS.Bucket != expectedBucket {
+				t.Errorf("expected bucket %q in status, got %#v", expectedBucket, config.Status.Storage.IBMCOS)
+			}
+			if config.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+				t.Errorf("expected storage to be managed, %q instead", config.Spec.Storage.ManagementState)
+			}
+		})
+	}
+}
+
+func TestCreateStorageEncryptionAndCleanup(t *testing.T) {
+	rootKeyCRN := "crn:v1:bluemix:public:kms:us-east:a/test-account-id:test-instance-id:key:test-key-id"
+
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-cluster-abc12",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.IBMCloudPlatformType,
+				IBMCloud: &configv1.IBMCloudPlatformStatus{
+					Location:          "us-east",
+					ResourceGroupName: "rg-test",
+				},
+			},
+		},
+	})
+	testBuilder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"ibmcloud_api_key": []byte("test-api-key"),
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	s3Error := func(code string) string {
+		return `<?xml version="1.0" encoding="UTF-8"?><Error><Code>` + code + `</Code><Message>error</Message></Error>`
+	}
+	rootKeyHeaders := http.Header{
+		"Ibm-Sse-Kp-Enabled":               {"true"},
+		"Ibm-Sse-Kp-Customer-Root-Key-Crn": {rootKeyCRN},
+	}
+	abortRule := `<LifecycleConfiguration><Rule><ID>other</ID><Status>Enabled</Status><Filter><Prefix></Prefix></Filter><AbortIncompleteMultipartUpload><DaysAfterInitiation>7</DaysAfterInitiation></AbortIncompleteMultipartUpload></Rule></LifecycleConfiguration>`
+
+	type response struct {
+		code   int
+		body   string
+		header http.Header
+	}
+	for _, tt := range []struct {
+		name            string
+		bucket          string
+		rootKeyCRN      string
+		bucketResponses []response
+		err             string
+		expectRootKey   bool
+		expectPut       bool
+		expectEncrypted operatorapi.ConditionStatus
+		expectCleanup   operatorapi.ConditionStatus
+	}{
+		{
+			name:       "bucket created with a root key",
+			rootKeyCRN: rootKeyCRN,
+			bucketResponses: []response{
+				{code: http.StatusOK},
+				{code: http.StatusOK},
+				{code: http.StatusOK, header: rootKeyHeaders},
+				{code: http.StatusNotFound, body: s3Error("NoSuchLifecycleConfiguration")},
+				{code: http.StatusOK},
+			},
+			expectRootKey:   true,
+			expectPut:       true,
+			expectEncrypted: operatorapi.ConditionTrue,
+			expectCleanup:   operatorapi.ConditionTrue,
+		},
+		{
+			name: "bucket created with keys managed by COS",
+			bucketResponses: []response{
+				{code: http.StatusOK},
+				{code: http.StatusOK},
+				{code: http.StatusOK},
+				{code: http.StatusNotFound, body: s3Error("NoSuchLifecycleConfiguration")},
+				{code: http.StatusOK},
+			},
+			expectPut:       true,
+			expectEncrypted: operatorapi.ConditionTrue,
+			expectCleanup:   operatorapi.ConditionTrue,
+		},
+		{
+			name:       "existing bucket without the root key",
+			bucket:     "test-bucket",
+			rootKeyCRN: rootKeyCRN,
+			bucketResponses: []response{
+				{code: http.StatusOK},
+				{code: http.StatusOK},
+				{code: http.StatusOK, body: abortRule},
+			},
+			expectEncrypted: operatorapi.ConditionFalse,
+			expectCleanup:   operatorapi.ConditionTrue,
+		},
+		{
+			name:   "cleanup can't be enabled",
+			bucket: "test-bucket",
+			bucketResponses: []response{
+				{code: http.StatusOK},
+				{code: http.StatusOK},
+				{code: http.StatusNotFound, body: s3Error("NoSuchLifecycleConfiguration")},
+				{code: http.StatusForbidden, body: s3Error("AccessDenied")},
+			},
+			expectPut:       true,
+			expectEncrypted: operatorapi.ConditionTrue,
+			expectCleanup:   operatorapi.ConditionFalse,
+		},
+		{
+			name:       "invalid root key",
+			rootKeyCRN: "crn:v1:bluemix:public:cloud-object-storage:global:a/test-account-id:test-instance-id::",
+			err:        "not the CRN of a root key",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &tripper{}
+			rt.AddResponse(http.StatusOK, `{"crn": "crn:test:instance", "resource_group_id": "rg-test-id", "state": "active"}`)
+			rt.AddResponse(http.StatusOK, `{"name": "rg-test"}`)
+			rt.AddResponse(http.StatusOK, `{"crn": "crn:test:resource-key"}`)
+			for _, r := range tt.bucketResponses {
+				rt.AddResponseWithHeaders(r.code, r.body, r.header)
+			}
+
+			config := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						defaults.IBMCOSRootKeyCRNAnnotation: tt.rootKeyCRN,
+					},
+				},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						ManagementState: imageregistryv1.StorageManagementStateManaged,
+						IBMCOS: &imageregistryv1.ImageRegistryConfigStorageIBMCOS{
+							Bucket:             tt.bucket,
+							ServiceInstanceCRN: "crn:test:instance",
+						},
+					},
+				},
+			}
+
+			drv := NewDriver(context.Background(), config.Spec.Storage.IBMCOS.DeepCopy(), &listers.StorageListers)
+			drv.AccountID = "test-account-id"
+			drv.roundTripper = rt
+			drv.resourceController = &resourcecontrollerv2.ResourceControllerV2{
+				Service: &core.BaseService{
+					Client: &http.Client{Transport: rt},
+					Options: &core.ServiceOptions{
+						URL:           "http://nowhere.cloud",
+						Authenticator: &core.NoAuthAuthenticator{},
+					},
+				},
+			}
+			drv.resourceManager = &resourcemanagerv2.ResourceManagerV2{
+				Service: &core.BaseService{
+					Client: &http.Client{Transport: rt},
+					Options: &core.ServiceOptions{
+						URL:           "http://nowhere.cloud",
+						Authenticator: &core.NoAuthAuthenticator{},
+					},
+				},
+			}
+
+			err := drv.CreateStorage(config)
+			if len(tt.err) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error to be %q, %v received instead", tt.err, err)
+				}
+				if cond := util.FetchCondition(config, defaults.StorageEncrypted); cond.Status != operatorapi.ConditionFalse {
+					t.Errorf("expected the storage not to be reported as encrypted, got %#v", cond)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var rootKey string
+			var put bool
+			for _, req := range rt.requests {
+				switch req.Method {
+				case http.MethodPut:
+					if req.URL.Query().Has("lifecycle") {
+						put = true
+						body, err := io.ReadAll(req.Body)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if !strings.Contains(string(body), "<ID>"+incompleteUploadsRuleID+"</ID>") {
+							t.Errorf("expected the lifecycle rule cleaning up incomplete uploads, got %s", body)
+						}
+					} else {
+						rootKey = req.Header.Get("ibm-sse-kp-customer-root-key-crn")
+					}
+				}
+			}
+			if tt.expectRootKey && rootKey != rootKeyCRN {
+				t.Errorf("expected the bucket to be created with root key %q, got %q", rootKeyCRN, rootKey)
+			}
+			if put != tt.expectPut {
+				t.Errorf("expected the lifecycle configuration to be put: %t, got %t", tt.expectPut, put)
+			}
+			if cond := util.FetchCondition(config, defaults.StorageEncrypted); cond.Status != tt.expectEncrypted {
+				t.Errorf("expected %s to be %s, got %#v", defaults.StorageEncrypted, tt.expectEncrypted, cond)
+			}
+			if cond := util.FetchCondition(config, defaults.StorageIncompleteUploadCleanupEnabled); cond.Status != tt.expectCleanup {
+				t.Errorf("expected %s to be %s, got %#v", defaults.StorageIncompleteUploadCleanupEnabled, tt.expectCleanup, cond)
+			}
+			// failures are retried after a while, not on the next sync
+			if drv.StorageChanged(config) {
+				t.Errorf("expected the storage to be reconciled")
+			}
+		})
+	}
+}
+
 type tripper struct {
-	req            int
-	responseCodes  []int
-	responseBodies []string
+	req             int
+	requests        []*http.Request
+	responseCodes   []int
+	responseBodies  []string
+	responseHeaders []http.Header
 }
 
 func (r *tripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	defer func() {
 		r.req++
 	}()
+	r.requests = append(r.requests, req)
 
+	header := http.Header{"Content-Type": {"application/json"}}
+	for name, values := range r.responseHeaders[r.req] {
+		header[name] = values
+	}
 	return &http.Response{
 		StatusCode: r.responseCodes[r.req],
-		Header:     http.Header{"Content-Type": {"application/json"}},
+		Header:     header,
 		Body:       io.NopCloser(bytes.NewBufferString(r.responseBodies[r.req])),
 	}, nil
 }
 
 func (r *tripper) AddResponse(code int, body string) {
+	r.AddResponseWithHeaders(code, body, nil)
+}
+
+func (r *tripper) AddResponseWithHeaders(code int, body string, header http.Header) {
 	r.responseCodes = append(r.responseCodes, code)
 	r.responseBodies = append(r.responseBodies, body)
+	r.responseHeaders = append(r.responseHeaders, header)
+}
+
+func TestRemoveOwnedStorage(t *testing.T) {
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-cluster-abc12",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.IBMCloudPlatformType,
+				IBMCloud: &configv1.IBMCloudPlatformStatus{
+					Location:          "us-east",
+					ResourceGroupName: "rg-test",
+				},
+			},
+		},
+	})
+	testBuilder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"ibmcloud_api_key": []byte("test-api-key"),
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	for _, tt := range []struct {
+		name          string
+		objects       []string
+		expectRemoved bool
+	}{
+		{
+			name:          "empty bucket",
+			expectRemoved: true,
+		},
+		{
+			name:          "ownership marker and canary objects",
+			objects:       []string{"openshift-image-registry-operator/canary", "openshift-image-registry-owner.json"},
+			expectRemoved: true,
+		},
+		{
+			name:    "registry content",
+			objects: []string{"docker/registry/v2/blobs/sha256/1c/1c1f/data", "openshift-image-registry-owner.json"},
+		},
+		{
+			name:    "registry content under a custom root directory",
+			objects: []string{"openshift-image-registry-owner.json", "registry/docker/registry/v2/blobs/sha256/1c/1c1f/data"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var contents strings.Builder
+			for _, key := range tt.objects {
+				fmt.Fprintf(&contents, "<Contents><Key>%s</Key></Contents>", key)
+			}
+			rt := &tripper{}
+			rt.AddResponse(http.StatusOK, `<ListBucketResult><IsTruncated>false</IsTruncated>`+contents.String()+`</ListBucketResult>`)
+			if len(tt.objects) > 0 {
+				rt.AddResponse(http.StatusOK, `<DeleteResult></DeleteResult>`)
+			}
+			rt.AddResponse(http.StatusNoContent, "")
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageIBMCOS{
+				Bucket:             "test-cluster-abc12-image-registry-us-east",
+				Location:           "us-east",
+				ServiceInstanceCRN: "crn:test:instance",
+			}, &listers.StorageListers)
+			drv.roundTripper = rt
+
+			removed, err := drv.RemoveOwnedStorage(context.Background(), "orphan")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if removed != tt.expectRemoved {
+				t.Errorf("expected the bucket to be removed: %t, got %t", tt.expectRemoved, removed)
+			}
+			var deleted bool
+			for _, req := range rt.requests {
+				if req.Method == http.MethodDelete && req.URL.Path == "/orphan" {
+					deleted = true
+				}
+			}
+			if deleted != tt.expectRemoved {
+				t.Errorf("expected the bucket to be deleted: %t, got %t", tt.expectRemoved, deleted)
+			}
+			if !tt.expectRemoved && len(rt.requests) != 1 {
+				t.Errorf("expected the bucket to be left untouched, got %d requests", len(rt.requests))
+			}
+		})
+	}
 }
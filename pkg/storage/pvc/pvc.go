@@ -183,6 +183,11 @@ func (d *driver) createPVC(cr *imageregistryv1.Config) (*corev1.PersistentVolume
 	)
 }
 
+// Validate is a no-op, claims are managed with the operator credentials.
+func (d *driver) Validate(cr *imageregistryv1.Config) error {
+	return nil
+}
+
 func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	var (
 		err   error
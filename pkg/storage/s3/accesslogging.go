@@ -0,0 +1,376 @@
+package s3
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"k8s.io/klog/v2"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	// accessLogsOfTagKey is set on the access log bucket created by the
+	// operator to the name of the bucket whose access it logs. Access log
+	// buckets are not reported as orphans, and are removed along with the
+	// bucket they log.
+	accessLogsOfTagKey = "image-registry.openshift.io/access-logs-of"
+
+	// accessLogsRuleIDPrefix starts the ID of the lifecycle rule expiring
+	// the access logs of a bucket. It is followed by the bucket name, the
+	// log bucket may be shared.
+	accessLogsRuleIDPrefix = "expire-registry-access-logs-"
+
+	// accessLogDeliverySidPrefix starts the Sid of the statement allowing
+	// S3 to deliver the access logs of a bucket. It is followed by the
+	// bucket name, stripped of the characters a Sid can't hold.
+	accessLogDeliverySidPrefix = policySidPrefix + "AccessLogDelivery"
+
+	defaultAccessLogRetentionDays = 90
+)
+
+// sidInvalidChars matches the characters of a bucket name a Sid can't hold.
+var sidInvalidChars = regexp.MustCompile(`[^0-9A-Za-z]`)
+
+// accessLogError is returned when the access logging can't be set up.
+// Reason is used on the StorageAccessLoggingEnabled condition.
+type accessLogError struct {
+	reason string
+	err    error
+}
+
+func (e *accessLogError) Error() string {
+	return e.err.Error()
+}
+
+// accessLogging is the server access logging of the bucket, as set on the
+// image registry config. Logging is not wanted when bucket is empty.
+type accessLogging struct {
+	bucket        string
+	prefix        string
+	retentionDays int64
+}
+
+func (d *driver) bucketAccessLogging(cr *imageregistryv1.Config) accessLogging {
+	logging := accessLogging{
+		bucket:        strings.TrimSpace(cr.Annotations[defaults.S3AccessLogBucketAnnotation]),
+		prefix:        d.Config.Bucket + "/",
+		retentionDays: defaultAccessLogRetentionDays,
+	}
+	if prefix, ok := cr.Annotations[defaults.S3AccessLogPrefixAnnotation]; ok {
+		logging.prefix = prefix
+	}
+	if raw, ok := cr.Annotations[defaults.S3AccessLogRetentionDaysAnnotation]; ok {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n <= 0 {
+			klog.Warningf("ignoring invalid %s annotation %q: a positive number of days is expected", defaults.S3AccessLogRetentionDaysAnnotation, raw)
+		} else {
+			logging.retentionDays = n
+		}
+	}
+	return logging
+}
+
+func accessLoggingMessage(logging accessLogging) string {
+	return fmt.Sprintf("Server access logs of the S3 bucket are written to s3://%s/%s and kept for %d days", logging.bucket, logging.prefix, logging.retentionDays)
+}
+
+// accessLoggingInputs returns the fingerprint of the access logging set on
+// the image registry config.
+func accessLoggingInputs(logging accessLogging) string {
+	if logging.bucket == "" {
+		return util.SettingInputs(logging.bucket)
+	}
+	return util.SettingInputs(logging.bucket, logging.prefix, logging.retentionDays)
+}
+
+// accessLoggingChanged tells whether the access logging set on the image
+// registry config is not the one last applied to the bucket, or whether
+// applying it failed and is due for a retry.
+func (d *driver) accessLoggingChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false
+	}
+	inputs := accessLoggingInputs(d.bucketAccessLogging(cr))
+	return util.SettingChanged(cr, defaults.StorageAccessLoggingEnabled, inputs, accessLoggingInputs(accessLogging{}))
+}
+
+// accessLogDriver returns a driver for the access log bucket, in the region
+// of the bucket as S3 requires.
+func (d *driver) accessLogDriver(bucket string) *driver {
+	return &driver{
+		Context: d.Context,
+		Config: &imageregistryv1.ImageRegistryConfigStorageS3{
+			Bucket:             bucket,
+			Region:             d.Config.Region,
+			RegionEndpoint:     d.Config.RegionEndpoint,
+			VirtualHostedStyle: d.Config.VirtualHostedStyle,
+			TrustedCA:          d.Config.TrustedCA,
+		},
+		Listers:             d.Listers,
+		roundTripper:        d.roundTripper,
+		featureGateAccessor: d.featureGateAccessor,
+	}
+}
+
+// reconcileAccessLogging logs the access to the bucket into the bucket set
+// on the image registry config, or stops logging it when none is set
+// anymore. The outcome is reported through the StorageAccessLoggingEnabled
+// condition.
+func (d *driver) reconcileAccessLogging(cr *imageregistryv1.Config, svc *s3.S3, infra *configv1.Infrastructure) {
+	logging := d.bucketAccessLogging(cr)
+	inputs := accessLoggingInputs(logging)
+	if logging.bucket == "" {
+		if util.FetchCondition(cr, defaults.StorageAccessLoggingEnabled).Status != operatorapi.ConditionTrue {
+			util.RecordSetting(cr, defaults.StorageAccessLoggingEnabled, inputs, nil)
+			return
+		}
+		if err := d.putBucketLogging(svc, nil); err != nil {
+			reportAccessLoggingError(cr, inputs, err)
+			return
+		}
+		// the logs are left behind, someone may still need them.
+		util.UpdateCondition(cr, defaults.StorageAccessLoggingEnabled, operatorapi.ConditionFalse, "Access Logging Disabled", "The access to the S3 bucket is not logged")
+		util.RecordSetting(cr, defaults.StorageAccessLoggingEnabled, inputs, nil)
+		return
+	}
+
+	if err := d.setupAccessLogging(svc, infra, logging); err != nil {
+		reportAccessLoggingError(cr, inputs, err)
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageAccessLoggingEnabled, operatorapi.ConditionTrue, "Access Logging Enabled", accessLoggingMessage(logging))
+	util.RecordSetting(cr, defaults.StorageAccessLoggingEnabled, inputs, nil)
+}
+
+func reportAccessLoggingError(cr *imageregistryv1.Config, inputs string, err error) {
+	util.RecordSetting(cr, defaults.StorageAccessLoggingEnabled, inputs, err)
+	if aerr, ok := err.(awserr.Error); ok {
+		util.UpdateCondition(cr, defaults.StorageAccessLoggingEnabled, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+	} else if lerr, ok := err.(*accessLogError); ok {
+		util.UpdateCondition(cr, defaults.StorageAccessLoggingEnabled, operatorapi.ConditionFalse, lerr.reason, lerr.Error())
+	} else {
+		util.UpdateCondition(cr, defaults.StorageAccessLoggingEnabled, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+	}
+}
+
+// setupAccessLogging creates the access log bucket when it doesn't exist,
+// lets S3 deliver the access logs of the bucket into it, sets their
+// retention and turns on the access logging of the bucket.
+func (d *driver) setupAccessLogging(svc *s3.S3, infra *configv1.Infrastructure, logging accessLogging) error {
+	if logging.bucket == d.Config.Bucket {
+		return &accessLogError{"Invalid Target", fmt.Errorf("the access to the S3 bucket can't be logged into itself")}
+	}
+
+	logs := d.accessLogDriver(logging.bucket)
+	lsvc, err := logs.getS3Service()
+	if err != nil {
+		return err
+	}
+
+	owned, err := logs.ensureAccessLogBucket(lsvc, infra, d.Config.Bucket)
+	if err != nil {
+		return err
+	}
+
+	sid := accessLogDeliverySid(d.Config.Bucket)
+	arn := bucketARN(logs.Config.Region, logs.Config.Bucket)
+	statements := []policyStatement{
+		{
+			"Sid":       sid,
+			"Effect":    "Allow",
+			"Principal": map[string]string{"Service": "logging.s3.amazonaws.com"},
+			"Action":    "s3:PutObject",
+			"Resource":  arn + "/" + logging.prefix + "*",
+			"Condition": map[string]interface{}{
+				"ArnLike": map[string]string{
+					"aws:SourceArn": bucketARN(d.Config.Region, d.Config.Bucket),
+				},
+			},
+		},
+	}
+	// the policy of a bucket created by the operator is the operator's.
+	if owned {
+		statements = append(statements, policyStatement{
+			"Sid":       denyInsecureTransportSid,
+			"Effect":    "Deny",
+			"Principal": "*",
+			"Action":    "s3:*",
+			"Resource":  []string{arn, arn + "/*"},
+			"Condition": map[string]interface{}{
+				"Bool": map[string]string{
+					"aws:SecureTransport": "false",
+				},
+			},
+		})
+	}
+	if err := logs.putPolicyStatements(lsvc, func(s string) bool {
+		return s == sid || (owned && s == denyInsecureTransportSid)
+	}, statements); err != nil {
+		return err
+	}
+
+	if err := logs.putLifecycleRules(lsvc, []*s3.LifecycleRule{
+		{
+			ID:     aws.String(accessLogsRuleIDPrefix + d.Config.Bucket),
+			Status: aws.String(s3.ExpirationStatusEnabled),
+			Filter: &s3.LifecycleRuleFilter{
+				Prefix: aws.String(logging.prefix),
+			},
+			Expiration: &s3.LifecycleExpiration{
+				Days: aws.Int64(logging.retentionDays),
+			},
+		},
+	}); err != nil {
+		return err
+	}
+
+	return d.putBucketLogging(svc, &s3.LoggingEnabled{
+		TargetBucket: aws.String(logging.bucket),
+		TargetPrefix: aws.String(logging.prefix),
+	})
+}
+
+// ensureAccessLogBucket creates the access log bucket of source when it
+// doesn't exist. It tells whether the bucket is owned by the operator,
+// buckets created by someone else are only given the statements and the
+// lifecycle rule the access logging needs.
+func (d *driver) ensureAccessLogBucket(svc *s3.S3, infra *configv1.Infrastructure, source string) (bool, error) {
+	err := d.bucketExists(d.Config.Bucket)
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchBucket || aerr.Code() == "NotFound") {
+		klog.Infof("creating access log bucket %s", d.Config.Bucket)
+		if err := d.createBucket(svc); err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeBucketAlreadyExists {
+				return false, &accessLogError{"Unable to Access Bucket", fmt.Errorf("the access log bucket %s exists, but is owned by another account", d.Config.Bucket)}
+			}
+			return false, err
+		}
+		if err := d.waitForBucket(svc); err != nil {
+			return false, err
+		}
+	} else if err != nil {
+		return false, err
+	} else {
+		owner, err := d.accessLogsOf(svc)
+		if err != nil {
+			return false, err
+		}
+		if owner != source {
+			return false, nil
+		}
+	}
+
+	// created now, or by a previous attempt.
+	tags := append(bucketTags(infra), &s3.Tag{
+		Key:   aws.String(accessLogsOfTagKey),
+		Value: aws.String(source),
+	})
+	if err := d.putBucketTags(svc, tags); err != nil {
+		return false, err
+	}
+	if err := d.blockPublicAccess(svc); err != nil {
+		return false, err
+	}
+	// server access logs can't be delivered into a bucket encrypted with
+	// a KMS key, the driver has none.
+	if _, err := d.putBucketEncryption(svc); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// accessLogsOf returns the name of the bucket whose access logs the bucket
+// was created for by the operator, if any.
+func (d *driver) accessLogsOf(svc *s3.S3) (string, error) {
+	out, err := svc.GetBucketTaggingWithContext(d.Context, &s3.GetBucketTaggingInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errCodeNoSuchTagSet {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	for _, tag := range out.TagSet {
+		if aws.StringValue(tag.Key) == accessLogsOfTagKey {
+			return aws.StringValue(tag.Value), nil
+		}
+	}
+	return "", nil
+}
+
+// accessLogDeliverySid returns the Sid of the statement allowing S3 to
+// deliver the access logs of bucket.
+func accessLogDeliverySid(bucket string) string {
+	return accessLogDeliverySidPrefix + sidInvalidChars.ReplaceAllString(bucket, "")
+}
+
+// putBucketLogging turns on the access logging of the bucket into target,
+// or turns it off when target is nil.
+func (d *driver) putBucketLogging(svc *s3.S3, target *s3.LoggingEnabled) error {
+	_, err := svc.PutBucketLoggingWithContext(d.Context, &s3.PutBucketLoggingInput{
+		Bucket: aws.String(d.Config.Bucket),
+		BucketLoggingStatus: &s3.BucketLoggingStatus{
+			LoggingEnabled: target,
+		},
+	})
+	return err
+}
+
+// removeAccessLogBucket turns off the access logging of the bucket and
+// removes the bucket its access is logged into, when the operator created
+// it for the bucket. Access log buckets created by someone else are left
+// untouched.
+func (d *driver) removeAccessLogBucket(svc *s3.S3) error {
+	out, err := svc.GetBucketLoggingWithContext(d.Context, &s3.GetBucketLoggingInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if isBucketNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if out.LoggingEnabled == nil || aws.StringValue(out.LoggingEnabled.TargetBucket) == "" {
+		return nil
+	}
+
+	logs := d.accessLogDriver(aws.StringValue(out.LoggingEnabled.TargetBucket))
+	lsvc, err := logs.getS3Service()
+	if err != nil {
+		return err
+	}
+	owner, err := logs.accessLogsOf(lsvc)
+	if isBucketNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if owner != d.Config.Bucket {
+		return nil
+	}
+
+	// no more logs are delivered while the log bucket is emptied.
+	if err := d.putBucketLogging(svc, nil); err != nil {
+		return err
+	}
+	klog.Infof("removing access log bucket %s", logs.Config.Bucket)
+	if err := logs.emptyBucket(lsvc); err != nil {
+		return err
+	}
+	_, err = lsvc.DeleteBucketWithContext(d.Context, &s3.DeleteBucketInput{
+		Bucket: aws.String(logs.Config.Bucket),
+	})
+	if isBucketNotFound(err) {
+		return nil
+	}
+	return err
+}
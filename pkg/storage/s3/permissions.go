@@ -0,0 +1,165 @@
+package s3
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// evalDecisionAllowed is the decision of the policy simulation for the
+// actions the principal is allowed to perform.
+const evalDecisionAllowed = "allowed"
+
+// requiredActions returns the actions the operator and the registry perform
+// on the bucket, and on its objects, when the storage goes through
+// CreateStorage. create tells whether the bucket is to be created.
+func (d *driver) requiredActions(cr *imageregistryv1.Config, create bool) ([]string, []string) {
+	bucketActions := []string{
+		"s3:ListBucket",
+		"s3:ListBucketMultipartUploads",
+	}
+	objectActions := []string{
+		"s3:GetObject",
+		"s3:PutObject",
+		"s3:DeleteObject",
+		"s3:AbortMultipartUpload",
+	}
+
+	if create {
+		bucketActions = append(bucketActions, "s3:CreateBucket")
+	}
+
+	// buckets that exist and are not claimed yet are not managed by the
+	// operator, see CreateStorage.
+	managed := cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged ||
+		(cr.Spec.Storage.ManagementState == "" && create)
+	if !managed {
+		return bucketActions, objectActions
+	}
+
+	bucketActions = append(bucketActions,
+		"s3:PutBucketPublicAccessBlock",
+		"s3:GetBucketTagging",
+		"s3:PutBucketTagging",
+		"s3:PutEncryptionConfiguration",
+		"s3:GetBucketVersioning",
+		"s3:GetLifecycleConfiguration",
+		"s3:PutLifecycleConfiguration",
+		"s3:GetBucketPolicy",
+		"s3:PutBucketPolicy",
+	)
+	if status, _ := bucketVersioning(cr); status != "" {
+		bucketActions = append(bucketActions, "s3:PutBucketVersioning")
+	}
+	if replicationRegion(cr) != "" {
+		bucketActions = append(bucketActions, "s3:GetReplicationConfiguration", "s3:PutReplicationConfiguration")
+	}
+	if d.bucketAccessLogging(cr).bucket != "" {
+		bucketActions = append(bucketActions, "s3:PutBucketLogging")
+	}
+	return bucketActions, objectActions
+}
+
+// simulationPrincipal returns the ARN of the IAM user or role whose policies
+// apply to the caller. Sessions of an assumed role are simulated as the role,
+// whose path is not known. Nothing is returned for principals the policies of
+// can't be simulated, such as federated users or the root user.
+func simulationPrincipal(callerARN string) (arn.ARN, bool) {
+	principal, err := arn.Parse(callerARN)
+	if err != nil {
+		return arn.ARN{}, false
+	}
+	switch {
+	case principal.Service == "iam" && strings.HasPrefix(principal.Resource, "user/"):
+		return principal, true
+	case principal.Service == "sts" && strings.HasPrefix(principal.Resource, "assumed-role/"):
+		// assumed-role/<role>/<session>
+		parts := strings.Split(principal.Resource, "/")
+		if len(parts) != 3 {
+			return arn.ARN{}, false
+		}
+		principal.Service = "iam"
+		principal.Resource = "role/" + parts[1]
+		return principal, true
+	}
+	return arn.ARN{}, false
+}
+
+// deniedActions returns the actions, out of actions, the policies of the
+// principal don't allow on the resource.
+func (d *driver) deniedActions(svc *iam.IAM, principal, resource string, actions []string) ([]string, error) {
+	var denied []string
+	err := svc.SimulatePrincipalPolicyPagesWithContext(d.Context, &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(principal),
+		ActionNames:     aws.StringSlice(actions),
+		ResourceArns:    aws.StringSlice([]string{resource}),
+	}, func(out *iam.SimulatePolicyResponse, lastPage bool) bool {
+		for _, result := range out.EvaluationResults {
+			if aws.StringValue(result.EvalDecision) != evalDecisionAllowed {
+				denied = append(denied, aws.StringValue(result.EvalActionName))
+			}
+		}
+		return true
+	})
+	return denied, err
+}
+
+// simulatePermissions checks, through the IAM policy simulator, that the
+// principal the operator runs as is allowed to perform the actions of
+// requiredActions on bucket. The check is skipped when the policies of the
+// principal can't be simulated: S3 compatible storage outside of AWS,
+// principals that are not IAM users or roles, or credentials not allowed to
+// run the simulation.
+func (d *driver) simulatePermissions(sess *session.Session, cr *imageregistryv1.Config, bucket string, create bool) error {
+	if d.Config.RegionEndpoint != "" {
+		return nil
+	}
+
+	identity, err := sts.New(sess).GetCallerIdentityWithContext(d.Context, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		klog.Warningf("unable to get the identity of the S3 credentials, their permissions are not simulated: %s", err)
+		return nil
+	}
+	principal, ok := simulationPrincipal(aws.StringValue(identity.Arn))
+	if !ok {
+		klog.Infof("the permissions of %s can't be simulated", aws.StringValue(identity.Arn))
+		return nil
+	}
+
+	bucketARN := arn.ARN{
+		Partition: principal.Partition,
+		Service:   "s3",
+		Resource:  bucket,
+	}.String()
+	bucketActions, objectActions := d.requiredActions(cr, create)
+
+	svc := iam.New(sess)
+	var denied []string
+	for _, check := range []struct {
+		resource string
+		actions  []string
+	}{
+		{resource: bucketARN, actions: bucketActions},
+		{resource: bucketARN + "/*", actions: objectActions},
+	} {
+		actions, err := d.deniedActions(svc, principal.String(), check.resource, check.actions)
+		if err != nil {
+			klog.Warningf("unable to simulate the permissions of %s on bucket %s: %s", principal, bucket, err)
+			return nil
+		}
+		denied = append(denied, actions...)
+	}
+	if len(denied) > 0 {
+		return util.PermissionDenied("%s not allowed on bucket %s for %s", strings.Join(denied, ", "), bucket, principal)
+	}
+	return nil
+}
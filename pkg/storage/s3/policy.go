@@ -0,0 +1,328 @@
+package s3
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	// policySidPrefix starts the Sid of the policy statements managed by
+	// the operator. Statements with other Sids are left untouched.
+	policySidPrefix = "OpenShiftImageRegistry"
+
+	denyInsecureTransportSid  = policySidPrefix + "DenyInsecureTransport"
+	denyOutsideVPCEndpointSid = policySidPrefix + "DenyOutsideVPCEndpoint"
+	denyOtherPrincipalsSid    = policySidPrefix + "DenyOtherPrincipals"
+
+	policyVersion = "2012-10-17"
+
+	// errCodeNoSuchBucketPolicy is returned when getting the policy of a
+	// bucket without any
+	errCodeNoSuchBucketPolicy = "NoSuchBucketPolicy"
+)
+
+// policyDataActions are the actions restricted to a VPC endpoint or to the
+// cluster principal. Managing the bucket, its policy included, is left out
+// so a restriction can't lock the operator out.
+var policyDataActions = []string{
+	"s3:GetObject*",
+	"s3:PutObject*",
+	"s3:DeleteObject*",
+	"s3:ListBucket*",
+	"s3:AbortMultipartUpload",
+	"s3:ListMultipartUploadParts",
+}
+
+// bucketPolicy is an S3 bucket policy. Statements are kept as decoded so
+// the ones set by others are written back untouched.
+type bucketPolicy struct {
+	Version   string
+	ID        string `json:"Id,omitempty"`
+	Statement []policyStatement
+}
+
+type policyStatement map[string]interface{}
+
+func (s policyStatement) sid() string {
+	sid, _ := s["Sid"].(string)
+	return sid
+}
+
+// UnmarshalJSON decodes a policy whose Statement is either a list of
+// statements or a single one.
+func (p *bucketPolicy) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Version   string
+		ID        string `json:"Id"`
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	p.Version = raw.Version
+	p.ID = raw.ID
+	p.Statement = nil
+
+	statement := strings.TrimSpace(string(raw.Statement))
+	switch {
+	case statement == "" || statement == "null":
+		return nil
+	case strings.HasPrefix(statement, "{"):
+		var s policyStatement
+		if err := json.Unmarshal(raw.Statement, &s); err != nil {
+			return err
+		}
+		p.Statement = []policyStatement{s}
+		return nil
+	default:
+		return json.Unmarshal(raw.Statement, &p.Statement)
+	}
+}
+
+// policyRestrictions are the restrictions of the access to the bucket set on
+// the image registry config, on top of denying insecure transport.
+type policyRestrictions struct {
+	vpcEndpointID    string
+	clusterPrincipal bool
+}
+
+func bucketPolicyRestrictions(cr *imageregistryv1.Config) policyRestrictions {
+	return policyRestrictions{
+		vpcEndpointID:    strings.TrimSpace(cr.Annotations[defaults.S3VPCEndpointIDAnnotation]),
+		clusterPrincipal: cr.Annotations[defaults.S3RestrictToClusterPrincipalAnnotation] == "true",
+	}
+}
+
+func bucketPolicyMessage(r policyRestrictions) string {
+	message := "The bucket policy denies insecure transport"
+	if r.vpcEndpointID != "" {
+		message += fmt.Sprintf(", and the access to objects outside of VPC endpoint %s", r.vpcEndpointID)
+	}
+	if r.clusterPrincipal {
+		message += ", and the access to objects by other principals than the cluster"
+	}
+	return message
+}
+
+// policyInputs returns the fingerprint of the bucket policy the operator
+// should manage. The replication region counts as the replication role is
+// let through the restrictions.
+func policyInputs(managed bool, r policyRestrictions, replicationRegion string) string {
+	if !managed {
+		return util.SettingInputs(managed)
+	}
+	return util.SettingInputs(managed, r.vpcEndpointID, r.clusterPrincipal, replicationRegion)
+}
+
+func bucketPolicyInputs(cr *imageregistryv1.Config) string {
+	managed := cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged
+	return policyInputs(managed, bucketPolicyRestrictions(cr), replicationRegion(cr))
+}
+
+// policyChanged tells whether the bucket policy the operator should manage
+// is not the one last applied to the bucket, or whether applying it failed
+// and is due for a retry.
+func policyChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged &&
+		util.FetchCondition(cr, defaults.StoragePolicyApplied).Status != operatorapi.ConditionTrue {
+		return false
+	}
+	return util.SettingChanged(cr, defaults.StoragePolicyApplied, bucketPolicyInputs(cr), policyInputs(true, policyRestrictions{}, ""))
+}
+
+// reconcileBucketPolicy merges the policy statements of the operator into
+// the bucket policy when the storage is managed, and removes them when it
+// is not anymore. The outcome is reported through the StoragePolicyApplied
+// condition.
+func (d *driver) reconcileBucketPolicy(cr *imageregistryv1.Config, svc *s3.S3) {
+	inputs := bucketPolicyInputs(cr)
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		if util.FetchCondition(cr, defaults.StoragePolicyApplied).Status != operatorapi.ConditionTrue {
+			return
+		}
+		if err := d.putPolicyStatements(svc, isOperatorStatement, nil); err != nil {
+			reportBucketPolicyError(cr, inputs, err)
+			return
+		}
+		util.UpdateCondition(cr, defaults.StoragePolicyApplied, operatorapi.ConditionFalse, "Storage Unmanaged", "The operator statements were removed from the bucket policy")
+		util.RecordSetting(cr, defaults.StoragePolicyApplied, inputs, nil)
+		return
+	}
+
+	restrictions := bucketPolicyRestrictions(cr)
+	statements, err := d.policyStatements(cr, restrictions)
+	if err != nil {
+		reportBucketPolicyError(cr, inputs, err)
+		return
+	}
+	if err := d.putPolicyStatements(svc, isOperatorStatement, statements); err != nil {
+		reportBucketPolicyError(cr, inputs, err)
+		return
+	}
+	util.UpdateCondition(cr, defaults.StoragePolicyApplied, operatorapi.ConditionTrue, "Policy Applied", bucketPolicyMessage(restrictions))
+	util.RecordSetting(cr, defaults.StoragePolicyApplied, inputs, nil)
+}
+
+func reportBucketPolicyError(cr *imageregistryv1.Config, inputs string, err error) {
+	util.RecordSetting(cr, defaults.StoragePolicyApplied, inputs, err)
+	if aerr, ok := err.(awserr.Error); ok {
+		util.UpdateCondition(cr, defaults.StoragePolicyApplied, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+	} else {
+		util.UpdateCondition(cr, defaults.StoragePolicyApplied, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+	}
+}
+
+// policyStatements returns the statements the operator adds to the bucket
+// policy.
+func (d *driver) policyStatements(cr *imageregistryv1.Config, r policyRestrictions) ([]policyStatement, error) {
+	arn := bucketARN(d.Config.Region, d.Config.Bucket)
+	resources := []string{arn, arn + "/*"}
+
+	statements := []policyStatement{
+		{
+			"Sid":       denyInsecureTransportSid,
+			"Effect":    "Deny",
+			"Principal": "*",
+			"Action":    "s3:*",
+			"Resource":  resources,
+			"Condition": map[string]interface{}{
+				"Bool": map[string]string{
+					"aws:SecureTransport": "false",
+				},
+			},
+		},
+	}
+
+	// S3 reads the objects to replicate through the replication role,
+	// from outside of any VPC.
+	var replicationRole string
+	if replicationRegion(cr) != "" {
+		if role, err := d.replicationRoleARN(); err == nil {
+			replicationRole = role
+		}
+	}
+	restrict := func(sid string, condition map[string]interface{}) policyStatement {
+		if replicationRole != "" {
+			condition["ArnNotEquals"] = map[string]string{
+				"aws:PrincipalArn": replicationRole,
+			}
+		}
+		return policyStatement{
+			"Sid":       sid,
+			"Effect":    "Deny",
+			"Principal": "*",
+			"Action":    policyDataActions,
+			"Resource":  resources,
+			"Condition": condition,
+		}
+	}
+
+	if r.vpcEndpointID != "" {
+		statements = append(statements, restrict(denyOutsideVPCEndpointSid, map[string]interface{}{
+			"StringNotEquals": map[string]string{
+				"aws:SourceVpce": r.vpcEndpointID,
+			},
+		}))
+	}
+	if r.clusterPrincipal {
+		userID, err := d.clusterPrincipalUserID()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, restrict(denyOtherPrincipalsSid, map[string]interface{}{
+			"StringNotLike": map[string]string{
+				"aws:userid": userID,
+			},
+		}))
+	}
+	return statements, nil
+}
+
+// clusterPrincipalUserID returns the ID of the principal whose credentials
+// the operator and the registry use, as matched by the aws:userid policy
+// key.
+func (d *driver) clusterPrincipalUserID() (string, error) {
+	sess, err := d.getSession()
+	if err != nil {
+		return "", err
+	}
+	out, err := sts.New(sess).GetCallerIdentityWithContext(d.Context, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+	userID := aws.StringValue(out.UserId)
+	// the ID of an assumed role is followed by the session name, which
+	// changes whenever the role is assumed again.
+	if i := strings.Index(userID, ":"); i >= 0 {
+		userID = userID[:i+1] + "*"
+	}
+	return userID, nil
+}
+
+// isOperatorStatement tells whether the statement with sid is managed by the
+// operator.
+func isOperatorStatement(sid string) bool {
+	return strings.HasPrefix(sid, policySidPrefix)
+}
+
+// putPolicyStatements replaces the statements of the bucket policy whose Sid
+// is owned with statements. The bucket policy is deleted when no statement
+// is left.
+func (d *driver) putPolicyStatements(svc *s3.S3, owned func(sid string) bool, statements []policyStatement) error {
+	policy := bucketPolicy{Version: policyVersion}
+	var exists bool
+	out, err := svc.GetBucketPolicyWithContext(d.Context, &s3.GetBucketPolicyInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errCodeNoSuchBucketPolicy {
+		// no policy yet.
+	} else if err != nil {
+		return err
+	} else {
+		if err := json.Unmarshal([]byte(aws.StringValue(out.Policy)), &policy); err != nil {
+			return fmt.Errorf("unable to decode the policy of bucket %s: %w", d.Config.Bucket, err)
+		}
+		exists = true
+	}
+
+	var merged []policyStatement
+	for _, s := range policy.Statement {
+		if !owned(s.sid()) {
+			merged = append(merged, s)
+		}
+	}
+	merged = append(merged, statements...)
+
+	if len(merged) == 0 {
+		if !exists {
+			return nil
+		}
+		_, err := svc.DeleteBucketPolicyWithContext(d.Context, &s3.DeleteBucketPolicyInput{
+			Bucket: aws.String(d.Config.Bucket),
+		})
+		return err
+	}
+
+	policy.Statement = merged
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	_, err = svc.PutBucketPolicyWithContext(d.Context, &s3.PutBucketPolicyInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Policy: aws.String(string(data)),
+	})
+	return err
+}
@@ -0,0 +1,389 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	// replicationRoleARNKey is the key of the private configuration secret
+	// holding the IAM role S3 assumes to replicate the bucket.
+	replicationRoleARNKey = "REGISTRY_STORAGE_S3_REPLICATIONROLEARN"
+
+	replicationRuleID = "replicate-registry-content"
+
+	// replicaOfTagKey is set on the replica to the name of the bucket it
+	// replicates. Replicas are not reported as orphans.
+	replicaOfTagKey = "image-registry.openshift.io/replica-of"
+
+	// errCodeReplicationConfigurationNotFound is returned when getting the
+	// replication configuration of a bucket without any
+	errCodeReplicationConfigurationNotFound = "ReplicationConfigurationNotFoundError"
+)
+
+// replicationError is returned when the replication can't be set up. Reason
+// is used on the StorageReplicationEnabled condition.
+type replicationError struct {
+	reason string
+	err    error
+}
+
+func (e *replicationError) Error() string {
+	return e.err.Error()
+}
+
+// replicationRegion returns the region the bucket is replicated to, as set on
+// the image registry config. Replication is not wanted when it is empty.
+func replicationRegion(cr *imageregistryv1.Config) string {
+	return strings.TrimSpace(cr.Annotations[defaults.S3ReplicationRegionAnnotation])
+}
+
+func replicationMessage(bucket, region, keyID string) string {
+	message := fmt.Sprintf("The S3 bucket is replicated to bucket %s in region %s", bucket, region)
+	if keyID != "" {
+		message += fmt.Sprintf(", replicas are encrypted with KMS key %s", keyID)
+	}
+	return message
+}
+
+// replicationInputs returns the fingerprint of the replication set on the
+// image registry config.
+func replicationInputs(region, keyID string) string {
+	if region == "" {
+		return util.SettingInputs(region)
+	}
+	return util.SettingInputs(region, keyID)
+}
+
+// replicationChanged tells whether the replication set on the image registry
+// config is not the one last applied to the bucket, or whether applying it
+// failed and is due for a retry.
+func replicationChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false
+	}
+	inputs := replicationInputs(replicationRegion(cr), cr.Annotations[defaults.S3ReplicaKMSKeyIDAnnotation])
+	return util.SettingChanged(cr, defaults.StorageReplicationEnabled, inputs, replicationInputs("", ""))
+}
+
+// replicationRoleARN returns the IAM role S3 assumes to replicate the bucket.
+func (d *driver) replicationRoleARN() (string, error) {
+	secretName := fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser)
+	sec, err := d.Listers.Secrets.Get(defaults.ImageRegistryPrivateConfigurationUser)
+	if errors.IsNotFound(err) {
+		return "", fmt.Errorf("secret %q with the %q key is required to replicate the bucket", secretName, replicationRoleARNKey)
+	} else if err != nil {
+		return "", err
+	}
+	role, ok := sec.Data[replicationRoleARNKey]
+	if !ok || len(role) == 0 {
+		return "", fmt.Errorf("secret %q does not contain required key %q", secretName, replicationRoleARNKey)
+	}
+	return string(role), nil
+}
+
+// replicaDriver returns a driver for the replica of the bucket in region.
+func (d *driver) replicaDriver(region, keyID string) (*driver, error) {
+	name, err := util.GenerateDeterministicStorageName(d.Listers, "replica", region)
+	if err != nil {
+		return nil, err
+	}
+	return &driver{
+		Context: d.Context,
+		Config: &imageregistryv1.ImageRegistryConfigStorageS3{
+			Bucket:    name,
+			Region:    region,
+			KeyID:     keyID,
+			TrustedCA: d.Config.TrustedCA,
+		},
+		Listers:             d.Listers,
+		roundTripper:        d.roundTripper,
+		featureGateAccessor: d.featureGateAccessor,
+	}, nil
+}
+
+// bucketARN returns the ARN of bucket, in the partition of region.
+func bucketARN(region, bucket string) string {
+	partition := endpoints.AwsPartitionID
+	if p, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		partition = p.ID()
+	}
+	return fmt.Sprintf("arn:%s:s3:::%s", partition, bucket)
+}
+
+// reconcileReplication replicates the bucket to the region set on the image
+// registry config, or stops replicating it when none is set anymore. The
+// outcome is reported through the StorageReplicationEnabled condition.
+func (d *driver) reconcileReplication(cr *imageregistryv1.Config, svc *s3.S3, infra *configv1.Infrastructure) {
+	region := replicationRegion(cr)
+	keyID := cr.Annotations[defaults.S3ReplicaKMSKeyIDAnnotation]
+	inputs := replicationInputs(region, keyID)
+	if region == "" {
+		if util.FetchCondition(cr, defaults.StorageReplicationEnabled).Status != operatorapi.ConditionTrue {
+			util.RecordSetting(cr, defaults.StorageReplicationEnabled, inputs, nil)
+			return
+		}
+		if err := d.removeReplicationRule(svc); err != nil {
+			reportReplicationError(cr, inputs, err)
+			return
+		}
+		// the replica is left behind, it is the copy of the registry
+		// content someone may still need.
+		util.UpdateCondition(cr, defaults.StorageReplicationEnabled, operatorapi.ConditionFalse, "Replication Disabled", "The S3 bucket is not replicated")
+		util.RecordSetting(cr, defaults.StorageReplicationEnabled, inputs, nil)
+		return
+	}
+
+	replica, err := d.setupReplication(cr, svc, infra, region, keyID)
+	if err != nil {
+		reportReplicationError(cr, inputs, err)
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageReplicationEnabled, operatorapi.ConditionTrue, "Replication Successful", replicationMessage(replica, region, keyID))
+	util.RecordSetting(cr, defaults.StorageReplicationEnabled, inputs, nil)
+}
+
+func reportReplicationError(cr *imageregistryv1.Config, inputs string, err error) {
+	util.RecordSetting(cr, defaults.StorageReplicationEnabled, inputs, err)
+	if aerr, ok := err.(awserr.Error); ok {
+		util.UpdateCondition(cr, defaults.StorageReplicationEnabled, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+	} else if rerr, ok := err.(*replicationError); ok {
+		util.UpdateCondition(cr, defaults.StorageReplicationEnabled, operatorapi.ConditionFalse, rerr.reason, rerr.Error())
+	} else {
+		util.UpdateCondition(cr, defaults.StorageReplicationEnabled, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+	}
+}
+
+// setupReplication creates the replica of the bucket in region, going
+// through the same steps as the bucket itself, and replicates the bucket
+// into it. It returns the name of the replica.
+func (d *driver) setupReplication(cr *imageregistryv1.Config, svc *s3.S3, infra *configv1.Infrastructure, region, keyID string) (string, error) {
+	if region == d.Config.Region {
+		return "", &replicationError{"Invalid Region", fmt.Errorf("the S3 bucket can't be replicated to its own region %s", region)}
+	}
+	if d.Config.RegionEndpoint != "" {
+		return "", &replicationError{"Unsupported Endpoint", fmt.Errorf("the S3 bucket can't be replicated when a custom endpoint is used")}
+	}
+	if versioning := util.FetchCondition(cr, defaults.StorageVersioningEnabled); versioning.Status != operatorapi.ConditionTrue {
+		return "", &replicationError{"Versioning Required", fmt.Errorf("the S3 bucket can't be replicated unless versioning is enabled on it")}
+	}
+	if d.Config.KeyID != "" && keyID == "" {
+		return "", &replicationError{"Replica KMS Key Required", fmt.Errorf("the S3 bucket is encrypted with a KMS key, the %s annotation must be set to replicate it", defaults.S3ReplicaKMSKeyIDAnnotation)}
+	}
+	role, err := d.replicationRoleARN()
+	if err != nil {
+		return "", &replicationError{"Role Missing", err}
+	}
+
+	replica, err := d.replicaDriver(region, keyID)
+	if err != nil {
+		return "", err
+	}
+	rsvc, err := replica.getS3Service()
+	if err != nil {
+		return "", err
+	}
+
+	klog.Infof("creating replica bucket %s in region %s", replica.Config.Bucket, region)
+	if err := replica.createBucket(rsvc); err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeBucketAlreadyExists {
+			return "", &replicationError{"Unable to Access Bucket", fmt.Errorf("the replica bucket %s exists, but is owned by another account", replica.Config.Bucket)}
+		}
+		return "", err
+	}
+	if err := replica.waitForBucket(rsvc); err != nil {
+		return "", err
+	}
+	if err := replica.blockPublicAccess(rsvc); err != nil {
+		return "", err
+	}
+	tags := append(bucketTags(infra), &s3.Tag{
+		Key:   aws.String(replicaOfTagKey),
+		Value: aws.String(d.Config.Bucket),
+	})
+	if err := replica.putBucketTags(rsvc, tags); err != nil {
+		return "", err
+	}
+	if _, err := replica.putBucketEncryption(rsvc); err != nil {
+		return "", err
+	}
+	if err := replica.putBucketVersioning(rsvc, s3.BucketVersioningStatusEnabled); err != nil {
+		return "", err
+	}
+	_, noncurrentDays := bucketVersioning(cr)
+	if err := replica.putLifecycleRules(rsvc, registryLifecycleRules(s3.BucketVersioningStatusEnabled, noncurrentDays)); err != nil {
+		return "", err
+	}
+
+	destination := &s3.Destination{
+		Bucket: aws.String(bucketARN(region, replica.Config.Bucket)),
+	}
+	rule := &s3.ReplicationRule{
+		ID:     aws.String(replicationRuleID),
+		Status: aws.String(s3.ReplicationRuleStatusEnabled),
+		Filter: &s3.ReplicationRuleFilter{
+			Prefix: aws.String(""),
+		},
+		DeleteMarkerReplication: &s3.DeleteMarkerReplication{
+			Status: aws.String(s3.DeleteMarkerReplicationStatusEnabled),
+		},
+		Destination: destination,
+	}
+	if keyID != "" {
+		destination.EncryptionConfiguration = &s3.EncryptionConfiguration{
+			ReplicaKmsKeyID: aws.String(keyID),
+		}
+		rule.SourceSelectionCriteria = &s3.SourceSelectionCriteria{
+			SseKmsEncryptedObjects: &s3.SseKmsEncryptedObjects{
+				Status: aws.String(s3.SseKmsEncryptedObjectsStatusEnabled),
+			},
+		}
+	}
+	if err := d.putReplicationRule(svc, role, rule); err != nil {
+		return "", err
+	}
+	return replica.Config.Bucket, nil
+}
+
+// getReplicationRules returns the replication rules of the bucket.
+func (d *driver) getReplicationRules(svc *s3.S3) ([]*s3.ReplicationRule, error) {
+	out, err := svc.GetBucketReplicationWithContext(d.Context, &s3.GetBucketReplicationInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errCodeReplicationConfigurationNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if out.ReplicationConfiguration == nil {
+		return nil, nil
+	}
+	return out.ReplicationConfiguration.Rules, nil
+}
+
+// putReplicationRule adds rule to the replication configuration of the
+// bucket, replacing the rule with the same ID. Other rules are kept, the
+// role is shared by all of them.
+func (d *driver) putReplicationRule(svc *s3.S3, role string, rule *s3.ReplicationRule) error {
+	existing, err := d.getReplicationRules(svc)
+	if err != nil {
+		return err
+	}
+
+	// rules are applied by priority, ours comes last.
+	var priority int64
+	for _, r := range existing {
+		if aws.StringValue(r.ID) != replicationRuleID && aws.Int64Value(r.Priority) >= priority {
+			priority = aws.Int64Value(r.Priority) + 1
+		}
+	}
+	rule.Priority = aws.Int64(priority)
+
+	_, err = svc.PutBucketReplicationWithContext(d.Context, &s3.PutBucketReplicationInput{
+		Bucket: aws.String(d.Config.Bucket),
+		ReplicationConfiguration: &s3.ReplicationConfiguration{
+			Role: aws.String(role),
+			Rules: mergeByKey(existing, []*s3.ReplicationRule{rule}, func(r *s3.ReplicationRule) string {
+				return aws.StringValue(r.ID)
+			}),
+		},
+	})
+	return err
+}
+
+// removeReplicationRule removes the replication rule of the operator from
+// the bucket, along with the replication configuration when no other rule
+// is left.
+func (d *driver) removeReplicationRule(svc *s3.S3) error {
+	out, err := svc.GetBucketReplicationWithContext(d.Context, &s3.GetBucketReplicationInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errCodeReplicationConfigurationNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if out.ReplicationConfiguration == nil {
+		return nil
+	}
+
+	var rules []*s3.ReplicationRule
+	for _, r := range out.ReplicationConfiguration.Rules {
+		if aws.StringValue(r.ID) != replicationRuleID {
+			rules = append(rules, r)
+		}
+	}
+	if len(rules) == len(out.ReplicationConfiguration.Rules) {
+		return nil
+	}
+	if len(rules) == 0 {
+		_, err = svc.DeleteBucketReplicationWithContext(d.Context, &s3.DeleteBucketReplicationInput{
+			Bucket: aws.String(d.Config.Bucket),
+		})
+		return err
+	}
+	_, err = svc.PutBucketReplicationWithContext(d.Context, &s3.PutBucketReplicationInput{
+		Bucket: aws.String(d.Config.Bucket),
+		ReplicationConfiguration: &s3.ReplicationConfiguration{
+			Role:  out.ReplicationConfiguration.Role,
+			Rules: rules,
+		},
+	})
+	return err
+}
+
+// CheckReplication returns the replication status S3 reports for key, and
+// writes key again so the next check looks at a fresh object.
+func (d *driver) CheckReplication(ctx context.Context, key string) (util.ReplicationStatus, error) {
+	svc, err := d.getS3Service()
+	if err != nil {
+		return util.ReplicationUnknown, err
+	}
+
+	status := util.ReplicationUnknown
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(key),
+	})
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == "NotFound" || aerr.Code() == s3.ErrCodeNoSuchKey) {
+		// first check, nothing was written yet.
+	} else if err != nil {
+		return util.ReplicationUnknown, err
+	} else {
+		switch aws.StringValue(head.ReplicationStatus) {
+		case s3.ReplicationStatusPending:
+			status = util.ReplicationPending
+		case s3.ReplicationStatusComplete, s3.ReplicationStatusCompleted:
+			status = util.ReplicationCompleted
+		case s3.ReplicationStatusFailed:
+			status = util.ReplicationFailed
+		}
+	}
+
+	_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader([]byte(time.Now().UTC().Format(time.RFC3339Nano))),
+	})
+	if err != nil {
+		return status, fmt.Errorf("unable to write %s: %w", key, err)
+	}
+	return status, nil
+}
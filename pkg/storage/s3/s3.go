@@ -6,12 +6,16 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -23,9 +27,11 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"golang.org/x/net/http/httpproxy"
 	"golang.org/x/net/http2"
+	"golang.org/x/time/rate"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 
 	configv1 "github.com/openshift/api/config/v1"
@@ -43,6 +49,23 @@ import (
 const (
 	imageRegistrySecretMountpoint = "/var/run/secrets/cloud"
 	imageRegistrySecretDataKey    = "credentials"
+
+	incompleteUploadsRuleID  = "cleanup-incomplete-multipart-registry-uploads"
+	noncurrentVersionsRuleID = "expire-noncurrent-registry-versions"
+
+	defaultNoncurrentVersionExpirationDays = 30
+
+	// errCodeNoSuchLifecycleConfiguration is returned when getting the
+	// lifecycle configuration of a bucket without any
+	errCodeNoSuchLifecycleConfiguration = "NoSuchLifecycleConfiguration"
+
+	// errCodeNoSuchTagSet is returned when getting the tags of a bucket
+	// without any
+	errCodeNoSuchTagSet = "NoSuchTagSet"
+
+	// registryRootPrefix is where the registry keeps its content in the
+	// bucket.
+	registryRootPrefix = "docker/"
 )
 
 type endpointsResolver struct {
@@ -113,6 +136,9 @@ type driver struct {
 
 	// featureGateAccessor is used to get a list of enabled and disabled featuregates
 	featureGateAccessor featuregates.FeatureGateAccess
+
+	// created is set by CreateStorage when it created the bucket.
+	created bool
 }
 
 // NewDriver creates a new s3 storage driver
@@ -197,9 +223,11 @@ func (d *driver) GetCredentialsFile() (string, error) {
 }
 
 func (d *driver) getCredentialsConfigData() ([]byte, error) {
-	// Look for a user defined secret to get the AWS credentials from first
+	// Look for a user defined secret to get the AWS credentials from first.
+	// A secret holding only settings, like the replication role, keeps
+	// the cluster minted credentials in use.
 	sec, err := d.Listers.Secrets.Get(defaults.ImageRegistryPrivateConfigurationUser)
-	if err != nil && errors.IsNotFound(err) {
+	if (err != nil && errors.IsNotFound(err)) || (err == nil && holdsOnlySettings(sec)) {
 		// Fall back to those provided by the credential minter if nothing is provided by the user
 		sec, err = d.Listers.Secrets.Get(defaults.CloudCredentialsName)
 		if err != nil {
@@ -230,6 +258,26 @@ func (d *driver) getCredentialsConfigData() ([]byte, error) {
 	}
 }
 
+// settingsKeys are the keys of the user secret that configure the driver
+// rather than provide credentials.
+var settingsKeys = sets.New[string](replicationRoleARNKey)
+
+// holdsOnlySettings tells whether the user secret holds settings and nothing
+// else. Such a secret doesn't replace the cluster minted credentials. Any
+// other key, including a misspelled credential, makes the secret a
+// credentials secret, so credentials can't be dropped by mistake.
+func holdsOnlySettings(sec *corev1.Secret) bool {
+	if len(sec.Data) == 0 {
+		return false
+	}
+	for key := range sec.Data {
+		if !settingsKeys.Has(key) {
+			return false
+		}
+	}
+	return true
+}
+
 // CABundle gets the custom CA bundle for trusting communication with the AWS
 // API.
 func (d *driver) CABundle() (string, bool, error) {
@@ -276,6 +324,16 @@ func (d *driver) useDualStack() (bool, error) {
 // getS3Service returns a client that allows us to interact
 // with the aws S3 service
 func (d *driver) getS3Service() (*s3.S3, error) {
+	sess, err := d.getSession()
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(sess), nil
+}
+
+// getSession returns an AWS session using the credentials, endpoints and CA
+// bundle of the driver configuration.
+func (d *driver) getSession() (*session.Session, error) {
 	credentialsFilename, err := d.GetCredentialsFile()
 	if err != nil {
 		return nil, err
@@ -370,7 +428,7 @@ func (d *driver) getS3Service() (*s3.S3, error) {
 		Fn:   request.MakeAddToUserAgentHandler("openshift.io cluster-image-registry-operator", version.Version),
 	})
 
-	return s3.New(sess), nil
+	return sess, nil
 }
 
 func isBucketNotFound(err interface{}) bool {
@@ -612,7 +670,67 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 		return true
 	}
 
-	return false
+	// CreateStorage applies the versioning, the replication, the access
+	// logging and the bucket policy set on the config
+	return versioningChanged(cr) || replicationChanged(cr) || d.accessLoggingChanged(cr) || policyChanged(cr)
+}
+
+// Validate checks we are allowed to access the configured bucket and to list
+// its content, and that the policies of the credentials allow the actions
+// CreateStorage and the registry perform on the bucket, its creation
+// included when it doesn't exist yet.
+func (d *driver) Validate(cr *imageregistryv1.Config) error {
+	sess, err := d.getSession()
+	if err != nil {
+		return err
+	}
+	svc := s3.New(sess)
+
+	bucket := d.Config.Bucket
+	create := len(bucket) == 0
+	if create {
+		// the name CreateStorage gives to the bucket
+		bucket, err = util.GenerateDeterministicStorageName(d.Listers, d.Config.Region)
+		if err != nil {
+			return err
+		}
+	} else {
+		create, err = d.validateBucketAccess(svc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.simulatePermissions(sess, cr, bucket, create)
+}
+
+// validateBucketAccess checks we are allowed to access the configured bucket
+// and to list its content. It tells whether the bucket doesn't exist, in
+// which case CreateStorage creates it.
+func (d *driver) validateBucketAccess(svc *s3.S3) (bool, error) {
+	_, err := svc.HeadBucketWithContext(d.Context, &s3.HeadBucketInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchBucket, "NotFound":
+			return true, nil
+		case "Forbidden", "AccessDenied":
+			return false, util.PermissionDenied("s3:ListBucket is not allowed on bucket %s: %s", d.Config.Bucket, aerr.Code())
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, err = svc.ListObjectsV2WithContext(d.Context, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(d.Config.Bucket),
+		MaxKeys: aws.Int64(1),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "AccessDenied" {
+		return false, util.PermissionDenied("unable to list objects in bucket %s: %s", d.Config.Bucket, aerr.Message())
+	}
+	return false, err
 }
 
 // CreateStorage attempts to create an s3 bucket
@@ -679,15 +797,10 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		}
 		klog.Infof("creating bucket %s", d.Config.Bucket)
 
-		_, err = svc.CreateBucketWithContext(d.Context, &s3.CreateBucketInput{
-			Bucket: aws.String(d.Config.Bucket),
-		})
+		err = d.createBucket(svc)
 		if err != nil {
 			if aerr, ok := err.(awserr.Error); ok {
 				switch aerr.Code() {
-				case s3.ErrCodeBucketAlreadyOwnedByYou:
-					// We own this bucket from a previous attempt — reuse it.
-					klog.Infof("bucket %s already owned by us, reusing", d.Config.Bucket)
 				case s3.ErrCodeBucketAlreadyExists:
 					util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Unable to Access Bucket", fmt.Sprintf("The bucket %s exists, but is owned by another account", d.Config.Bucket))
 					return fmt.Errorf("bucket %s exists but is owned by another account", d.Config.Bucket)
@@ -712,9 +825,7 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	}
 
 	// Wait until the bucket exists
-	if err := svc.WaitUntilBucketExistsWithContext(d.Context, &s3.HeadBucketInput{
-		Bucket: aws.String(d.Config.Bucket),
-	}); err != nil {
+	if err := d.waitForBucket(svc); err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
 		}
@@ -724,16 +835,7 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 
 	// Block public access to the s3 bucket and its objects by default
 	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
-		_, err := svc.PutPublicAccessBlockWithContext(d.Context, &s3.PutPublicAccessBlockInput{
-			Bucket: aws.String(d.Config.Bucket),
-			PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
-				BlockPublicAcls:       aws.Bool(true),
-				BlockPublicPolicy:     aws.Bool(true),
-				IgnorePublicAcls:      aws.Bool(true),
-				RestrictPublicBuckets: aws.Bool(true),
-			},
-		})
-
+		err := d.blockPublicAccess(svc)
 		if err != nil {
 			if aerr, ok := err.(awserr.Error); ok {
 				util.UpdateCondition(cr, defaults.StoragePublicAccessBlocked, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
@@ -754,37 +856,7 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
 		klog.Info("setting aws bucket tags")
 
-		tagset := []*s3.Tag{
-			{
-				Key:   aws.String("kubernetes.io/cluster/" + infra.Status.InfrastructureName),
-				Value: aws.String("owned"),
-			},
-			{
-				Key:   aws.String("Name"),
-				Value: aws.String(infra.Status.InfrastructureName + "-image-registry"),
-			},
-		}
-
-		// at this stage we are not keeping user tags in sync. as per enhancement proposal
-		// we only set user provided tags when we created the bucket.
-		if infra.Status.PlatformStatus.AWS != nil && len(infra.Status.PlatformStatus.AWS.ResourceTags) != 0 {
-			klog.V(5).Infof("infra.Status has %d user provided tags", len(infra.Status.PlatformStatus.AWS.ResourceTags))
-			for _, tag := range infra.Status.PlatformStatus.AWS.ResourceTags {
-				klog.Infof("user provided bucket tag in infra.Status: %s: %s", tag.Key, tag.Value)
-				tagset = append(tagset, &s3.Tag{
-					Key:   aws.String(tag.Key),
-					Value: aws.String(tag.Value),
-				})
-			}
-		}
-		klog.V(5).Infof("tagging bucket with tags: %+v", tagset)
-
-		_, err := svc.PutBucketTaggingWithContext(d.Context, &s3.PutBucketTaggingInput{
-			Bucket: aws.String(d.Config.Bucket),
-			Tagging: &s3.Tagging{
-				TagSet: tagset,
-			},
-		})
+		err := d.putBucketTags(svc, bucketTags(infra))
 		if err != nil {
 			if aerr, ok := err.(awserr.Error); ok {
 				util.UpdateCondition(cr, defaults.StorageTagged, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
@@ -800,34 +872,7 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 
 	// Enable default encryption on the bucket
 	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
-		var encryption *s3.ServerSideEncryptionByDefault
-		var encryptionType string
-
-		if len(d.Config.KeyID) != 0 {
-			encryption = &s3.ServerSideEncryptionByDefault{
-				SSEAlgorithm:   aws.String(s3.ServerSideEncryptionAwsKms),
-				KMSMasterKeyID: aws.String(d.Config.KeyID),
-			}
-			encryptionType = s3.ServerSideEncryptionAwsKms
-		} else {
-			encryption = &s3.ServerSideEncryptionByDefault{
-				SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256),
-			}
-			encryptionType = s3.ServerSideEncryptionAes256
-		}
-
-		enableBucketKey := true
-		_, err = svc.PutBucketEncryptionWithContext(d.Context, &s3.PutBucketEncryptionInput{
-			Bucket: aws.String(d.Config.Bucket),
-			ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
-				Rules: []*s3.ServerSideEncryptionRule{
-					{
-						ApplyServerSideEncryptionByDefault: encryption,
-						BucketKeyEnabled:                   &enableBucketKey,
-					},
-				},
-			},
-		})
+		encryptionType, err := d.putBucketEncryption(svc)
 		if err != nil {
 			if aerr, ok := err.(awserr.Error); ok {
 				util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
@@ -850,39 +895,423 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		}
 	}
 
-	// Enable default incomplete multipart upload cleanup after one (1) day
+	// Enable or suspend versioning when asked to on the image registry
+	// config, report whatever the bucket has otherwise
+	versioning, noncurrentDays := bucketVersioning(cr)
+	var versioningApplied bool
+	var versioningErr error
 	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
-		_, err = svc.PutBucketLifecycleConfigurationWithContext(d.Context, &s3.PutBucketLifecycleConfigurationInput{
-			Bucket: aws.String(d.Config.Bucket),
-			LifecycleConfiguration: &s3.BucketLifecycleConfiguration{
-				Rules: []*s3.LifecycleRule{
-					{
-						ID:     aws.String("cleanup-incomplete-multipart-registry-uploads"),
-						Status: aws.String("Enabled"),
-						Filter: &s3.LifecycleRuleFilter{
-							Prefix: aws.String(""),
-						},
-						AbortIncompleteMultipartUpload: &s3.AbortIncompleteMultipartUpload{
-							DaysAfterInitiation: aws.Int64(1),
-						},
-					},
-				},
-			},
-		})
+		if versioning != "" {
+			err = d.putBucketVersioning(svc, versioning)
+			if err != nil {
+				versioningErr = err
+				if aerr, ok := err.(awserr.Error); ok {
+					util.UpdateCondition(cr, defaults.StorageVersioningEnabled, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+				} else {
+					util.UpdateCondition(cr, defaults.StorageVersioningEnabled, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+				}
+			} else {
+				reportBucketVersioning(cr, versioning, noncurrentDays)
+				versioningApplied = true
+			}
+		} else {
+			out, err := svc.GetBucketVersioningWithContext(d.Context, &s3.GetBucketVersioningInput{
+				Bucket: aws.String(d.Config.Bucket),
+			})
+			if err != nil {
+				versioningErr = err
+				if aerr, ok := err.(awserr.Error); ok {
+					util.UpdateCondition(cr, defaults.StorageVersioningEnabled, operatorapi.ConditionUnknown, aerr.Code(), aerr.Error())
+				} else {
+					util.UpdateCondition(cr, defaults.StorageVersioningEnabled, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+				}
+			} else {
+				reportBucketVersioning(cr, aws.StringValue(out.Status), 0)
+			}
+		}
+	}
+
+	// Enable default incomplete multipart upload cleanup after one (1) day,
+	// and the expiration of noncurrent versions when the operator manages
+	// versioning, removing it once it doesn't anymore. The lifecycle rules
+	// set by others are kept.
+	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		var removedRuleIDs []string
+		if versioning == "" {
+			removedRuleIDs = append(removedRuleIDs, noncurrentVersionsRuleID)
+		}
+		err = d.putLifecycleRules(svc, registryLifecycleRules(versioning, noncurrentDays), removedRuleIDs...)
 		if err != nil {
 			if aerr, ok := err.(awserr.Error); ok {
 				util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
 			} else {
 				util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
 			}
+			if versioningApplied {
+				cond := util.FetchCondition(cr, defaults.StorageVersioningEnabled)
+				util.UpdateCondition(cr, defaults.StorageVersioningEnabled, cond.Status, "Noncurrent Version Expiration Failed", fmt.Sprintf("Noncurrent object versions could not be set to expire: %s", err))
+			}
+			if versioningErr == nil {
+				versioningErr = err
+			}
 		} else {
 			util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionTrue, "Enable Cleanup Successful", "Default cleanup of incomplete multipart uploads after one (1) day was successfully enabled")
 		}
+		util.RecordSetting(cr, defaults.StorageVersioningEnabled, versioningInputs(versioning, noncurrentDays), versioningErr)
 	}
 
+	// Replicate the bucket to another region when asked to on the image
+	// registry config
+	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		d.reconcileReplication(cr, svc, infra)
+	}
+
+	// Log the access to the bucket when asked to on the image registry
+	// config
+	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		d.reconcileAccessLogging(cr, svc, infra)
+	}
+
+	// Deny insecure transport, and restrict the access to the bucket when
+	// asked to on the image registry config. The statements are removed
+	// once the storage is not managed anymore.
+	d.reconcileBucketPolicy(cr, svc)
+
 	return nil
 }
 
+// createBucket creates the bucket of the driver configuration. A bucket
+// created by a previous attempt is reused.
+func (d *driver) createBucket(svc *s3.S3) error {
+	_, err := svc.CreateBucketWithContext(d.Context, &s3.CreateBucketInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou {
+		// We own this bucket from a previous attempt — reuse it.
+		klog.Infof("bucket %s already owned by us, reusing", d.Config.Bucket)
+		return nil
+	}
+	d.created = err == nil
+	return err
+}
+
+// StorageCreated tells whether CreateStorage created the bucket, rather than
+// reusing one it already owned.
+func (d *driver) StorageCreated() bool {
+	return d.created
+}
+
+func (d *driver) waitForBucket(svc *s3.S3) error {
+	return svc.WaitUntilBucketExistsWithContext(d.Context, &s3.HeadBucketInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+}
+
+// blockPublicAccess blocks public access to the bucket and its objects.
+func (d *driver) blockPublicAccess(svc *s3.S3) error {
+	_, err := svc.PutPublicAccessBlockWithContext(d.Context, &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(d.Config.Bucket),
+		PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	})
+	return err
+}
+
+// bucketTags returns the tags of the buckets created for the cluster: the
+// openshiftClusterID along with any user defined tags from the cluster
+// configuration.
+func bucketTags(infra *configv1.Infrastructure) []*s3.Tag {
+	tagset := []*s3.Tag{
+		{
+			Key:   aws.String("kubernetes.io/cluster/" + infra.Status.InfrastructureName),
+			Value: aws.String("owned"),
+		},
+		{
+			Key:   aws.String("Name"),
+			Value: aws.String(infra.Status.InfrastructureName + "-image-registry"),
+		},
+	}
+
+	// user provided tags are kept in sync afterwards by the AWSTagController.
+	if infra.Status.PlatformStatus.AWS != nil && len(infra.Status.PlatformStatus.AWS.ResourceTags) != 0 {
+		klog.V(5).Infof("infra.Status has %d user provided tags", len(infra.Status.PlatformStatus.AWS.ResourceTags))
+		for _, tag := range infra.Status.PlatformStatus.AWS.ResourceTags {
+			klog.Infof("user provided bucket tag in infra.Status: %s: %s", tag.Key, tag.Value)
+			tagset = append(tagset, &s3.Tag{
+				Key:   aws.String(tag.Key),
+				Value: aws.String(tag.Value),
+			})
+		}
+	}
+	klog.V(5).Infof("tagging bucket with tags: %+v", tagset)
+	return tagset
+}
+
+// putBucketEncryption enables default encryption on the bucket, with the
+// KMS key of the driver configuration if any. It returns the encryption
+// type.
+func (d *driver) putBucketEncryption(svc *s3.S3) (string, error) {
+	var encryption *s3.ServerSideEncryptionByDefault
+	var encryptionType string
+
+	if len(d.Config.KeyID) != 0 {
+		encryption = &s3.ServerSideEncryptionByDefault{
+			SSEAlgorithm:   aws.String(s3.ServerSideEncryptionAwsKms),
+			KMSMasterKeyID: aws.String(d.Config.KeyID),
+		}
+		encryptionType = s3.ServerSideEncryptionAwsKms
+	} else {
+		encryption = &s3.ServerSideEncryptionByDefault{
+			SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256),
+		}
+		encryptionType = s3.ServerSideEncryptionAes256
+	}
+
+	enableBucketKey := true
+	_, err := svc.PutBucketEncryptionWithContext(d.Context, &s3.PutBucketEncryptionInput{
+		Bucket: aws.String(d.Config.Bucket),
+		ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+			Rules: []*s3.ServerSideEncryptionRule{
+				{
+					ApplyServerSideEncryptionByDefault: encryption,
+					BucketKeyEnabled:                   &enableBucketKey,
+				},
+			},
+		},
+	})
+	return encryptionType, err
+}
+
+// bucketVersioning returns the versioning status the bucket should have,
+// as set on the image registry config, and the number of days noncurrent
+// versions are kept for. An empty status means versioning is left untouched.
+func bucketVersioning(cr *imageregistryv1.Config) (string, int64) {
+	var status string
+	switch raw, ok := cr.Annotations[defaults.S3BucketVersioningAnnotation]; {
+	case !ok:
+	case raw == "true":
+		status = s3.BucketVersioningStatusEnabled
+	case raw == "false":
+		status = s3.BucketVersioningStatusSuspended
+	default:
+		klog.Warningf("ignoring invalid %s annotation %q: \"true\" or \"false\" is expected", defaults.S3BucketVersioningAnnotation, raw)
+	}
+	// replication requires versioning
+	if status == "" && replicationRegion(cr) != "" {
+		status = s3.BucketVersioningStatusEnabled
+	}
+
+	days := int64(defaultNoncurrentVersionExpirationDays)
+	if raw, ok := cr.Annotations[defaults.S3NoncurrentVersionExpirationDaysAnnotation]; ok {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n <= 0 {
+			klog.Warningf("ignoring invalid %s annotation %q: a positive number of days is expected", defaults.S3NoncurrentVersionExpirationDaysAnnotation, raw)
+		} else {
+			days = n
+		}
+	}
+	return status, days
+}
+
+// bucketVersioningMessage describes the versioning status of the bucket.
+// The expiration of noncurrent versions is only mentioned when days is set,
+// that is when the operator manages versioning.
+func bucketVersioningMessage(status string, days int64) string {
+	var message string
+	switch status {
+	case s3.BucketVersioningStatusEnabled:
+		message = "Versioning is enabled on the S3 bucket"
+	case s3.BucketVersioningStatusSuspended:
+		message = "Versioning is suspended on the S3 bucket"
+	default:
+		return "Versioning is not enabled on the S3 bucket"
+	}
+	if days > 0 {
+		message += fmt.Sprintf(", noncurrent object versions expire after %d days", days)
+	}
+	return message
+}
+
+func reportBucketVersioning(cr *imageregistryv1.Config, status string, days int64) {
+	message := bucketVersioningMessage(status, days)
+	switch status {
+	case s3.BucketVersioningStatusEnabled:
+		util.UpdateCondition(cr, defaults.StorageVersioningEnabled, operatorapi.ConditionTrue, "Versioning Enabled", message)
+	case s3.BucketVersioningStatusSuspended:
+		util.UpdateCondition(cr, defaults.StorageVersioningEnabled, operatorapi.ConditionFalse, "Versioning Suspended", message)
+	default:
+		util.UpdateCondition(cr, defaults.StorageVersioningEnabled, operatorapi.ConditionFalse, "Versioning Disabled", message)
+	}
+}
+
+// versioningInputs returns the fingerprint of the versioning set on the
+// image registry config. The expiration of noncurrent versions only counts
+// when the operator manages versioning.
+func versioningInputs(status string, days int64) string {
+	if status == "" {
+		return util.SettingInputs(status)
+	}
+	return util.SettingInputs(status, days)
+}
+
+// versioningChanged tells whether the versioning set on the image registry
+// config is not the one last applied to the bucket, or whether applying it
+// failed and is due for a retry.
+func versioningChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false
+	}
+	return util.SettingChanged(cr, defaults.StorageVersioningEnabled, versioningInputs(bucketVersioning(cr)), versioningInputs("", 0))
+}
+
+func (d *driver) putBucketVersioning(svc *s3.S3, status string) error {
+	_, err := svc.PutBucketVersioningWithContext(d.Context, &s3.PutBucketVersioningInput{
+		Bucket: aws.String(d.Config.Bucket),
+		VersioningConfiguration: &s3.VersioningConfiguration{
+			Status: aws.String(status),
+		},
+	})
+	return err
+}
+
+// registryLifecycleRules returns the lifecycle rules managed by the operator:
+// the cleanup of incomplete multipart uploads after one (1) day, and the
+// expiration of noncurrent versions when the operator manages versioning.
+func registryLifecycleRules(versioning string, noncurrentDays int64) []*s3.LifecycleRule {
+	rules := []*s3.LifecycleRule{
+		{
+			ID:     aws.String(incompleteUploadsRuleID),
+			Status: aws.String("Enabled"),
+			Filter: &s3.LifecycleRuleFilter{
+				Prefix: aws.String(""),
+			},
+			AbortIncompleteMultipartUpload: &s3.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: aws.Int64(1),
+			},
+		},
+	}
+	if versioning != "" {
+		rules = append(rules, &s3.LifecycleRule{
+			ID:     aws.String(noncurrentVersionsRuleID),
+			Status: aws.String("Enabled"),
+			Filter: &s3.LifecycleRuleFilter{
+				Prefix: aws.String(""),
+			},
+			NoncurrentVersionExpiration: &s3.NoncurrentVersionExpiration{
+				NoncurrentDays: aws.Int64(noncurrentDays),
+			},
+			// delete markers left without any version are useless
+			Expiration: &s3.LifecycleExpiration{
+				ExpiredObjectDeleteMarker: aws.Bool(true),
+			},
+		})
+	}
+	return rules
+}
+
+// putLifecycleRules adds rules to the lifecycle configuration of the bucket,
+// replacing the rules with the same IDs, and removes the rules with the
+// removed IDs. Other rules are kept.
+func (d *driver) putLifecycleRules(svc *s3.S3, rules []*s3.LifecycleRule, removed ...string) error {
+	var existing []*s3.LifecycleRule
+	out, err := svc.GetBucketLifecycleConfigurationWithContext(d.Context, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if !ok || aerr.Code() != errCodeNoSuchLifecycleConfiguration {
+			return err
+		}
+	} else {
+		for _, rule := range out.Rules {
+			if !slices.Contains(removed, aws.StringValue(rule.ID)) {
+				existing = append(existing, rule)
+			}
+		}
+	}
+
+	_, err = svc.PutBucketLifecycleConfigurationWithContext(d.Context, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket: aws.String(d.Config.Bucket),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{
+			Rules: mergeLifecycleRules(existing, rules),
+		},
+	})
+	return err
+}
+
+// putBucketTags adds tags to the bucket, replacing the values of the tags
+// with the same keys. Other tags are kept.
+func (d *driver) putBucketTags(svc *s3.S3, tags []*s3.Tag) error {
+	var existing []*s3.Tag
+	out, err := svc.GetBucketTaggingWithContext(d.Context, &s3.GetBucketTaggingInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if !ok || aerr.Code() != errCodeNoSuchTagSet {
+			return err
+		}
+	} else {
+		existing = out.TagSet
+	}
+
+	_, err = svc.PutBucketTaggingWithContext(d.Context, &s3.PutBucketTaggingInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Tagging: &s3.Tagging{
+			TagSet: mergeBucketTags(existing, tags),
+		},
+	})
+	return err
+}
+
+// mergeBucketTags returns the existing tags with the values of the ones
+// sharing a key with tags replaced, followed by the tags not existing yet.
+func mergeBucketTags(existing, tags []*s3.Tag) []*s3.Tag {
+	return mergeByKey(existing, tags, func(tag *s3.Tag) string {
+		return aws.StringValue(tag.Key)
+	})
+}
+
+// mergeLifecycleRules returns the existing rules with the ones sharing an ID
+// with rules replaced, followed by the rules not existing yet.
+func mergeLifecycleRules(existing, rules []*s3.LifecycleRule) []*s3.LifecycleRule {
+	return mergeByKey(existing, rules, func(rule *s3.LifecycleRule) string {
+		return aws.StringValue(rule.ID)
+	})
+}
+
+// mergeByKey returns the existing items with the ones sharing a key with
+// items replaced, followed by the items not existing yet. It is used to
+// manage part of the bucket settings that are set as a whole, without
+// dropping the parts set by others.
+func mergeByKey[T any](existing, items []T, key func(T) string) []T {
+	byKey := make(map[string]T, len(items))
+	for _, item := range items {
+		byKey[key(item)] = item
+	}
+
+	merged := make([]T, 0, len(existing)+len(items))
+	for _, item := range existing {
+		k := key(item)
+		if i, ok := byKey[k]; ok {
+			merged = append(merged, i)
+			delete(byKey, k)
+			continue
+		}
+		merged = append(merged, item)
+	}
+	for _, item := range items {
+		if _, ok := byKey[key(item)]; ok {
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
 // RemoveStorage deletes the storage medium that we created
 // The s3 bucket must be empty before it can be removed
 func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
@@ -896,12 +1325,12 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 		return false, err
 	}
 
-	iter := s3manager.NewDeleteListIterator(svc, &s3.ListObjectsInput{
-		Bucket: aws.String(d.Config.Bucket),
-	})
+	if err := d.emptyBucket(svc); err != nil {
+		return false, err
+	}
 
-	err = s3manager.NewBatchDeleteWithClient(svc).Delete(d.Context, iter)
-	if err != nil && !isBucketNotFound(err) {
+	// the access logs bucket created by the operator goes with the bucket.
+	if err := d.removeAccessLogBucket(svc); err != nil {
 		return false, err
 	}
 
@@ -948,6 +1377,269 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 	return false, nil
 }
 
+// emptyBucket deletes every object of the bucket, along with their
+// versions. A bucket that doesn't exist is empty.
+func (d *driver) emptyBucket(svc *s3.S3) error {
+	iter := s3manager.NewDeleteListIterator(svc, &s3.ListObjectsInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+
+	err := s3manager.NewBatchDeleteWithClient(svc).Delete(d.Context, iter)
+	if err != nil && !isBucketNotFound(err) {
+		return err
+	}
+
+	err = d.deleteObjectVersions(svc)
+	if err != nil && !isBucketNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// deleteObjectVersions deletes the noncurrent versions and the delete
+// markers left in a bucket that has, or had, versioning enabled. A versioned
+// bucket can't be removed until they are gone.
+func (d *driver) deleteObjectVersions(svc *s3.S3) error {
+	out, err := svc.GetBucketVersioningWithContext(d.Context, &s3.GetBucketVersioningInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if err != nil {
+		return err
+	}
+	if aws.StringValue(out.Status) == "" {
+		return nil
+	}
+
+	batcher := s3manager.NewBatchDeleteWithClient(svc)
+	var deleteErr error
+	err = svc.ListObjectVersionsPagesWithContext(d.Context, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(d.Config.Bucket),
+	}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		var objects []s3manager.BatchDeleteObject
+		for _, v := range page.Versions {
+			objects = append(objects, s3manager.BatchDeleteObject{
+				Object: &s3.DeleteObjectInput{
+					Bucket:    aws.String(d.Config.Bucket),
+					Key:       v.Key,
+					VersionId: v.VersionId,
+				},
+			})
+		}
+		for _, m := range page.DeleteMarkers {
+			objects = append(objects, s3manager.BatchDeleteObject{
+				Object: &s3.DeleteObjectInput{
+					Bucket:    aws.String(d.Config.Bucket),
+					Key:       m.Key,
+					VersionId: m.VersionId,
+				},
+			})
+		}
+		deleteErr = batcher.Delete(d.Context, &s3manager.DeleteObjectsIterator{Objects: objects})
+		return deleteErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return deleteErr
+}
+
+// StorageUsage returns the number of bytes and objects stored by the registry
+// in the bucket. The limiter is waited on before every listing request.
+func (d *driver) StorageUsage(ctx context.Context, limiter *rate.Limiter) (int64, int64, error) {
+	svc, err := d.getS3Service()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var size, objects int64
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(d.Config.Bucket),
+		Prefix: aws.String(registryRootPrefix),
+	}
+	for {
+		if err := limiter.Wait(ctx); err != nil {
+			return 0, 0, err
+		}
+		output, err := svc.ListObjectsV2WithContext(ctx, input)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, obj := range output.Contents {
+			size += aws.Int64Value(obj.Size)
+			objects++
+		}
+		if !aws.BoolValue(output.IsTruncated) {
+			return size, objects, nil
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+}
+
+// PutObject writes data into key. It is used to probe the bucket.
+func (d *driver) PutObject(ctx context.Context, key string, data []byte) error {
+	svc, err := d.getS3Service()
+	if err != nil {
+		return err
+	}
+	_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+// GetObject reads the content of key. It is used to probe the bucket.
+func (d *driver) GetObject(ctx context.Context, key string) ([]byte, error) {
+	svc, err := d.getS3Service()
+	if err != nil {
+		return nil, err
+	}
+	output, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(key),
+	})
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == s3.ErrCodeNoSuchBucket) {
+		return nil, util.ObjectNotFound(key, err)
+	} else if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+	return io.ReadAll(output.Body)
+}
+
+// DeleteObject removes key. It is used to probe the bucket.
+func (d *driver) DeleteObject(ctx context.Context, key string) error {
+	svc, err := d.getS3Service()
+	if err != nil {
+		return err
+	}
+	_, err = svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(d.Config.Bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// ListOwnedStorage returns the buckets named after the cluster and tagged as
+// owned by it. Buckets living in other regions can't be inspected with our
+// regional client and are left out.
+func (d *driver) ListOwnedStorage(ctx context.Context) ([]util.OwnedStorage, error) {
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := util.OwnedStorageNamePrefix(d.Listers)
+	if err != nil {
+		return nil, err
+	}
+
+	svc, err := d.getS3Service()
+	if err != nil {
+		return nil, err
+	}
+	output, err := svc.ListBucketsWithContext(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	ownerTag := "kubernetes.io/cluster/" + infra.Status.InfrastructureName
+	var owned []util.OwnedStorage
+	for _, bucket := range output.Buckets {
+		name := aws.StringValue(bucket.Name)
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		tagging, err := svc.GetBucketTaggingWithContext(ctx, &s3.GetBucketTaggingInput{
+			Bucket: bucket.Name,
+		})
+		if err != nil {
+			klog.V(4).Infof("unable to get tags of bucket %s: %s", name, err)
+			continue
+		}
+		var isOwned, isReplica, isAccessLogs bool
+		for _, tag := range tagging.TagSet {
+			switch aws.StringValue(tag.Key) {
+			case ownerTag:
+				isOwned = aws.StringValue(tag.Value) == "owned"
+			case replicaOfTagKey:
+				isReplica = aws.StringValue(tag.Value) == d.Config.Bucket
+			case accessLogsOfTagKey:
+				isAccessLogs = aws.StringValue(tag.Value) == d.Config.Bucket
+			}
+		}
+		// the replica and the access logs of the bucket in use are in
+		// use too.
+		if isOwned && !isReplica && !isAccessLogs {
+			owned = append(owned, util.OwnedStorage{
+				Name:    name,
+				Created: aws.TimeValue(bucket.CreationDate),
+			})
+		}
+	}
+	return owned, nil
+}
+
+// RemoveOwnedStorage deletes the bucket name when it holds nothing but the
+// ownership marker and the canary objects. Buckets holding anything else,
+// like registry content under a custom root directory or access logs, are
+// left untouched. Every version of the objects is looked at so the deleted,
+// but still recoverable, content of versioned buckets keeps them too.
+func (d *driver) RemoveOwnedStorage(ctx context.Context, name string) (bool, error) {
+	svc, err := d.getS3Service()
+	if err != nil {
+		return false, err
+	}
+
+	var objects []s3manager.BatchDeleteObject
+	empty := true
+	collect := func(key, version *string) bool {
+		if !util.IsOperatorObject(aws.StringValue(key)) {
+			empty = false
+			return false
+		}
+		objects = append(objects, s3manager.BatchDeleteObject{
+			Object: &s3.DeleteObjectInput{
+				Bucket:    aws.String(name),
+				Key:       key,
+				VersionId: version,
+			},
+		})
+		return true
+	}
+	err = svc.ListObjectVersionsPagesWithContext(ctx, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(name),
+	}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		for _, v := range page.Versions {
+			if !collect(v.Key, v.VersionId) {
+				return false
+			}
+		}
+		for _, m := range page.DeleteMarkers {
+			if !collect(m.Key, m.VersionId) {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return false, err
+	}
+	if !empty {
+		return false, nil
+	}
+
+	if err := s3manager.NewBatchDeleteWithClient(svc).Delete(ctx, &s3manager.DeleteObjectsIterator{Objects: objects}); err != nil {
+		return false, err
+	}
+	if _, err := svc.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{
+		Bucket: aws.String(name),
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // ID return the underlying storage identificator, on this case the bucket name.
 func (d *driver) ID() string {
 	return d.Config.Bucket
@@ -992,19 +1684,26 @@ func sharedCredentialsDataFromStaticCreds(accessKey, accessSecret string) []byte
 	return buf.Bytes()
 }
 
-// PutStorageTags is for adding/overwriting tags of the S3 bucket
+// PutStorageTags is for replacing the tags of the S3 bucket
 // which name is obtained using this driver's ID() method.
+// An empty tagMap deletes every tag of the bucket.
 func (d *driver) PutStorageTags(tagMap map[string]string) error {
-	if len(tagMap) == 0 {
-		klog.Info("Tags is empty, no action taken")
-		return nil
-	}
-
 	svc, err := d.getS3Service()
 	if err != nil {
 		return err
 	}
 
+	if len(tagMap) == 0 {
+		klog.Infof("no tags left, deleting the tagset of s3 bucket %s", d.ID())
+		_, err = svc.DeleteBucketTaggingWithContext(d.Context, &s3.DeleteBucketTaggingInput{
+			Bucket: aws.String(d.ID()),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete s3 bucket tags: %s", err)
+		}
+		return nil
+	}
+
 	tags := make([]*s3.Tag, 0, len(tagMap))
 	for key, value := range tagMap {
 		tags = append(tags, &s3.Tag{
@@ -1048,9 +1747,10 @@ func (d *driver) GetStorageTags() (map[string]string, error) {
 	if err != nil {
 		errMsg := ""
 		if aerr, ok := err.(awserr.Error); ok {
-			if aerr.Code() != "NoSuchTagSet" {
-				errMsg = fmt.Sprintf("%s: %s", aerr.Code(), aerr.Error())
+			if aerr.Code() == errCodeNoSuchTagSet {
+				return map[string]string{}, nil
 			}
+			errMsg = fmt.Sprintf("%s: %s", aerr.Code(), aerr.Error())
 		} else {
 			errMsg = fmt.Sprintf("Unknown Error Occurred: %s", err.Error())
 		}
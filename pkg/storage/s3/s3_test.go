@@ -3,10 +3,13 @@ package s3
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"reflect"
 	"strings"
@@ -23,6 +26,7 @@ import (
 
 	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
 	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
 
 	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
@@ -289,6 +293,114 @@ func TestConfigEnv(t *testing.T) {
 	}
 }
 
+func TestGetCredentialsConfigData(t *testing.T) {
+	const roleARN = "arn:aws:iam::123456789012:role/replication"
+	minted := string(sharedCredentialsDataFromStaticCreds("minted-access", "minted-secret"))
+	user := string(sharedCredentialsDataFromStaticCreds("user-access", "user-secret"))
+
+	for _, tt := range []struct {
+		name       string
+		userSecret map[string][]byte
+		expected   string
+		err        string
+	}{
+		{
+			name:     "no user secret",
+			expected: minted,
+		},
+		{
+			name: "user credentials",
+			userSecret: map[string][]byte{
+				"REGISTRY_STORAGE_S3_ACCESSKEY": []byte("user-access"),
+				"REGISTRY_STORAGE_S3_SECRETKEY": []byte("user-secret"),
+			},
+			expected: user,
+		},
+		{
+			name: "replication role only",
+			userSecret: map[string][]byte{
+				replicationRoleARNKey: []byte(roleARN),
+			},
+			expected: minted,
+		},
+		{
+			name: "replication role and user credentials",
+			userSecret: map[string][]byte{
+				replicationRoleARNKey:           []byte(roleARN),
+				"REGISTRY_STORAGE_S3_ACCESSKEY": []byte("user-access"),
+				"REGISTRY_STORAGE_S3_SECRETKEY": []byte("user-secret"),
+			},
+			expected: user,
+		},
+		{
+			name: "replication role and an access key only",
+			userSecret: map[string][]byte{
+				replicationRoleARNKey:           []byte(roleARN),
+				"REGISTRY_STORAGE_S3_ACCESSKEY": []byte("user-access"),
+			},
+			err: `does not contain required key "REGISTRY_STORAGE_S3_SECRETKEY"`,
+		},
+		{
+			name: "replication role and misspelled user credentials",
+			userSecret: map[string][]byte{
+				replicationRoleARNKey:            []byte(roleARN),
+				"REGISTRY_STORAGE_S3_ACCESS_KEY": []byte("user-access"),
+				"REGISTRY_STORAGE_S3_SECRET_KEY": []byte("user-secret"),
+			},
+			err: `does not contain required key "REGISTRY_STORAGE_S3_ACCESSKEY"`,
+		},
+		{
+			name:       "empty user secret",
+			userSecret: map[string][]byte{},
+			err:        `does not contain required key "REGISTRY_STORAGE_S3_ACCESSKEY"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := cirofake.NewFixturesBuilder()
+			builder.AddSecrets(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.CloudCredentialsName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string][]byte{
+					"aws_access_key_id":     []byte("minted-access"),
+					"aws_secret_access_key": []byte("minted-secret"),
+				},
+			})
+			if tt.userSecret != nil {
+				builder.AddSecrets(&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      defaults.ImageRegistryPrivateConfigurationUser,
+						Namespace: defaults.ImageRegistryOperatorNamespace,
+					},
+					Data: tt.userSecret,
+				})
+			}
+			listers := builder.BuildListers()
+
+			fg := featuregates.NewHardcodedFeatureGateAccess(
+				[]configv1.FeatureGateName{util.TestFeatureGateName},
+				[]configv1.FeatureGateName{},
+			)
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageS3{}, &listers.StorageListers, fg)
+
+			data, err := drv.getCredentialsConfigData()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("expected credentials %q, got %q", tt.expected, data)
+			}
+		})
+	}
+}
+
 func TestServiceEndpointCanBeOverwritten(t *testing.T) {
 	ctx := context.Background()
 
@@ -903,18 +1015,20 @@ func TestCreateStorageDeterministicNaming(t *testing.T) {
 	}
 
 	for _, tt := range []struct {
-		name       string
-		bucket     string
-		responses  []s3ErrorResponse
-		wantErr    bool
-		wantErrMsg string
-		wantBucket string
+		name        string
+		bucket      string
+		responses   []s3ErrorResponse
+		wantErr     bool
+		wantErrMsg  string
+		wantBucket  string
+		wantCreated bool
 	}{
 		{
-			name:       "When bucket name is empty, it should generate a deterministic name and create the bucket",
-			bucket:     "",
-			responses:  nil, // all 200 OK
-			wantBucket: expectedBucket,
+			name:        "When bucket name is empty, it should generate a deterministic name and create the bucket",
+			bucket:      "",
+			responses:   nil, // all 200 OK
+			wantBucket:  expectedBucket,
+			wantCreated: true,
 		},
 		{
 			name:   "When bucket already owned by us, it should reuse it without error",
@@ -983,6 +1097,1513 @@ func TestCreateStorageDeterministicNaming(t *testing.T) {
 			if config.Spec.Storage.ManagementState == "" {
 				t.Error("expected ManagementState to be set, got empty")
 			}
+
+			if drv.StorageCreated() != tt.wantCreated {
+				t.Errorf("expected the bucket to be reported as created: %t, got %t", tt.wantCreated, drv.StorageCreated())
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-east-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access"),
+			"aws_secret_access_key": []byte("secret"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	for _, tt := range []struct {
+		name             string
+		bucket           string
+		responses        []s3ErrorResponse
+		permissionDenied bool
+	}{
+		{
+			name: "bucket not configured",
+		},
+		{
+			name:   "bucket accessible",
+			bucket: "abucket",
+		},
+		{
+			name:   "bucket does not exist",
+			bucket: "abucket",
+			responses: []s3ErrorResponse{
+				{code: http.StatusNotFound, errCode: "NotFound"},
+			},
+		},
+		{
+			name:   "bucket not accessible",
+			bucket: "abucket",
+			responses: []s3ErrorResponse{
+				{code: http.StatusForbidden},
+			},
+			permissionDenied: true,
+		},
+		{
+			name:   "objects can't be listed",
+			bucket: "abucket",
+			responses: []s3ErrorResponse{
+				{code: http.StatusOK},
+				{code: http.StatusForbidden, errCode: "AccessDenied"},
+			},
+			permissionDenied: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fg := featuregates.NewHardcodedFeatureGateAccess(
+				[]configv1.FeatureGateName{util.TestFeatureGateName},
+				[]configv1.FeatureGateName{},
+			)
+			drv := NewDriver(
+				context.Background(),
+				&imageregistryv1.ImageRegistryConfigStorageS3{
+					Bucket: tt.bucket,
+					Region: "us-east-1",
+				},
+				&listers.StorageListers,
+				fg,
+			)
+			drv.roundTripper = &s3ErrorTripper{responses: tt.responses}
+
+			err := drv.Validate(&imageregistryv1.Config{})
+			if tt.permissionDenied {
+				if !errors.Is(err, util.ErrPermissionDenied) {
+					t.Errorf("expected a permission denied error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// iamSimulationTripper is an http.RoundTripper answering the identity of the
+// caller, the IAM policy simulation, denying the actions in denied, and S3
+// requests with headStatus for HEAD requests.
+type iamSimulationTripper struct {
+	callerARN  string
+	denied     map[string]bool
+	headStatus int
+	simulated  []string
+}
+
+func (r *iamSimulationTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	respond := func(code int, body string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: code,
+			Body:       io.NopCloser(bytes.NewBufferString(body)),
+			Header:     http.Header{"Content-Type": []string{"text/xml"}},
+		}, nil
+	}
+
+	switch {
+	case strings.HasPrefix(req.URL.Host, "sts."):
+		return respond(http.StatusOK, fmt.Sprintf(`<GetCallerIdentityResponse><GetCallerIdentityResult><UserId>AROAEXAMPLEID:registry-session</UserId><Account>123456789012</Account><Arn>%s</Arn></GetCallerIdentityResult></GetCallerIdentityResponse>`, r.callerARN))
+	case strings.HasPrefix(req.URL.Host, "iam."):
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		var results strings.Builder
+		for i := 1; form.Has(fmt.Sprintf("ActionNames.member.%d", i)); i++ {
+			action := form.Get(fmt.Sprintf("ActionNames.member.%d", i))
+			r.simulated = append(r.simulated, action)
+			decision := "allowed"
+			if r.denied[action] {
+				decision = "implicitDeny"
+			}
+			fmt.Fprintf(&results, "<member><EvalActionName>%s</EvalActionName><EvalDecision>%s</EvalDecision></member>", action, decision)
+		}
+		return respond(http.StatusOK, fmt.Sprintf(`<SimulatePrincipalPolicyResponse><SimulatePrincipalPolicyResult><IsTruncated>false</IsTruncated><EvaluationResults>%s</EvaluationResults></SimulatePrincipalPolicyResult></SimulatePrincipalPolicyResponse>`, results.String()))
+	case req.Method == http.MethodHead && r.headStatus != 0:
+		return respond(r.headStatus, "")
+	}
+	return respond(http.StatusOK, "")
+}
+
+func TestValidateSimulatesPermissions(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-infra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-east-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access"),
+			"aws_secret_access_key": []byte("secret"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	for _, tt := range []struct {
+		name             string
+		bucket           string
+		state            string
+		annotations      map[string]string
+		callerARN        string
+		headStatus       int
+		denied           []string
+		regionEndpoint   string
+		permissionDenied bool
+		simulated        []string
+		notSimulated     []string
+	}{
+		{
+			name:         "bucket to be created",
+			callerARN:    "arn:aws:sts::123456789012:assumed-role/registry/registry-session",
+			simulated:    []string{"s3:CreateBucket", "s3:PutBucketTagging", "s3:PutLifecycleConfiguration", "s3:PutObject"},
+			notSimulated: []string{"s3:PutBucketVersioning", "s3:PutReplicationConfiguration", "s3:PutBucketLogging"},
+		},
+		{
+			name:             "bucket to be created without tagging",
+			callerARN:        "arn:aws:sts::123456789012:assumed-role/registry/registry-session",
+			denied:           []string{"s3:PutBucketTagging"},
+			permissionDenied: true,
+		},
+		{
+			name:             "configured bucket to be created",
+			bucket:           "abucket",
+			callerARN:        "arn:aws:iam::123456789012:user/registry",
+			headStatus:       http.StatusNotFound,
+			denied:           []string{"s3:CreateBucket"},
+			permissionDenied: true,
+		},
+		{
+			name:         "unmanaged bucket",
+			bucket:       "abucket",
+			state:        imageregistryv1.StorageManagementStateUnmanaged,
+			callerARN:    "arn:aws:iam::123456789012:user/registry",
+			denied:       []string{"s3:PutBucketTagging", "s3:CreateBucket"},
+			simulated:    []string{"s3:ListBucket", "s3:GetObject"},
+			notSimulated: []string{"s3:CreateBucket", "s3:PutBucketTagging"},
+		},
+		{
+			name:   "managed bucket with versioning and replication",
+			bucket: "abucket",
+			state:  imageregistryv1.StorageManagementStateManaged,
+			annotations: map[string]string{
+				defaults.S3BucketVersioningAnnotation:  "Enabled",
+				defaults.S3ReplicationRegionAnnotation: "us-west-2",
+			},
+			callerARN:        "arn:aws:iam::123456789012:user/registry",
+			denied:           []string{"s3:PutReplicationConfiguration"},
+			permissionDenied: true,
+			simulated:        []string{"s3:PutBucketVersioning", "s3:PutReplicationConfiguration"},
+		},
+		{
+			name:         "principal that can't be simulated",
+			bucket:       "abucket",
+			callerARN:    "arn:aws:sts::123456789012:federated-user/registry",
+			denied:       []string{"s3:ListBucket"},
+			notSimulated: []string{"s3:ListBucket"},
+		},
+		{
+			name:           "S3 compatible storage",
+			bucket:         "abucket",
+			regionEndpoint: "https://s3.example.com",
+			callerARN:      "arn:aws:iam::123456789012:user/registry",
+			denied:         []string{"s3:ListBucket"},
+			notSimulated:   []string{"s3:ListBucket"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fg := featuregates.NewHardcodedFeatureGateAccess(
+				[]configv1.FeatureGateName{util.TestFeatureGateName},
+				[]configv1.FeatureGateName{},
+			)
+			drv := NewDriver(
+				context.Background(),
+				&imageregistryv1.ImageRegistryConfigStorageS3{
+					Bucket:         tt.bucket,
+					Region:         "us-east-1",
+					RegionEndpoint: tt.regionEndpoint,
+				},
+				&listers.StorageListers,
+				fg,
+			)
+			denied := map[string]bool{}
+			for _, action := range tt.denied {
+				denied[action] = true
+			}
+			rt := &iamSimulationTripper{
+				callerARN:  tt.callerARN,
+				denied:     denied,
+				headStatus: tt.headStatus,
+			}
+			drv.roundTripper = rt
+
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: tt.annotations,
+				},
+			}
+			cr.Spec.Storage.ManagementState = tt.state
+
+			err := drv.Validate(cr)
+			if tt.permissionDenied {
+				if !errors.Is(err, util.ErrPermissionDenied) {
+					t.Errorf("expected a permission denied error, got %v", err)
+				}
+				for _, action := range tt.denied {
+					if !strings.Contains(err.Error(), action) {
+						t.Errorf("expected %s to be reported as denied, got %v", action, err)
+					}
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			simulated := map[string]bool{}
+			for _, action := range rt.simulated {
+				simulated[action] = true
+			}
+			for _, action := range tt.simulated {
+				if !simulated[action] {
+					t.Errorf("expected %s to be simulated, got %v", action, rt.simulated)
+				}
+			}
+			for _, action := range tt.notSimulated {
+				if simulated[action] {
+					t.Errorf("unexpected simulation of %s", action)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeLifecycleRules(t *testing.T) {
+	rule := func(id string, days int64) *s3.LifecycleRule {
+		return &s3.LifecycleRule{
+			ID:     aws.String(id),
+			Status: aws.String("Enabled"),
+			Expiration: &s3.LifecycleExpiration{
+				Days: aws.Int64(days),
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		existing []*s3.LifecycleRule
+		rules    []*s3.LifecycleRule
+		expected []*s3.LifecycleRule
+	}{
+		{
+			name:     "no existing rules",
+			rules:    []*s3.LifecycleRule{rule("ours", 1)},
+			expected: []*s3.LifecycleRule{rule("ours", 1)},
+		},
+		{
+			name:     "foreign rules are kept",
+			existing: []*s3.LifecycleRule{rule("theirs", 7)},
+			rules:    []*s3.LifecycleRule{rule("ours", 1)},
+			expected: []*s3.LifecycleRule{rule("theirs", 7), rule("ours", 1)},
+		},
+		{
+			name:     "rules with the same id are replaced in place",
+			existing: []*s3.LifecycleRule{rule("ours", 3), rule("theirs", 7)},
+			rules:    []*s3.LifecycleRule{rule("ours", 1), rule("new", 30)},
+			expected: []*s3.LifecycleRule{rule("ours", 1), rule("theirs", 7), rule("new", 30)},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := mergeLifecycleRules(tt.existing, tt.rules)
+			if !reflect.DeepEqual(merged, tt.expected) {
+				t.Errorf("unexpected rules: %s", cmp.Diff(tt.expected, merged))
+			}
+		})
+	}
+}
+
+// s3SubresourceTripper is an http.RoundTripper answering the requests made
+// to a bucket subresource (e.g. ?lifecycle) with canned XML bodies, and
+// recording the bodies sent to them, if any.
+type s3SubresourceTripper struct {
+	// responses maps a method and a subresource (e.g. "GET lifecycle") to
+	// a response.
+	responses map[string]s3SubresourceResponse
+	bodies    map[string][]byte
+	requests  []s3SubresourceRequest
+}
+
+type s3SubresourceRequest struct {
+	key  string
+	url  *url.URL
+	body []byte
+}
+
+type s3SubresourceResponse struct {
+	code int
+	body string
+}
+
+func (r *s3SubresourceTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	var subresource string
+	for _, s := range []string{"lifecycle", "versioning", "tagging", "encryption", "publicAccessBlock", "replication", "policy", "logging", "versions", "delete"} {
+		if req.URL.Query().Has(s) {
+			subresource = s
+		}
+	}
+	if strings.HasPrefix(req.URL.Host, "sts.") {
+		subresource = "sts"
+	}
+	key := req.Method + " " + subresource
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+	}
+	if r.bodies == nil {
+		r.bodies = map[string][]byte{}
+	}
+	r.bodies[key] = body
+	r.requests = append(r.requests, s3SubresourceRequest{key: key, url: req.URL, body: body})
+
+	resp, ok := r.responses[key]
+	if !ok {
+		resp = s3SubresourceResponse{code: http.StatusOK}
+	}
+	return &http.Response{
+		StatusCode: resp.code,
+		Body:       io.NopCloser(bytes.NewBufferString(resp.body)),
+		Header:     http.Header{"Content-Type": []string{"application/xml"}},
+	}, nil
+}
+
+// bucketBody returns the body of the last request made with key to bucket,
+// and whether there is one.
+func (r *s3SubresourceTripper) bucketBody(key, bucket string) ([]byte, bool) {
+	for i := len(r.requests) - 1; i >= 0; i-- {
+		req := r.requests[i]
+		if req.key != key {
+			continue
+		}
+		if strings.HasPrefix(req.url.Host, bucket+".") || strings.HasPrefix(req.url.Path, "/"+bucket+"/") || req.url.Path == "/"+bucket {
+			return req.body, true
+		}
+	}
+	return nil, false
+}
+
+func TestCreateStorageBucketVersioning(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-cluster-abc12",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-east-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access"),
+			"aws_secret_access_key": []byte("secret"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	userRules := `<LifecycleConfiguration><Rule><ID>user-rule</ID><Status>Enabled</Status><Filter><Prefix>logs/</Prefix></Filter><Expiration><Days>7</Days></Expiration></Rule></LifecycleConfiguration>`
+	noLifecycle := `<Error><Code>NoSuchLifecycleConfiguration</Code><Message>error</Message></Error>`
+	operatorRules := `<LifecycleConfiguration><Rule><ID>user-rule</ID><Status>Enabled</Status><Filter><Prefix>logs/</Prefix></Filter><Expiration><Days>7</Days></Expiration></Rule><Rule><ID>` + noncurrentVersionsRuleID + `</ID><Status>Enabled</Status><Filter><Prefix></Prefix></Filter><NoncurrentVersionExpiration><NoncurrentDays>30</NoncurrentDays></NoncurrentVersionExpiration></Rule></LifecycleConfiguration>`
+
+	for _, tt := range []struct {
+		name                   string
+		annotations            map[string]string
+		responses              map[string]s3SubresourceResponse
+		expectedVersioning     string
+		expectedRuleIDs        []string
+		expectedNoncurrentDays int64
+		expectedStatus         operatorapi.ConditionStatus
+		expectedReason         string
+	}{
+		{
+			name: "versioning not managed",
+			responses: map[string]s3SubresourceResponse{
+				"GET lifecycle":  {code: http.StatusNotFound, body: noLifecycle},
+				"GET versioning": {code: http.StatusOK, body: `<VersioningConfiguration><Status>Enabled</Status></VersioningConfiguration>`},
+			},
+			expectedRuleIDs: []string{incompleteUploadsRuleID},
+			expectedStatus:  operatorapi.ConditionTrue,
+			expectedReason:  "Versioning Enabled",
+		},
+		{
+			name: "versioning not managed anymore",
+			responses: map[string]s3SubresourceResponse{
+				"GET lifecycle":  {code: http.StatusOK, body: operatorRules},
+				"GET versioning": {code: http.StatusOK, body: `<VersioningConfiguration><Status>Enabled</Status></VersioningConfiguration>`},
+			},
+			expectedRuleIDs: []string{"user-rule", incompleteUploadsRuleID},
+			expectedStatus:  operatorapi.ConditionTrue,
+			expectedReason:  "Versioning Enabled",
+		},
+		{
+			name: "versioning enabled",
+			annotations: map[string]string{
+				defaults.S3BucketVersioningAnnotation: "true",
+			},
+			responses: map[string]s3SubresourceResponse{
+				"GET lifecycle": {code: http.StatusOK, body: userRules},
+			},
+			expectedVersioning:     s3.BucketVersioningStatusEnabled,
+			expectedRuleIDs:        []string{"user-rule", incompleteUploadsRuleID, noncurrentVersionsRuleID},
+			expectedNoncurrentDays: defaultNoncurrentVersionExpirationDays,
+			expectedStatus:         operatorapi.ConditionTrue,
+			expectedReason:         "Versioning Enabled",
+		},
+		{
+			name: "versioning suspended",
+			annotations: map[string]string{
+				defaults.S3BucketVersioningAnnotation:                "false",
+				defaults.S3NoncurrentVersionExpirationDaysAnnotation: "5",
+			},
+			responses: map[string]s3SubresourceResponse{
+				"GET lifecycle": {code: http.StatusNotFound, body: noLifecycle},
+			},
+			expectedVersioning:     s3.BucketVersioningStatusSuspended,
+			expectedRuleIDs:        []string{incompleteUploadsRuleID, noncurrentVersionsRuleID},
+			expectedNoncurrentDays: 5,
+			expectedStatus:         operatorapi.ConditionFalse,
+			expectedReason:         "Versioning Suspended",
+		},
+		{
+			name: "versioning can't be enabled",
+			annotations: map[string]string{
+				defaults.S3BucketVersioningAnnotation: "true",
+			},
+			responses: map[string]s3SubresourceResponse{
+				"GET lifecycle":  {code: http.StatusOK, body: userRules},
+				"PUT versioning": {code: http.StatusForbidden, body: `<Error><Code>AccessDenied</Code><Message>error</Message></Error>`},
+			},
+			expectedRuleIDs:        []string{"user-rule", incompleteUploadsRuleID, noncurrentVersionsRuleID},
+			expectedNoncurrentDays: defaultNoncurrentVersionExpirationDays,
+			expectedStatus:         operatorapi.ConditionFalse,
+			expectedReason:         "AccessDenied",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fg := featuregates.NewHardcodedFeatureGateAccess(
+				[]configv1.FeatureGateName{util.TestFeatureGateName},
+				[]configv1.FeatureGateName{},
+			)
+			drv := NewDriver(
+				context.Background(),
+				&imageregistryv1.ImageRegistryConfigStorageS3{
+					Region: "us-east-1",
+				},
+				&listers.StorageListers,
+				fg,
+			)
+			rt := &s3SubresourceTripper{responses: tt.responses}
+			drv.roundTripper = rt
+
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: tt.annotations,
+				},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							Region: "us-east-1",
+						},
+					},
+				},
+			}
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.expectedVersioning != "" {
+				var versioning s3.VersioningConfiguration
+				if err := xmlutil.UnmarshalXML(&versioning, xml.NewDecoder(bytes.NewReader(rt.bodies["PUT versioning"])), ""); err != nil {
+					t.Fatalf("error decoding versioning request: %s", err)
+				}
+				if status := aws.StringValue(versioning.Status); status != tt.expectedVersioning {
+					t.Errorf("expected versioning %q, got %q", tt.expectedVersioning, status)
+				}
+			}
+			if _, ok := rt.bodies["PUT versioning"]; ok && tt.annotations == nil {
+				t.Errorf("versioning is not expected to be set")
+			}
+
+			var lifecycle s3.BucketLifecycleConfiguration
+			if err := xmlutil.UnmarshalXML(&lifecycle, xml.NewDecoder(bytes.NewReader(rt.bodies["PUT lifecycle"])), ""); err != nil {
+				t.Fatalf("error decoding lifecycle request: %s", err)
+			}
+			var ids []string
+			for _, rule := range lifecycle.Rules {
+				id := aws.StringValue(rule.ID)
+				ids = append(ids, id)
+				if id == noncurrentVersionsRuleID {
+					if days := aws.Int64Value(rule.NoncurrentVersionExpiration.NoncurrentDays); days != tt.expectedNoncurrentDays {
+						t.Errorf("expected noncurrent versions to expire after %d days, got %d", tt.expectedNoncurrentDays, days)
+					}
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.expectedRuleIDs) {
+				t.Errorf("expected lifecycle rules %v, got %v", tt.expectedRuleIDs, ids)
+			}
+
+			cond := util.FetchCondition(cr, defaults.StorageVersioningEnabled)
+			if cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason {
+				t.Errorf("expected condition %s/%s, got %s/%s: %s", tt.expectedStatus, tt.expectedReason, cond.Status, cond.Reason, cond.Message)
+			}
+			// failures are retried after a while, not on the next sync
+			if versioningChanged(cr) {
+				t.Errorf("unexpected versioning change detected: %s", cond.Message)
+			}
+			cr.Annotations = map[string]string{
+				defaults.S3BucketVersioningAnnotation:                "true",
+				defaults.S3NoncurrentVersionExpirationDaysAnnotation: "7",
+				defaults.StorageSettingsAnnotation:                   cr.Annotations[defaults.StorageSettingsAnnotation],
+			}
+			if !versioningChanged(cr) {
+				t.Errorf("expected the versioning change to be detected")
+			}
+		})
+	}
+}
+
+func TestCreateStorageKeepsBucketTags(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-cluster-abc12",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-east-1",
+					ResourceTags: []configv1.AWSResourceTag{
+						{Key: "cost-center", Value: "registry"},
+					},
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access"),
+			"aws_secret_access_key": []byte("secret"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	for _, tt := range []struct {
+		name         string
+		response     s3SubresourceResponse
+		expectedTags []*s3.Tag
+	}{
+		{
+			name:     "bucket without tags",
+			response: s3SubresourceResponse{code: http.StatusNotFound, body: `<Error><Code>NoSuchTagSet</Code><Message>error</Message></Error>`},
+			expectedTags: []*s3.Tag{
+				{Key: aws.String("kubernetes.io/cluster/test-cluster-abc12"), Value: aws.String("owned")},
+				{Key: aws.String("Name"), Value: aws.String("test-cluster-abc12-image-registry")},
+				{Key: aws.String("cost-center"), Value: aws.String("registry")},
+			},
+		},
+		{
+			name:     "bucket with tags",
+			response: s3SubresourceResponse{code: http.StatusOK, body: `<Tagging><TagSet><Tag><Key>team</Key><Value>storage</Value></Tag><Tag><Key>cost-center</Key><Value>other</Value></Tag></TagSet></Tagging>`},
+			expectedTags: []*s3.Tag{
+				{Key: aws.String("team"), Value: aws.String("storage")},
+				{Key: aws.String("cost-center"), Value: aws.String("registry")},
+				{Key: aws.String("kubernetes.io/cluster/test-cluster-abc12"), Value: aws.String("owned")},
+				{Key: aws.String("Name"), Value: aws.String("test-cluster-abc12-image-registry")},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fg := featuregates.NewHardcodedFeatureGateAccess(
+				[]configv1.FeatureGateName{util.TestFeatureGateName},
+				[]configv1.FeatureGateName{},
+			)
+			drv := NewDriver(
+				context.Background(),
+				&imageregistryv1.ImageRegistryConfigStorageS3{
+					Region: "us-east-1",
+				},
+				&listers.StorageListers,
+				fg,
+			)
+			rt := &s3SubresourceTripper{
+				responses: map[string]s3SubresourceResponse{
+					"GET tagging": tt.response,
+				},
+			}
+			drv.roundTripper = rt
+
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							Region: "us-east-1",
+						},
+					},
+				},
+			}
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var tagging s3.Tagging
+			if err := xmlutil.UnmarshalXML(&tagging, xml.NewDecoder(bytes.NewReader(rt.bodies["PUT tagging"])), ""); err != nil {
+				t.Fatalf("error decoding tagging request: %s", err)
+			}
+			if !reflect.DeepEqual(tagging.TagSet, tt.expectedTags) {
+				t.Errorf("unexpected tags: %s", cmp.Diff(tt.expectedTags, tagging.TagSet))
+			}
+			if cond := util.FetchCondition(cr, defaults.StorageTagged); cond.Status != operatorapi.ConditionTrue {
+				t.Errorf("expected the bucket to be tagged, got %s: %s", cond.Reason, cond.Message)
+			}
+		})
+	}
+}
+
+func TestCreateStorageReplication(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		roleARN         string
+		annotations     map[string]string
+		expectedStatus  operatorapi.ConditionStatus
+		expectedReason  string
+		expectedKMSKey  string
+		expectedReplica bool
+	}{
+		{
+			name:    "replicated",
+			roleARN: "arn:aws:iam::123456789012:role/replication",
+			annotations: map[string]string{
+				defaults.S3ReplicationRegionAnnotation: "us-west-2",
+			},
+			expectedStatus:  operatorapi.ConditionTrue,
+			expectedReason:  "Replication Successful",
+			expectedReplica: true,
+		},
+		{
+			name:    "replicated with a kms key",
+			roleARN: "arn:aws:iam::123456789012:role/replication",
+			annotations: map[string]string{
+				defaults.S3ReplicationRegionAnnotation: "us-west-2",
+				defaults.S3ReplicaKMSKeyIDAnnotation:   "replica-key",
+			},
+			expectedStatus:  operatorapi.ConditionTrue,
+			expectedReason:  "Replication Successful",
+			expectedKMSKey:  "replica-key",
+			expectedReplica: true,
+		},
+		{
+			name: "role missing",
+			annotations: map[string]string{
+				defaults.S3ReplicationRegionAnnotation: "us-west-2",
+			},
+			expectedStatus: operatorapi.ConditionFalse,
+			expectedReason: "Role Missing",
+		},
+		{
+			name:    "same region",
+			roleARN: "arn:aws:iam::123456789012:role/replication",
+			annotations: map[string]string{
+				defaults.S3ReplicationRegionAnnotation: "us-east-1",
+			},
+			expectedStatus: operatorapi.ConditionFalse,
+			expectedReason: "Invalid Region",
+		},
+		{
+			name:    "versioning suspended",
+			roleARN: "arn:aws:iam::123456789012:role/replication",
+			annotations: map[string]string{
+				defaults.S3ReplicationRegionAnnotation: "us-west-2",
+				defaults.S3BucketVersioningAnnotation:  "false",
+			},
+			expectedStatus: operatorapi.ConditionFalse,
+			expectedReason: "Versioning Required",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := cirofake.NewFixturesBuilder()
+			builder.AddInfraConfig(&configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Status: configv1.InfrastructureStatus{
+					InfrastructureName: "test-cluster-abc12",
+					PlatformStatus: &configv1.PlatformStatus{
+						Type: configv1.AWSPlatformType,
+						AWS: &configv1.AWSPlatformStatus{
+							Region: "us-east-1",
+						},
+					},
+				},
+			})
+			builder.AddSecrets(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.CloudCredentialsName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string][]byte{
+					"aws_access_key_id":     []byte("access"),
+					"aws_secret_access_key": []byte("secret"),
+				},
+			})
+			if tt.roleARN != "" {
+				// the secret holds no credentials, the minted ones are used.
+				builder.AddSecrets(&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      defaults.ImageRegistryPrivateConfigurationUser,
+						Namespace: defaults.ImageRegistryOperatorNamespace,
+					},
+					Data: map[string][]byte{
+						replicationRoleARNKey: []byte(tt.roleARN),
+					},
+				})
+			}
+			listers := builder.BuildListers()
+
+			fg := featuregates.NewHardcodedFeatureGateAccess(
+				[]configv1.FeatureGateName{util.TestFeatureGateName},
+				[]configv1.FeatureGateName{},
+			)
+			drv := NewDriver(
+				context.Background(),
+				&imageregistryv1.ImageRegistryConfigStorageS3{
+					Region: "us-east-1",
+				},
+				&listers.StorageListers,
+				fg,
+			)
+			rt := &s3SubresourceTripper{
+				responses: map[string]s3SubresourceResponse{
+					"GET replication": {code: http.StatusNotFound, body: `<Error><Code>ReplicationConfigurationNotFoundError</Code><Message>error</Message></Error>`},
+				},
+			}
+			drv.roundTripper = rt
+
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: tt.annotations,
+				},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							Region: "us-east-1",
+						},
+					},
+				},
+			}
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			cond := util.FetchCondition(cr, defaults.StorageReplicationEnabled)
+			if cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason {
+				t.Fatalf("expected condition %s/%s, got %s/%s: %s", tt.expectedStatus, tt.expectedReason, cond.Status, cond.Reason, cond.Message)
+			}
+
+			// failures are retried after a while, not on the next sync
+			if replicationChanged(cr) {
+				t.Errorf("replication is not expected to have changed: %s", cond.Message)
+			}
+
+			body, ok := rt.bodies["PUT replication"]
+			if ok != tt.expectedReplica {
+				t.Fatalf("expected replication to be configured: %t, got %t", tt.expectedReplica, ok)
+			}
+			if !tt.expectedReplica {
+				return
+			}
+
+			var replication s3.ReplicationConfiguration
+			if err := xmlutil.UnmarshalXML(&replication, xml.NewDecoder(bytes.NewReader(body)), ""); err != nil {
+				t.Fatalf("error decoding replication request: %s", err)
+			}
+			if role := aws.StringValue(replication.Role); role != tt.roleARN {
+				t.Errorf("expected role %q, got %q", tt.roleARN, role)
+			}
+			if len(replication.Rules) != 1 {
+				t.Fatalf("expected one replication rule, got %d", len(replication.Rules))
+			}
+			rule := replication.Rules[0]
+			if bucket := aws.StringValue(rule.Destination.Bucket); bucket != "arn:aws:s3:::test-cluster-abc12-image-registry-replica-us-west-2" {
+				t.Errorf("unexpected destination %q", bucket)
+			}
+			var kmsKey string
+			if rule.Destination.EncryptionConfiguration != nil {
+				kmsKey = aws.StringValue(rule.Destination.EncryptionConfiguration.ReplicaKmsKeyID)
+			}
+			if kmsKey != tt.expectedKMSKey {
+				t.Errorf("expected replica kms key %q, got %q", tt.expectedKMSKey, kmsKey)
+			}
+
+			delete(cr.Annotations, defaults.S3ReplicationRegionAnnotation)
+			if !replicationChanged(cr) {
+				t.Errorf("replication is expected to have changed once disabled")
+			}
+		})
+	}
+}
+
+func TestCreateStorageBucketPolicy(t *testing.T) {
+	const arn = "arn:aws:s3:::test-cluster-abc12-image-registry-us-east-1"
+
+	for _, tt := range []struct {
+		name            string
+		managementState string
+		annotations     map[string]string
+		conditions      []operatorapi.OperatorCondition
+		policy          string
+		expectedSids    []string
+		expectedStatus  operatorapi.ConditionStatus
+		expectedReason  string
+		expectedUserID  string
+		expectDelete    bool
+	}{
+		{
+			name:           "bucket without policy",
+			expectedSids:   []string{denyInsecureTransportSid},
+			expectedStatus: operatorapi.ConditionTrue,
+			expectedReason: "Policy Applied",
+		},
+		{
+			name: "foreign statements are kept",
+			annotations: map[string]string{
+				defaults.S3VPCEndpointIDAnnotation: "vpce-1a2b3c4d",
+			},
+			policy:         `{"Version":"2012-10-17","Statement":{"Sid":"Theirs","Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:root"},"Action":"s3:GetObject","Resource":"` + arn + `/*"}}`,
+			expectedSids:   []string{"Theirs", denyInsecureTransportSid, denyOutsideVPCEndpointSid},
+			expectedStatus: operatorapi.ConditionTrue,
+			expectedReason: "Policy Applied",
+		},
+		{
+			name: "restricted to the cluster principal",
+			annotations: map[string]string{
+				defaults.S3RestrictToClusterPrincipalAnnotation: "true",
+			},
+			policy:         `{"Version":"2012-10-17","Statement":[{"Sid":"` + denyOutsideVPCEndpointSid + `","Effect":"Deny","Principal":"*","Action":"s3:*","Resource":"` + arn + `"}]}`,
+			expectedSids:   []string{denyInsecureTransportSid, denyOtherPrincipalsSid},
+			expectedStatus: operatorapi.ConditionTrue,
+			expectedReason: "Policy Applied",
+			expectedUserID: "AROAEXAMPLEID:*",
+		},
+		{
+			name:            "unmanaged storage",
+			managementState: imageregistryv1.StorageManagementStateUnmanaged,
+			conditions: []operatorapi.OperatorCondition{
+				{Type: defaults.StoragePolicyApplied, Status: operatorapi.ConditionTrue},
+			},
+			policy:         `{"Version":"2012-10-17","Statement":[{"Sid":"` + denyInsecureTransportSid + `","Effect":"Deny","Principal":"*","Action":"s3:*","Resource":"` + arn + `"}]}`,
+			expectedStatus: operatorapi.ConditionFalse,
+			expectedReason: "Storage Unmanaged",
+			expectDelete:   true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := cirofake.NewFixturesBuilder()
+			builder.AddInfraConfig(&configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Status: configv1.InfrastructureStatus{
+					InfrastructureName: "test-cluster-abc12",
+					PlatformStatus: &configv1.PlatformStatus{
+						Type: configv1.AWSPlatformType,
+						AWS: &configv1.AWSPlatformStatus{
+							Region: "us-east-1",
+						},
+					},
+				},
+			})
+			builder.AddSecrets(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.CloudCredentialsName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string][]byte{
+					"aws_access_key_id":     []byte("access"),
+					"aws_secret_access_key": []byte("secret"),
+				},
+			})
+			listers := builder.BuildListers()
+
+			fg := featuregates.NewHardcodedFeatureGateAccess(
+				[]configv1.FeatureGateName{util.TestFeatureGateName},
+				[]configv1.FeatureGateName{},
+			)
+			config := &imageregistryv1.ImageRegistryConfigStorageS3{
+				Region: "us-east-1",
+			}
+			if tt.managementState == imageregistryv1.StorageManagementStateUnmanaged {
+				config.Bucket = "test-cluster-abc12-image-registry-us-east-1"
+			}
+			drv := NewDriver(context.Background(), config, &listers.StorageListers, fg)
+
+			responses := map[string]s3SubresourceResponse{
+				"POST sts": {code: http.StatusOK, body: `<GetCallerIdentityResponse><GetCallerIdentityResult><UserId>AROAEXAMPLEID:registry-session</UserId><Account>123456789012</Account><Arn>arn:aws:sts::123456789012:assumed-role/registry/registry-session</Arn></GetCallerIdentityResult></GetCallerIdentityResponse>`},
+			}
+			if tt.policy != "" {
+				responses["GET policy"] = s3SubresourceResponse{code: http.StatusOK, body: tt.policy}
+			} else {
+				responses["GET policy"] = s3SubresourceResponse{code: http.StatusNotFound, body: `<Error><Code>NoSuchBucketPolicy</Code><Message>error</Message></Error>`}
+			}
+			rt := &s3SubresourceTripper{responses: responses}
+			drv.roundTripper = rt
+
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: tt.annotations,
+				},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						ManagementState: tt.managementState,
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							Region: "us-east-1",
+							Bucket: config.Bucket,
+						},
+					},
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					OperatorStatus: operatorapi.OperatorStatus{
+						Conditions: tt.conditions,
+					},
+				},
+			}
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			cond := util.FetchCondition(cr, defaults.StoragePolicyApplied)
+			if cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason {
+				t.Fatalf("expected condition %s/%s, got %s/%s: %s", tt.expectedStatus, tt.expectedReason, cond.Status, cond.Reason, cond.Message)
+			}
+			if _, ok := rt.bodies["DELETE policy"]; ok != tt.expectDelete {
+				t.Errorf("expected the policy to be deleted: %t, got %t", tt.expectDelete, ok)
+			}
+			if policyChanged(cr) {
+				t.Errorf("policy is not expected to have changed: %s", cond.Message)
+			}
+			if tt.expectDelete {
+				return
+			}
+
+			var policy bucketPolicy
+			if err := json.Unmarshal(rt.bodies["PUT policy"], &policy); err != nil {
+				t.Fatalf("error decoding policy request: %s", err)
+			}
+			var sids []string
+			for _, s := range policy.Statement {
+				sids = append(sids, s.sid())
+			}
+			if !reflect.DeepEqual(sids, tt.expectedSids) {
+				t.Errorf("unexpected statements: %s", cmp.Diff(tt.expectedSids, sids))
+			}
+			if tt.expectedUserID != "" {
+				body := string(rt.bodies["PUT policy"])
+				if !strings.Contains(body, fmt.Sprintf(`"aws:userid":%q`, tt.expectedUserID)) {
+					t.Errorf("expected the policy to restrict access to %s, got %s", tt.expectedUserID, body)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyChanged(t *testing.T) {
+	applied := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				ManagementState: imageregistryv1.StorageManagementStateManaged,
+			},
+		},
+	}
+	util.RecordSetting(applied, defaults.StoragePolicyApplied, bucketPolicyInputs(applied), nil)
+
+	for _, tt := range []struct {
+		name        string
+		annotations map[string]string
+		expected    bool
+	}{
+		{
+			// existing buckets don't go through CreateStorage on upgrade
+			name:     "never applied, nothing requested",
+			expected: false,
+		},
+		{
+			name: "never applied, restricted to a vpc endpoint",
+			annotations: map[string]string{
+				defaults.S3VPCEndpointIDAnnotation: "vpce-1a2b3c4d",
+			},
+			expected: true,
+		},
+		{
+			name: "applied",
+			annotations: map[string]string{
+				defaults.StorageSettingsAnnotation: applied.Annotations[defaults.StorageSettingsAnnotation],
+			},
+			expected: false,
+		},
+		{
+			name: "applied, then restricted to the cluster principal",
+			annotations: map[string]string{
+				defaults.StorageSettingsAnnotation:              applied.Annotations[defaults.StorageSettingsAnnotation],
+				defaults.S3RestrictToClusterPrincipalAnnotation: "true",
+			},
+			expected: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := applied.DeepCopy()
+			cr.Annotations = tt.annotations
+			if changed := policyChanged(cr); changed != tt.expected {
+				t.Errorf("expected the policy change to be %t, got %t", tt.expected, changed)
+			}
+		})
+	}
+}
+
+func TestCreateStorageAccessLogging(t *testing.T) {
+	const bucket = "test-cluster-abc12-image-registry-us-east-1"
+
+	for _, tt := range []struct {
+		name           string
+		annotations    map[string]string
+		conditions     []operatorapi.OperatorCondition
+		logBucketTags  string
+		expectedStatus operatorapi.ConditionStatus
+		expectedReason string
+		expectedTarget string
+		expectedPrefix string
+		expectedSids   []string
+		expectDisabled bool
+	}{
+		{
+			name: "log bucket owned by the operator",
+			annotations: map[string]string{
+				defaults.S3AccessLogBucketAnnotation: "registry-logs",
+			},
+			logBucketTags:  `<Tagging><TagSet><Tag><Key>image-registry.openshift.io/access-logs-of</Key><Value>` + bucket + `</Value></Tag></TagSet></Tagging>`,
+			expectedStatus: operatorapi.ConditionTrue,
+			expectedReason: "Access Logging Enabled",
+			expectedTarget: "registry-logs",
+			expectedPrefix: bucket + "/",
+			expectedSids:   []string{accessLogDeliverySid(bucket), denyInsecureTransportSid},
+		},
+		{
+			name: "log bucket owned by someone else",
+			annotations: map[string]string{
+				defaults.S3AccessLogBucketAnnotation: "registry-logs",
+				defaults.S3AccessLogPrefixAnnotation: "audit/",
+			},
+			logBucketTags:  `<Tagging><TagSet><Tag><Key>team</Key><Value>audit</Value></Tag></TagSet></Tagging>`,
+			expectedStatus: operatorapi.ConditionTrue,
+			expectedReason: "Access Logging Enabled",
+			expectedTarget: "registry-logs",
+			expectedPrefix: "audit/",
+			expectedSids:   []string{accessLogDeliverySid(bucket)},
+		},
+		{
+			name: "logged into itself",
+			annotations: map[string]string{
+				defaults.S3AccessLogBucketAnnotation: bucket,
+			},
+			expectedStatus: operatorapi.ConditionFalse,
+			expectedReason: "Invalid Target",
+		},
+		{
+			name: "logging disabled",
+			conditions: []operatorapi.OperatorCondition{
+				{Type: defaults.StorageAccessLoggingEnabled, Status: operatorapi.ConditionTrue},
+			},
+			expectedStatus: operatorapi.ConditionFalse,
+			expectedReason: "Access Logging Disabled",
+			expectDisabled: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := cirofake.NewFixturesBuilder()
+			builder.AddInfraConfig(&configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Status: configv1.InfrastructureStatus{
+					InfrastructureName: "test-cluster-abc12",
+					PlatformStatus: &configv1.PlatformStatus{
+						Type: configv1.AWSPlatformType,
+						AWS: &configv1.AWSPlatformStatus{
+							Region: "us-east-1",
+						},
+					},
+				},
+			})
+			builder.AddSecrets(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.CloudCredentialsName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string][]byte{
+					"aws_access_key_id":     []byte("access"),
+					"aws_secret_access_key": []byte("secret"),
+				},
+			})
+			listers := builder.BuildListers()
+
+			fg := featuregates.NewHardcodedFeatureGateAccess(
+				[]configv1.FeatureGateName{util.TestFeatureGateName},
+				[]configv1.FeatureGateName{},
+			)
+			drv := NewDriver(
+				context.Background(),
+				&imageregistryv1.ImageRegistryConfigStorageS3{
+					Region: "us-east-1",
+				},
+				&listers.StorageListers,
+				fg,
+			)
+			responses := map[string]s3SubresourceResponse{
+				"GET policy": {code: http.StatusNotFound, body: `<Error><Code>NoSuchBucketPolicy</Code><Message>error</Message></Error>`},
+			}
+			if tt.logBucketTags != "" {
+				responses["GET tagging"] = s3SubresourceResponse{code: http.StatusOK, body: tt.logBucketTags}
+			}
+			rt := &s3SubresourceTripper{responses: responses}
+			drv.roundTripper = rt
+
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: tt.annotations,
+				},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							Region: "us-east-1",
+						},
+					},
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					OperatorStatus: operatorapi.OperatorStatus{
+						Conditions: tt.conditions,
+					},
+				},
+			}
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			cond := util.FetchCondition(cr, defaults.StorageAccessLoggingEnabled)
+			if cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason {
+				t.Fatalf("expected condition %s/%s, got %s/%s: %s", tt.expectedStatus, tt.expectedReason, cond.Status, cond.Reason, cond.Message)
+			}
+			// failures are retried after a while, not on the next sync
+			if drv.accessLoggingChanged(cr) {
+				t.Errorf("unexpected access logging change detected: %s", cond.Message)
+			}
+			changed := cr.DeepCopy()
+			changed.Annotations = map[string]string{
+				defaults.S3AccessLogBucketAnnotation: "other-logs",
+				defaults.StorageSettingsAnnotation:   cr.Annotations[defaults.StorageSettingsAnnotation],
+			}
+			if !drv.accessLoggingChanged(changed) {
+				t.Errorf("expected the access logging change to be detected")
+			}
+
+			body, ok := rt.bodies["PUT logging"]
+			if ok != (tt.expectedTarget != "" || tt.expectDisabled) {
+				t.Fatalf("unexpected access logging update: %t", ok)
+			}
+			if !ok {
+				return
+			}
+			var status s3.BucketLoggingStatus
+			if err := xmlutil.UnmarshalXML(&status, xml.NewDecoder(bytes.NewReader(body)), ""); err != nil {
+				t.Fatalf("error decoding logging request: %s", err)
+			}
+			if tt.expectDisabled {
+				if status.LoggingEnabled != nil {
+					t.Errorf("expected access logging to be disabled, got %s", status.LoggingEnabled)
+				}
+				return
+			}
+			if status.LoggingEnabled == nil {
+				t.Fatalf("expected access logging to be enabled")
+			}
+			if target := aws.StringValue(status.LoggingEnabled.TargetBucket); target != tt.expectedTarget {
+				t.Errorf("expected target bucket %q, got %q", tt.expectedTarget, target)
+			}
+			if prefix := aws.StringValue(status.LoggingEnabled.TargetPrefix); prefix != tt.expectedPrefix {
+				t.Errorf("expected target prefix %q, got %q", tt.expectedPrefix, prefix)
+			}
+
+			body, _ = rt.bucketBody("PUT lifecycle", tt.expectedTarget)
+			var lifecycle s3.BucketLifecycleConfiguration
+			if err := xmlutil.UnmarshalXML(&lifecycle, xml.NewDecoder(bytes.NewReader(body)), ""); err != nil {
+				t.Fatalf("error decoding lifecycle request: %s", err)
+			}
+			var found bool
+			for _, rule := range lifecycle.Rules {
+				if aws.StringValue(rule.ID) == accessLogsRuleIDPrefix+bucket {
+					found = true
+					if days := aws.Int64Value(rule.Expiration.Days); days != defaultAccessLogRetentionDays {
+						t.Errorf("expected access logs to be kept for %d days, got %d", defaultAccessLogRetentionDays, days)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("expected a lifecycle rule expiring the access logs")
+			}
+
+			body, _ = rt.bucketBody("PUT policy", tt.expectedTarget)
+			var policy bucketPolicy
+			if err := json.Unmarshal(body, &policy); err != nil {
+				t.Fatalf("error decoding log bucket policy request: %s", err)
+			}
+			var sids []string
+			for _, s := range policy.Statement {
+				sids = append(sids, s.sid())
+			}
+			if !reflect.DeepEqual(sids, tt.expectedSids) {
+				t.Errorf("unexpected log bucket statements: %s", cmp.Diff(tt.expectedSids, sids))
+			}
+		})
+	}
+}
+
+func TestRemoveStorageAccessLogBucket(t *testing.T) {
+	const bucket = "test-cluster-abc12-image-registry-us-east-1"
+
+	for _, tt := range []struct {
+		name          string
+		logBucketTags string
+		expectRemoved bool
+	}{
+		{
+			name:          "log bucket owned by the operator",
+			logBucketTags: `<Tagging><TagSet><Tag><Key>image-registry.openshift.io/access-logs-of</Key><Value>` + bucket + `</Value></Tag></TagSet></Tagging>`,
+			expectRemoved: true,
+		},
+		{
+			name:          "log bucket owned by someone else",
+			logBucketTags: `<Tagging><TagSet><Tag><Key>team</Key><Value>audit</Value></Tag></TagSet></Tagging>`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := cirofake.NewFixturesBuilder()
+			builder.AddInfraConfig(&configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Status: configv1.InfrastructureStatus{
+					InfrastructureName: "test-cluster-abc12",
+					PlatformStatus: &configv1.PlatformStatus{
+						Type: configv1.AWSPlatformType,
+						AWS: &configv1.AWSPlatformStatus{
+							Region: "us-east-1",
+						},
+					},
+				},
+			})
+			builder.AddSecrets(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.CloudCredentialsName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string][]byte{
+					"aws_access_key_id":     []byte("access"),
+					"aws_secret_access_key": []byte("secret"),
+				},
+			})
+			listers := builder.BuildListers()
+
+			fg := featuregates.NewHardcodedFeatureGateAccess(
+				[]configv1.FeatureGateName{util.TestFeatureGateName},
+				[]configv1.FeatureGateName{},
+			)
+			config := &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket: bucket,
+				Region: "us-east-1",
+			}
+			drv := NewDriver(context.Background(), config, &listers.StorageListers, fg)
+			rt := &s3SubresourceTripper{
+				responses: map[string]s3SubresourceResponse{
+					"GET logging": {code: http.StatusOK, body: `<BucketLoggingStatus><LoggingEnabled><TargetBucket>registry-logs</TargetBucket><TargetPrefix>` + bucket + `/</TargetPrefix></LoggingEnabled></BucketLoggingStatus>`},
+					"GET tagging": {code: http.StatusOK, body: tt.logBucketTags},
+					// the bucket is gone once deleted.
+					"HEAD ": {code: http.StatusNotFound},
+				},
+			}
+			drv.roundTripper = rt
+
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						ManagementState: imageregistryv1.StorageManagementStateManaged,
+						S3:              config.DeepCopy(),
+					},
+				},
+			}
+			if _, err := drv.RemoveStorage(cr); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if _, removed := rt.bucketBody("DELETE ", "registry-logs"); removed != tt.expectRemoved {
+				t.Errorf("expected the log bucket to be removed: %t, got %t", tt.expectRemoved, removed)
+			}
+			if _, removed := rt.bucketBody("DELETE ", bucket); !removed {
+				t.Errorf("expected the bucket to be removed")
+			}
+		})
+	}
+}
+
+func TestRemoveOwnedStorage(t *testing.T) {
+	const bucket = "test-cluster-abc12-image-registry-us-east-1-abcdef"
+
+	for _, tt := range []struct {
+		name          string
+		versions      string
+		expectRemoved bool
+	}{
+		{
+			name:          "empty bucket",
+			expectRemoved: true,
+		},
+		{
+			name:          "ownership marker and canary objects",
+			versions:      `<Version><Key>openshift-image-registry-owner.json</Key><VersionId>null</VersionId></Version><Version><Key>openshift-image-registry-operator/canary</Key><VersionId>null</VersionId></Version>`,
+			expectRemoved: true,
+		},
+		{
+			name:     "registry content",
+			versions: `<Version><Key>openshift-image-registry-owner.json</Key><VersionId>null</VersionId></Version><Version><Key>docker/registry/v2/blobs/sha256/1c/1c1f/data</Key><VersionId>null</VersionId></Version>`,
+		},
+		{
+			name:     "registry content under a custom root directory",
+			versions: `<Version><Key>registry/docker/registry/v2/blobs/sha256/1c/1c1f/data</Key><VersionId>null</VersionId></Version>`,
+		},
+		{
+			name:     "access logs",
+			versions: `<Version><Key>openshift-image-registry-owner.json</Key><VersionId>null</VersionId></Version><Version><Key>logs/2024-01-01-00-00-00-ABCDEF</Key><VersionId>null</VersionId></Version>`,
+		},
+		{
+			name:     "deleted registry content of a versioned bucket",
+			versions: `<DeleteMarker><Key>docker/registry/v2/blobs/sha256/1c/1c1f/data</Key><VersionId>2</VersionId></DeleteMarker><Version><Key>docker/registry/v2/blobs/sha256/1c/1c1f/data</Key><VersionId>1</VersionId></Version>`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := cirofake.NewFixturesBuilder()
+			builder.AddInfraConfig(&configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Status: configv1.InfrastructureStatus{
+					InfrastructureName: "test-cluster-abc12",
+					PlatformStatus: &configv1.PlatformStatus{
+						Type: configv1.AWSPlatformType,
+						AWS: &configv1.AWSPlatformStatus{
+							Region: "us-east-1",
+						},
+					},
+				},
+			})
+			builder.AddSecrets(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.CloudCredentialsName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string][]byte{
+					"aws_access_key_id":     []byte("access"),
+					"aws_secret_access_key": []byte("secret"),
+				},
+			})
+			listers := builder.BuildListers()
+
+			fg := featuregates.NewHardcodedFeatureGateAccess(
+				[]configv1.FeatureGateName{util.TestFeatureGateName},
+				[]configv1.FeatureGateName{},
+			)
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket: "test-cluster-abc12-image-registry-us-east-1",
+				Region: "us-east-1",
+			}, &listers.StorageListers, fg)
+			rt := &s3SubresourceTripper{
+				responses: map[string]s3SubresourceResponse{
+					"GET versions": {code: http.StatusOK, body: `<ListVersionsResult><IsTruncated>false</IsTruncated>` + tt.versions + `</ListVersionsResult>`},
+					"POST delete":  {code: http.StatusOK, body: `<DeleteResult></DeleteResult>`},
+				},
+			}
+			drv.roundTripper = rt
+
+			removed, err := drv.RemoveOwnedStorage(context.Background(), bucket)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if removed != tt.expectRemoved {
+				t.Errorf("expected the bucket to be removed: %t, got %t", tt.expectRemoved, removed)
+			}
+			if _, deleted := rt.bucketBody("DELETE ", bucket); deleted != tt.expectRemoved {
+				t.Errorf("expected the bucket to be deleted: %t, got %t", tt.expectRemoved, deleted)
+			}
+			if _, deleted := rt.bucketBody("POST delete", bucket); deleted != (tt.expectRemoved && tt.versions != "") {
+				t.Errorf("expected the objects to be deleted: %t, got %t", tt.expectRemoved && tt.versions != "", deleted)
+			}
 		})
 	}
 }
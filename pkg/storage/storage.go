@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
 
@@ -67,6 +68,12 @@ type Driver interface {
 	// Volumes.
 	VolumeSecrets() (map[string]string, error)
 
+	// Validate checks the credentials given to the driver are allowed to
+	// manage the configured storage. It is called before CreateStorage
+	// and must not mutate the storage backend. Errors caused by missing
+	// permissions wrap util.ErrPermissionDenied.
+	Validate(*imageregistryv1.Config) error
+
 	// CreateStorage configures, creates, and reconsiles the storage
 	// backend. It is called when the storage configuration is changed or
 	// the storage backend does not exist.
@@ -88,6 +95,89 @@ type Driver interface {
 	ID() string
 }
 
+// UsageReporter is implemented by the drivers able to measure, from the
+// operator, the amount of data stored by the registry.
+type UsageReporter interface {
+	// StorageUsage returns the number of bytes and objects stored under
+	// the registry root. Listing requests wait on the limiter so they
+	// don't hammer the storage API.
+	StorageUsage(ctx context.Context, limiter *rate.Limiter) (bytes int64, objects int64, err error)
+}
+
+// QuotaReporter is implemented by the drivers able to tell the quota capping
+// the storage, as enforced by the storage itself.
+type QuotaReporter interface {
+	// StorageQuota returns the number of bytes accounted against the
+	// quota and the quota itself, zero when the storage has none.
+	StorageQuota(ctx context.Context) (used int64, quota int64, err error)
+}
+
+// CanaryPrefix is where the operator writes the objects it uses to probe the
+// storage, see util.CanaryPrefix.
+const CanaryPrefix = util.CanaryPrefix
+
+// OwnershipMarkerKey is the object that records which cluster the storage
+// belongs to, see util.OwnershipMarkerKey.
+const OwnershipMarkerKey = util.OwnershipMarkerKey
+
+// ObjectStore is implemented by the drivers able to write, read and delete
+// objects from the operator. It is used to probe the storage and to mark it
+// as owned by the cluster.
+type ObjectStore interface {
+	PutObject(ctx context.Context, key string, data []byte) error
+	// GetObject returns an error wrapping util.ErrObjectNotFound when
+	// either the object or its bucket does not exist.
+	GetObject(ctx context.Context, key string) ([]byte, error)
+	DeleteObject(ctx context.Context, key string) error
+}
+
+// CreationReporter is implemented by the drivers able to tell whether
+// CreateStorage created the storage medium, or reused one that already
+// existed under the same name.
+type CreationReporter interface {
+	// StorageCreated tells whether the last call to CreateStorage created
+	// the storage medium.
+	StorageCreated() bool
+}
+
+// OrphanCollector is implemented by the drivers able to find the storage
+// mediums created for the cluster, including the ones the registry no
+// longer uses.
+type OrphanCollector interface {
+	// ListOwnedStorage returns the buckets or containers named and tagged
+	// as owned by the cluster.
+	ListOwnedStorage(ctx context.Context) ([]util.OwnedStorage, error)
+	// RemoveOwnedStorage deletes the named bucket or container when it
+	// holds nothing but the objects the operator writes for its own use,
+	// see util.IsOperatorObject. Storage holding anything else is left
+	// untouched. It returns whether the storage was deleted.
+	RemoveOwnedStorage(ctx context.Context, name string) (bool, error)
+}
+
+// ReplicationChecker is implemented by the drivers able to tell whether the
+// storage medium is replicated to another location.
+type ReplicationChecker interface {
+	// CheckReplication returns the replication status of the object key
+	// written by the previous check, and writes it again for the next
+	// one. ReplicationUnknown is returned when the object does not exist
+	// yet.
+	CheckReplication(ctx context.Context, key string) (util.ReplicationStatus, error)
+}
+
+// KeyRotator is implemented by the drivers accessing the storage with one of
+// two keys the operator can regenerate. The keys are rotated in turn: the
+// standby key is regenerated and the registry switched to it, then the key
+// the registry used before becomes the standby key.
+type KeyRotator interface {
+	// StandbyKey returns the name of the key the registry is not
+	// configured with. No name is returned when the registry does not
+	// access the storage with keys the operator can regenerate.
+	StandbyKey(ctx context.Context) (string, error)
+	// RegenerateKey regenerates the named key and returns the parameter
+	// of the registry private configuration switching the registry to it.
+	RegenerateKey(ctx context.Context, name string) (envvar.EnvVar, error)
+}
+
 func NewDriver(cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *rest.Config, listers *regopclient.StorageListers, fg featuregates.FeatureGateAccess) (Driver, error) {
 	var names []string
 	var drivers []Driver
@@ -105,7 +195,7 @@ func NewDriver(cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *rest
 
 	if cfg.Swift != nil {
 		names = append(names, "Swift")
-		drivers = append(drivers, swift.NewDriver(cfg.Swift, listers))
+		drivers = append(drivers, swift.NewDriver(cfg.Swift, kubeconfig, listers))
 	}
 
 	if cfg.GCS != nil {
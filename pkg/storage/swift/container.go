@@ -0,0 +1,227 @@
+package swift
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/objectstorage/v1/containers"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	// quotaBytesMetadata is the metadata of the container capping the
+	// number of bytes it stores, enforced by the container quotas
+	// middleware of Swift.
+	quotaBytesMetadata = "Quota-Bytes"
+
+	storagePolicyReasonApplied  = "StoragePolicyApplied"
+	storagePolicyReasonMismatch = "StoragePolicyMismatch"
+	storagePolicyReasonError    = "StoragePolicyError"
+
+	quotaReasonSet   = "QuotaSet"
+	quotaReasonNone  = "NoQuota"
+	quotaReasonError = "QuotaError"
+)
+
+// requestedStoragePolicy returns the storage policy the container is to be
+// created with, as set on the image registry config. Nothing is returned
+// for the default storage policy of the cluster.
+func requestedStoragePolicy(cr *imageregistryv1.Config) string {
+	return strings.TrimSpace(cr.Annotations[defaults.SwiftStoragePolicyAnnotation])
+}
+
+// requestedQuotaBytes returns the quota of the container, as set on the image
+// registry config, zero when no quota is requested.
+func requestedQuotaBytes(cr *imageregistryv1.Config) int64 {
+	raw, ok := cr.Annotations[defaults.SwiftQuotaAnnotation]
+	if !ok {
+		return 0
+	}
+	quantity, err := resource.ParseQuantity(strings.TrimSpace(raw))
+	if err != nil || quantity.Sign() <= 0 {
+		klog.Warningf("ignoring invalid %s annotation %q: a positive quantity of bytes such as 500Gi is expected", defaults.SwiftQuotaAnnotation, raw)
+		return 0
+	}
+	return quantity.Value()
+}
+
+// storagePolicyRequest opens the messages of the StoragePlacementPolicyApplied
+// condition, it tells the storage policy they were reported for.
+func storagePolicyRequest(requested string) string {
+	if requested == "" {
+		return "The default storage policy is requested"
+	}
+	return fmt.Sprintf("The %s storage policy is requested", requested)
+}
+
+func storagePolicyMessage(requested, actual string) string {
+	if requested != "" && requested != actual {
+		return fmt.Sprintf("%s, but the container uses the %s storage policy: the storage policy of a container can't be changed once it is created", storagePolicyRequest(requested), actual)
+	}
+	return fmt.Sprintf("%s, the container uses the %s storage policy", storagePolicyRequest(requested), actual)
+}
+
+func quotaMessage(quota int64) string {
+	if quota == 0 {
+		return "No quota is set on the container by the operator"
+	}
+	return fmt.Sprintf("The container is capped at %s", resource.NewQuantity(quota, resource.BinarySI))
+}
+
+// storagePolicyChanged tells whether the storage policy of the container the
+// operator should manage was not checked against the requested one, or
+// whether checking it failed and is due for a retry.
+func storagePolicyChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false
+	}
+	return util.SettingChanged(cr, defaults.StoragePlacementPolicyApplied, util.SettingInputs(requestedStoragePolicy(cr)), util.SettingInputs(""))
+}
+
+// quotaChanged tells whether the quota set on the image registry config is
+// not the one last applied to the container the operator should manage, or
+// whether applying it failed and is due for a retry.
+func quotaChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false
+	}
+	return util.SettingChanged(cr, defaults.StorageQuotaEnforced, util.SettingInputs(requestedQuotaBytes(cr)), util.SettingInputs(int64(0)))
+}
+
+// containerCreated deploys the temporary URL key the container was just
+// created with and reports the settings it was created with.
+func (d *driver) containerCreated(cr *imageregistryv1.Config, tempURLKey string) {
+	d.tempURLKeyDeployed(cr, tempURLKey, d.deployTempURLKey(tempURLKey))
+
+	policy := requestedStoragePolicy(cr)
+	if policy == "" {
+		policy = "default"
+	}
+	util.UpdateCondition(cr, defaults.StoragePlacementPolicyApplied, operatorapi.ConditionTrue, storagePolicyReasonApplied, storagePolicyMessage(requestedStoragePolicy(cr), policy))
+	util.RecordSetting(cr, defaults.StoragePlacementPolicyApplied, util.SettingInputs(requestedStoragePolicy(cr)), nil)
+
+	quota := requestedQuotaBytes(cr)
+	if quota > 0 {
+		util.UpdateCondition(cr, defaults.StorageQuotaEnforced, operatorapi.ConditionTrue, quotaReasonSet, quotaMessage(quota))
+	} else {
+		util.UpdateCondition(cr, defaults.StorageQuotaEnforced, operatorapi.ConditionFalse, quotaReasonNone, quotaMessage(0))
+	}
+	util.RecordSetting(cr, defaults.StorageQuotaEnforced, util.SettingInputs(quota), nil)
+}
+
+// reconcileContainer brings the settings of an existing container the
+// operator manages in line with the image registry config, given the result
+// of the request getting the container.
+func (d *driver) reconcileContainer(cr *imageregistryv1.Config, client *gophercloud.ServiceClient, result containers.GetResult, infraName string) {
+	metadata, err := result.ExtractMetadata()
+	if err != nil {
+		metadata = map[string]string{}
+	}
+	d.reconcileTempURLKey(cr, client, metadata, infraName)
+
+	header, err := result.Extract()
+	util.RecordSetting(cr, defaults.StoragePlacementPolicyApplied, util.SettingInputs(requestedStoragePolicy(cr)), err)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StoragePlacementPolicyApplied, operatorapi.ConditionFalse, storagePolicyReasonError, fmt.Sprintf("Unable to get the storage policy of the container: %s", err))
+	} else {
+		reconcileStoragePolicy(cr, header.StoragePolicy)
+	}
+
+	d.reconcileQuota(cr, client, metadata)
+}
+
+// reconcileStoragePolicy reports whether the container uses the requested
+// storage policy through the StoragePlacementPolicyApplied condition. The
+// storage policy of a container can't be changed.
+func reconcileStoragePolicy(cr *imageregistryv1.Config, actual string) {
+	if actual == "" {
+		actual = "default"
+	}
+	requested := requestedStoragePolicy(cr)
+	if requested != "" && requested != actual {
+		util.UpdateCondition(cr, defaults.StoragePlacementPolicyApplied, operatorapi.ConditionFalse, storagePolicyReasonMismatch, storagePolicyMessage(requested, actual))
+		return
+	}
+	util.UpdateCondition(cr, defaults.StoragePlacementPolicyApplied, operatorapi.ConditionTrue, storagePolicyReasonApplied, storagePolicyMessage(requested, actual))
+}
+
+// operatorSetQuota tells whether the quota of the container was set by the
+// operator, failing to update it included.
+func operatorSetQuota(cr *imageregistryv1.Config) bool {
+	reason := util.FetchCondition(cr, defaults.StorageQuotaEnforced).Reason
+	return reason == quotaReasonSet || reason == quotaReasonError
+}
+
+// reconcileQuota sets the requested quota on the container and reports it
+// through the StorageQuotaEnforced condition. When none is requested, the
+// quota of the container is only removed if the operator set it.
+func (d *driver) reconcileQuota(cr *imageregistryv1.Config, client *gophercloud.ServiceClient, metadata map[string]string) {
+	quota := requestedQuotaBytes(cr)
+	current := metadata[quotaBytesMetadata]
+
+	var opts containers.UpdateOpts
+	switch {
+	case quota > 0 && current != strconv.FormatInt(quota, 10):
+		opts.Metadata = map[string]string{quotaBytesMetadata: strconv.FormatInt(quota, 10)}
+	case quota == 0 && current != "" && operatorSetQuota(cr):
+		opts.RemoveMetadata = []string{quotaBytesMetadata}
+	}
+	var err error
+	if opts.Metadata != nil || opts.RemoveMetadata != nil {
+		_, err = containers.Update(context.TODO(), client, d.Config.Container, opts).Extract()
+	}
+	util.RecordSetting(cr, defaults.StorageQuotaEnforced, util.SettingInputs(quota), err)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageQuotaEnforced, operatorapi.ConditionFalse, quotaReasonError, fmt.Sprintf("Unable to set the quota of the container: %s", err))
+		return
+	}
+	if opts.Metadata != nil || opts.RemoveMetadata != nil {
+		klog.Infof("quota of container %s has been updated", d.Config.Container)
+	}
+
+	if quota > 0 {
+		util.UpdateCondition(cr, defaults.StorageQuotaEnforced, operatorapi.ConditionTrue, quotaReasonSet, quotaMessage(quota))
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageQuotaEnforced, operatorapi.ConditionFalse, quotaReasonNone, quotaMessage(0))
+}
+
+// StorageQuota returns the number of bytes stored in the container and its
+// quota. A zero quota is returned when the container has none.
+func (d *driver) StorageQuota(ctx context.Context) (int64, int64, error) {
+	client, err := d.getSwiftClient()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	result := containers.Get(ctx, client, d.Config.Container, containers.GetOpts{})
+	header, err := result.Extract()
+	if err != nil {
+		return 0, 0, err
+	}
+	metadata, err := result.ExtractMetadata()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	raw, ok := metadata[quotaBytesMetadata]
+	if !ok {
+		return header.BytesUsed, 0, nil
+	}
+	quota, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to parse the quota %q of the container %s: %w", raw, d.Config.Container, err)
+	}
+	return header.BytesUsed, quota, nil
+}
@@ -1,6 +1,7 @@
 package swift
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
@@ -18,11 +19,14 @@ import (
 	"github.com/gophercloud/gophercloud/v2/pagination"
 	"github.com/gophercloud/utils/v2/openstack/clientconfig"
 	"github.com/goware/urlx"
+	"golang.org/x/time/rate"
 	yamlv2 "gopkg.in/yaml.v2"
 
 	corev1 "k8s.io/api/core/v1"
 	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
 	k8sutilerrors "k8s.io/apimachinery/pkg/util/errors"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
@@ -55,6 +59,13 @@ type driver struct {
 	Config *imageregistryv1.ImageRegistryConfigStorageSwift
 	// Listers are used to download OpenStack credentials from the native secret
 	Listers *regopclient.StorageListers
+	// kubeconfig is used to deploy the temporary URL key of the container
+	kubeconfig *rest.Config
+	// secrets is the client the temporary URL key is deployed with, it is
+	// built from kubeconfig when unset
+	secrets coreset.SecretsGetter
+	// created is set by CreateStorage when it created the container
+	created bool
 }
 
 // replaceEmpty is a helper function to replace empty fields with another field
@@ -67,7 +78,7 @@ func replaceEmpty(a string, b string) string {
 
 // IsSwiftEnabled checks if Swift service is available for OpenStack platform
 func IsSwiftEnabled(listers *regopclient.StorageListers) (bool, error) {
-	driver := NewDriver(&imageregistryv1.ImageRegistryConfigStorageSwift{}, listers)
+	driver := NewDriver(&imageregistryv1.ImageRegistryConfigStorageSwift{}, nil, listers)
 	conn, err := driver.getSwiftClient()
 	if err != nil {
 		if errors.As(err, &ErrContainerEndpointNotFound{}) {
@@ -318,10 +329,11 @@ func (d *driver) getSwiftClient() (*gophercloud.ServiceClient, error) {
 }
 
 // NewDriver creates new Swift driver for the Image Registry
-func NewDriver(c *imageregistryv1.ImageRegistryConfigStorageSwift, listers *regopclient.StorageListers) *driver {
+func NewDriver(c *imageregistryv1.ImageRegistryConfigStorageSwift, kubeconfig *rest.Config, listers *regopclient.StorageListers) *driver {
 	return &driver{
-		Config:  c,
-		Listers: listers,
+		Config:     c,
+		Listers:    listers,
+		kubeconfig: kubeconfig,
 	}
 }
 
@@ -378,6 +390,14 @@ func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_REGION", Value: regionName})
 	}
 
+	key, err := d.registrySecretKey()
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		envs = append(envs, tempURLEnv(key)...)
+	}
+
 	return
 }
 
@@ -444,7 +464,32 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 		return true
 	}
 
-	return false
+	return d.tempURLKeyChanged(cr) || storagePolicyChanged(cr) || quotaChanged(cr)
+}
+
+// Validate checks we are allowed to access the configured container.
+// Containers that don't exist yet are not checked, CreateStorage creates
+// them.
+func (d *driver) Validate(cr *imageregistryv1.Config) error {
+	if len(d.Config.Container) == 0 {
+		return nil
+	}
+
+	client, err := d.getSwiftClient()
+	if err != nil {
+		if gophercloud.ResponseCodeIs(err, http.StatusUnauthorized) || gophercloud.ResponseCodeIs(err, http.StatusForbidden) {
+			return util.PermissionDenied("unable to authenticate against OpenStack: %s", err)
+		}
+		return err
+	}
+
+	err = d.containerExists(client, d.Config.Container)
+	if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return nil
+	} else if gophercloud.ResponseCodeIs(err, http.StatusUnauthorized) || gophercloud.ResponseCodeIs(err, http.StatusForbidden) {
+		return util.PermissionDenied("unable to access container %s: %s", d.Config.Container, err)
+	}
+	return err
 }
 
 func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
@@ -460,50 +505,71 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	}
 
 	generatedName := false
-	const numRetries = 5000
-	for i := 0; i < numRetries; i++ {
-		if len(cr.Spec.Storage.Swift.Container) == 0 {
-			if cr.Spec.Storage.Swift.Container, err = util.GenerateStorageName(d.Listers, ""); err != nil {
-				return err
-			}
-			generatedName = true
+	if len(cr.Spec.Storage.Swift.Container) == 0 {
+		// Generated names are deterministic so a retry after a failed
+		// config update finds the container created by the previous
+		// attempt instead of leaking it.
+		if cr.Spec.Storage.Swift.Container, err = util.GenerateDeterministicStorageName(d.Listers, ""); err != nil {
+			return err
 		}
+		generatedName = true
+	}
 
-		err = d.containerExists(client, cr.Spec.Storage.Swift.Container)
-		if err != nil {
-			// If the error is not ErrResourceNotFound
-			// return the error
-			if !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
-				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Unable to check if container exists", fmt.Sprintf("Error occurred checking if container exists: %v", err))
-				return err
-			}
-			// If the error is ErrResourceNotFound
-			// fall through to the container creation
+	containerExists := true
+	result := containers.Get(context.TODO(), client, cr.Spec.Storage.Swift.Container, containers.GetOpts{})
+	metadata, err := result.ExtractMetadata()
+	if err != nil {
+		// If the error is not ErrResourceNotFound
+		// return the error
+		if !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Unable to check if container exists", fmt.Sprintf("Error occurred checking if container exists: %v", err))
+			return err
 		}
+		// If the error is ErrResourceNotFound
+		// fall through to the container creation
+		containerExists = false
+	} else if !generatedName {
 		// If we were supplied a container name and it exists
 		// we can skip the create
-		if !generatedName && err == nil {
-			if cr.Spec.Storage.ManagementState == "" {
-				cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateUnmanaged
-			}
-			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "Container exists", "User supplied container already exists")
-			cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
-				Swift: d.Config.DeepCopy(),
-			}
-			break
+		if cr.Spec.Storage.ManagementState == "" {
+			cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateUnmanaged
 		}
-		// If we generated a container name and it exists
-		// let's try again
-		if generatedName && err == nil {
-			cr.Spec.Storage.Swift.Container = ""
-			continue
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "Container exists", "User supplied container already exists")
+		if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+			d.reconcileContainer(cr, client, result, infra.Status.InfrastructureName)
 		}
+		cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
+			Swift: d.Config.DeepCopy(),
+		}
+		return nil
+	} else if metadata["Openshiftclusterid"] != infra.Status.InfrastructureName {
+		// We generated a container name that exists but was not
+		// created by this cluster.
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Container Owned By Another Cluster", fmt.Sprintf("The container %s exists, but was created by another cluster", cr.Spec.Storage.Swift.Container))
+		return fmt.Errorf("container %s exists but was created by another cluster", cr.Spec.Storage.Swift.Container)
+	} else {
+		// We created this container in a previous attempt, reuse it.
+		klog.Infof("container %s already owned by us, reusing", cr.Spec.Storage.Swift.Container)
+	}
 
+	var tempURLKey string
+	if !containerExists {
+		// the registry redirects clients to Swift with temporary URLs
+		// signed with the key of the container.
+		tempURLKey, err = generateTempURLKey()
+		if err != nil {
+			return err
+		}
 		createOps := containers.CreateOpts{
 			Metadata: map[string]string{
 				"Openshiftclusterid": infra.Status.InfrastructureName,
 				"Name":               cr.Spec.Storage.Swift.Container,
 			},
+			TempURLKey:    tempURLKey,
+			StoragePolicy: requestedStoragePolicy(cr),
+		}
+		if quota := requestedQuotaBytes(cr); quota > 0 {
+			createOps.Metadata[quotaBytesMetadata] = strconv.FormatInt(quota, 10)
 		}
 
 		_, err = containers.Create(context.TODO(), client, cr.Spec.Storage.Swift.Container, createOps).Extract()
@@ -511,19 +577,23 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Creation Failed", err.Error())
 			return err
 		}
+		d.created = true
+	}
 
-		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "Swift Container Created", "")
+	util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "Swift Container Created", "")
 
-		if cr.Spec.Storage.ManagementState == "" {
-			cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
-		}
-		cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
-			Swift: d.Config.DeepCopy(),
-		}
-		cr.Spec.Storage.Swift = d.Config.DeepCopy()
-
-		break
+	if cr.Spec.Storage.ManagementState == "" {
+		cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
+	}
+	if !containerExists {
+		d.containerCreated(cr, tempURLKey)
+	} else if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		d.reconcileContainer(cr, client, result, infra.Status.InfrastructureName)
 	}
+	cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
+		Swift: d.Config.DeepCopy(),
+	}
+	cr.Spec.Storage.Swift = d.Config.DeepCopy()
 
 	return nil
 }
@@ -600,6 +670,80 @@ func (d *driver) VolumeSecrets() (map[string]string, error) {
 	return nil, nil
 }
 
+// StorageUsage returns the number of bytes and objects stored by the registry
+// in the container. The whole container is accounted for as the segments of
+// large objects are kept outside of the registry root. The limiter is waited
+// on before every listing request.
+func (d *driver) StorageUsage(ctx context.Context, limiter *rate.Limiter) (int64, int64, error) {
+	client, err := d.getSwiftClient()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := limiter.Wait(ctx); err != nil {
+		return 0, 0, err
+	}
+	var size, count int64
+	err = objects.List(client, d.Config.Container, objects.ListOpts{}).EachPage(ctx, func(ctx context.Context, page pagination.Page) (bool, error) {
+		infos, err := objects.ExtractInfo(page)
+		if err != nil {
+			return false, err
+		}
+		for _, info := range infos {
+			size += info.Bytes
+			count++
+		}
+		// the next page is only requested once we are allowed to.
+		return true, limiter.Wait(ctx)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return size, count, nil
+}
+
+// PutObject writes data into key. It is used to probe the container.
+func (d *driver) PutObject(ctx context.Context, key string, data []byte) error {
+	client, err := d.getSwiftClient()
+	if err != nil {
+		return err
+	}
+	_, err = objects.Create(ctx, client, d.Config.Container, key, objects.CreateOpts{
+		Content: bytes.NewReader(data),
+	}).Extract()
+	return err
+}
+
+// GetObject reads the content of key. It is used to probe the container.
+func (d *driver) GetObject(ctx context.Context, key string) ([]byte, error) {
+	client, err := d.getSwiftClient()
+	if err != nil {
+		return nil, err
+	}
+	result := objects.Download(ctx, client, d.Config.Container, key, nil)
+	content, err := result.ExtractContent()
+	if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return nil, util.ObjectNotFound(key, err)
+	}
+	return content, err
+}
+
+// DeleteObject removes key. It is used to probe the container.
+func (d *driver) DeleteObject(ctx context.Context, key string) error {
+	client, err := d.getSwiftClient()
+	if err != nil {
+		return err
+	}
+	_, err = objects.Delete(ctx, client, d.Config.Container, key, nil).Extract()
+	return err
+}
+
+// StorageCreated tells whether CreateStorage created the container, rather
+// than reusing one it created before.
+func (d *driver) StorageCreated() bool {
+	return d.created
+}
+
 // ID return the underlying storage identificator, on this case the Swift
 // container name.
 func (d *driver) ID() string {
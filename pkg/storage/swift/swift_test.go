@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
@@ -18,6 +19,8 @@ import (
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
 
 	configv1 "github.com/openshift/api/config/v1"
@@ -26,6 +29,8 @@ import (
 	configlisters "github.com/openshift/client-go/config/listers/config/v1"
 
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 const (
@@ -296,13 +301,15 @@ func mockConfig(
 		Tenant:    tenant,
 	}
 
+	secrets := fake.NewSimpleClientset().CoreV1()
 	d := driver{
 		Listers: &regopclient.StorageListers{
-			Secrets:         secretLister,
+			Secrets:         privateConfigSecretLister{MockSecretNamespaceLister: secretLister, secrets: secrets},
 			Infrastructures: fakeInfrastructureLister(cloudName),
 			OpenShiftConfig: MockConfigMapNamespaceLister{},
 		},
-		Config: &config,
+		Config:  &config,
+		secrets: secrets,
 	}
 
 	ic := imageregistryv1.Config{
@@ -461,6 +468,86 @@ func TestSwiftCreateStorageNativeSecret(t *testing.T) {
 	th.AssertEquals(t, container, installConfig.Status.Storage.Swift.Container)
 }
 
+func TestSwiftCreateStorageDeterministicNaming(t *testing.T) {
+	expectedContainer := "user-j45xj-" + defaults.ImageRegistryName
+
+	for _, tt := range []struct {
+		name      string
+		clusterID string
+		exists    bool
+		err       string
+	}{
+		{
+			name: "container created",
+		},
+		{
+			name:      "container already owned by us (retry after conflict)",
+			exists:    true,
+			clusterID: "user-j45xj",
+		},
+		{
+			name:      "container created by another cluster",
+			exists:    true,
+			clusterID: "other-abcde",
+			err:       "created by another cluster",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+			handleAuthentication(t, "container")
+
+			var created bool
+			var tempURLKey string
+			th.Mux.HandleFunc("/"+expectedContainer, func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case "HEAD":
+					if !tt.exists {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					w.Header().Set("X-Container-Meta-Openshiftclusterid", tt.clusterID)
+					w.WriteHeader(http.StatusNoContent)
+				case "PUT":
+					created = true
+					tempURLKey = r.Header.Get("X-Container-Meta-Temp-URL-Key")
+					w.WriteHeader(http.StatusCreated)
+				case "POST":
+					// the container reused has no temporary URL key yet.
+					tempURLKey = r.Header.Get("X-Container-Meta-Temp-URL-Key")
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					t.Errorf("unexpected %s request", r.Method)
+				}
+			})
+
+			// the first attempt generates the name, the config update is
+			// lost and the retry starts over from an empty container name.
+			d, installConfig := mockConfig(false, th.Endpoint()+"v3", MockUPISecretNamespaceLister{}, false)
+			installConfig.Spec.Storage.Swift.Container = ""
+
+			err := d.CreateStorage(&installConfig)
+			if len(tt.err) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error to be %q, %v received instead", tt.err, err)
+				}
+				return
+			}
+			th.AssertNoErr(t, err)
+			th.AssertEquals(t, !tt.exists, created)
+			th.AssertEquals(t, imageregistryv1.StorageManagementStateManaged, installConfig.Spec.Storage.ManagementState)
+			th.AssertEquals(t, expectedContainer, installConfig.Spec.Storage.Swift.Container)
+			th.AssertEquals(t, expectedContainer, installConfig.Status.Storage.Swift.Container)
+			if len(tempURLKey) != 64 {
+				t.Errorf("expected a temporary URL key to be set on the container, got %q", tempURLKey)
+			}
+			deployed, err := d.deployedSecretKey()
+			th.AssertNoErr(t, err)
+			th.AssertEquals(t, tempURLKey, deployed)
+		})
+	}
+}
+
 func TestSwiftRemoveStorageWithContent(t *testing.T) {
 	th.SetupHTTP()
 	defer th.TeardownHTTP()
@@ -937,6 +1024,40 @@ func TestSwiftStorageExistsCloudConfig(t *testing.T) {
 	th.AssertEquals(t, true, res)
 }
 
+func TestSwiftValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		statusCode       int
+		permissionDenied bool
+	}{
+		{name: "container accessible", statusCode: http.StatusNoContent},
+		{name: "container does not exist", statusCode: http.StatusNotFound},
+		{name: "container not accessible", statusCode: http.StatusForbidden, permissionDenied: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+			handleAuthentication(t, "container")
+
+			th.Mux.HandleFunc("/"+container, func(w http.ResponseWriter, r *http.Request) {
+				th.TestMethod(t, r, "HEAD")
+				w.WriteHeader(tc.statusCode)
+			})
+
+			d, installConfig := mockConfig(false, th.Endpoint()+"v3", MockUPISecretNamespaceLister{}, false)
+
+			err := d.Validate(&installConfig)
+			if tc.permissionDenied {
+				if !errors.Is(err, util.ErrPermissionDenied) {
+					t.Errorf("expected a permission denied error, got %v", err)
+				}
+				return
+			}
+			th.AssertNoErr(t, err)
+		})
+	}
+}
+
 func TestSwiftConfigEnvCloudConfig(t *testing.T) {
 	fakeCloudsYAMLData := []byte(`clouds:
   ` + cloudName + `:
@@ -1318,3 +1439,289 @@ func TestConfigStatusUpdate(t *testing.T) {
 		spew.Dump(status)
 	}
 }
+
+// privateConfigSecretLister gets the registry private configuration from
+// the client the driver deploys the temporary URL key with.
+type privateConfigSecretLister struct {
+	MockSecretNamespaceLister
+	secrets coreset.SecretsGetter
+}
+
+func (m privateConfigSecretLister) Get(name string) (*corev1.Secret, error) {
+	if name == defaults.ImageRegistryPrivateConfiguration {
+		return m.secrets.Secrets(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), name, metav1.GetOptions{})
+	}
+	return m.MockSecretNamespaceLister.Get(name)
+}
+
+func TestSwiftTempURLKeyRotation(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+	handleAuthentication(t, "container")
+
+	clusterID := "user-j45xj"
+	keys := map[string]string{"Temp-Url-Key": "first"}
+	requests := 0
+	th.Mux.HandleFunc("/"+container, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.Method {
+		case "HEAD":
+			w.Header().Set("X-Container-Meta-Openshiftclusterid", clusterID)
+			for name, value := range keys {
+				w.Header().Set("X-Container-Meta-"+name, value)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case "POST":
+			for _, name := range []string{"Temp-Url-Key", "Temp-Url-Key-2"} {
+				if value := r.Header.Get("X-Container-Meta-" + name); value != "" {
+					keys[name] = value
+				}
+				if r.Header.Get("X-Remove-Container-Meta-"+name) != "" {
+					delete(keys, name)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected %s request", r.Method)
+		}
+	})
+
+	secrets := fake.NewSimpleClientset().CoreV1()
+	newDriver := func() (driver, imageregistryv1.Config) {
+		d, cr := mockConfig(false, th.Endpoint()+"v3", MockUPISecretNamespaceLister{}, true)
+		d.Listers.Secrets = privateConfigSecretLister{MockSecretNamespaceLister: MockUPISecretNamespaceLister{}, secrets: secrets}
+		d.secrets = secrets
+		return d, cr
+	}
+	secretKey := func(d driver) string {
+		before := requests
+		envs, err := d.ConfigEnv()
+		th.AssertNoErr(t, err)
+		if requests != before {
+			t.Errorf("expected ConfigEnv not to send requests to Swift, got %d", requests-before)
+		}
+		for _, e := range envs {
+			if e.Name == "REGISTRY_STORAGE_SWIFT_SECRETKEY" {
+				return e.Value.(string)
+			}
+		}
+		return ""
+	}
+
+	// the keys of the container are only known once CreateStorage checked
+	// them and deployed the one the registry is to use.
+	d, cr := newDriver()
+	th.AssertEquals(t, "", secretKey(d))
+	th.AssertEquals(t, true, d.StorageChanged(&cr))
+	th.AssertNoErr(t, d.CreateStorage(&cr))
+	th.AssertEquals(t, false, d.StorageChanged(&cr))
+	th.AssertEquals(t, "first", secretKey(d))
+	other, _ := newDriver()
+	th.AssertEquals(t, "first", secretKey(other))
+
+	// the rotation starts with a new key, the previous one is kept
+	// until the registry is rolled out.
+	name, err := d.StandbyKey(context.Background())
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "Temp-URL-Key", name)
+	param, err := d.RegenerateKey(context.Background(), name)
+	th.AssertNoErr(t, err)
+	second := keys["Temp-Url-Key"]
+	th.AssertEquals(t, second, param.Value)
+	th.AssertEquals(t, "first", keys["Temp-Url-Key-2"])
+	th.AssertEquals(t, "first", secretKey(d))
+	th.AssertEquals(t, false, d.StorageChanged(&cr))
+
+	// the registry is switched to the new key, CreateStorage keeps it.
+	sec, err := secrets.Secrets(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), defaults.ImageRegistryPrivateConfiguration, metav1.GetOptions{})
+	th.AssertNoErr(t, err)
+	value, err := param.EnvValue()
+	th.AssertNoErr(t, err)
+	sec.Data[param.Name] = []byte(value)
+	_, err = secrets.Secrets(defaults.ImageRegistryOperatorNamespace).Update(context.Background(), sec, metav1.UpdateOptions{})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, true, d.StorageChanged(&cr))
+	th.AssertNoErr(t, d.CreateStorage(&cr))
+	th.AssertEquals(t, false, d.StorageChanged(&cr))
+	th.AssertEquals(t, second, secretKey(d))
+
+	// once switched to the new key, the previous one is retired.
+	name, err = d.StandbyKey(context.Background())
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "Temp-URL-Key-2", name)
+	param, err = d.RegenerateKey(context.Background(), name)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, second, param.Value)
+	th.AssertDeepEquals(t, map[string]string{"Temp-Url-Key": second}, keys)
+
+	// the keys of containers created by someone else are left alone, and
+	// not used by the registry.
+	clusterID = "other-abcde"
+	name, err = d.StandbyKey(context.Background())
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "", name)
+	th.AssertNoErr(t, d.CreateStorage(&cr))
+	th.AssertEquals(t, "", secretKey(d))
+	th.AssertDeepEquals(t, map[string]string{"Temp-Url-Key": second}, keys)
+}
+
+func TestSwiftContainerQuotaAndStoragePolicy(t *testing.T) {
+	for _, tt := range []struct {
+		name              string
+		exists            bool
+		policy            string
+		metadata          map[string]string
+		annotations       map[string]string
+		quotaReason       string
+		updateStatus      int
+		expectedPolicy    string
+		expectedQuota     string
+		expectedRemoved   bool
+		expectedPolicyCnd operatorapi.ConditionStatus
+		expectedQuotaCnd  operatorapi.ConditionStatus
+	}{
+		{
+			name: "container created with a storage policy and a quota",
+			annotations: map[string]string{
+				defaults.SwiftStoragePolicyAnnotation: "gold",
+				defaults.SwiftQuotaAnnotation:         "1Gi",
+			},
+			expectedPolicy:    "gold",
+			expectedQuota:     "1073741824",
+			expectedPolicyCnd: operatorapi.ConditionTrue,
+			expectedQuotaCnd:  operatorapi.ConditionTrue,
+		},
+		{
+			name:              "container created with the defaults",
+			expectedPolicyCnd: operatorapi.ConditionTrue,
+			expectedQuotaCnd:  operatorapi.ConditionFalse,
+		},
+		{
+			name:   "quota set on an existing container",
+			exists: true,
+			policy: "gold",
+			annotations: map[string]string{
+				defaults.SwiftStoragePolicyAnnotation: "gold",
+				defaults.SwiftQuotaAnnotation:         "500Mi",
+			},
+			expectedQuota:     "524288000",
+			expectedPolicyCnd: operatorapi.ConditionTrue,
+			expectedQuotaCnd:  operatorapi.ConditionTrue,
+		},
+		{
+			name:   "storage policy of an existing container mismatches",
+			exists: true,
+			policy: "silver",
+			annotations: map[string]string{
+				defaults.SwiftStoragePolicyAnnotation: "gold",
+			},
+			expectedPolicyCnd: operatorapi.ConditionFalse,
+			expectedQuotaCnd:  operatorapi.ConditionFalse,
+		},
+		{
+			name:              "quota set by the operator is removed",
+			exists:            true,
+			metadata:          map[string]string{"Quota-Bytes": "1024"},
+			quotaReason:       "QuotaSet",
+			expectedRemoved:   true,
+			expectedPolicyCnd: operatorapi.ConditionTrue,
+			expectedQuotaCnd:  operatorapi.ConditionFalse,
+		},
+		{
+			name:         "quota can't be set",
+			exists:       true,
+			annotations:  map[string]string{defaults.SwiftQuotaAnnotation: "1Gi"},
+			updateStatus: http.StatusForbidden,
+			// the request is retried after a while, not on every
+			// reconcile.
+			expectedQuota:     "1073741824",
+			expectedPolicyCnd: operatorapi.ConditionTrue,
+			expectedQuotaCnd:  operatorapi.ConditionFalse,
+		},
+		{
+			name:              "quota set by someone else is kept",
+			exists:            true,
+			metadata:          map[string]string{"Quota-Bytes": "1024"},
+			expectedPolicyCnd: operatorapi.ConditionTrue,
+			expectedQuotaCnd:  operatorapi.ConditionFalse,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+			handleAuthentication(t, "container")
+
+			var policy, quota string
+			var removed bool
+			th.Mux.HandleFunc("/"+container, func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case "HEAD":
+					if !tt.exists {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					w.Header().Set("X-Container-Meta-Openshiftclusterid", "user-j45xj")
+					w.Header().Set("X-Container-Meta-Temp-Url-Key", "key")
+					w.Header().Set("X-Storage-Policy", tt.policy)
+					for name, value := range tt.metadata {
+						w.Header().Set("X-Container-Meta-"+name, value)
+					}
+					w.WriteHeader(http.StatusNoContent)
+				case "PUT":
+					policy = r.Header.Get("X-Storage-Policy")
+					quota = r.Header.Get("X-Container-Meta-Quota-Bytes")
+					w.WriteHeader(http.StatusCreated)
+				case "POST":
+					quota = r.Header.Get("X-Container-Meta-Quota-Bytes")
+					removed = r.Header.Get("X-Remove-Container-Meta-Quota-Bytes") != ""
+					if tt.updateStatus != 0 {
+						w.WriteHeader(tt.updateStatus)
+						return
+					}
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					t.Errorf("unexpected %s request", r.Method)
+				}
+			})
+
+			d, installConfig := mockConfig(false, th.Endpoint()+"v3", MockUPISecretNamespaceLister{}, true)
+			installConfig.Annotations = tt.annotations
+			if tt.quotaReason != "" {
+				util.UpdateCondition(&installConfig, defaults.StorageQuotaEnforced, operatorapi.ConditionTrue, tt.quotaReason, "The container is capped at 1Ki")
+				util.RecordSetting(&installConfig, defaults.StorageQuotaEnforced, util.SettingInputs(int64(1024)), nil)
+			}
+			if !d.StorageChanged(&installConfig) {
+				t.Errorf("expected the storage to be reported as changed")
+			}
+
+			th.AssertNoErr(t, d.CreateStorage(&installConfig))
+			th.AssertEquals(t, tt.expectedPolicy, policy)
+			th.AssertEquals(t, tt.expectedQuota, quota)
+			th.AssertEquals(t, tt.expectedRemoved, removed)
+			th.AssertEquals(t, tt.expectedPolicyCnd, util.FetchCondition(&installConfig, defaults.StoragePlacementPolicyApplied).Status)
+			th.AssertEquals(t, tt.expectedQuotaCnd, util.FetchCondition(&installConfig, defaults.StorageQuotaEnforced).Status)
+			if d.StorageChanged(&installConfig) {
+				t.Errorf("expected the storage to be reconciled")
+			}
+		})
+	}
+}
+
+func TestSwiftStorageQuota(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+	handleAuthentication(t, "container")
+
+	th.Mux.HandleFunc("/"+container, func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "HEAD")
+		w.Header().Set("X-Container-Bytes-Used", "900")
+		w.Header().Set("X-Container-Meta-Quota-Bytes", "1000")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	d, _ := mockConfig(false, th.Endpoint()+"v3", MockUPISecretNamespaceLister{}, true)
+	used, quota, err := d.StorageQuota(context.Background())
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, int64(900), used)
+	th.AssertEquals(t, int64(1000), quota)
+}
@@ -0,0 +1,364 @@
+package swift
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/objectstorage/v1/containers"
+	yamlv2 "gopkg.in/yaml.v2"
+
+	corev1 "k8s.io/api/core/v1"
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	// secretKeyEnvName is the registry configuration parameter holding the
+	// key the registry signs temporary URLs with.
+	secretKeyEnvName = "REGISTRY_STORAGE_SWIFT_SECRETKEY"
+
+	// tempURLKeyName and tempURLKey2Name are the two temporary URL keys of
+	// a container. Swift accepts the URLs signed with either of them. The
+	// registry keeps the key it is configured with in the first one, so
+	// the second one is where the previous key is kept while a rotation
+	// rolls out.
+	tempURLKeyName  = "Temp-URL-Key"
+	tempURLKey2Name = "Temp-URL-Key-2"
+
+	tempURLKeyReasonSet      = "TempURLKeySet"
+	tempURLKeyReasonNotOwned = "NotOwned"
+	tempURLKeyReasonError    = "TempURLKeyError"
+)
+
+// tempURLMethods are the methods the registry redirects clients to Swift
+// for.
+var tempURLMethods = []string{"GET", "HEAD"}
+
+// generateTempURLKey returns a new random temporary URL key.
+func generateTempURLKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("unable to generate a temporary URL key: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// tempURLKeys are the temporary URL keys of the container.
+type tempURLKeys struct {
+	key  string
+	key2 string
+	// owned tells whether the container was created by this cluster.
+	// Keys are only managed on the containers the operator created, the
+	// keys of other containers may be relied on by someone else.
+	owned bool
+}
+
+// getTempURLKeys returns the temporary URL keys of the container.
+func (d *driver) getTempURLKeys(ctx context.Context, client *gophercloud.ServiceClient) (tempURLKeys, error) {
+	infra, err := util.GetInfrastructure(d.Listers.Infrastructures)
+	if err != nil {
+		return tempURLKeys{}, fmt.Errorf("failed to get cluster infrastructure info: %w", err)
+	}
+
+	result := containers.Get(ctx, client, d.Config.Container, containers.GetOpts{})
+	header, err := result.Extract()
+	if err != nil {
+		return tempURLKeys{}, err
+	}
+	metadata, err := result.ExtractMetadata()
+	if err != nil {
+		return tempURLKeys{}, err
+	}
+	return tempURLKeys{
+		key:   header.TempURLKey,
+		key2:  header.TempURLKey2,
+		owned: metadata["Openshiftclusterid"] == infra.Status.InfrastructureName,
+	}, nil
+}
+
+// deployedSecretKey returns the temporary URL key the registry is
+// configured with in its private configuration, if any.
+func (d *driver) deployedSecretKey() (string, error) {
+	sec, err := d.Listers.Secrets.Get(defaults.ImageRegistryPrivateConfiguration)
+	if apimachineryerrors.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("unable to get the registry private configuration: %w", err)
+	}
+	data, ok := sec.Data[secretKeyEnvName]
+	if !ok {
+		return "", nil
+	}
+	// the parameters of the private configuration are YAML encoded.
+	var key string
+	if err := yamlv2.Unmarshal(data, &key); err != nil {
+		return "", fmt.Errorf("unable to decode %s of the registry private configuration: %w", secretKeyEnvName, err)
+	}
+	return key, nil
+}
+
+// deployTempURLKey sets the temporary URL key the registry signs temporary
+// URLs with in the registry private configuration, where ConfigEnv picks it
+// up from. The key is removed when empty.
+func (d *driver) deployTempURLKey(key string) error {
+	if d.secrets == nil {
+		if d.kubeconfig == nil {
+			return fmt.Errorf("unable to deploy the temporary URL key: no client configuration")
+		}
+		client, err := coreset.NewForConfig(d.kubeconfig)
+		if err != nil {
+			return err
+		}
+		d.secrets = client
+	}
+	client := d.secrets.Secrets(defaults.ImageRegistryOperatorNamespace)
+
+	value, err := tempURLEnv(key)[0].EnvValue()
+	if err != nil {
+		return err
+	}
+
+	sec, err := client.Get(context.TODO(), defaults.ImageRegistryPrivateConfiguration, metav1.GetOptions{})
+	if apimachineryerrors.IsNotFound(err) {
+		if key == "" {
+			return nil
+		}
+		_, err = client.Create(context.TODO(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      defaults.ImageRegistryPrivateConfiguration,
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+			},
+			Data: map[string][]byte{secretKeyEnvName: []byte(value)},
+		}, metav1.CreateOptions{})
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	current, ok := sec.Data[secretKeyEnvName]
+	if (key == "" && !ok) || (key != "" && string(current) == value) {
+		return nil
+	}
+	if sec.Data == nil {
+		sec.Data = map[string][]byte{}
+	}
+	if key == "" {
+		delete(sec.Data, secretKeyEnvName)
+	} else {
+		sec.Data[secretKeyEnvName] = []byte(value)
+	}
+	_, err = client.Update(context.TODO(), sec, metav1.UpdateOptions{})
+	return err
+}
+
+// registrySecretKey returns the temporary URL key the registry is to sign
+// temporary URLs with, as deployed by CreateStorage or a key rotation. No key
+// is returned until CreateStorage deployed one, nor for containers whose keys
+// the operator doesn't manage: the registry then doesn't redirect clients.
+func (d *driver) registrySecretKey() (string, error) {
+	if d.Config.Container == "" {
+		return "", nil
+	}
+	return d.deployedSecretKey()
+}
+
+// tempURLEnv returns the registry configuration parameters signing
+// temporary URLs with the key.
+func tempURLEnv(key string) envvar.List {
+	return envvar.List{
+		{Name: secretKeyEnvName, Value: key, Secret: true},
+		{Name: "REGISTRY_STORAGE_SWIFT_TEMPURLCONTAINERKEY", Value: true},
+		{Name: "REGISTRY_STORAGE_SWIFT_TEMPURLMETHODS", Value: tempURLMethods},
+	}
+}
+
+func tempURLKeyMessage() string {
+	return "The container has a key the registry signs temporary URLs with"
+}
+
+// tempURLKeyInputs returns the fingerprint of the temporary URL key deployed
+// for the container.
+func tempURLKeyInputs(container, key string) string {
+	return util.SettingInputs(container, key)
+}
+
+// tempURLKeyChanged tells whether the temporary URL key of the container the
+// operator should manage is to be checked: it was never checked, the
+// deployed key is not the one CreateStorage last checked, as when a key
+// rotation switched the registry to another key, or setting the key failed
+// and is due for a retry.
+func (d *driver) tempURLKeyChanged(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged || cr.Spec.Storage.Swift == nil {
+		return false
+	}
+	deployed, err := d.deployedSecretKey()
+	if err != nil {
+		klog.Errorf("unable to get the deployed temporary URL key: %s", err)
+		return true
+	}
+	// settings never recorded are taken as changed, the key of existing
+	// containers is checked once.
+	return util.SettingChanged(cr, defaults.StorageTempURLKeyConfigured, tempURLKeyInputs(cr.Spec.Storage.Swift.Container, deployed), "")
+}
+
+// tempURLKeyDeployed reports through the StorageTempURLKeyConfigured
+// condition the key deployed for the container, or the error deploying it.
+func (d *driver) tempURLKeyDeployed(cr *imageregistryv1.Config, deployed string, err error) {
+	util.RecordSetting(cr, defaults.StorageTempURLKeyConfigured, tempURLKeyInputs(d.Config.Container, deployed), err)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageTempURLKeyConfigured, operatorapi.ConditionFalse, tempURLKeyReasonError, fmt.Sprintf("Unable to set the temporary URL key of the container: %s", err))
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageTempURLKeyConfigured, operatorapi.ConditionTrue, tempURLKeyReasonSet, tempURLKeyMessage())
+}
+
+// reconcileTempURLKey sets a temporary URL key on the container unless it
+// already has one, deploys the key the registry is to sign temporary URLs
+// with, and reports it through the StorageTempURLKeyConfigured condition.
+// The key the registry is configured with is kept while it is a key of the
+// container, so that the registry sticks to the key a rotation switched it
+// to. The metadata is the one of the container, keys are only managed if the
+// container was created by this cluster.
+func (d *driver) reconcileTempURLKey(cr *imageregistryv1.Config, client *gophercloud.ServiceClient, metadata map[string]string, infraName string) {
+	deployed, err := d.deployedSecretKey()
+	if err != nil {
+		d.tempURLKeyDeployed(cr, deployed, err)
+		return
+	}
+
+	if metadata["Openshiftclusterid"] != infraName {
+		// the key deployed for another container would only sign
+		// URLs this one doesn't accept.
+		if err := d.deployTempURLKey(""); err != nil {
+			d.tempURLKeyDeployed(cr, deployed, err)
+			return
+		}
+		util.UpdateCondition(cr, defaults.StorageTempURLKeyConfigured, operatorapi.ConditionFalse, tempURLKeyReasonNotOwned, "Temporary URL keys are only set on the containers created by the operator")
+		util.RecordSetting(cr, defaults.StorageTempURLKeyConfigured, tempURLKeyInputs(d.Config.Container, ""), nil)
+		return
+	}
+
+	// the metadata keys are canonicalized as HTTP headers are.
+	key := metadata["Temp-Url-Key"]
+	switch {
+	case deployed != "" && (deployed == key || deployed == metadata["Temp-Url-Key-2"]):
+		key = deployed
+	case key == "":
+		key, err = generateTempURLKey()
+		if err == nil {
+			_, err = containers.Update(context.TODO(), client, d.Config.Container, containers.UpdateOpts{TempURLKey: key}).Extract()
+		}
+		if err != nil {
+			d.tempURLKeyDeployed(cr, deployed, err)
+			return
+		}
+		klog.Infof("temporary URL key of container %s has been set", d.Config.Container)
+	}
+	if err := d.deployTempURLKey(key); err != nil {
+		d.tempURLKeyDeployed(cr, deployed, err)
+		return
+	}
+	d.tempURLKeyDeployed(cr, key, nil)
+}
+
+// keyRotationClient returns the client managing the temporary URL keys of
+// the container. No client is returned when the container has no key the
+// operator manages.
+func (d *driver) keyRotationClient(ctx context.Context) (*gophercloud.ServiceClient, tempURLKeys, error) {
+	if d.Config.Container == "" {
+		return nil, tempURLKeys{}, nil
+	}
+	client, err := d.getSwiftClient()
+	if err != nil {
+		return nil, tempURLKeys{}, err
+	}
+	keys, err := d.getTempURLKeys(ctx, client)
+	if err != nil {
+		return nil, tempURLKeys{}, err
+	}
+	if !keys.owned || keys.key == "" {
+		return nil, tempURLKeys{}, nil
+	}
+	return client, keys, nil
+}
+
+// StandbyKey returns the name of the temporary URL key to regenerate next.
+// The registry keeps the key it is configured with in Temp-URL-Key: to start
+// a rotation, Temp-URL-Key is regenerated and its previous value moved to
+// Temp-URL-Key-2. Once the registry is switched to the new key, the previous
+// one in Temp-URL-Key-2 is the standby key.
+func (d *driver) StandbyKey(ctx context.Context) (string, error) {
+	_, keys, err := d.keyRotationClient(ctx)
+	if err != nil || keys.key == "" {
+		return "", err
+	}
+
+	deployed, err := d.deployedSecretKey()
+	if err != nil {
+		return "", err
+	}
+	if keys.key2 != "" && deployed == keys.key {
+		return tempURLKey2Name, nil
+	}
+	return tempURLKeyName, nil
+}
+
+// RegenerateKey regenerates the named temporary URL key of the container and
+// returns the registry configuration parameter switching the registry to the
+// key it is to sign temporary URLs with. Temp-URL-Key-2 is not regenerated
+// but removed, the URLs signed with the previous key are then no longer
+// accepted.
+func (d *driver) RegenerateKey(ctx context.Context, name string) (envvar.EnvVar, error) {
+	client, keys, err := d.keyRotationClient(ctx)
+	if err != nil {
+		return envvar.EnvVar{}, err
+	}
+	if client == nil {
+		return envvar.EnvVar{}, fmt.Errorf("the container %s has no temporary URL key managed by the operator", d.Config.Container)
+	}
+
+	switch name {
+	case tempURLKeyName:
+		deployed, err := d.deployedSecretKey()
+		if err != nil {
+			return envvar.EnvVar{}, err
+		}
+		// the previous key is the one the registry signs temporary
+		// URLs with until it is rolled out with the new key.
+		previous := keys.key
+		if deployed != "" && deployed == keys.key2 {
+			previous = keys.key2
+		}
+		key, err := generateTempURLKey()
+		if err != nil {
+			return envvar.EnvVar{}, err
+		}
+		opts := containers.UpdateOpts{TempURLKey: key, TempURLKey2: previous}
+		if _, err := containers.Update(ctx, client, d.Config.Container, opts).Extract(); err != nil {
+			return envvar.EnvVar{}, err
+		}
+		klog.Infof("temporary URL key %s of container %s has been regenerated", name, d.Config.Container)
+		return tempURLEnv(key)[0], nil
+	case tempURLKey2Name:
+		opts := containers.UpdateOpts{RemoveMetadata: []string{tempURLKey2Name}}
+		if _, err := containers.Update(ctx, client, d.Config.Container, opts).Extract(); err != nil {
+			return envvar.EnvVar{}, err
+		}
+		klog.Infof("temporary URL key %s of container %s has been removed", name, d.Config.Container)
+		return tempURLEnv(keys.key)[0], nil
+	default:
+		return envvar.EnvVar{}, fmt.Errorf("unknown temporary URL key %s", name)
+	}
+}
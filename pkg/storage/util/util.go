@@ -1,13 +1,18 @@
 package util
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
 	"regexp"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
 
 	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
@@ -24,6 +29,62 @@ const TestFeatureGateName = "TestFeatureGate"
 // multiDashes is a regexp matching multiple dashes in a sequence.
 var multiDashes = regexp.MustCompile(`-{2,}`)
 
+// ErrPermissionDenied is wrapped by the errors returned by the drivers
+// Validate method when the storage credentials lack a permission the
+// operator needs.
+var ErrPermissionDenied = errors.New("permission denied")
+
+// ErrObjectNotFound is wrapped by the errors returned when reading an object
+// that does not exist.
+var ErrObjectNotFound = errors.New("object not found")
+
+// PermissionDenied returns an error wrapping ErrPermissionDenied.
+func PermissionDenied(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrPermissionDenied, fmt.Sprintf(format, a...))
+}
+
+// ObjectNotFound returns an error wrapping ErrObjectNotFound.
+func ObjectNotFound(key string, err error) error {
+	return fmt.Errorf("%w: %s: %s", ErrObjectNotFound, key, err)
+}
+
+// CanaryPrefix is where the operator writes the objects it uses to probe the
+// storage. It lives next to the registry content, not under it, so the
+// registry never sees them.
+const CanaryPrefix = "openshift-image-registry-operator/"
+
+// OwnershipMarkerKey is the object, at the root of the storage, that records
+// which cluster the storage belongs to.
+const OwnershipMarkerKey = "openshift-image-registry-owner.json"
+
+// IsOperatorObject tells whether key is one of the objects the operator
+// writes into the storage for its own use: the ownership marker and the
+// canary objects. A storage medium holding nothing else has no data worth
+// keeping.
+func IsOperatorObject(key string) bool {
+	return key == OwnershipMarkerKey || strings.HasPrefix(key, CanaryPrefix)
+}
+
+// OwnedStorage is a storage medium, a bucket or a container, created by the
+// operator for the cluster.
+type OwnedStorage struct {
+	Name    string
+	Created time.Time
+}
+
+// ReplicationStatus is the replication status of an object written to a
+// storage medium replicated to another location.
+type ReplicationStatus string
+
+const (
+	// ReplicationUnknown is the status of an object that does not exist,
+	// or that is not replicated.
+	ReplicationUnknown   ReplicationStatus = ""
+	ReplicationPending   ReplicationStatus = "Pending"
+	ReplicationCompleted ReplicationStatus = "Completed"
+	ReplicationFailed    ReplicationStatus = "Failed"
+)
+
 // UpdateCondition will update or add the provided condition.
 func UpdateCondition(cr *imageregistryv1.Config, conditionType string, status operatorapi.ConditionStatus, reason string, message string) {
 	found := false
@@ -63,13 +124,112 @@ func UpdateCondition(cr *imageregistryv1.Config, conditionType string, status op
 }
 
 // FetchCondition will return the provided condition.
-func FetchCondition(cr *imageregistryv1.Config, conditionType string) (c operatorapi.OperatorCondition) {
-	for _, c = range cr.Status.Conditions {
+func FetchCondition(cr *imageregistryv1.Config, conditionType string) operatorapi.OperatorCondition {
+	for _, c := range cr.Status.Conditions {
 		if conditionType == c.Type {
 			return c
 		}
 	}
-	return
+	return operatorapi.OperatorCondition{}
+}
+
+// SettingRetryInterval is how long a storage setting that could not be
+// applied is left alone before CreateStorage applies it again, unless the
+// inputs it is applied from change in the meantime.
+const SettingRetryInterval = 10 * time.Minute
+
+// appliedSetting is the record of the last time a storage setting was
+// applied: the fingerprint of its inputs, and when it failed if it did.
+type appliedSetting struct {
+	Inputs string        `json:"inputs"`
+	Failed *metaapi.Time `json:"failed,omitempty"`
+}
+
+func appliedSettings(cr *imageregistryv1.Config) map[string]appliedSetting {
+	settings := map[string]appliedSetting{}
+	raw, ok := cr.Annotations[defaults.StorageSettingsAnnotation]
+	if !ok {
+		return settings
+	}
+	if err := json.Unmarshal([]byte(raw), &settings); err != nil {
+		klog.Warningf("ignoring invalid %s annotation: %s", defaults.StorageSettingsAnnotation, err)
+		return map[string]appliedSetting{}
+	}
+	return settings
+}
+
+// SettingInputs returns the fingerprint of the inputs a storage setting is
+// applied from. Inputs are plain values, compared through their JSON
+// encoding.
+func SettingInputs(inputs ...interface{}) string {
+	data, err := json.Marshal(inputs)
+	if err != nil {
+		data = []byte(fmt.Sprintf("%#v", inputs))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// RecordSetting records on the image registry config that the storage
+// setting reported through the condition conditionType was applied from
+// inputs, and whether it failed to.
+func RecordSetting(cr *imageregistryv1.Config, conditionType string, inputs string, err error) {
+	settings := appliedSettings(cr)
+	setting := appliedSetting{Inputs: inputs}
+	if err != nil {
+		now := metaapi.Now()
+		setting.Failed = &now
+	}
+	settings[conditionType] = setting
+
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		klog.Errorf("unable to encode annotation %s: %s", defaults.StorageSettingsAnnotation, err)
+		return
+	}
+	if cr.Annotations == nil {
+		cr.Annotations = map[string]string{}
+	}
+	cr.Annotations[defaults.StorageSettingsAnnotation] = string(raw)
+}
+
+// SettingChanged tells whether the storage setting reported through the
+// condition conditionType is to be applied again: the inputs it is applied
+// from are not the ones it was last applied from, or it could not be
+// applied and SettingRetryInterval elapsed since. A setting never applied
+// is taken as applied from defaultInputs, so existing storage doesn't go
+// through CreateStorage on upgrade for settings nobody asked for.
+func SettingChanged(cr *imageregistryv1.Config, conditionType string, inputs, defaultInputs string) bool {
+	setting, ok := appliedSettings(cr)[conditionType]
+	if !ok {
+		return inputs != defaultInputs
+	}
+	if setting.Inputs != inputs {
+		return true
+	}
+	return setting.Failed != nil && time.Since(setting.Failed.Time) >= SettingRetryInterval
+}
+
+// SettingRetryAfter returns how long until the first storage setting that
+// could not be applied is due to be applied again. Settings overdue, whose
+// storage didn't go through CreateStorage since, are given another
+// SettingRetryInterval.
+func SettingRetryAfter(cr *imageregistryv1.Config) (time.Duration, bool) {
+	var after time.Duration
+	var found bool
+	for _, setting := range appliedSettings(cr) {
+		if setting.Failed == nil {
+			continue
+		}
+		d := SettingRetryInterval - time.Since(setting.Failed.Time)
+		if d <= 0 {
+			d = SettingRetryInterval
+		}
+		if !found || d < after {
+			after, found = d, true
+		}
+	}
+	return after, found
 }
 
 // GetInfrastructure gets information about the cloud platform that the cluster is
@@ -87,63 +247,24 @@ func GetValueFromSecret(sec *corev1.Secret, key string) (string, error) {
 	return "", fmt.Errorf("secret %q does not contain required key %q", fmt.Sprintf("%s/%s", sec.Namespace, sec.Name), key)
 }
 
-// GenerateStorageName generates a unique name for the storage
-// medium that the registry will use
-func GenerateStorageName(listers *regopclient.StorageListers, additionalInfo ...string) (string, error) {
-	// Get the infrastructure name
+// OwnedStorageNamePrefix returns the prefix shared by the names of the
+// storage mediums generated for the cluster.
+func OwnedStorageNamePrefix(listers *regopclient.StorageListers) (string, error) {
 	infra, err := GetInfrastructure(listers.Infrastructures)
 	if err != nil {
 		return "", err
 	}
-
-	// A slice to store the parts of our name
-	var parts []string
-
-	// Put the infrastructure name first
-	parts = append(parts, infra.Status.InfrastructureName)
-
-	// Image Registry Name second
-	parts = append(parts, defaults.ImageRegistryName)
-
-	// Additional information provided to the function third
-	for _, i := range additionalInfo {
-		if len(i) != 0 {
-			parts = append(parts, i)
-		}
-	}
-
-	// Join the slice together with dashes, removing any occurrence of
-	// multiple dashes in a row as some cloud providers consider this
-	// invalid.
-	name := multiDashes.ReplaceAllString(strings.Join(parts, "-"), "-")
-
-	// Check the length and pad or truncate as needed
-	switch {
-	case len(name) == 61:
-		// if the name is 61 chars, we don't have room for a dash before the padding
-		name = name + string(byte(97+rand.Intn(25)))
-	case len(name) < 62:
-		padding := 62 - len(name) - 1
-		bytes := make([]byte, padding)
-		for i := 0; i < padding; i++ {
-			bytes[i] = byte(97 + rand.Intn(25)) // a=97 and z=97+25
-		}
-		name = fmt.Sprintf("%s-%s", name, string(bytes))
-	case len(name) >= 62:
-		name = name[0:62]
-		if before, hasDash := strings.CutSuffix(name, "-"); hasDash {
-			name = before + string(byte(97+rand.Intn(25)))
-		}
+	if infra.Status.InfrastructureName == "" {
+		return "", fmt.Errorf("infrastructure name is not set")
 	}
-
-	return strings.ToLower(name), nil
+	return GenerateDeterministicStorageName(listers)
 }
 
 // GenerateDeterministicStorageName generates a deterministic, non-random name
-// for the storage medium. This is used as the first bucket name attempt,
+// for the storage medium. This is used by every object storage driver,
 // making bucket creation idempotent across controller retries. If this name
-// collides with a bucket owned by another AWS account, the caller should
-// return an error (do not fall back to random names).
+// collides with a bucket owned by another account or project, the caller
+// should return an error (do not fall back to random names).
 func GenerateDeterministicStorageName(listers *regopclient.StorageListers, additionalInfo ...string) (string, error) {
 	infra, err := GetInfrastructure(listers.Infrastructures)
 	if err != nil {
@@ -1,14 +1,18 @@
 package util
 
 import (
+	"encoding/json"
+	"errors"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 
 	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
@@ -140,103 +144,109 @@ func TestGenerateDeterministicStorageName(t *testing.T) {
 	}
 }
 
-func TestGenerateStorageName(t *testing.T) {
-	multiDash := regexp.MustCompile(`-{2,}`)
-	replaceMultiDash := regexp.MustCompile(`-{1,}`)
+func TestSettingChanged(t *testing.T) {
+	const conditionType = "StorageSettingApplied"
+	defaultInputs := SettingInputs("")
+	requested := SettingInputs("requested")
+
+	// failedAgo records the setting as applied from requested, failing d
+	// ago.
+	failedAgo := func(d time.Duration) func(*imageregistryv1.Config) {
+		return func(cr *imageregistryv1.Config) {
+			RecordSetting(cr, conditionType, requested, errors.New("access denied"))
+			settings := appliedSettings(cr)
+			setting := settings[conditionType]
+			setting.Failed = &metav1.Time{Time: setting.Failed.Add(-d)}
+			settings[conditionType] = setting
+			raw, err := json.Marshal(settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cr.Annotations[defaults.StorageSettingsAnnotation] = string(raw)
+		}
+	}
+
 	for _, tt := range []struct {
-		name           string
-		infraName      string
-		additionalInfo []string
+		name       string
+		record     func(*imageregistryv1.Config)
+		inputs     string
+		changed    bool
+		retryAfter bool
 	}{
 		{
-			name:           "nil additional info",
-			infraName:      "valid-infra-name",
-			additionalInfo: nil,
-		},
-		{
-			name:           "empty slice of additional info",
-			infraName:      "valid-infra-name",
-			additionalInfo: []string{},
+			name:    "never applied, nothing requested",
+			inputs:  defaultInputs,
+			changed: false,
 		},
 		{
-			name:           "slice of empty strings",
-			infraName:      "valid-infra-name",
-			additionalInfo: []string{"", ""},
+			name:    "never applied, requested",
+			inputs:  requested,
+			changed: true,
 		},
 		{
-			name:           "one additional",
-			infraName:      "valid-infra-name",
-			additionalInfo: []string{"test1"},
+			name: "applied",
+			record: func(cr *imageregistryv1.Config) {
+				RecordSetting(cr, conditionType, requested, nil)
+			},
+			inputs:  requested,
+			changed: false,
 		},
 		{
-			name:           "two additionals",
-			infraName:      "valid-infra-name",
-			additionalInfo: []string{"test1", "test2"},
+			name: "applied, then requested otherwise",
+			record: func(cr *imageregistryv1.Config) {
+				RecordSetting(cr, conditionType, requested, nil)
+			},
+			inputs:  defaultInputs,
+			changed: true,
 		},
 		{
-			name:           "really long additionals",
-			infraName:      "valid-infra-name",
-			additionalInfo: []string{"abcdefghijklmnopqrstuvwxyz", "abcdefghijklmnopqrstuvwxyz"},
+			name:       "failed recently",
+			record:     failedAgo(time.Minute),
+			inputs:     requested,
+			changed:    false,
+			retryAfter: true,
 		},
 		{
-			name:           "double dashes infra name",
-			infraName:      "invalid-infra--name",
-			additionalInfo: []string{"test1", "test2"},
+			name:       "failed recently, then requested otherwise",
+			record:     failedAgo(time.Minute),
+			inputs:     defaultInputs,
+			changed:    true,
+			retryAfter: true,
 		},
 		{
-			name:           "invalid infra name",
-			infraName:      "invalid-infra-name---",
-			additionalInfo: []string{"test1", "test2"},
-		},
-		{
-			name:           "upper case on infra name",
-			infraName:      "MY-INFRA",
-			additionalInfo: []string{"test1", "test2"},
-		},
-		{
-			name:           "govcloud region name",
-			infraName:      "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx",
-			additionalInfo: []string{"us-gov-west-1"},
+			name:       "failed a while ago",
+			record:     failedAgo(SettingRetryInterval),
+			inputs:     requested,
+			changed:    true,
+			retryAfter: true,
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
-			l := regopclient.StorageListers{Infrastructures: MockInfrastructureLister{
-				infraName: tt.infraName,
-			}}
-
-			n, err := GenerateStorageName(&l, tt.additionalInfo...)
-			if err != nil {
-				t.Errorf("%v", err)
+			cr := &imageregistryv1.Config{}
+			if tt.record != nil {
+				tt.record(cr)
 			}
 
-			rawPrefix := strings.ToLower(tt.infraName + "-" + defaults.ImageRegistryName)
-			wantedPrefix := replaceMultiDash.ReplaceAllString(rawPrefix, "-")
-			if len(wantedPrefix) > 62 {
-				wantedPrefix = wantedPrefix[0:62]
+			if changed := SettingChanged(cr, conditionType, tt.inputs, defaultInputs); changed != tt.changed {
+				t.Errorf("expected changed to be %t, got %t", tt.changed, changed)
 			}
 
-			// Name should have the wanted prefix
-			if !strings.HasPrefix(n, wantedPrefix) {
-				t.Errorf("name should have the prefix %s, but was %s instead", wantedPrefix, n)
+			after, ok := SettingRetryAfter(cr)
+			if ok != tt.retryAfter {
+				t.Fatalf("expected a retry to be pending to be %t, got %t", tt.retryAfter, ok)
 			}
-
-			// Name should be exactly 62 characters long
-			if len(n) != 62 {
-				t.Errorf("name should be exactly 62 characters long, but was %d instead: %s", len(n), n)
-			}
-
-			// Name should not have multiple dashes together
-			if multiDash.MatchString(n) {
-				t.Errorf("name should not include a double dash: %s", n)
-			}
-
-			if n != strings.ToLower(n) {
-				t.Errorf("name should not contain upper case: %s", n)
-			}
-
-			if strings.HasSuffix(n, "-") {
-				t.Errorf("name should not end in a dash: %s", n)
+			if ok && (after <= 0 || after > SettingRetryInterval) {
+				t.Errorf("expected a retry within %s, got %s", SettingRetryInterval, after)
 			}
 		})
 	}
 }
+
+func TestSettingInputs(t *testing.T) {
+	if SettingInputs("a", int64(1)) != SettingInputs("a", int64(1)) {
+		t.Errorf("expected the fingerprints of the same inputs to be the same")
+	}
+	if SettingInputs("a b") == SettingInputs("a", "b") {
+		t.Errorf("expected the fingerprints of different inputs to differ")
+	}
+}